@@ -0,0 +1,78 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Credit kinds, as named in the resource files of the dlb2 driver.
+var creditKinds = []string{"ldb", "dir"}
+
+// getCredits returns the number of load-balanced ("ldb") or directed ("dir")
+// credits of the DLB device, or 0 when the driver does not report them.
+func getCredits(sysfsDev, kind string) int {
+	data, err := os.ReadFile(filepath.Join(sysfsDev, "device", "total_resources", "num_"+kind+"_credits"))
+	if err != nil {
+		klog.V(4).Infof("no %s credits for %s: %v", kind, filepath.Base(sysfsDev), err)
+		return 0
+	}
+
+	credits, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		klog.Warningf("Invalid number of %s credits of %s: %v", kind, filepath.Base(sysfsDev), err)
+		return 0
+	}
+
+	return credits
+}
+
+// creditEnvName returns the name of the environment variable with the
+// credits of the DLB device, e.g. DLB0_LDB_CREDITS.
+func creditEnvName(device, kind string) string {
+	return strings.ToUpper(device + "_" + kind + "_credits")
+}
+
+// PostAllocate passes the credits of the allocated DLB devices to the
+// containers. For the VF devices, these are the credits assigned to the VF
+// through the vfN_resources of its PF, which the device enforces.
+func (dp *DevicePlugin) PostAllocate(response *pluginapi.AllocateResponse) error {
+	for _, cresp := range response.ContainerResponses {
+		for _, dev := range cresp.Devices {
+			device := filepath.Base(dev.HostPath)
+
+			for _, kind := range creditKinds {
+				credits := getCredits(filepath.Join(dp.sysfsDir, device), kind)
+				if credits == 0 {
+					continue
+				}
+
+				if cresp.Envs == nil {
+					cresp.Envs = map[string]string{}
+				}
+
+				cresp.Envs[creditEnvName(device, kind)] = strconv.Itoa(credits)
+			}
+		}
+	}
+
+	return nil
+}
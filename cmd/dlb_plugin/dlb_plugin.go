@@ -43,12 +43,26 @@ type DevicePlugin struct {
 
 	dlbDeviceFilePathReg string
 	sysfsDir             string
+	// Fatal errors of the devices when the plugin started or the device
+	// was reset, and the health of the devices found by the previous scan.
+	fatalErrors map[string]uint64
+	health      map[string]string
+	// Reset backoff of the unhealthy devices.
+	resets map[string]resetBackoff
+
+	autoReset bool
 }
 
-func NewDevicePlugin(dlbDeviceFilePathReg string, sysfsDir string) *DevicePlugin {
+// NewDevicePlugin returns new instance of the DLB plugin. With autoReset, the
+// plugin resets the devices it finds unhealthy.
+func NewDevicePlugin(dlbDeviceFilePathReg string, sysfsDir string, autoReset bool) *DevicePlugin {
 	return &DevicePlugin{
 		dlbDeviceFilePathReg: dlbDeviceFilePathReg,
 		sysfsDir:             sysfsDir,
+		autoReset:            autoReset,
+		fatalErrors:          map[string]uint64{},
+		health:               map[string]string{},
+		resets:               map[string]resetBackoff{},
 		scanTicker:           time.NewTicker(scanPeriod),
 		scanDone:             make(chan bool, 1), // buffered as we may send to it before Scan starts receiving from it
 	}
@@ -83,23 +97,25 @@ func (dp *DevicePlugin) scan() dpapi.DeviceTree {
 	devTree := dpapi.NewDeviceTree()
 
 	for _, file := range files {
+		sysfsDev := filepath.Join(dp.sysfsDir, filepath.Base(file))
+		sriovNumVFs := pluginutils.GetSriovNumVFs(sysfsDev)
+
+		// The PF devices with VFs enabled are not advertised.
+		if sriovNumVFs != "0" && sriovNumVFs != "-1" {
+			continue
+		}
+
 		devs := []pluginapi.DeviceSpec{{
 			HostPath:      file,
 			ContainerPath: file,
 			Permissions:   "rw",
 		}}
-		deviceInfo := dpapi.NewDeviceInfo(pluginapi.Healthy, devs, nil, nil, nil, nil)
+		deviceInfo := dpapi.NewDeviceInfo(dp.getHealth(filepath.Base(file)), devs, nil, nil, nil, nil)
 
-		sysfsDev := filepath.Join(dp.sysfsDir, filepath.Base(file))
-		sriovNumVFs := pluginutils.GetSriovNumVFs(sysfsDev)
-
-		switch sriovNumVFs {
-		case "0":
+		if sriovNumVFs == "0" {
 			devTree.AddDevice(deviceTypePF, file, deviceInfo)
-		case "-1":
+		} else {
 			devTree.AddDevice(deviceTypeVF, file, deviceInfo)
-		default:
-			continue
 		}
 	}
 
@@ -107,10 +123,11 @@ func (dp *DevicePlugin) scan() dpapi.DeviceTree {
 }
 
 func main() {
+	autoReset := flag.Bool("auto-reset", false, "reset the devices on fatal errors and hangs")
 	flag.Parse()
 	klog.V(1).Infof("DLB device plugin started")
 
-	plugin := NewDevicePlugin(dlbDeviceFilePathRE, sysfsDir)
+	plugin := NewDevicePlugin(dlbDeviceFilePathRE, sysfsDir, *autoReset)
 	manager := dpapi.NewManager(namespace, plugin)
 	manager.Run()
 }
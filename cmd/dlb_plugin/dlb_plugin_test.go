@@ -16,12 +16,15 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 
 	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
 	"github.com/pkg/errors"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
 func init() {
@@ -65,7 +68,7 @@ func createTestFiles(devfs string, devfsdirs []string, sysfs string, pfDevs []st
 }
 
 func TestNewDevicePlugin(t *testing.T) {
-	if NewDevicePlugin("", "") == nil {
+	if NewDevicePlugin("", "", false) == nil {
 		t.Error("Failed to create plugin")
 	}
 }
@@ -129,7 +132,7 @@ func TestScan(t *testing.T) {
 			}
 
 			devfs = path.Join(devfs, "dlb*")
-			plugin := NewDevicePlugin(devfs, sysfs)
+			plugin := NewDevicePlugin(devfs, sysfs, false)
 
 			notifier := &mockNotifier{
 				scanDone: plugin.scanDone,
@@ -147,3 +150,133 @@ func TestScan(t *testing.T) {
 		})
 	}
 }
+
+func TestCredits(t *testing.T) {
+	root := t.TempDir()
+	devfs := path.Join(root, "dev")
+	sysfs := path.Join(root, sysfsDir)
+
+	if err := createTestFiles(devfs, []string{"dlb0", "dlb1"}, sysfs, []string{"dlb0"}, []string{"0"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	resources := path.Join(sysfs, "dlb0", "device", "total_resources")
+	if err := os.MkdirAll(resources, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, credits := range map[string]string{"num_ldb_credits": "8192\n", "num_dir_credits": "2048\n"} {
+		if err := os.WriteFile(path.Join(resources, file), []byte(credits), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin := NewDevicePlugin(path.Join(devfs, "dlb*"), sysfs, false)
+
+	// dlb1 does not report its credits.
+	response := &pluginapi.AllocateResponse{
+		ContainerResponses: []*pluginapi.ContainerAllocateResponse{
+			{Devices: []*pluginapi.DeviceSpec{{HostPath: path.Join(devfs, "dlb0")}, {HostPath: path.Join(devfs, "dlb1")}}},
+			{Devices: []*pluginapi.DeviceSpec{{HostPath: path.Join(devfs, "dlb1")}}},
+		},
+	}
+
+	if err := plugin.PostAllocate(response); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if expected := map[string]string{"DLB0_LDB_CREDITS": "8192", "DLB0_DIR_CREDITS": "2048"}; !reflect.DeepEqual(response.ContainerResponses[0].Envs, expected) {
+		t.Errorf("expected %v, got %v", expected, response.ContainerResponses[0].Envs)
+	}
+
+	if envs := response.ContainerResponses[1].Envs; envs != nil {
+		t.Errorf("expected no credits, got %v", envs)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	root := t.TempDir()
+	devfs := path.Join(root, "dev")
+	sysfs := path.Join(root, sysfsDir)
+	pciDev := path.Join(sysfs, "dlb0", "device")
+
+	if err := createTestFiles(devfs, []string{"dlb0"}, sysfs, []string{"dlb0"}, []string{"0"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(path.Join(pciDev, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aerFatal := "Undefined 0\nDLP 0\nTOTAL_ERR_FATAL %d\n"
+
+	plugin := NewDevicePlugin(path.Join(devfs, "dlb*"), sysfs, true)
+	devID := path.Join(devfs, "dlb0")
+
+	for _, step := range []struct {
+		name     string
+		config   string
+		fatal    int
+		expected string
+		reset    bool
+	}{
+		{name: "errors before the plugin started", config: "\x86\x80\x10\x27", fatal: 1, expected: pluginapi.Healthy},
+		{name: "fatal error", config: "\x86\x80\x10\x27", fatal: 2, expected: pluginapi.Unhealthy, reset: true},
+		{name: "recovered after reset", config: "\x86\x80\x10\x27", fatal: 2, expected: pluginapi.Healthy},
+		{name: "hung", config: "\xff\xff\xff\xff", fatal: 2, expected: pluginapi.Unhealthy, reset: true},
+	} {
+		writeFile("config", step.config)
+		writeFile("aer_dev_fatal", fmt.Sprintf(aerFatal, step.fatal))
+
+		if err := os.RemoveAll(path.Join(pciDev, "reset")); err != nil {
+			t.Fatal(err)
+		}
+
+		devTree := plugin.scan()
+
+		if state := reflect.ValueOf(devTree[deviceTypePF][devID]).FieldByName("state").String(); state != step.expected {
+			t.Errorf("%s: expected %s, got %s", step.name, step.expected, state)
+		}
+
+		if _, err := os.Stat(path.Join(pciDev, "reset")); (err == nil) != step.reset {
+			t.Errorf("%s: expected reset %t, got %t", step.name, step.reset, err == nil)
+		}
+	}
+}
+
+func TestResetBackoff(t *testing.T) {
+	root := t.TempDir()
+	devfs := path.Join(root, "dev")
+	sysfs := path.Join(root, sysfsDir)
+	pciDev := path.Join(sysfs, "dlb0", "device")
+
+	if err := createTestFiles(devfs, []string{"dlb0"}, sysfs, []string{"dlb0"}, []string{"0"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	// The device hangs for good.
+	if err := os.WriteFile(path.Join(pciDev, "config"), []byte("\xff\xff\xff\xff"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := NewDevicePlugin(path.Join(devfs, "dlb*"), sysfs, true)
+	resets := []int{}
+
+	for scan := 0; scan < 40; scan++ {
+		if err := os.RemoveAll(path.Join(pciDev, "reset")); err != nil {
+			t.Fatal(err)
+		}
+
+		plugin.scan()
+
+		if _, err := os.Stat(path.Join(pciDev, "reset")); err == nil {
+			resets = append(resets, scan)
+		}
+	}
+
+	if expected := []int{0, 2, 6, 14, 30}; !reflect.DeepEqual(resets, expected) {
+		t.Errorf("expected resets on scans %v, got %v", expected, resets)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Maximum number of consecutive resets of an unhealthy device. The plugin
+// waits for 1, 3, 7, 15 and 31 scans after the successive resets for the
+// device to recover, and gives up after the last one.
+const maxResets = 5
+
+// resetBackoff is the reset state of an unhealthy device.
+type resetBackoff struct {
+	// Number of resets since the device was healthy.
+	resets int
+	// Number of scans to wait before the next reset.
+	wait int
+}
+
+// isResponding tells whether the PCI device responds to the configuration
+// space reads. Hung devices, and devices fallen off the bus, return all ones.
+func isResponding(pciDev string) bool {
+	f, err := os.Open(filepath.Join(pciDev, "config"))
+	if err != nil {
+		klog.V(4).Infof("can't read configuration space of %s: %q", filepath.Base(pciDev), err)
+		return true
+	}
+	defer f.Close()
+
+	vendorID := make([]byte, 2)
+	if _, err = f.Read(vendorID); err != nil {
+		return false
+	}
+
+	return !bytes.Equal(vendorID, []byte{0xff, 0xff})
+}
+
+// getFatalErrors returns the number of the fatal AER errors of the PCI
+// device, or 0 when AER is not supported.
+func getFatalErrors(pciDev string) uint64 {
+	f, err := os.Open(filepath.Join(pciDev, "aer_dev_fatal"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "TOTAL_ERR_FATAL" {
+			count, _ := strconv.ParseUint(fields[1], 10, 64)
+			return count
+		}
+	}
+
+	return 0
+}
+
+// resetDevice resets the PCI device, i.e. the PF device with its VFs or the
+// VF device.
+func resetDevice(pciDev string) bool {
+	if err := os.WriteFile(filepath.Join(pciDev, "reset"), []byte("1"), 0600); err != nil {
+		klog.Warningf("failed to reset %s: %q", filepath.Base(pciDev), err)
+		return false
+	}
+
+	return true
+}
+
+// getHealth returns the health of the DLB device. The device is unhealthy
+// when it does not respond, or when it has had fatal errors since the plugin
+// started or the device was reset. With autoReset, the unhealthy devices are
+// reset, so that they are advertised again after they have recovered.
+func (dp *DevicePlugin) getHealth(device string) string {
+	pciDev := filepath.Join(dp.sysfsDir, device, "device")
+	fatalErrors := getFatalErrors(pciDev)
+
+	health := pluginapi.Healthy
+
+	if baseline, found := dp.fatalErrors[device]; !found {
+		dp.fatalErrors[device] = fatalErrors
+	} else if fatalErrors > baseline {
+		health = pluginapi.Unhealthy
+	}
+
+	if !isResponding(pciDev) {
+		health = pluginapi.Unhealthy
+	}
+
+	if previous, found := dp.health[device]; !found || previous != health {
+		if health == pluginapi.Unhealthy {
+			klog.Warningf("%s has failed, it is unhealthy", device)
+		} else if found {
+			klog.Infof("%s has recovered, it is healthy", device)
+		}
+	}
+
+	dp.health[device] = health
+
+	if health == pluginapi.Healthy {
+		delete(dp.resets, device)
+	} else if dp.autoReset && dp.shouldReset(device) && resetDevice(pciDev) {
+		klog.Infof("Reset %s", device)
+
+		// Errors before the reset do not count, whether the device
+		// recovered is checked on the next scan.
+		dp.fatalErrors[device] = fatalErrors
+	}
+
+	return health
+}
+
+// shouldReset tells whether to reset the unhealthy device on this scan. The
+// resets back off exponentially, and stop after maxResets, as each reset
+// also disrupts the containers still using the device.
+func (dp *DevicePlugin) shouldReset(device string) bool {
+	backoff := dp.resets[device]
+	reset := false
+
+	switch {
+	case backoff.wait > 0:
+		backoff.wait--
+	case backoff.resets < maxResets:
+		backoff.resets++
+		backoff.wait = 1<<backoff.resets - 1
+		reset = true
+	case backoff.resets == maxResets:
+		klog.Warningf("%s has not recovered after %d resets, giving up", device, maxResets)
+
+		backoff.resets++
+	}
+
+	dp.resets[device] = backoff
+
+	return reset
+}
@@ -0,0 +1,230 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fakedri generates, validates and removes fake device sysfs, debugfs and
+// devfs content (see pkg/fakedri), and snapshots real GPU nodes to specs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fakedri"
+
+	"k8s.io/klog/v2"
+)
+
+const usage = `Usage: %s [-v N] <command> [flags]
+
+Commands:
+  generate   generate fake device files from -spec file and/or spec flags
+  validate   validate -spec file and/or spec flags, and print the resulting YAML spec
+  verify     verify that GPU plugin discovers fake devices as specified, and that fake device
+             files still match the -manifest written on generation, if one is given
+  cleanup    remove previously generated fake device files (and -spec file Tmpfs mounts)
+  snapshot   print YAML spec reproducing GPUs of the real node
+
+Run '%s <command> -h' for the command flags.
+`
+
+// addSpecFlags adds flags for the scalar spec fields to given flag set,
+// bound to the fields of given options.
+func addSpecFlags(fset *flag.FlagSet, opts *fakedri.GenOptions) {
+	fset.StringVar(&opts.Info, "info", opts.Info, "spec Info: description of the fake node")
+	fset.StringVar(&opts.Mode, "mode", opts.Mode, "spec Mode: gpu, qat, sgx, dsa, iaa, dlb or npu")
+	fset.StringVar(&opts.Driver, "driver", opts.Driver, "spec Driver: kernel driver name")
+	fset.StringVar(&opts.DeviceID, "device-id", opts.DeviceID, "spec DeviceID: PCI device ID")
+	fset.StringVar(&opts.Revision, "revision", opts.Revision, "spec Revision: PCI revision")
+	fset.StringVar(&opts.VfDeviceID, "vf-device-id", opts.VfDeviceID, "spec VfDeviceID: PCI device ID of the SR-IOV VFs")
+	fset.StringVar(&opts.PciAddress, "pci-address", opts.PciAddress, "spec PciAddress: PCI address of the first device")
+	fset.StringVar(&opts.Manifest, "manifest", opts.Manifest, "spec Manifest: file for the manifest of the generated files")
+	fset.StringVar(&opts.NfdFeatureDir, "nfd-feature-dir", opts.NfdFeatureDir, "spec NfdFeatureDir: NFD feature file dir")
+	fset.IntVar(&opts.DevCount, "devices", opts.DevCount, "spec DevCount: number of devices")
+	fset.IntVar(&opts.CardBase, "card-base", opts.CardBase, "spec CardBase: index of the first DRM card")
+	fset.IntVar(&opts.RenderBase, "render-base", opts.RenderBase, "spec RenderBase: index of the first DRM render node")
+	fset.IntVar(&opts.TilesPerDev, "tiles", opts.TilesPerDev, "spec TilesPerDev: GPU tiles per device")
+	fset.IntVar(&opts.DevMemSize, "mem", opts.DevMemSize, "spec DevMemSize: device local memory size in bytes")
+	fset.IntVar(&opts.DevsPerNode, "devs-per-node", opts.DevsPerNode, "spec DevsPerNode: devices per NUMA node")
+	fset.IntVar(&opts.VfsPerPf, "vfs", opts.VfsPerPf, "spec VfsPerPf: SR-IOV VFs following each PF")
+	fset.IntVar(&opts.TotalVfs, "total-vfs", opts.TotalVfs, "spec TotalVfs: max SR-IOV VFs of a PF")
+	fset.IntVar(&opts.Workers, "workers", opts.Workers, "spec Workers: device generation workers (0 = CPU count)")
+	fset.BoolVar(&opts.RequireCharDevices, "require-char-devices", opts.RequireCharDevices,
+		"spec RequireCharDevices: fail instead of using placeholders when creating device nodes is not permitted")
+	fset.BoolVar(&opts.Quiet, "quiet", opts.Quiet, "spec Quiet: discard all informational and warning messages")
+	fset.BoolVar(&opts.Append, "append", opts.Append, "spec Append: add only devices missing from already generated fake files")
+}
+
+// specOptions returns the options read from the given (YAML or JSON) spec
+// file, overridden by the spec flags set in given flag set. Defaults are
+// applied to the result, and it is validated.
+func specOptions(fset *flag.FlagSet, name string) (fakedri.GenOptions, error) {
+	var opts fakedri.GenOptions
+
+	if name != "" {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return opts, errors.Wrapf(err, "reading spec file '%s' failed", name)
+		}
+
+		if opts, err = fakedri.UnmarshalSpec(data); err != nil {
+			return opts, errors.Wrapf(err, "invalid spec file '%s'", name)
+		}
+	}
+
+	// Flags re-bound to the spec file options, to override only the given ones.
+	overrides := flag.NewFlagSet("overrides", flag.ContinueOnError)
+	addSpecFlags(overrides, &opts)
+
+	var err error
+
+	fset.Visit(func(f *flag.Flag) {
+		if bound := overrides.Lookup(f.Name); bound != nil && err == nil {
+			err = bound.Value.Set(f.Value.String())
+		}
+	})
+
+	if err != nil {
+		return opts, err
+	}
+
+	return fakedri.MakeOptionsE(opts)
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) < 1 {
+		return errors.New("no command given")
+	}
+
+	cmd := args[0]
+	fset := flag.NewFlagSet(cmd, flag.ContinueOnError)
+
+	var (
+		spec, sysfsRoot, devfsRoot string
+		scratch                    fakedri.GenOptions
+	)
+
+	switch cmd {
+	case "generate", "validate", "verify":
+		fset.StringVar(&spec, "spec", "", "YAML or JSON spec file, overridden by the spec flags")
+		addSpecFlags(fset, &scratch)
+	case "snapshot":
+		fset.StringVar(&sysfsRoot, "sysfs", "/sys", "sysfs root of the real node")
+		fset.StringVar(&devfsRoot, "devfs", "/dev", "devfs root of the real node")
+	case "cleanup":
+		fset.StringVar(&spec, "spec", "", "YAML or JSON spec file, whose Tmpfs mounts are removed too")
+	default:
+		return errors.Errorf("unknown command '%s'", cmd)
+	}
+
+	if err := fset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if fset.NArg() > 0 {
+		return errors.Errorf("unexpected '%s' command arguments: %v", cmd, fset.Args())
+	}
+
+	switch cmd {
+	case "generate":
+		opts, err := specOptions(fset, spec)
+		if err != nil {
+			return err
+		}
+
+		return fakedri.GenerateDriFilesE(opts)
+	case "verify":
+		opts, err := specOptions(fset, spec)
+		if err != nil {
+			return err
+		}
+
+		if opts.Manifest != "" {
+			if err = fakedri.VerifyManifest(opts); err != nil {
+				return err
+			}
+
+			// GPU plugin discovery is verified only in GPU mode.
+			if opts.Mode != "" && opts.Mode != "gpu" {
+				return nil
+			}
+		}
+
+		return fakedri.Verify(opts)
+	case "validate":
+		opts, err := specOptions(fset, spec)
+		if err != nil {
+			return err
+		}
+
+		return printSpec(stdout, opts)
+	case "snapshot":
+		opts, err := fakedri.Snapshot(sysfsRoot, devfsRoot)
+		if err != nil {
+			return err
+		}
+
+		return printSpec(stdout, opts)
+	}
+
+	if spec == "" {
+		return fakedri.RemoveDriFiles(fakedri.GenOptions{})
+	}
+
+	opts, err := specOptions(fset, spec)
+	if err != nil {
+		return err
+	}
+
+	return fakedri.RemoveDriFiles(opts)
+}
+
+func printSpec(stdout io.Writer, opts fakedri.GenOptions) error {
+	data, err := fakedri.MarshalSpec(opts)
+	if err != nil {
+		return errors.Wrap(err, "spec marshaling failed")
+	}
+
+	_, err = stdout.Write(data)
+
+	return err
+}
+
+func main() {
+	klog.InitFlags(nil)
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), usage, os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if err := run(flag.Args(), os.Stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+
+		klog.Errorf("%v", err)
+
+		if flag.NArg() == 0 {
+			flag.Usage()
+		}
+
+		os.Exit(1)
+	}
+}
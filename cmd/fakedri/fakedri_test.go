@@ -0,0 +1,89 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "spec.yaml")
+	if err := os.WriteFile(spec, []byte("DevCount: 4\nTilesPerDev: 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tcases := []struct {
+		name     string
+		args     []string
+		expected []string
+		fail     bool
+	}{
+		{
+			name:     "spec flags only",
+			args:     []string{"validate", "-mode", "qat", "-devices", "2", "-vfs", "1"},
+			expected: []string{"Mode: qat\n", "DevCount: 2\n", "VfsPerPf: 1\n"},
+		},
+		{
+			name:     "spec file overridden by flags",
+			args:     []string{"validate", "-spec", spec, "-devices", "2"},
+			expected: []string{"DevCount: 2\n", "TilesPerDev: 2\n"},
+		},
+		{
+			name: "invalid spec flags",
+			args: []string{"validate", "-devices", "2", "-vfs", "-1"},
+			fail: true,
+		},
+		{
+			name: "missing spec file",
+			args: []string{"generate", "-spec", spec + ".missing"},
+			fail: true,
+		},
+		{
+			name: "verify without generated files",
+			args: []string{"verify", "-spec", spec},
+			fail: true,
+		},
+		{
+			name: "unknown command",
+			args: []string{"foo"},
+			fail: true,
+		},
+		{
+			name: "no command",
+			fail: true,
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+
+			err := run(tc.args, &stdout)
+			if tc.fail != (err != nil) {
+				t.Fatalf("expected failure: %v, got error: %v", tc.fail, err)
+			}
+
+			for _, expected := range tc.expected {
+				if !strings.Contains(stdout.String(), expected) {
+					t.Errorf("'%s' missing from output:\n%s", expected, stdout.String())
+				}
+			}
+		})
+	}
+}
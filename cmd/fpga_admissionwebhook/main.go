@@ -18,6 +18,7 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/klog/v2/textlogger"
@@ -42,6 +43,9 @@ func init() {
 
 func main() {
 	var (
+		catalogURL           string
+		sharedNamespace      string
+		catalogRefresh       time.Duration
 		enableLeaderElection bool
 	)
 
@@ -50,6 +54,11 @@ func main() {
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&catalogURL, "catalog-url", "",
+		"URL of a bitstream catalog for resolving the accelerator functions without AcceleratorFunction CRs.")
+	flag.StringVar(&sharedNamespace, "shared-namespace", "",
+		"Namespace of the AcceleratorFunction and FpgaRegion CRs mapping the resources in all namespaces.")
+	flag.DurationVar(&catalogRefresh, "catalog-refresh", 5*time.Minute, "Period of refreshing the bitstream catalog.")
 	flag.Parse()
 
 	ctrl.SetLogger(textlogger.NewLogger(tlConf))
@@ -85,6 +94,12 @@ func main() {
 
 	pm := patcher.NewPatcherManager(ctrl.Log.WithName("webhooks").WithName("Fpga"))
 
+	pm.SetSharedNamespace(sharedNamespace)
+
+	if catalogURL != "" {
+		pm.AddMappingSource(patcher.NewHTTPCatalog(catalogURL, catalogRefresh))
+	}
+
 	mgr.GetWebhookServer().Register("/pods", &webhook.Admission{
 		Handler: admission.HandlerFunc(pm.GetPodMutator()),
 	})
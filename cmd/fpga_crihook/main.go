@@ -20,10 +20,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpga"
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpga/bitstream"
 	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 	"k8s.io/klog/v2"
 )
 
@@ -32,6 +34,13 @@ const (
 	configJSON             = "config.json"
 	fpgaRegionEnvPrefix    = "FPGA_REGION_"
 	fpgaAfuEnvPrefix       = "FPGA_AFU_"
+
+	// Directory of the lock files serializing the programming of the ports.
+	portLockDirectory = "/var/run/intel-fpga/locks"
+	// Time to wait for the programming of a port by other containers.
+	portLockTimeout = 2 * time.Minute
+	// Period of retrying the port lock.
+	portLockRetryPeriod = 100 * time.Millisecond
 )
 
 // Stdin defines structure for standard JSONed input of the OCI platform hook.
@@ -91,6 +100,11 @@ type hookEnv struct {
 	newPort      newPortFun
 	bitstreamDir string
 	config       string
+	// Directory of the PR events for the FPGA plugin, no events when empty.
+	eventDir string
+	// Directory of the port lock files, no locking when empty.
+	lockDir     string
+	lockTimeout time.Duration
 }
 
 type fpgaParams struct {
@@ -209,6 +223,79 @@ func (he *hookEnv) getFPGAParams(config *Config) ([]fpgaParams, error) {
 	return params, nil
 }
 
+// recordEvent records the PR event with the result of the programming for the
+// FPGA plugin to report. Failing to record the event does not fail the hook.
+func (he *hookEnv) recordEvent(event fpga.PREvent, prErr error) {
+	if he.eventDir == "" {
+		return
+	}
+
+	if prErr != nil {
+		event.Error = prErr.Error()
+	}
+
+	if err := fpga.WritePREvent(he.eventDir, event); err != nil {
+		klog.Warningf("unable to record PR event: %+v", err)
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+
+	return err == nil && info.IsDir()
+}
+
+// lockPort takes an exclusive lock of the port for programming it. It waits
+// for the other containers programming the port until lockTimeout, and gives
+// up when the container bundle is removed, e.g. when its pod is deleted while
+// waiting. Returns the function releasing the lock.
+func (he *hookEnv) lockPort(portDevice, bundle string) (func(), error) {
+	if he.lockDir == "" {
+		return func() {}, nil
+	}
+
+	if err := os.MkdirAll(he.lockDir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create port lock directory")
+	}
+
+	lockFile, err := os.OpenFile(filepath.Join(he.lockDir, portDevice+".lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open lock file of %s", portDevice)
+	}
+
+	deadline := time.Now().Add(he.lockTimeout)
+
+	for {
+		err = unix.Flock(int(lockFile.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		switch {
+		case !errors.Is(err, unix.EWOULDBLOCK):
+			err = errors.Wrapf(err, "failed to lock %s", portDevice)
+		case !isDir(bundle):
+			err = errors.Errorf("container bundle %s removed while waiting for %s", bundle, portDevice)
+		case time.Now().After(deadline):
+			err = errors.Errorf("timed out waiting for programming of %s by other containers", portDevice)
+		default:
+			klog.V(4).Infof("%s is being programmed by another container, waiting", portDevice)
+			time.Sleep(portLockRetryPeriod)
+
+			continue
+		}
+
+		lockFile.Close()
+
+		return nil, err
+	}
+
+	return func() {
+		// Closing the file releases the lock.
+		lockFile.Close()
+	}, nil
+}
+
 func getStdin(reader io.Reader) (*Stdin, error) {
 	var stdinJ Stdin
 
@@ -245,36 +332,62 @@ func (he *hookEnv) process(reader io.Reader) error {
 	}
 
 	for _, params := range paramslist {
-		port, err := he.newPort(params.portDevice)
-		if err != nil {
+		if err := he.programPort(params, stdin.Bundle); err != nil {
 			return err
 		}
+	}
 
-		programmedAfu := port.GetAcceleratorTypeUUID()
-		if programmedAfu == params.afu {
-			// Afu is already programmed
-			return nil
-		}
+	return nil
+}
 
-		bstream, err := bitstream.GetFPGABitstream(he.bitstreamDir, params.region, params.afu)
-		if err != nil {
-			return err
-		}
-		defer bstream.Close()
+// programPort programs the AFU to the PR region of the port, unless it is
+// already programmed there. The programming of the port is serialized with
+// the hooks of the other containers requesting the same port.
+func (he *hookEnv) programPort(params fpgaParams, bundle string) error {
+	port, err := he.newPort(params.portDevice)
+	if err != nil {
+		return err
+	}
 
-		err = port.PR(bstream, false)
-		if err != nil {
-			return err
-		}
+	unlock, err := he.lockPort(params.portDevice, bundle)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Checked with the lock held, as another container may have programmed
+	// the AFU while waiting for the lock.
+	programmedAfu := port.GetAcceleratorTypeUUID()
+	if programmedAfu == params.afu {
+		// Afu is already programmed
+		return nil
+	}
 
-		programmedAfu = port.GetAcceleratorTypeUUID()
+	bstream, err := bitstream.GetFPGABitstream(he.bitstreamDir, params.region, params.afu)
+	if err != nil {
+		return err
+	}
+	defer bstream.Close()
 
-		if programmedAfu != bstream.AcceleratorTypeUUID() {
-			return errors.Errorf("programmed function %s instead of %s", programmedAfu, bstream.AcceleratorTypeUUID())
+	start := time.Now()
+
+	err = port.PR(bstream, false)
+	if err == nil {
+		if programmedAfu = port.GetAcceleratorTypeUUID(); programmedAfu != bstream.AcceleratorTypeUUID() {
+			err = errors.Errorf("programmed function %s instead of %s", programmedAfu, bstream.AcceleratorTypeUUID())
 		}
 	}
 
-	return nil
+	he.recordEvent(fpga.PREvent{
+		Start:       start,
+		Duration:    time.Since(start),
+		Port:        params.portDevice,
+		InterfaceID: params.region,
+		AfuID:       params.afu,
+		BitstreamID: bstream.UniqueUUID(),
+	}, err)
+
+	return err
 }
 
 func init() {
@@ -287,6 +400,9 @@ func main() {
 	}
 
 	he := newHookEnv(fpgaBitStreamDirectory, configJSON, fpga.NewPort)
+	he.eventDir = fpga.PREventDirectory
+	he.lockDir = portLockDirectory
+	he.lockTimeout = portLockTimeout
 
 	if err := he.process(os.Stdin); err != nil {
 		klog.Errorf("%+v", err)
@@ -19,6 +19,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpga"
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpga/bitstream"
@@ -336,19 +337,21 @@ func TestProcess(t *testing.T) {
 
 	sysfs := path.Join(tmpdir, "sys", "class", "fpga")
 	tcases := []struct {
-		name        string
-		stdinJSON   string
-		configJSON  string
-		newPort     newPortFun
-		sysfsfiles  map[string][]byte
-		sysfsdirs   []string
-		expectedErr bool
+		name           string
+		stdinJSON      string
+		configJSON     string
+		newPort        newPortFun
+		sysfsfiles     map[string][]byte
+		sysfsdirs      []string
+		expectedEvents int
+		expectedErr    bool
 	}{
 		{
-			name:       "Reprogramming",
-			stdinJSON:  "stdin-correct.json",
-			configJSON: "config-correct.json",
-			sysfsdirs:  []string{"intel-fpga-dev.0/intel-fpga-fme.0/pr"},
+			name:           "Reprogramming",
+			expectedEvents: 1,
+			stdinJSON:      "stdin-correct.json",
+			configJSON:     "config-correct.json",
+			sysfsdirs:      []string{"intel-fpga-dev.0/intel-fpga-fme.0/pr"},
 			sysfsfiles: map[string][]byte{
 				"intel-fpga-dev.0/intel-fpga-fme.0/pr/interface_id": []byte("ce48969398f05f33946d560708be108a"),
 			},
@@ -420,7 +423,8 @@ func TestProcess(t *testing.T) {
 					failProgramming: true,
 				}, nil
 			},
-			expectedErr: true,
+			expectedEvents: 1,
+			expectedErr:    true,
 		},
 		{
 			name:       "Device is not reprogrammed",
@@ -434,7 +438,8 @@ func TestProcess(t *testing.T) {
 						"d8424dc4a4a3c413f89e433683f9040b"},
 				}, nil
 			},
-			expectedErr: true,
+			expectedEvents: 1,
+			expectedErr:    true,
 		},
 	}
 
@@ -451,6 +456,7 @@ func TestProcess(t *testing.T) {
 			}
 
 			he := newHookEnv("testdata/intel.com/fpga", tc.configJSON, tc.newPort)
+			he.eventDir = path.Join(tmpdir, "pr-events")
 
 			err = he.process(stdin)
 
@@ -458,6 +464,21 @@ func TestProcess(t *testing.T) {
 				t.Errorf("[%s]: unexpected error: %+v", tc.name, err)
 			}
 
+			events, err := fpga.ReadPREvents(he.eventDir)
+			if err != nil {
+				t.Fatalf("can't read PR events: %+v", err)
+			}
+
+			if len(events) != tc.expectedEvents {
+				t.Errorf("[%s]: expected %d PR events, got %d", tc.name, tc.expectedEvents, len(events))
+			}
+
+			for _, event := range events {
+				if (event.Error != "") != tc.expectedErr {
+					t.Errorf("[%s]: unexpected PR event error %q", tc.name, event.Error)
+				}
+			}
+
 			err = os.RemoveAll(tmpdir)
 			if err != nil {
 				t.Fatal(err)
@@ -465,3 +486,51 @@ func TestProcess(t *testing.T) {
 		})
 	}
 }
+
+func TestLockPort(t *testing.T) {
+	tmpdir := t.TempDir()
+	bundle := path.Join(tmpdir, "bundle")
+
+	if err := os.Mkdir(bundle, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	he := newHookEnv("", "", newTestPort)
+	he.lockDir = path.Join(tmpdir, "locks")
+	he.lockTimeout = 3 * portLockRetryPeriod
+
+	unlock, err := he.lockPort("intel-fpga-port.0", bundle)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if _, err = he.lockPort("intel-fpga-port.0", bundle); err == nil {
+		t.Error("expected timeout when the port is locked")
+	}
+
+	other, err := he.lockPort("intel-fpga-port.1", bundle)
+	if err != nil {
+		t.Errorf("unexpected error locking another port: %+v", err)
+	} else {
+		other()
+	}
+
+	he.lockTimeout = time.Minute
+
+	if err = os.Remove(bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = he.lockPort("intel-fpga-port.0", bundle); err == nil {
+		t.Error("expected error when the bundle is removed")
+	}
+
+	unlock()
+
+	unlock, err = he.lockPort("intel-fpga-port.0", bundle)
+	if err != nil {
+		t.Errorf("unexpected error after unlocking: %+v", err)
+	} else {
+		unlock()
+	}
+}
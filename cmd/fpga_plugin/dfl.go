@@ -21,6 +21,7 @@ import (
 const (
 	dflDeviceRE = `^region[0-9]+$`
 	dflPortRE   = `^dfl-port\.[0-9]+$`
+	dflFmeRE    = `^dfl-fme\.[0-9]+$`
 )
 
 // newDevicePluginDFL returns new instance of devicePlugin.
@@ -33,14 +34,18 @@ func newDevicePluginDFL(sysfsDir string, devfsDir string, mode string) (*deviceP
 	return &devicePlugin{
 		name: "DFL",
 
-		sysfsDir: sysfsDir,
-		devfsDir: devfsDir,
+		sysfsDir:  sysfsDir,
+		devfsDir:  devfsDir,
+		pciBusDir: pciBusDirectory,
 
 		deviceReg: regexp.MustCompile(dflDeviceRE),
 		portReg:   regexp.MustCompile(dflPortRE),
+		fmeReg:    regexp.MustCompile(dflFmeRE),
 
 		getDevTree: getDevTree,
 
 		annotationValue: annotationValue,
+
+		vfio: mode == vfioMode,
 	}, nil
 }
@@ -40,6 +40,9 @@ func TestNewDevicePluginDFL(t *testing.T) {
 		{
 			mode: regionDevelMode,
 		},
+		{
+			mode: vfioMode,
+		},
 		{
 			mode:        "unparsable",
 			expectedErr: true,
@@ -441,6 +444,28 @@ func TestScanFPGAsDFL(t *testing.T) {
 				"region-69528db6eb31577a8c3668f9faa081f6": {"dfl-fme.0", "dfl-fme.1"},
 			},
 		},
+		{
+			name: "Valid DFL scan of static OFS design in af mode",
+			mode: afMode,
+			devs: []string{
+				"dfl-fme.0", "dfl-port.0",
+			},
+			sysfsdirs: []string{
+				"class/fpga_region/region0/dfl-port.0",
+				"devices/pci0000:80/0000:80:01.0/0000:81:00.0/fpga_region/region0/dfl-port.0",
+				"devices/pci0000:80/0000:80:01.0/0000:81:00.0/fpga_region/region0/dfl-fme.0",
+			},
+			sysfsfiles: map[string][]byte{
+				"devices/pci0000:80/0000:80:01.0/0000:81:00.0/fpga_region/region0/dfl-port.0/afu_id": []byte("d8424dc4a4a3c413f89e433683f9040b\n"),
+			},
+			newPort: genNewDFLPort(sysfs, dev,
+				map[string][]string{
+					"dfl-port.0": {"devices/pci0000:80/0000:80:01.0/0000:81:00.0", "dfl-fme.0", "devices/pci0000:80/0000:80:01.0/0000:81:00.0"},
+				}),
+			expectedDevTreeKeys: map[string][]string{
+				"af-000.d84.AAAAAAAAAAAAAAAAAAAAANhCTcSko8QT-J5DNoP5BAs": {"dfl-port.0"},
+			},
+		},
 	}
 
 	for _, tcase := range tcases {
@@ -22,6 +22,7 @@ import (
 	"regexp"
 	"time"
 
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 	cdispec "tags.cncf.io/container-device-interface/specs-go"
@@ -44,11 +45,16 @@ const (
 	afMode          = "af"
 	regionMode      = "region"
 	regionDevelMode = "regiondevel"
+	vfioMode        = "vfio"
 
 	// When the device's firmware crashes the driver reports these values.
 	unhealthyAfuID       = "ffffffffffffffffffffffffffffffff"
 	unhealthyInterfaceID = "ffffffffffffffffffffffffffffffff"
 
+	// Interface ID of the regions that do not support partial reconfiguration,
+	// e.g. static OFS designs, whose FME has no PR region with an interface ID.
+	staticInterfaceID = "00000000000000000000000000000000"
+
 	// Period of device scans.
 	scanPeriod = 5 * time.Second
 
@@ -59,6 +65,7 @@ const (
 )
 
 type newPortFunc func(fname string) (fpga.Port, error)
+type newFMEFunc func(fname string) (fpga.FME, error)
 type getDevTreeFunc func(devices []device) dpapi.DeviceTree
 
 // getRegionDevelTree returns mapping of region interface IDs to AF ports and FME devices.
@@ -200,16 +207,24 @@ type devicePlugin struct {
 	sysfsDir string
 	devfsDir string
 
+	// PCI bus directory for binding the VFs to vfio-pci in vfio mode.
+	pciBusDir string
+
 	deviceReg *regexp.Regexp
 	portReg   *regexp.Regexp
+	fmeReg    *regexp.Regexp
 
 	getDevTree getDevTreeFunc
 	newPort    newPortFunc
+	newFME     newFMEFunc
 
 	scanTicker *time.Ticker
 	scanDone   chan bool
 
 	annotationValue string
+
+	// Whether the AFU ports are passed through as VFs bound to vfio-pci.
+	vfio bool
 }
 
 // newDevicePlugin returns new instance of devicePlugin.
@@ -238,6 +253,7 @@ func newDevicePlugin(mode string, rootPath string) (*devicePlugin, error) {
 	}
 
 	dp.newPort = fpga.NewPort
+	dp.newFME = fpga.NewFME
 	dp.scanTicker = time.NewTicker(scanPeriod)
 	dp.scanDone = make(chan bool, 1) // buffered as we may send to it before Scan starts receiving from it
 
@@ -299,8 +315,16 @@ func (dp *devicePlugin) getRegions(deviceFiles []os.DirEntry) ([]region, error)
 			reg, ok := regions[regionName]
 			if ok {
 				reg.afus = append(reg.afus, afuInfo)
+				regions[regionName] = reg
 			} else {
-				regions[regionName] = region{id: regionName, interfaceID: fme.GetInterfaceUUID(), devNode: fme.GetDevPath(), afus: []afu{afuInfo}}
+				interfaceID := fme.GetInterfaceUUID()
+				if interfaceID == "" {
+					klog.V(2).Infof("no interface ID for %s, partial reconfiguration not supported", regionName)
+
+					interfaceID = staticInterfaceID
+				}
+
+				regions[regionName] = region{id: regionName, interfaceID: interfaceID, devNode: fme.GetDevPath(), afus: []afu{afuInfo}}
 			}
 		}
 	}
@@ -335,7 +359,14 @@ func (dp *devicePlugin) scanFPGAs() (dpapi.DeviceTree, error) {
 			return nil, errors.WithStack(err)
 		}
 
-		regions, err := dp.getRegions(deviceFiles)
+		var regions []region
+
+		if dp.vfio {
+			regions, err = dp.getVFIORegions(deviceFiles)
+		} else {
+			regions, err = dp.getRegions(deviceFiles)
+		}
+
 		if err != nil {
 			return nil, err
 		}
@@ -363,6 +394,8 @@ func getPluginParams(mode string) (getDevTreeFunc, string, error) {
 		annotationValue = fmt.Sprintf("%s/%s", namespace, regionMode)
 	case regionDevelMode:
 		getDevTree = getRegionDevelTree
+	case vfioMode:
+		getDevTree = getVFIOTree
 	default:
 		return nil, annotationValue, errors.Errorf("Wrong mode: '%s'", mode)
 	}
@@ -372,17 +405,19 @@ func getPluginParams(mode string) (getDevTreeFunc, string, error) {
 
 func main() {
 	var (
-		mode       string
-		kubeconfig string
-		master     string
-		nodename   string
+		mode           string
+		kubeconfig     string
+		master         string
+		nodename       string
+		metricsAddress string
 	)
 
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "absolute path to the kubeconfig file")
 	flag.StringVar(&master, "master", "", "master url")
 	flag.StringVar(&nodename, "node-name", os.Getenv("NODE_NAME"), "node name in the cluster to query mode annotation from")
 	flag.StringVar(&mode, "mode", string(afMode),
-		fmt.Sprintf("device plugin mode: '%s' (default), '%s' or '%s'", afMode, regionMode, regionDevelMode))
+		fmt.Sprintf("device plugin mode: '%s' (default), '%s', '%s' or '%s'", afMode, regionMode, regionDevelMode, vfioMode))
+	flag.StringVar(&metricsAddress, "metrics-address", "", "address to serve Prometheus metrics of the FPGA programming at, e.g. :8080 (region mode only, default: disabled)")
 	flag.Parse()
 
 	nodeMode, err := getModeOverrideFromCluster(nodename, kubeconfig, master, mode)
@@ -404,6 +439,38 @@ func main() {
 	}
 
 	klog.V(1).Infof("FPGA device plugin (%s) started in %s mode%s", plugin.name, mode, modeMessage)
+
+	if mode == regionMode {
+		startPRReporter(nodename, kubeconfig, master, metricsAddress)
+	}
+
 	manager := dpapi.NewManager(namespace, plugin)
 	manager.Run()
 }
+
+// startPRReporter starts reporting the FPGA programming by the CRI hook as
+// Kubernetes events of the node and, with the metrics address, as metrics.
+func startPRReporter(nodeName, kubeConfig, master, metricsAddress string) {
+	var recorder record.EventRecorder
+
+	clientset, err := newClientset(kubeConfig, master)
+
+	switch {
+	case err != nil:
+		klog.Warningf("FPGA programming is not reported as node events: %+v", err)
+	case nodeName == "":
+		klog.Warning("FPGA programming is not reported as node events: node name is not set")
+	default:
+		recorder = newEventRecorder(clientset, nodeName)
+	}
+
+	reporter := newPRReporter(fpga.PREventDirectory, recorder, nodeName)
+
+	go reporter.run(scanPeriod)
+
+	if metricsAddress != "" {
+		go func() {
+			klog.Fatal(reporter.serveMetrics(metricsAddress))
+		}()
+	}
+}
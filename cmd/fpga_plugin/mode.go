@@ -10,16 +10,14 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func getModeOverrideFromCluster(nodeName, kubeConfig, master, mode string) (string, error) {
+// newClientset returns a clientset for the cluster of the kubeconfig file,
+// or the cluster of the plugin, when the file is not given.
+func newClientset(kubeConfig, master string) (*kubernetes.Clientset, error) {
 	var (
 		config *rest.Config
 		err    error
 	)
 
-	if len(nodeName) == 0 {
-		return mode, errors.New("node name is not set")
-	}
-
 	if len(kubeConfig) == 0 {
 		config, err = rest.InClusterConfig()
 	} else {
@@ -27,10 +25,18 @@ func getModeOverrideFromCluster(nodeName, kubeConfig, master, mode string) (stri
 	}
 
 	if err != nil {
-		return mode, err
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+func getModeOverrideFromCluster(nodeName, kubeConfig, master, mode string) (string, error) {
+	if len(nodeName) == 0 {
+		return mode, errors.New("node name is not set")
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	clientset, err := newClientset(kubeConfig, master)
 	if err != nil {
 		return mode, err
 	}
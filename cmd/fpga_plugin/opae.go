@@ -16,6 +16,8 @@ package main
 
 import (
 	"regexp"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -25,6 +27,10 @@ const (
 
 // newDevicePlugin returns new instance of devicePlugin.
 func newDevicePluginOPAE(sysfsDir string, devfsDir string, mode string) (*devicePlugin, error) {
+	if mode == vfioMode {
+		return nil, errors.Errorf("%s mode is supported only with the DFL driver", vfioMode)
+	}
+
 	getDevTree, annotationValue, err := getPluginParams(mode)
 	if err != nil {
 		return nil, err
@@ -40,6 +40,10 @@ func TestNewDevicePluginOPAE(t *testing.T) {
 		{
 			mode: regionDevelMode,
 		},
+		{
+			mode:        vfioMode,
+			expectedErr: true,
+		},
 		{
 			mode:        "unparsable",
 			expectedErr: true,
@@ -0,0 +1,142 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpga"
+)
+
+const (
+	prSucceededReason = "FPGAProgrammed"
+	prFailedReason    = "FPGAProgrammingFailed"
+)
+
+// prReporter reports the partial reconfigurations of the FPGA ports, recorded
+// by the CRI hook, as Kubernetes events of the node and Prometheus metrics.
+type prReporter struct {
+	recorder   record.EventRecorder
+	node       *corev1.ObjectReference
+	registry   *prometheus.Registry
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	eventDir   string
+}
+
+func newPRReporter(eventDir string, recorder record.EventRecorder, nodeName string) *prReporter {
+	r := &prReporter{
+		recorder: recorder,
+		// Events of the node are recorded with the node name as the UID like kubelet does.
+		node:     &corev1.ObjectReference{Kind: "Node", Name: nodeName, UID: types.UID(nodeName)},
+		registry: prometheus.NewRegistry(),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fpga_pr_operations_total",
+			Help: "Number of FPGA partial reconfigurations by the CRI hook, by interface ID, AFU ID and result.",
+		}, []string{"interface_id", "afu_id", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "fpga_pr_duration_seconds",
+			Help:    "Duration of the FPGA partial reconfigurations by the CRI hook, by result.",
+			Buckets: prometheus.ExponentialBuckets(0.25, 2, 8),
+		}, []string{"result"}),
+		eventDir: eventDir,
+	}
+
+	r.registry.MustRegister(r.operations, r.duration)
+
+	return r
+}
+
+// newEventRecorder returns a recorder of the Kubernetes events of the plugin.
+func newEventRecorder(clientset kubernetes.Interface, nodeName string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "intel-fpga-plugin", Host: nodeName})
+}
+
+func (r *prReporter) report(event fpga.PREvent) {
+	result := "success"
+	if event.Error != "" {
+		result = "failure"
+	}
+
+	r.operations.WithLabelValues(event.InterfaceID, event.AfuID, result).Inc()
+	r.duration.WithLabelValues(result).Observe(event.Duration.Seconds())
+
+	klog.V(2).Infof("PR of %s with bitstream %s (%s): %s in %v %s", event.Port, event.BitstreamID, event.AfuID, result, event.Duration, event.Error)
+
+	if r.recorder == nil {
+		return
+	}
+
+	if event.Error != "" {
+		r.recorder.Eventf(r.node, corev1.EventTypeWarning, prFailedReason,
+			"Programming %s with bitstream %s (interface %s, AFU %s) failed after %v: %s",
+			event.Port, event.BitstreamID, event.InterfaceID, event.AfuID, event.Duration, event.Error)
+
+		return
+	}
+
+	r.recorder.Eventf(r.node, corev1.EventTypeNormal, prSucceededReason,
+		"Programmed %s with bitstream %s (interface %s, AFU %s) in %v",
+		event.Port, event.BitstreamID, event.InterfaceID, event.AfuID, event.Duration)
+}
+
+// run reports the recorded PR events every period.
+func (r *prReporter) run(period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		events, err := fpga.ReadPREvents(r.eventDir)
+		if err != nil {
+			klog.Warningf("unable to read PR events: %+v", err)
+		}
+
+		for _, event := range events {
+			r.report(event)
+		}
+	}
+}
+
+// serveMetrics serves the PR metrics at /metrics of the given address. It
+// returns only on errors.
+func (r *prReporter) serveMetrics(address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: scanPeriod,
+	}
+
+	klog.V(1).Infof("Serving metrics at %s/metrics", address)
+
+	return errors.Wrap(server.ListenAndServe(), "metrics server failed")
+}
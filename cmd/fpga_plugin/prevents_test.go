@@ -0,0 +1,72 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpga"
+)
+
+func TestPRReporter(t *testing.T) {
+	eventDir := t.TempDir()
+	recorder := record.NewFakeRecorder(10)
+	reporter := newPRReporter(eventDir, recorder, "node1")
+
+	start := time.Now()
+	for _, event := range []fpga.PREvent{
+		{Start: start, Port: "dfl-port.0", InterfaceID: "69528db6eb31577a8c3668f9faa081f6", AfuID: "d8424dc4a4a3c413f89e433683f9040b", Duration: time.Second},
+		{Start: start.Add(time.Minute), Port: "dfl-port.1", InterfaceID: "69528db6eb31577a8c3668f9faa081f6", AfuID: "d8424dc4a4a3c413f89e433683f9040b", Duration: time.Second, Error: "PR failed"},
+	} {
+		if err := fpga.WritePREvent(eventDir, event); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+
+	events, err := fpga.ReadPREvents(eventDir)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("expected 2 PR events, got %v: %+v", events, err)
+	}
+
+	for _, event := range events {
+		reporter.report(event)
+	}
+
+	if events, err := fpga.ReadPREvents(eventDir); err != nil || len(events) != 0 {
+		t.Errorf("expected PR events to be removed, got %v: %+v", events, err)
+	}
+
+	for _, expected := range []string{"Normal " + prSucceededReason, "Warning " + prFailedReason} {
+		if event := <-recorder.Events; !strings.HasPrefix(event, expected) {
+			t.Errorf("expected %q event, got %q", expected, event)
+		}
+	}
+
+	for result, expected := range map[string]float64{"success": 1, "failure": 1} {
+		m := &dto.Metric{}
+		if err := reporter.operations.WithLabelValues("69528db6eb31577a8c3668f9faa081f6", "d8424dc4a4a3c413f89e433683f9040b", result).Write(m); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+
+		if m.Counter.GetValue() != expected {
+			t.Errorf("expected %v %s operations, got %v", expected, result, m.Counter.GetValue())
+		}
+	}
+}
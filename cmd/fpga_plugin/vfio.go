@@ -0,0 +1,231 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpga"
+)
+
+const (
+	pciBusDirectory    = "/sys/bus/pci"
+	vfioDriver         = "vfio-pci"
+	vfioDevicePath     = "/dev/vfio"
+	vfioCtrlDevicePath = vfioDevicePath + "/vfio"
+
+	// Prefix of the environment variables with the PCI addresses of the VFs.
+	vfEnvPrefix = "FPGA_VF_"
+)
+
+// getVFIOTree returns mapping of region interface IDs to the VFs of AF ports
+// bound to vfio-pci.
+func getVFIOTree(devices []device) dpapi.DeviceTree {
+	vfioTree := dpapi.NewDeviceTree()
+
+	for _, dev := range devices {
+		for _, region := range dev.regions {
+			health := pluginapi.Healthy
+			if region.interfaceID == unhealthyInterfaceID {
+				health = pluginapi.Unhealthy
+			}
+
+			devType := fmt.Sprintf("%s-%s", vfioMode, region.interfaceID)
+
+			for _, afu := range region.afus {
+				devNodes := []pluginapi.DeviceSpec{
+					{
+						HostPath:      afu.devNode,
+						ContainerPath: afu.devNode,
+						Permissions:   "rw",
+					},
+					{
+						HostPath:      vfioCtrlDevicePath,
+						ContainerPath: vfioCtrlDevicePath,
+						Permissions:   "rw",
+					},
+				}
+				envs := map[string]string{
+					vfEnvPrefix + strings.NewReplacer(":", "_", ".", "_").Replace(afu.id): afu.id,
+				}
+
+				vfioTree.AddDevice(devType, afu.id, dpapi.NewDeviceInfo(health, devNodes, nil, envs, nil, nil))
+			}
+		}
+	}
+
+	return vfioTree
+}
+
+// getVFIORegions releases the AF ports of the regions from the PF devices,
+// enables a VF for each port, binds the VFs to vfio-pci, and returns the
+// regions with the VFs as their AFUs.
+func (dp *devicePlugin) getVFIORegions(deviceFiles []os.DirEntry) ([]region, error) {
+	regions := []region{}
+
+	for _, deviceFile := range deviceFiles {
+		name := deviceFile.Name()
+		if !dp.fmeReg.MatchString(name) {
+			continue
+		}
+
+		fme, err := dp.newFME(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't get FME info for %s", name)
+		}
+
+		if err = dp.releasePorts(fme, deviceFiles); err != nil {
+			return nil, err
+		}
+
+		pf, err := fme.GetPCIDevice()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't get PCI device of %s", name)
+		}
+
+		if err = enableVFs(pf.SysFsPath, fme.GetPortsNum()); err != nil {
+			return nil, err
+		}
+
+		vfs, err := dp.bindVFs(pf.SysFsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(vfs) == 0 {
+			continue
+		}
+
+		interfaceID := fme.GetInterfaceUUID()
+		if interfaceID == "" {
+			interfaceID = staticInterfaceID
+		}
+
+		regions = append(regions, region{id: fme.GetName(), interfaceID: interfaceID, devNode: fme.GetDevPath(), afus: vfs})
+	}
+
+	return regions, nil
+}
+
+// releasePorts releases the AF ports still assigned to the PF device, so that
+// its VFs get them.
+func (dp *devicePlugin) releasePorts(fme fpga.FME, deviceFiles []os.DirEntry) error {
+	for _, deviceFile := range deviceFiles {
+		name := deviceFile.Name()
+		if !dp.portReg.MatchString(name) {
+			continue
+		}
+
+		port, err := dp.newPort(name)
+		if err != nil {
+			return errors.Wrapf(err, "can't get port info for %s", name)
+		}
+
+		portID, err := port.GetPortID()
+		if err != nil {
+			return errors.Wrapf(err, "can't get port ID of %s", name)
+		}
+
+		klog.V(1).Infof("Releasing %s from %s", name, fme.GetName())
+
+		if err = fme.PortRelease(portID); err != nil {
+			return errors.Wrapf(err, "can't release %s", name)
+		}
+	}
+
+	return nil
+}
+
+// enableVFs enables numVFs VFs of the PF device, unless its VFs are enabled.
+func enableVFs(pfDir string, numVFs int) error {
+	numVFsFile := filepath.Join(pfDir, "sriov_numvfs")
+
+	data, err := os.ReadFile(numVFsFile)
+	if err != nil {
+		return errors.Wrapf(err, "%s does not support SR-IOV", filepath.Base(pfDir))
+	}
+
+	if strings.TrimSpace(string(data)) != "0" || numVFs <= 0 {
+		return nil
+	}
+
+	klog.V(1).Infof("Enabling %d VFs of %s", numVFs, filepath.Base(pfDir))
+
+	return errors.Wrapf(os.WriteFile(numVFsFile, []byte(strconv.Itoa(numVFs)), 0600), "can't enable VFs of %s", filepath.Base(pfDir))
+}
+
+// bindVFs binds the VFs of the PF device to vfio-pci, and returns them with
+// their VFIO group device nodes.
+func (dp *devicePlugin) bindVFs(pfDir string) ([]afu, error) {
+	vfLinks, err := filepath.Glob(filepath.Join(pfDir, "virtfn*"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	vfs := make([]afu, 0, len(vfLinks))
+
+	for _, vfLink := range vfLinks {
+		vfDir, err := filepath.EvalSymlinks(vfLink)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if err = dp.bindVFIO(vfDir); err != nil {
+			return nil, err
+		}
+
+		group, err := filepath.EvalSymlinks(filepath.Join(vfDir, "iommu_group"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "no IOMMU group for %s, is IOMMU enabled?", filepath.Base(vfDir))
+		}
+
+		vfs = append(vfs, afu{id: filepath.Base(vfDir), devNode: filepath.Join(vfioDevicePath, filepath.Base(group))})
+	}
+
+	return vfs, nil
+}
+
+// bindVFIO binds the VF device to vfio-pci, unless it is bound to it already.
+func (dp *devicePlugin) bindVFIO(vfDir string) error {
+	bdf := filepath.Base(vfDir)
+
+	driver, err := filepath.EvalSymlinks(filepath.Join(vfDir, "driver"))
+	if err == nil && filepath.Base(driver) == vfioDriver {
+		return nil
+	}
+
+	if err = os.WriteFile(filepath.Join(vfDir, "driver_override"), []byte(vfioDriver), 0600); err != nil {
+		return errors.Wrapf(err, "can't override driver of %s", bdf)
+	}
+
+	if driver != "" {
+		if err = os.WriteFile(filepath.Join(driver, "unbind"), []byte(bdf), 0600); err != nil {
+			return errors.Wrapf(err, "can't unbind %s from %s", bdf, filepath.Base(driver))
+		}
+	}
+
+	klog.V(1).Infof("Binding %s to %s", bdf, vfioDriver)
+
+	return errors.Wrapf(os.WriteFile(filepath.Join(dp.pciBusDir, "drivers_probe"), []byte(bdf), 0600), "can't bind %s to %s", bdf, vfioDriver)
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpga"
+)
+
+func vfioDeviceInfo(health, bdf, group string) dpapi.DeviceInfo {
+	nodes := []pluginapi.DeviceSpec{
+		{
+			HostPath:      path.Join(vfioDevicePath, group),
+			ContainerPath: path.Join(vfioDevicePath, group),
+			Permissions:   "rw",
+		},
+		{
+			HostPath:      vfioCtrlDevicePath,
+			ContainerPath: vfioCtrlDevicePath,
+			Permissions:   "rw",
+		},
+	}
+	envs := map[string]string{
+		"FPGA_VF_" + bdf[:4] + "_" + bdf[5:7] + "_" + bdf[8:10] + "_" + bdf[11:]: bdf,
+	}
+
+	return dpapi.NewDeviceInfo(health, nodes, nil, envs, nil, nil)
+}
+
+func TestGetVFIOTree(t *testing.T) {
+	devices := []device{
+		{
+			name: "region0",
+			regions: []region{
+				{
+					id:          "dfl-fme.0",
+					interfaceID: "ce48969398f05f33946d560708be108a",
+					devNode:     "/dev/dfl-fme.0",
+					afus: []afu{
+						{id: "0000:81:00.1", devNode: "/dev/vfio/42"},
+						{id: "0000:81:00.2", devNode: "/dev/vfio/43"},
+					},
+				},
+			},
+		},
+		{
+			name: "region1",
+			regions: []region{
+				{
+					id:          "dfl-fme.1",
+					interfaceID: unhealthyInterfaceID,
+					devNode:     "/dev/dfl-fme.1",
+					afus: []afu{
+						{id: "0000:42:00.1", devNode: "/dev/vfio/44"},
+					},
+				},
+			},
+		},
+	}
+
+	expected := dpapi.NewDeviceTree()
+	expected.AddDevice("vfio-ce48969398f05f33946d560708be108a", "0000:81:00.1", vfioDeviceInfo(pluginapi.Healthy, "0000:81:00.1", "42"))
+	expected.AddDevice("vfio-ce48969398f05f33946d560708be108a", "0000:81:00.2", vfioDeviceInfo(pluginapi.Healthy, "0000:81:00.2", "43"))
+	expected.AddDevice("vfio-"+unhealthyInterfaceID, "0000:42:00.1", vfioDeviceInfo(pluginapi.Unhealthy, "0000:42:00.1", "44"))
+
+	result := getVFIOTree(devices)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Got %+v, expected %+v", result, expected)
+	}
+}
+
+func TestScanFPGAsVFIO(t *testing.T) {
+	tmpdir := t.TempDir()
+	sysfs := path.Join(tmpdir, "sys")
+	dev := path.Join(tmpdir, "dev")
+	pfDir := path.Join(sysfs, "devices/pci0000:80/0000:80:01.0/0000:81:00.0")
+	vfDir := path.Join(sysfs, "devices/pci0000:80/0000:80:01.0/0000:81:00.1")
+	driverDir := path.Join(sysfs, "bus/pci/drivers/dfl-pci")
+
+	err := createTestDirs(dev, sysfs, []string{"dfl-fme.0"},
+		[]string{
+			"class/fpga_region/region0/dfl-fme.0",
+			"devices/pci0000:80/0000:80:01.0/0000:81:00.0",
+			"devices/pci0000:80/0000:80:01.0/0000:81:00.1",
+			"kernel/iommu_groups/42",
+			"bus/pci/drivers/dfl-pci",
+		},
+		map[string][]byte{
+			"devices/pci0000:80/0000:80:01.0/0000:81:00.0/sriov_numvfs": []byte("0\n"),
+		})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The VF, as the kernel creates it when enabling the VFs of the PF device.
+	for link, target := range map[string]string{
+		path.Join(pfDir, "virtfn0"):     vfDir,
+		path.Join(vfDir, "iommu_group"): path.Join(sysfs, "kernel/iommu_groups/42"),
+		path.Join(vfDir, "driver"):      driverDir,
+	} {
+		if err = os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin, err := newDevicePluginDFL(path.Join(sysfs, "class", "fpga_region"), dev, vfioMode)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	plugin.pciBusDir = path.Join(sysfs, "bus/pci")
+	plugin.newFME = func(name string) (fpga.FME, error) {
+		return &fpga.DflFME{
+			Name:      name,
+			DevPath:   path.Join(dev, name),
+			CompatID:  "69528db6eb31577a8c3668f9faa081f6",
+			PortsNum:  "1",
+			PCIDevice: &fpga.PCIDevice{SysFsPath: pfDir},
+		}, nil
+	}
+
+	devTree, err := plugin.scanFPGAs()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	expected := dpapi.NewDeviceTree()
+	expected.AddDevice("vfio-69528db6eb31577a8c3668f9faa081f6", "0000:81:00.1", vfioDeviceInfo(pluginapi.Healthy, "0000:81:00.1", "42"))
+
+	if !reflect.DeepEqual(devTree, expected) {
+		t.Errorf("Got %+v, expected %+v", devTree, expected)
+	}
+
+	for file, expectedContent := range map[string]string{
+		path.Join(pfDir, "sriov_numvfs"):          "1",
+		path.Join(vfDir, "driver_override"):       vfioDriver,
+		path.Join(driverDir, "unbind"):            "0000:81:00.1",
+		path.Join(sysfs, "bus/pci/drivers_probe"): "0000:81:00.1",
+	} {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Errorf("unexpected error: %+v", err)
+		} else if string(content) != expectedContent {
+			t.Errorf("%s: got %q, expected %q", file, content, expectedContent)
+		}
+	}
+}
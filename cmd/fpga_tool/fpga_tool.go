@@ -347,6 +347,10 @@ func printPCIeInfo(pci *fpga.PCIDevice, quiet bool) {
 
 	fmt.Printf("Device Id                        : %s:%s\n", pci.Vendor, pci.Device)
 
+	if family := pci.DFLFamily(); family != "" {
+		fmt.Printf("Device Family                    : %s\n", family)
+	}
+
 	if !quiet {
 		fmt.Printf("Device Class                     : %s\n", pci.Class)
 		fmt.Printf("Local CPUs                       : %s\n", pci.CPUs)
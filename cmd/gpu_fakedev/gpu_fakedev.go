@@ -35,7 +35,14 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fakedri"
 
@@ -44,16 +51,117 @@ import (
 
 func main() {
 	name := flag.String("json", "", "JSON spec for fake device sysfs, debugfs and devfs content")
+	snapshot := flag.Bool("snapshot", false, "print YAML spec reproducing GPUs of the real node under -sysfs and -devfs, instead of generating fake ones")
+	sysfsRoot := flag.String("sysfs", "/sys", "sysfs root for -snapshot")
+	devfsRoot := flag.String("devfs", "/dev", "devfs root for -snapshot")
+	watch := flag.Bool("watch", false, "keep running and re-apply JSON spec on SIGHUP, hot-plugging/unplugging fake devices accordingly")
+	cleanup := flag.Bool("cleanup", false, "remove the fake device files on termination, when kept running")
+	control := flag.String("control", "", "keep running and serve REST control API for the fake devices at given address (e.g. \":8080\")")
 
 	// Initialize klog flags for verbosity
 	klog.InitFlags(nil)
 
 	flag.Parse()
 
+	if *snapshot {
+		options, err := fakedri.Snapshot(*sysfsRoot, *devfsRoot)
+		if err != nil {
+			klog.Fatalf("Snapshot failed: %v", err)
+		}
+
+		spec, err := fakedri.MarshalSpec(options)
+		if err != nil {
+			klog.Fatalf("Spec marshaling failed: %v", err)
+		}
+
+		fmt.Print(string(spec))
+
+		return
+	}
+
 	if *name == "" {
 		klog.Error("ERROR: no fake device spec provided")
 	}
 
 	options := fakedri.GetOptions(*name)
 	fakedri.GenerateDriFiles(options)
+
+	if *watch || options.Dynamic != nil || *control != "" {
+		options = serve(*name, *watch, *control, options)
+
+		if *cleanup {
+			if err := fakedri.RemoveDriFiles(options); err != nil {
+				klog.ErrorS(err, "Fake device files removal failed")
+			}
+		}
+	}
+}
+
+func runDynamic(ctx context.Context, options fakedri.GenOptions) {
+	if err := fakedri.RunDynamic(ctx, options); err != nil {
+		klog.ErrorS(err, "Dynamic sysfs file updates failed")
+	}
+}
+
+// runControl serves the REST control API at given address.
+func runControl(address string, server *fakedri.ControlServer) {
+	httpServer := &http.Server{
+		Addr:              address,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	klog.V(1).InfoS("Serving control API", "address", address)
+
+	if err := httpServer.ListenAndServe(); err != nil {
+		klog.ErrorS(err, "Control API serving failed", "address", address)
+	}
+}
+
+// serve keeps updating the dynamic sysfs files until terminated, and
+// if watch is set, re-applies the spec file on SIGHUP. If control
+// address is given, control API is served there. Returns the options
+// in effect at termination.
+func serve(name string, watch bool, control string, options fakedri.GenOptions) fakedri.GenOptions {
+	server := fakedri.NewControlServer(options)
+	if control != "" {
+		go runControl(control, server)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go runDynamic(ctx, options)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+
+	for sig := range sigs {
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		if !watch {
+			continue
+		}
+
+		klog.V(1).InfoS("SIGHUP, re-applying spec", "file", name)
+
+		newOptions, err := fakedri.GetOptionsE(name)
+		if err != nil {
+			klog.InfoS("Warning: ignoring invalid spec", "file", name, "err", err)
+			continue
+		}
+
+		cancel()
+
+		if options, err = server.Respec(newOptions); err != nil {
+			klog.ErrorS(err, "Re-applying spec failed", "file", name)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		go runDynamic(ctx, options)
+	}
+
+	cancel()
+
+	return options
 }
@@ -0,0 +1,135 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+var errChecksum = errors.New("checksum mismatch")
+
+// usageCheckpoint is the device usage persisted over plugin restarts. Like
+// in the kubelet device manager checkpoint, the checksum is used to detect
+// a corrupted file.
+type usageCheckpoint struct {
+	InUse    map[string]time.Time `json:"inUse"`
+	Checksum uint32               `json:"checksum"`
+}
+
+func usageChecksum(inUse map[string]time.Time) (uint32, error) {
+	// Map keys are marshaled in sorted order.
+	data, err := json.Marshal(inUse)
+	if err != nil {
+		return 0, err
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write(data)
+
+	return hash.Sum32(), nil
+}
+
+// writeCheckpoint atomically writes the device usage to the checkpoint file.
+func writeCheckpoint(file string, inUse map[string]time.Time) error {
+	checksum, err := usageChecksum(inUse)
+	if err != nil {
+		return errors.Wrap(err, "Could not calculate checksum")
+	}
+
+	data, err := json.Marshal(usageCheckpoint{InUse: inUse, Checksum: checksum})
+	if err != nil {
+		return errors.Wrap(err, "Could not marshal checkpoint")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		return errors.Wrap(err, "Could not create checkpoint directory")
+	}
+
+	tmpFile := file + ".tmp"
+
+	if err = os.WriteFile(tmpFile, data, 0600); err != nil {
+		return errors.Wrap(err, "Could not write checkpoint")
+	}
+
+	return os.Rename(tmpFile, file)
+}
+
+// readCheckpoint reads the device usage from the checkpoint file.
+func readCheckpoint(file string) (map[string]time.Time, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := usageCheckpoint{}
+	if err = json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, errors.Wrap(err, "Could not unmarshal checkpoint")
+	}
+
+	if checkpoint.InUse == nil {
+		checkpoint.InUse = map[string]time.Time{}
+	}
+
+	checksum, err := usageChecksum(checkpoint.InUse)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not calculate checksum")
+	}
+
+	if checksum != checkpoint.Checksum {
+		return nil, errChecksum
+	}
+
+	return checkpoint.InUse, nil
+}
+
+// checkpointUsage persists the device usage, when a checkpoint file is
+// configured. Caller holds the usageLock.
+func (dp *devicePlugin) checkpointUsage() {
+	if dp.options.checkpointFile == "" {
+		return
+	}
+
+	if err := writeCheckpoint(dp.options.checkpointFile, dp.inUse); err != nil {
+		klog.Warningf("GPU device usage checkpoint failed: %+v", err)
+	}
+}
+
+// restoreUsage restores the device usage from the checkpoint file, so that
+// allocations are accounted for after plugin restart also when kubelet
+// PodResources is not (yet) available, e.g. because kubelet is restarting.
+// The restored usage is replaced on the next usage reconciliation.
+func (dp *devicePlugin) restoreUsage() {
+	inUse, err := readCheckpoint(dp.options.checkpointFile)
+
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		klog.V(2).Infof("No GPU device usage checkpoint %s", dp.options.checkpointFile)
+	case err != nil:
+		klog.Warningf("Ignoring GPU device usage checkpoint %s: %+v", dp.options.checkpointFile, err)
+	default:
+		klog.V(2).Infof("Restored usage of %d GPU devices from checkpoint", len(inUse))
+
+		dp.usageLock.Lock()
+		dp.inUse = inUse
+		dp.usageLock.Unlock()
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// GPU cleanup modes, when all devices of a GPU have been released: no
+	// cleanup, PCI function reset, or else the cleanup command to run with
+	// the GPU card name and PCI address arguments.
+	cleanupNone  = "none"
+	cleanupReset = "reset"
+
+	cleanupTimeout = 30 * time.Second
+)
+
+// usedCards returns the GPUs having devices in use.
+func usedCards(inUse map[string]time.Time) map[string]bool {
+	cards := map[string]bool{}
+
+	for deviceID := range inUse {
+		cards[strings.Split(deviceID, "-")[0]] = true
+	}
+
+	return cards
+}
+
+// releasedCards returns the GPUs having devices in use before, but not after.
+func releasedCards(before, after map[string]time.Time) []string {
+	used := usedCards(after)
+	released := []string{}
+
+	for card := range usedCards(before) {
+		if !used[card] {
+			released = append(released, card)
+		}
+	}
+
+	sort.Strings(released)
+
+	return released
+}
+
+// cleanupCard runs the configured cleanup for the given GPU.
+func (dp *devicePlugin) cleanupCard(card string) error {
+	cardPath := path.Join(dp.sysfsDir, card)
+
+	if dp.options.releaseCleanup == cleanupReset {
+		return os.WriteFile(path.Join(cardPath, "device/reset"), []byte("1"), 0600)
+	}
+
+	pciAddress, err := dp.pciAddressForCard(cardPath, card)
+	if err != nil {
+		return errors.Wrap(err, "Could not get PCI address")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	// #nosec G204 // cleanup command is given by the cluster admin.
+	output, err := exec.CommandContext(ctx, dp.options.releaseCleanup, card, pciAddress).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "Cleanup command failed: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// cleanupReleased cleans up the given released GPUs, unless they have been
+// allocated again meanwhile.
+func (dp *devicePlugin) cleanupReleased(cards []string) {
+	for _, card := range cards {
+		dp.usageLock.Lock()
+		used := usedCards(dp.inUse)[card]
+		dp.usageLock.Unlock()
+
+		if used {
+			klog.V(4).Infof("GPU %s allocated again, skipping cleanup", card)
+			continue
+		}
+
+		klog.V(2).Infof("Cleaning up released GPU %s", card)
+
+		if err := dp.cleanupCard(card); err != nil {
+			klog.Warningf("GPU %s cleanup failed: %+v", card, err)
+		}
+	}
+}
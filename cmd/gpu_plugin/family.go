@@ -0,0 +1,54 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/pluginutils"
+)
+
+const (
+	// GPU family resource modes: no family resources, family resources
+	// in addition to the driver resource, or instead of it.
+	familyResourcesNone      = "none"
+	familyResourcesAlongside = "alongside"
+	familyResourcesInstead   = "instead"
+)
+
+// gpuFamily returns the family resource name for the given GPU, or empty
+// string if family resources are not enabled or GPU is not in any family.
+func (dp *devicePlugin) gpuFamily(card string) string {
+	if dp.options.familyResources != familyResourcesAlongside && dp.options.familyResources != familyResourcesInstead {
+		return ""
+	}
+
+	dat, err := os.ReadFile(path.Join(dp.sysfsDir, card, "device/device"))
+	if err != nil {
+		klog.Warningf("Can't read device file for %s family: %+v", card, err)
+		return ""
+	}
+
+	id := strings.TrimSpace(string(dat))
+	family := pluginutils.GpuFamily(id)
+
+	klog.V(4).Infof("GPU %s PCI device ID %s family: '%s'", card, id, family)
+
+	return family
+}
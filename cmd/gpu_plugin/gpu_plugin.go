@@ -22,20 +22,26 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fakedri"
 
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/gpu_plugin/policy"
 	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/gpu_plugin/rm"
 	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/labeler"
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/levelzero"
 	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	"tags.cncf.io/container-device-interface/pkg/cdi"
 	cdispec "tags.cncf.io/container-device-interface/specs-go"
 )
 
@@ -45,6 +51,7 @@ const (
 	gpuDeviceRE      = `^card[0-9]+$`
 	controlDeviceRE  = `^controlD[0-9]+$`
 	pciAddressRE     = "^[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\\.[0-9a-f]{1}$"
+	pciDeviceIDRE    = `^0x[0-9a-f]{4}$`
 	vendorString     = "0x8086"
 
 	// Device plugin settings.
@@ -53,11 +60,26 @@ const (
 	deviceTypeXe      = "xe"
 	deviceTypeDefault = deviceTypeI915
 
+	// CDI modes, i.e. how allocated devices are passed to the container runtime:
+	// device specs and mounts together with CDI devices, only CDI devices,
+	// or only CDI device annotations (for runtimes without CDI devices field support).
+	cdiModeBoth        = "both"
+	cdiModeDevices     = "devices"
+	cdiModeAnnotations = "annotations"
+
+	// Default device cgroup permissions of the GPU device nodes, as even
+	// querying metrics requires the devices to be writable.
+	defaultDevicePermissions = "rw"
+
+	// CDI annotation key is "cdi.k8s.io/<plugin>_<device ID>".
+	cdiAnnotationPlugin   = "intel.gpu"
+	cdiAnnotationDeviceID = "devices"
+
 	// telemetry resource settings.
 	monitorSuffix = "_monitoring"
 	monitorID     = "all"
 
-	// Period of device scans.
+	// Default period of device scans.
 	scanPeriod = 5 * time.Second
 
 	// Labeler's max update interval, 5min.
@@ -71,10 +93,32 @@ var (
 )
 
 type cliOptions struct {
+	allowIDs                  []string
+	denyIDs                   []string
 	preferredAllocationPolicy string
+	cdiMode                   string
+	familyResources           string
+	resourceNamespace         string
+	resourcePrefix            string
 	fakedriSpec               string
+	xeLinkFile                string
+	levelZeroSocket           string
+	releaseCleanup            string
+	devicePermissions         string
+	monitorPermissions        string
+	checkpointFile            string
 	sharedDevNum              int
+	memoryUnit                int
+	millicoreUnit             int
+	scanPeriod                time.Duration
 	enableMonitoring          bool
+	nodeLabels                bool
+	deviceSelectorEnvs        bool
+	healthMonitoring          bool
+	tileResources             bool
+	trackUsage                bool
+	pcieLocality              bool
+	renderNodesOnly           bool
 	resourceManagement        bool
 }
 
@@ -84,6 +128,21 @@ type rmWithMultipleDriversErr struct {
 
 type preferredAllocationPolicyFunc func(*pluginapi.ContainerPreferredAllocationRequest) []string
 
+func init() {
+	policy.Register("none", policy.Func(nonePolicy))
+	policy.Register("balanced", policy.Func(balancedPolicy))
+	policy.Register("packed", policy.Func(packedPolicy))
+}
+
+// allocationPolicies returns the names of the registered allocation
+// policies, and the ones using the plugin state.
+func allocationPolicies() []string {
+	names := append(policy.Names(), "numa")
+	sort.Strings(names)
+
+	return names
+}
+
 // nonePolicy is used for allocating GPU devices randomly, while trying
 // to select as many individual GPU devices as requested.
 func nonePolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
@@ -140,6 +199,18 @@ func nonePolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
 
 // balancedPolicy is used for allocating GPU devices in balance.
 func balancedPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	return balancedPolicyWithUsage(req, nil)
+}
+
+// usageBalancedPolicy is balancedPolicy taking into account also the GPU
+// devices in use by the other GPU resources.
+func (dp *devicePlugin) usageBalancedPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	return balancedPolicyWithUsage(req, dp.otherUsage(req.AvailableDeviceIDs))
+}
+
+// balancedPolicyWithUsage allocates GPU devices in balance, reducing the
+// given numbers of devices used by other resources from the available ones.
+func balancedPolicyWithUsage(req *pluginapi.ContainerPreferredAllocationRequest, used map[string]int) []string {
 	klog.V(2).Info("Select balancedPolicy for GPU device allocation")
 
 	// Save the shared-devices list of each physical GPU.
@@ -174,8 +245,8 @@ func balancedPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string
 		)
 
 		for _, key := range Index {
-			if Count[key] > max {
-				max = Count[key]
+			if Count[key] > 0 && (allocateCard == "" || Count[key]-used[key] > max) {
+				max = Count[key] - used[key]
 				allocateCard = key
 			}
 		}
@@ -197,6 +268,148 @@ func balancedPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string
 	return deviceIds
 }
 
+// fitPolicy is used for packing GPU memory and tile allocations to as few GPU
+// devices as possible: to the GPU with least free IDs that fits the whole
+// request, or to the GPUs with most free IDs first.
+func fitPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	klog.V(2).Info("Select fitPolicy for GPU memory, tile or millicore allocation")
+
+	deviceIDs := slices.Clone(req.MustIncludeDeviceIDs)
+	need := int(req.AllocationSize) - len(deviceIDs)
+
+	// Save the free IDs of each physical GPU.
+	free := make(map[string][]string)
+
+	for _, deviceID := range req.AvailableDeviceIDs {
+		if !slices.Contains(deviceIDs, deviceID) {
+			card := strings.Split(deviceID, "-")[0]
+			free[card] = append(free[card], deviceID)
+		}
+	}
+
+	cards := make([]string, 0, len(free))
+	for card := range free {
+		cards = append(cards, card)
+	}
+
+	sort.Slice(cards, func(i, j int) bool {
+		fitsI, fitsJ := len(free[cards[i]]) >= need, len(free[cards[j]]) >= need
+		if fitsI != fitsJ {
+			return fitsI
+		}
+
+		if fitsI && len(free[cards[i]]) != len(free[cards[j]]) {
+			return len(free[cards[i]]) < len(free[cards[j]])
+		}
+
+		if len(free[cards[i]]) != len(free[cards[j]]) {
+			return len(free[cards[i]]) > len(free[cards[j]])
+		}
+
+		return cards[i] < cards[j]
+	})
+
+	for _, card := range cards {
+		if need <= 0 {
+			break
+		}
+
+		count := min(need, len(free[card]))
+		deviceIDs = append(deviceIDs, free[card][:count]...)
+		need -= count
+	}
+
+	klog.V(2).Infof("Allocate deviceIds: %q", deviceIDs)
+
+	return deviceIDs
+}
+
+// numaPolicy is used for allocating GPU devices from the same NUMA node.
+// The required devices are selected first, and the rest with nonePolicy from
+// the NUMA node of most of the required devices, or from the NUMA node with
+// fewest available devices that still fits the rest of the request. If no
+// NUMA node fits it, the rest is selected with balancedPolicy.
+func (dp *devicePlugin) numaPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	klog.V(2).Info("Select numaPolicy for GPU device allocation")
+
+	deviceIDs := slices.Clone(req.MustIncludeDeviceIDs)
+	need := int(req.AllocationSize) - len(deviceIDs)
+
+	if need <= 0 {
+		return deviceIDs
+	}
+
+	// Save the other available device IDs of each NUMA node, and the
+	// numbers of the required devices on each NUMA node.
+	nodes := make(map[int][]string)
+	required := make(map[int]int)
+
+	dp.topologyLock.Lock()
+
+	for _, deviceID := range req.AvailableDeviceIDs {
+		node, found := dp.numaNodes[strings.Split(deviceID, "-")[0]]
+		if !found || node < 0 {
+			continue
+		}
+
+		if slices.Contains(deviceIDs, deviceID) {
+			required[node]++
+		} else {
+			nodes[node] = append(nodes[node], deviceID)
+		}
+	}
+
+	dp.topologyLock.Unlock()
+
+	best := -1
+
+	for node, count := range required {
+		if best < 0 || count > required[best] || (count == required[best] && node < best) {
+			best = node
+		}
+	}
+
+	for node, available := range nodes {
+		if len(required) > 0 || len(available) < need {
+			continue
+		}
+
+		if best < 0 || len(available) < len(nodes[best]) || (len(available) == len(nodes[best]) && node < best) {
+			best = node
+		}
+	}
+
+	fill := 0
+
+	if best < 0 {
+		klog.V(2).Info("No NUMA node fits the request, falling back to balancedPolicy")
+	} else {
+		klog.V(2).Infof("Allocating from NUMA node %d", best)
+
+		fill = min(need, len(nodes[best]))
+	}
+
+	if fill > 0 {
+		deviceIDs = append(deviceIDs, nonePolicy(&pluginapi.ContainerPreferredAllocationRequest{
+			AvailableDeviceIDs: nodes[best],
+			AllocationSize:     int32(fill),
+		})...)
+	}
+
+	if need > fill {
+		rest := slices.DeleteFunc(slices.Clone(req.AvailableDeviceIDs), func(deviceID string) bool {
+			return slices.Contains(deviceIDs, deviceID)
+		})
+
+		deviceIDs = append(deviceIDs, balancedPolicy(&pluginapi.ContainerPreferredAllocationRequest{
+			AvailableDeviceIDs: rest,
+			AllocationSize:     int32(need - fill),
+		})...)
+	}
+
+	return deviceIDs
+}
+
 // packedPolicy is used for allocating GPU devices one by one.
 func packedPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
 	klog.V(2).Info("Select packedPolicy for GPU device allocation")
@@ -258,6 +471,10 @@ func (dp *devicePlugin) bypathMountsForPci(pciAddress, bypathDir string) []plugi
 	var mounts []pluginapi.Mount
 
 	for _, f := range files {
+		if dp.options.renderNodesOnly && strings.HasSuffix(f.Name(), "-card") {
+			continue
+		}
+
 		if strings.HasPrefix(f.Name(), linkPrefix) {
 			absPath := path.Join(bypathDir, f.Name())
 
@@ -280,12 +497,34 @@ type devicePlugin struct {
 	scanTicker    *time.Ticker
 	scanDone      chan bool
 	scanResources chan bool
+	scanTrigger   chan bool
 
 	resMan rm.ResourceManager
 
-	sysfsDir  string
-	devfsDir  string
-	bypathDir string
+	levelZeroClient levelzero.Client
+
+	// NUMA nodes of the GPUs, for numaPolicy, Xe Link connected GPUs of
+	// each GPU, for xeLinkPolicy, and PCI hierarchy of the GPUs, for
+	// pcieLocalityPolicy.
+	numaNodes    map[string]int
+	xeLinks      map[string]map[string]bool
+	pciePaths    map[string][]string
+	topologyLock sync.Mutex
+
+	// Health of the GPUs found by the latest scan, updated by monitorHealth.
+	health      map[string]*gpuHealth
+	healthCards []string
+	healthLock  sync.Mutex
+
+	// Allocation times of the devices in use, zero for the devices
+	// found by reconcileUsage.
+	inUse     map[string]time.Time
+	usageLock sync.Mutex
+
+	sysfsDir   string
+	devfsDir   string
+	debugfsDir string // DRM debugfs dir relative to the sysfs DRM dir
+	bypathDir  string
 
 	// Note: If restarting the plugin with a new policy, the allocations for existing pods remain with old policy.
 	policy  preferredAllocationPolicyFunc
@@ -295,18 +534,49 @@ type devicePlugin struct {
 }
 
 func newDevicePlugin(sysfsDir, devfsDir string, options cliOptions) *devicePlugin {
+	if options.resourceNamespace == "" {
+		options.resourceNamespace = namespace
+	}
+
+	if options.releaseCleanup == "" {
+		options.releaseCleanup = cleanupNone
+	}
+
+	if options.scanPeriod == 0 {
+		options.scanPeriod = scanPeriod
+	}
+
+	if options.devicePermissions == "" {
+		options.devicePermissions = defaultDevicePermissions
+	}
+
+	if options.monitorPermissions == "" {
+		options.monitorPermissions = defaultDevicePermissions
+	}
+
 	dp := &devicePlugin{
 		sysfsDir:         sysfsDir,
 		devfsDir:         devfsDir,
+		debugfsDir:       path.Join(sysfsDir, "../../kernel/debug/dri"),
 		bypathDir:        path.Join(devfsDir, "/by-path"),
 		options:          options,
 		gpuDeviceReg:     regexp.MustCompile(gpuDeviceRE),
 		controlDeviceReg: regexp.MustCompile(controlDeviceRE),
 		pciAddressReg:    regexp.MustCompile(pciAddressRE),
-		scanTicker:       time.NewTicker(scanPeriod),
+		scanTicker:       time.NewTicker(options.scanPeriod),
 		scanDone:         make(chan bool, 1), // buffered as we may send to it before Scan starts receiving from it
 		bypathFound:      true,
 		scanResources:    make(chan bool, 1),
+		scanTrigger:      make(chan bool, 1),
+		inUse:            make(map[string]time.Time),
+	}
+
+	if options.checkpointFile != "" {
+		dp.restoreUsage()
+	}
+
+	if options.levelZeroSocket != "" {
+		dp.levelZeroClient = levelzero.NewClient(options.levelZeroSocket)
 	}
 
 	if options.resourceManagement {
@@ -314,8 +584,8 @@ func newDevicePlugin(sysfsDir, devfsDir string, options cliOptions) *devicePlugi
 
 		dp.resMan, err = rm.NewResourceManager(monitorID,
 			[]string{
-				namespace + "/" + deviceTypeI915,
-				namespace + "/" + deviceTypeXe,
+				dp.fullResourceName(deviceTypeI915),
+				dp.fullResourceName(deviceTypeXe),
 			})
 		if err != nil {
 			klog.Errorf("Failed to create resource manager: %+v", err)
@@ -323,13 +593,18 @@ func newDevicePlugin(sysfsDir, devfsDir string, options cliOptions) *devicePlugi
 		}
 	}
 
-	switch options.preferredAllocationPolicy {
-	case "balanced":
-		dp.policy = balancedPolicy
-	case "packed":
-		dp.policy = packedPolicy
+	// Policies using the plugin state are not in the policy registry.
+	switch {
+	case options.preferredAllocationPolicy == "balanced" && options.trackUsage:
+		dp.policy = dp.usageBalancedPolicy
+	case options.preferredAllocationPolicy == "numa":
+		dp.policy = dp.numaPolicy
 	default:
 		dp.policy = nonePolicy
+
+		if p, found := policy.Get(options.preferredAllocationPolicy); found {
+			dp.policy = p.Select
+		}
 	}
 
 	if _, err := os.ReadDir(dp.bypathDir); err != nil {
@@ -363,7 +638,23 @@ func (dp *devicePlugin) GetPreferredAllocation(rqt *pluginapi.PreferredAllocatio
 			return nil, err
 		}
 
-		IDs := dp.policy(req)
+		var IDs []string
+
+		switch {
+		case len(req.AvailableDeviceIDs) > 0 && (isMemoryID(req.AvailableDeviceIDs[0]) || isTileID(req.AvailableDeviceIDs[0]) ||
+			isMillicoreID(req.AvailableDeviceIDs[0])):
+			IDs = fitPolicy(req)
+		case dp.options.xeLinkFile != "" || dp.options.pcieLocality:
+			IDs = dp.xeLinkPolicy(req)
+
+			if IDs == nil && dp.options.pcieLocality {
+				IDs = dp.pcieLocalityPolicy(req)
+			}
+		}
+
+		if IDs == nil {
+			IDs = dp.policy(req)
+		}
 
 		resp := &pluginapi.ContainerPreferredAllocationResponse{
 			DeviceIDs: IDs,
@@ -385,6 +676,16 @@ func (dp *devicePlugin) Scan(notifier dpapi.Notifier) error {
 		deviceTypeXe + monitorSuffix:   0,
 		deviceTypeI915 + monitorSuffix: 0}
 
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Watch is set up before the first scan, to not miss any changes after it.
+	devfsMissing := !dp.startDevfsWatch(stop) && !dp.devfsDirExists()
+
+	if dp.options.healthMonitoring {
+		go dp.monitorHealth(stop)
+	}
+
 	for {
 		devTree, err := dp.scan()
 		if err != nil {
@@ -410,8 +711,15 @@ func (dp *devicePlugin) Scan(notifier dpapi.Notifier) error {
 
 		notifier.Notify(devTree)
 
+		// devfs DRI dir may be created only after plugin start, with the first GPU.
+		if devfsMissing && dp.devfsDirExists() {
+			devfsMissing = false
+
+			dp.startDevfsWatch(stop)
+		}
+
 		// Trigger resource scan if it's enabled.
-		if dp.resMan != nil && countChanged {
+		if (dp.resMan != nil || dp.options.nodeLabels) && countChanged {
 			dp.scanResources <- true
 		}
 
@@ -419,6 +727,7 @@ func (dp *devicePlugin) Scan(notifier dpapi.Notifier) error {
 		case <-dp.scanDone:
 			return nil
 		case <-dp.scanTicker.C:
+		case <-dp.scanTrigger:
 		}
 	}
 }
@@ -440,9 +749,81 @@ func (dp *devicePlugin) isCompatibleDevice(name string) bool {
 		return false
 	}
 
+	return dp.isAllowedDevice(name)
+}
+
+// isAllowedDevice tells whether the GPU PCI device ID is in the allow list (if
+// one is given) and not in the deny list.
+func (dp *devicePlugin) isAllowedDevice(name string) bool {
+	if len(dp.options.allowIDs) == 0 && len(dp.options.denyIDs) == 0 {
+		return true
+	}
+
+	dat, err := os.ReadFile(path.Join(dp.sysfsDir, name, "device/device"))
+	if err != nil {
+		klog.Warning("Skipping. Can't read device file: ", err)
+		return false
+	}
+
+	id := strings.ToLower(strings.TrimSpace(string(dat)))
+
+	if slices.Contains(dp.options.denyIDs, id) || (len(dp.options.allowIDs) > 0 && !slices.Contains(dp.options.allowIDs, id)) {
+		klog.V(4).Infof("Skipping %s, PCI device ID %s is not allowed", name, id)
+		return false
+	}
+
 	return true
 }
 
+// parsePciDeviceIDs parses a comma separated list of PCI device IDs.
+func parsePciDeviceIDs(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	re := regexp.MustCompile(pciDeviceIDRE)
+	ids := []string{}
+
+	for _, id := range strings.Split(list, ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if !re.MatchString(id) {
+			return nil, errors.Errorf("invalid PCI device ID '%s'", id)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// isValidDevicePermissions tells whether the given device cgroup permissions
+// are a combination of "r" (read), "w" (write) and "m" (mknod).
+func isValidDevicePermissions(permissions string) bool {
+	if permissions == "" {
+		return false
+	}
+
+	for i, c := range permissions {
+		if !strings.ContainsRune("rwm", c) || strings.ContainsRune(permissions[i+1:], c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withPermissions returns copies of the device specs with the given permissions.
+func withPermissions(devSpecs []pluginapi.DeviceSpec, permissions string) []pluginapi.DeviceSpec {
+	specs := make([]pluginapi.DeviceSpec, 0, len(devSpecs))
+
+	for _, spec := range devSpecs {
+		spec.Permissions = permissions
+		specs = append(specs, spec)
+	}
+
+	return specs
+}
+
 func (dp *devicePlugin) devSpecForDrmFile(drmFile string) (devSpec pluginapi.DeviceSpec, devPath string, err error) {
 	if dp.controlDeviceReg.MatchString(drmFile) {
 		//Skipping possible drm control node
@@ -456,11 +837,10 @@ func (dp *devicePlugin) devSpecForDrmFile(drmFile string) (devSpec pluginapi.Dev
 		return
 	}
 
-	// even querying metrics requires device to be writable
 	devSpec = pluginapi.DeviceSpec{
 		HostPath:      devPath,
 		ContainerPath: devPath,
-		Permissions:   "rw",
+		Permissions:   dp.options.devicePermissions,
 	}
 
 	return
@@ -491,6 +871,11 @@ func (dp *devicePlugin) createDeviceSpecsFromDrmFiles(cardPath string) []plugina
 	drmFiles, _ := os.ReadDir(path.Join(cardPath, "device/drm"))
 
 	for _, drmFile := range drmFiles {
+		// Primary (modesetting) nodes are not needed for compute and media.
+		if dp.options.renderNodesOnly && dp.gpuDeviceReg.MatchString(drmFile.Name()) {
+			continue
+		}
+
 		devSpec, devPath, devSpecErr := dp.devSpecForDrmFile(drmFile.Name())
 		if devSpecErr != nil {
 			continue
@@ -543,17 +928,51 @@ func (dp *devicePlugin) createMountsAndCDIDevices(cardPath, name string, devSpec
 	return mounts, spec
 }
 
+// resourceName returns the name of the given resource with the configured
+// resource name prefix.
+func (dp *devicePlugin) resourceName(resource string) string {
+	return dp.options.resourcePrefix + resource
+}
+
+// fullResourceName returns the given resource name with the configured
+// resource name prefix and namespace, as used in the pod specs.
+func (dp *devicePlugin) fullResourceName(resource string) string {
+	return dp.options.resourceNamespace + "/" + dp.resourceName(resource)
+}
+
 func (dp *devicePlugin) scan() (dpapi.DeviceTree, error) {
 	files, err := os.ReadDir(dp.sysfsDir)
 	if err != nil {
 		return nil, errors.Wrap(err, "Can't read sysfs folder")
 	}
 
-	monitor := make(map[string][]pluginapi.DeviceSpec, 0)
+	// udev may create the by-path links only after plugin startup.
+	if !dp.bypathFound {
+		if _, err = os.Stat(dp.bypathDir); err == nil {
+			klog.V(2).Infof("Found by-path dir %s", dp.bypathDir)
+
+			dp.bypathFound = true
+		}
+	}
+
+	// Monitoring resources of the found KMDs, and devices of all GPUs.
+	monitorResources := make(map[string]bool)
+	monitorSpecs := []pluginapi.DeviceSpec{}
+	monitorMounts := []pluginapi.Mount{}
 
 	devTree := dpapi.NewDeviceTree()
 	rmDevInfos := rm.NewDeviceInfoMap()
 	devProps := newDeviceProperties()
+	numaNodes := make(map[string]int)
+	cards := []string{}
+
+	var levelZeroDetails map[string]levelzero.DeviceDetails
+
+	if dp.options.memoryUnit > 0 && dp.levelZeroClient != nil {
+		if levelZeroDetails, err = dp.levelZeroClient.Devices(); err != nil {
+			klog.Warningf("Level Zero details not available, using sysfs: %+v", err)
+		}
+	}
 
 	for _, f := range dp.filterOutInvalidCards(files) {
 		name := f.Name()
@@ -571,31 +990,82 @@ func (dp *devicePlugin) scan() (dpapi.DeviceTree, error) {
 			continue
 		}
 
+		cards = append(cards, name)
+
+		if dp.options.preferredAllocationPolicy == "numa" {
+			numaNodes[name] = labeler.GetNumaNode(dp.sysfsDir, name)
+		}
+
 		mounts, cdiDevices := dp.createMountsAndCDIDevices(cardPath, name, devSpecs)
 
-		deviceInfo := dpapi.NewDeviceInfo(pluginapi.Healthy, devSpecs, mounts, nil, nil, cdiDevices, prefix+"/dev")
+		deviceInfo := dpapi.NewDeviceInfo(dp.cardHealth(name), devSpecs, mounts, dp.selectorEnvs(name), nil, cdiDevices, prefix+"/dev")
+
+		// GPUs not in any family stay in the driver resource.
+		family := dp.gpuFamily(name)
 
 		for i := 0; i < dp.options.sharedDevNum; i++ {
 			devID := fmt.Sprintf("%s-%d", name, i)
-			devTree.AddDevice(devProps.driver(), devID, deviceInfo)
+
+			if family == "" || dp.options.familyResources == familyResourcesAlongside {
+				devTree.AddDevice(dp.resourceName(devProps.driver()), devID, deviceInfo)
+			}
+
+			if family != "" {
+				devTree.AddDevice(dp.resourceName(family), devID, deviceInfo)
+			}
 
 			rmDevInfos[devID] = rm.NewDeviceInfo(devSpecs, mounts, nil)
 		}
 
+		if dp.options.memoryUnit > 0 {
+			dp.addMemoryDevices(devTree, devProps, cardPath, name, devSpecs, mounts, cdiDevices,
+				levelZeroDetails[levelzero.PciAddress(cardPath)].MemorySize)
+		}
+
+		if dp.options.millicoreUnit > 0 {
+			dp.addMillicoreDevices(devTree, devProps, name, devSpecs, mounts, cdiDevices)
+		}
+
+		if dp.options.tileResources {
+			dp.addTileDevices(devTree, devProps, cardPath, name, devSpecs, mounts, cdiDevices)
+		}
+
 		if dp.options.enableMonitoring {
-			res := devProps.monitorResource()
+			res := dp.resourceName(devProps.monitorResource())
 			klog.V(4).Infof("For %s/%s, adding nodes: %+v", res, monitorID, devSpecs)
 
-			monitor[res] = append(monitor[res], devSpecs...)
+			monitorResources[res] = true
+			monitorSpecs = append(monitorSpecs, withPermissions(devSpecs, dp.options.monitorPermissions)...)
+			monitorMounts = append(monitorMounts, mounts...)
 		}
 	}
 
-	// all Intel GPUs are under single monitoring resource per KMD
-	if len(monitor) > 0 {
-		for resourceName, devices := range monitor {
-			deviceInfo := dpapi.NewDeviceInfo(pluginapi.Healthy, devices, nil, nil, nil, nil)
-			devTree.AddDevice(resourceName, monitorID, deviceInfo)
-		}
+	var xeLinks map[string]map[string]bool
+	if dp.options.xeLinkFile != "" {
+		xeLinks = dp.updateXeLinks(cards)
+	}
+
+	var pciePaths map[string][]string
+	if dp.options.pcieLocality {
+		pciePaths = dp.updatePciePaths(cards)
+	}
+
+	dp.topologyLock.Lock()
+	dp.numaNodes = numaNodes
+	dp.xeLinks = xeLinks
+	dp.pciePaths = pciePaths
+	dp.topologyLock.Unlock()
+
+	dp.healthLock.Lock()
+	dp.healthCards = cards
+	dp.healthLock.Unlock()
+
+	// There is a single monitoring resource per KMD. On nodes with GPUs
+	// bound to both i915 and xe, each gives access to all the Intel GPUs,
+	// as monitoring tools are not limited to the GPUs of one KMD.
+	for resourceName := range monitorResources {
+		deviceInfo := dpapi.NewDeviceInfo(pluginapi.Healthy, monitorSpecs, monitorMounts, nil, nil, nil)
+		devTree.AddDevice(resourceName, monitorID, deviceInfo)
 	}
 
 	if dp.resMan != nil {
@@ -617,25 +1087,101 @@ func (dp *devicePlugin) scan() (dpapi.DeviceTree, error) {
 	return devTree, nil
 }
 
+// Implement the PostAllocator interface.
+func (dp *devicePlugin) PostAllocate(response *pluginapi.AllocateResponse) error {
+	for _, cresp := range response.GetContainerResponses() {
+		if _, ok := cresp.Envs[memoryUnitEnv]; ok {
+			dp.setMemoryEnvs(cresp)
+		}
+
+		if _, ok := cresp.Envs[millicoreUnitEnv]; ok {
+			dp.setMillicoreEnvs(cresp)
+		}
+
+		if dp.options.deviceSelectorEnvs {
+			dp.setDeviceSelectorEnvs(cresp)
+		} else {
+			setTileAffinityMask(cresp)
+		}
+
+		dedupeResponse(cresp)
+
+		// Responses without CDI devices (monitoring resource, failed CDI spec
+		// writes) keep the device specs and mounts.
+		if dp.options.cdiMode == "" || dp.options.cdiMode == cdiModeBoth || len(cresp.CDIDevices) == 0 {
+			continue
+		}
+
+		cresp.Devices, cresp.Mounts = nil, nil
+
+		if dp.options.cdiMode != cdiModeAnnotations {
+			continue
+		}
+
+		names := make([]string, 0, len(cresp.CDIDevices))
+		for _, dev := range cresp.CDIDevices {
+			names = append(names, dev.Name)
+		}
+
+		annotations, err := cdi.UpdateAnnotations(cresp.Annotations, cdiAnnotationPlugin, cdiAnnotationDeviceID, names)
+		if err != nil {
+			return errors.Wrap(err, "CDI device annotation failed")
+		}
+
+		cresp.Annotations = annotations
+		cresp.CDIDevices = nil
+	}
+
+	return nil
+}
+
 func (dp *devicePlugin) Allocate(request *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
 	if dp.resMan != nil {
 		return dp.resMan.CreateFractionalResourceResponse(request)
 	}
 
+	if dp.options.trackUsage {
+		dp.recordUsage(request, time.Now())
+	}
+
 	return nil, &dpapi.UseDefaultMethodError{}
 }
 
 func main() {
 	var (
-		opts cliOptions
+		opts              cliOptions
+		allowIDs, denyIDs string
+		err               error
 	)
 
 	flag.StringVar(&prefix, "prefix", "", "Prefix for devfs & sysfs paths")
 	flag.BoolVar(&opts.enableMonitoring, "enable-monitoring", false, "whether to enable '*_monitoring' (= all GPUs) resource")
+	flag.DurationVar(&opts.scanPeriod, "scan-period", scanPeriod, "period of GPU device scans, in addition to the scans triggered by device node changes")
+	flag.BoolVar(&opts.healthMonitoring, "health-monitoring", false, "whether to report wedged, driver unbound and repeatedly reset GPUs as unhealthy")
 	flag.BoolVar(&opts.resourceManagement, "resource-manager", false, "fractional GPU resource management")
+	flag.BoolVar(&opts.nodeLabels, "node-labels", false, "whether to write GPU node labels to NFD feature file, also without resource manager")
+	flag.StringVar(&opts.devicePermissions, "device-permissions", defaultDevicePermissions, "device cgroup permissions (combination of r, w and m) of the GPU device nodes given to containers")
+	flag.StringVar(&opts.monitorPermissions, "monitoring-permissions", defaultDevicePermissions, "device cgroup permissions (combination of r, w and m) of the GPU device nodes given to the monitoring resource containers")
+	flag.BoolVar(&opts.renderNodesOnly, "render-nodes-only", false, "whether to give containers only the GPU render nodes, without the primary (card) nodes")
 	flag.IntVar(&opts.sharedDevNum, "shared-dev-num", 1, "number of containers sharing the same GPU device")
-	flag.StringVar(&opts.preferredAllocationPolicy, "allocation-policy", "none", "modes of allocating GPU devices: balanced, packed and none")
+	flag.StringVar(&opts.preferredAllocationPolicy, "allocation-policy", "none", "modes of allocating GPU devices: "+strings.Join(allocationPolicies(), ", "))
+	flag.StringVar(&allowIDs, "allow-ids", "", "comma separated list of PCI device IDs (e.g. 0x56c0) of the GPUs to advertise, others are skipped")
+	flag.StringVar(&denyIDs, "deny-ids", "", "comma separated list of PCI device IDs (e.g. 0x46a6) of the GPUs to skip")
 	flag.StringVar(&opts.fakedriSpec, "fakedri-spec", "", "pass fakedri specification in Yaml format")
+	flag.BoolVar(&opts.tileResources, "tile-resources", false, "whether to enable '*_tile' (= GPU tile) resources")
+	flag.IntVar(&opts.memoryUnit, "memory-unit", 0, "GPU memory resource unit in MiB, 0 disables the '*_memory' resource")
+	flag.IntVar(&opts.millicoreUnit, "millicore-unit", 0, "GPU millicore resource unit, 0 disables the '*_millicores' resource with 1000 millicores per GPU")
+	flag.BoolVar(&opts.trackUsage, "track-usage", false, "track GPU device usage of all GPU resources, reconciled with kubelet PodResources API, for balanced allocation policy")
+	flag.StringVar(&opts.releaseCleanup, "release-cleanup", cleanupNone, "cleanup of GPUs released by all containers, requires -track-usage: none, reset (PCI function reset) or path of a cleanup command run with GPU card name and PCI address arguments")
+	flag.StringVar(&opts.checkpointFile, "checkpoint-file", "", "file for persisting GPU device usage over plugin restarts, requires -track-usage")
+	flag.BoolVar(&opts.deviceSelectorEnvs, "device-selector-envs", false, "whether to limit Level Zero workloads to the allocated GPUs and tiles with node-wide device indexes, for containers seeing also other GPUs")
+	flag.StringVar(&opts.xeLinkFile, "xe-link-file", "", "NFD feature label file with xe-links labels (e.g. from XPU Manager sidecar), for allocating multiple GPUs from Xe Link connected ones")
+	flag.BoolVar(&opts.pcieLocality, "pcie-locality", false, "whether to allocate multiple GPUs from ones behind the same PCIe switch, root port or root complex, when possible")
+	flag.StringVar(&opts.levelZeroSocket, "levelzero-socket", "", "unix socket of a Level Zero service (e.g. sidecar) for GPU memory sizes and node labels")
+	flag.StringVar(&opts.familyResources, "family-resources", familyResourcesNone, "modes of advertising GPU family resources (flex, max, arc): none, alongside (the driver resource) and instead (of the driver resource)")
+	flag.StringVar(&opts.resourceNamespace, "resource-namespace", namespace, "namespace of the advertised GPU resources")
+	flag.StringVar(&opts.resourcePrefix, "resource-prefix", "", "prefix for the advertised GPU resource names, e.g. 'test-' for '<namespace>/test-i915'")
+	flag.StringVar(&opts.cdiMode, "cdi-mode", cdiModeBoth, "modes of passing allocated GPU devices to container runtime: both (device specs and CDI devices), devices (CDI devices) and annotations (CDI annotations)")
 	flag.Parse()
 
 	fakedriSpec := opts.fakedriSpec
@@ -662,9 +1208,119 @@ func main() {
 		os.Exit(1)
 	}
 
+	if opts.memoryUnit < 0 {
+		klog.Error("GPU memory resource unit cannot be negative")
+		os.Exit(1)
+	}
+
+	if opts.memoryUnit > 0 && opts.resourceManagement {
+		klog.Error("GPU memory resources are not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.millicoreUnit < 0 || opts.millicoreUnit > millicoresPerCard {
+		klog.Errorf("GPU millicore resource unit must be between 0 and %d", millicoresPerCard)
+		os.Exit(1)
+	}
+
+	if opts.millicoreUnit > 0 && opts.resourceManagement {
+		klog.Error("GPU millicore resources are not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.tileResources && opts.resourceManagement {
+		klog.Error("GPU tile resources are not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.allowIDs, err = parsePciDeviceIDs(allowIDs); err != nil {
+		klog.Error("invalid value for allow-ids: ", err)
+		os.Exit(1)
+	}
+
+	if opts.denyIDs, err = parsePciDeviceIDs(denyIDs); err != nil {
+		klog.Error("invalid value for deny-ids: ", err)
+		os.Exit(1)
+	}
+
+	// Validate the longest resource name, the others have the same namespace and prefix.
+	if errs := validation.IsQualifiedName(opts.resourceNamespace + "/" + opts.resourcePrefix + deviceTypeI915 + monitorSuffix); len(errs) > 0 {
+		klog.Error("invalid value for resource-namespace or resource-prefix: ", strings.Join(errs, ", "))
+		os.Exit(1)
+	}
+
 	var str = opts.preferredAllocationPolicy
-	if !(str == "balanced" || str == "packed" || str == "none") {
-		klog.Error("invalid value for preferredAllocationPolicy, the valid values: balanced, packed, none")
+	if !slices.Contains(allocationPolicies(), str) {
+		klog.Error("invalid value for preferredAllocationPolicy, the valid values: ", strings.Join(allocationPolicies(), ", "))
+		os.Exit(1)
+	}
+
+	str = opts.cdiMode
+	if !(str == cdiModeBoth || str == cdiModeDevices || str == cdiModeAnnotations) {
+		klog.Error("invalid value for cdiMode, the valid values: both, devices, annotations")
+		os.Exit(1)
+	}
+
+	str = opts.familyResources
+	if !(str == familyResourcesNone || str == familyResourcesAlongside || str == familyResourcesInstead) {
+		klog.Error("invalid value for familyResources, the valid values: none, alongside, instead")
+		os.Exit(1)
+	}
+
+	if opts.familyResources != familyResourcesNone && opts.resourceManagement {
+		klog.Error("GPU family resources are not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.cdiMode != cdiModeBoth && opts.resourceManagement {
+		klog.Error("CDI-only modes are not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.trackUsage && opts.resourceManagement {
+		klog.Error("GPU device usage tracking is not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.releaseCleanup != cleanupNone && !opts.trackUsage {
+		klog.Error("GPU release cleanup requires GPU device usage tracking (-track-usage)")
+		os.Exit(1)
+	}
+
+	for _, permissions := range []string{opts.devicePermissions, opts.monitorPermissions} {
+		if !isValidDevicePermissions(permissions) {
+			klog.Errorf("Invalid device permissions: '%s'", permissions)
+			os.Exit(1)
+		}
+	}
+
+	if opts.scanPeriod <= 0 {
+		klog.Errorf("Invalid scan period: %v", opts.scanPeriod)
+		os.Exit(1)
+	}
+
+	if opts.checkpointFile != "" && !opts.trackUsage {
+		klog.Error("GPU device usage checkpoint requires GPU device usage tracking (-track-usage)")
+		os.Exit(1)
+	}
+
+	if (opts.resourceNamespace != namespace || opts.resourcePrefix != "") && opts.resourceManagement {
+		klog.Error("Custom GPU resource names are not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.deviceSelectorEnvs && opts.resourceManagement {
+		klog.Error("Device selector envs are not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.xeLinkFile != "" && opts.resourceManagement {
+		klog.Error("Xe Link topology file is not supported with fractional resource management")
+		os.Exit(1)
+	}
+
+	if opts.pcieLocality && opts.resourceManagement {
+		klog.Error("PCIe locality aware allocation is not supported with fractional resource management")
 		os.Exit(1)
 	}
 
@@ -672,7 +1328,7 @@ func main() {
 
 	plugin := newDevicePlugin(prefix+sysfsDrmDirectory, prefix+devfsDriDirectory, opts)
 
-	if plugin.options.resourceManagement {
+	if plugin.options.resourceManagement || plugin.options.nodeLabels {
 		// Start labeler to export labels file for NFD.
 		nfdFeatureFile := path.Join(nfdFeatureDir, resourceFilename)
 
@@ -680,9 +1336,13 @@ func main() {
 
 		// Labeler catches OS signals and calls os.Exit() after receiving any.
 		go labeler.Run(prefix+sysfsDrmDirectory, nfdFeatureFile,
-			labelerMaxInterval, plugin.scanResources)
+			labelerMaxInterval, plugin.scanResources, plugin.levelZeroClient, plugin.options.xeLinkFile)
+	}
+
+	if plugin.options.trackUsage {
+		go plugin.trackUsage()
 	}
 
-	manager := dpapi.NewManager(namespace, plugin)
+	manager := dpapi.NewManager(plugin.options.resourceNamespace, plugin)
 	manager.Run()
 }
@@ -15,19 +15,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
+	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
+	"google.golang.org/grpc"
 	"k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
 	"k8s.io/utils/strings/slices"
 
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/gpu_plugin/policy"
 	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/gpu_plugin/rm"
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/pluginutils"
 	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
 	cdispec "tags.cncf.io/container-device-interface/specs-go"
 )
@@ -39,18 +48,29 @@ func init() {
 // mockNotifier implements Notifier interface.
 type mockNotifier struct {
 	scanDone         chan bool
+	resourcePrefix   string
 	i915Count        int
 	xeCount          int
 	i915monitorCount int
 	xeMonitorCount   int
+	xeMemoryCount    int
+	i915MemoryCount  int
+	i915TileCount    int
+	i915Millicores   int
+	flexCount        int
 }
 
 // Notify stops plugin Scan.
 func (n *mockNotifier) Notify(newDeviceTree dpapi.DeviceTree) {
-	n.xeCount = len(newDeviceTree[deviceTypeXe])
-	n.xeMonitorCount = len(newDeviceTree[deviceTypeXe+monitorSuffix])
-	n.i915Count = len(newDeviceTree[deviceTypeI915])
-	n.i915monitorCount = len(newDeviceTree[deviceTypeDefault+monitorSuffix])
+	n.xeCount = len(newDeviceTree[n.resourcePrefix+deviceTypeXe])
+	n.xeMonitorCount = len(newDeviceTree[n.resourcePrefix+deviceTypeXe+monitorSuffix])
+	n.xeMemoryCount = len(newDeviceTree[n.resourcePrefix+deviceTypeXe+memorySuffix])
+	n.i915Count = len(newDeviceTree[n.resourcePrefix+deviceTypeI915])
+	n.i915monitorCount = len(newDeviceTree[n.resourcePrefix+deviceTypeDefault+monitorSuffix])
+	n.i915MemoryCount = len(newDeviceTree[n.resourcePrefix+deviceTypeI915+memorySuffix])
+	n.i915TileCount = len(newDeviceTree[n.resourcePrefix+deviceTypeI915+tileSuffix])
+	n.i915Millicores = len(newDeviceTree[n.resourcePrefix+deviceTypeI915+millicoreSuffix])
+	n.flexCount = len(newDeviceTree[n.resourcePrefix+pluginutils.FamilyFlex])
 
 	n.scanDone <- true
 }
@@ -84,9 +104,14 @@ type TestCaseDetails struct {
 	// what the result should be (i915)
 	expectedI915Devs     int
 	expectedI915Monitors int
+	expectedI915Memory   int
+	expectedI915Tiles    int
+	expectedI915Mcores   int
+	expectedFlexDevs     int
 	// what the result should be (xe)
 	expectedXeDevs     int
 	expectedXeMonitors int
+	expectedXeMemory   int
 }
 
 func createTestFiles(root string, tc TestCaseDetails) (string, string, error) {
@@ -188,6 +213,18 @@ func TestGetPreferredAllocation(t *testing.T) {
 		t.Error("Unexpected return value for packed preferred allocation", response.ContainerResponses[0].DeviceIDs)
 	}
 
+	policy.Register("last", policy.Func(func(req *v1beta1.ContainerPreferredAllocationRequest) []string {
+		return req.AvailableDeviceIDs[len(req.AvailableDeviceIDs)-int(req.AllocationSize):]
+	}))
+	t.Cleanup(func() { policy.Unregister("last") })
+
+	plugin = newDevicePlugin("", "", cliOptions{sharedDevNum: 5, resourceManagement: false, preferredAllocationPolicy: "last"})
+	response, _ = plugin.GetPreferredAllocation(rqt)
+
+	if !reflect.DeepEqual(response.ContainerResponses[0].DeviceIDs, rqt.ContainerRequests[0].AvailableDeviceIDs[16:]) {
+		t.Error("Unexpected return value for registered preferred allocation policy", response.ContainerResponses[0].DeviceIDs)
+	}
+
 	plugin = newDevicePlugin("", "", cliOptions{sharedDevNum: 5, resourceManagement: false, preferredAllocationPolicy: "none"})
 	response, _ = plugin.GetPreferredAllocation(rqtErr)
 
@@ -206,20 +243,734 @@ func TestGetPreferredAllocation(t *testing.T) {
 	}
 }
 
-func TestAllocate(t *testing.T) {
-	plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 2, resourceManagement: false})
-
-	_, err := plugin.Allocate(&v1beta1.AllocateRequest{})
-	if _, ok := err.(*dpapi.UseDefaultMethodError); !ok {
-		t.Errorf("Unexpected return value: %+v", err)
+func TestNumaPolicy(t *testing.T) {
+	plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 1, preferredAllocationPolicy: "numa"})
+	plugin.numaNodes = map[string]int{"card0": 0, "card1": 0, "card2": 1, "card3": 1, "card4": 1, "card5": -1}
+
+	available := []string{"card0-0", "card1-0", "card2-0", "card3-0", "card4-0", "card5-0"}
+
+	tcases := []struct {
+		name        string
+		mustInclude []string
+		expected    []string
+		size        int32
+	}{
+		{
+			name:     "fits to the smaller NUMA node",
+			size:     2,
+			expected: []string{"card0-0", "card1-0"},
+		},
+		{
+			name:     "fits only to the larger NUMA node",
+			size:     3,
+			expected: []string{"card2-0", "card3-0", "card4-0"},
+		},
+		{
+			name:     "does not fit to one NUMA node",
+			size:     4,
+			expected: nil,
+		},
+		{
+			name:        "required device on the larger NUMA node",
+			mustInclude: []string{"card2-0"},
+			size:        2,
+			expected:    []string{"card2-0", "card3-0"},
+		},
+		{
+			name:        "required device on a NUMA node not fitting the request",
+			mustInclude: []string{"card0-0"},
+			size:        3,
+			expected:    []string{"card0-0", "card1-0", "card2-0"},
+		},
+		{
+			name:        "required devices on both NUMA nodes",
+			mustInclude: []string{"card0-0", "card3-0", "card4-0"},
+			size:        4,
+			expected:    []string{"card0-0", "card2-0", "card3-0", "card4-0"},
+		},
+	}
+
+	for _, tc := range tcases {
+		response, err := plugin.GetPreferredAllocation(&v1beta1.PreferredAllocationRequest{
+			ContainerRequests: []*v1beta1.ContainerPreferredAllocationRequest{
+				{AvailableDeviceIDs: slices.Clone(available), MustIncludeDeviceIDs: tc.mustInclude, AllocationSize: tc.size},
+			},
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %+v", tc.name, err)
+		}
+
+		deviceIDs := response.ContainerResponses[0].DeviceIDs
+		sort.Strings(deviceIDs)
+
+		if len(deviceIDs) != int(tc.size) || (tc.expected != nil && !reflect.DeepEqual(deviceIDs, tc.expected)) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, deviceIDs)
+		}
+	}
+}
+
+func TestXeLinkPolicy(t *testing.T) {
+	labelFile := path.Join(t.TempDir(), "xpum-sidecar-labels.txt")
+	labels := "gpu.intel.com/xe-links=0.0-1.0_0.0-2.0_0.1-1\ngpu.intel.com/xe-links2=Z.1_1.0-2.0_2.1-3.0\n"
+
+	if err := os.WriteFile(labelFile, []byte(labels), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 2, preferredAllocationPolicy: "none", xeLinkFile: labelFile})
+	plugin.xeLinks = plugin.updateXeLinks([]string{"card3", "card2", "card10", "card1", "card0"})
+
+	all := []string{"card0-0", "card0-1", "card1-0", "card1-1", "card2-0", "card2-1", "card3-0", "card3-1"}
+
+	tcases := []struct {
+		name        string
+		available   []string
+		mustInclude []string
+		expected    []string
+		size        int32
+	}{
+		{
+			name:      "fully connected GPUs",
+			available: all,
+			size:      3,
+			expected:  []string{"card0-0", "card1-0", "card2-0"},
+		},
+		{
+			name:        "GPUs connected to required device",
+			available:   all,
+			mustInclude: []string{"card3-1"},
+			size:        2,
+			expected:    []string{"card2-0", "card3-1"},
+		},
+		{
+			name:      "no fully connected GPUs",
+			available: all,
+			size:      4,
+			expected:  nil,
+		},
+		{
+			name:      "no connected GPUs available",
+			available: []string{"card0-0", "card0-1", "card3-0", "card3-1"},
+			size:      2,
+			expected:  nil,
+		},
+	}
+
+	for _, tc := range tcases {
+		response, err := plugin.GetPreferredAllocation(&v1beta1.PreferredAllocationRequest{
+			ContainerRequests: []*v1beta1.ContainerPreferredAllocationRequest{
+				{AvailableDeviceIDs: slices.Clone(tc.available), MustIncludeDeviceIDs: tc.mustInclude, AllocationSize: tc.size},
+			},
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %+v", tc.name, err)
+		}
+
+		deviceIDs := response.ContainerResponses[0].DeviceIDs
+		sort.Strings(deviceIDs)
+
+		if len(deviceIDs) != int(tc.size) || (tc.expected != nil && !reflect.DeepEqual(deviceIDs, tc.expected)) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, deviceIDs)
+		}
+	}
+}
+
+func TestPcieLocalityPolicy(t *testing.T) {
+	sysfs := t.TempDir()
+
+	if err := os.Symlink("../../devices/pci0000:00/0000:00:01.0/0000:01:00.0/0000:02:01.0/0000:03:00.0/drm/card0", path.Join(sysfs, "card0")); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := newDevicePlugin(sysfs, "", cliOptions{sharedDevNum: 1, preferredAllocationPolicy: "none", pcieLocality: true})
+	plugin.pciePaths = plugin.updatePciePaths([]string{"card0", "card9"})
+
+	if expected := map[string][]string{
+		"card0": {"pci0000:00", "0000:00:01.0", "0000:01:00.0", "0000:02:01.0", "0000:03:00.0"},
+	}; !reflect.DeepEqual(plugin.pciePaths, expected) {
+		t.Fatalf("expected PCI paths %v, got %v", expected, plugin.pciePaths)
+	}
+
+	// card0 and card1 are behind the same PCIe switch, card2 behind another
+	// root port of the same root complex, card3 and card4 in another one.
+	plugin.pciePaths["card1"] = []string{"pci0000:00", "0000:00:01.0", "0000:01:00.0", "0000:02:02.0", "0000:04:00.0"}
+	plugin.pciePaths["card2"] = []string{"pci0000:00", "0000:00:02.0", "0000:05:00.0"}
+	plugin.pciePaths["card3"] = []string{"pci0000:80", "0000:80:01.0", "0000:81:00.0"}
+	plugin.pciePaths["card4"] = []string{"pci0000:80", "0000:80:02.0", "0000:82:00.0"}
+
+	all := []string{"card0-0", "card1-0", "card2-0", "card3-0", "card4-0"}
+
+	tcases := []struct {
+		name        string
+		available   []string
+		mustInclude []string
+		expected    []string
+		size        int32
+	}{
+		{
+			name:      "GPUs behind the same PCIe switch",
+			available: all,
+			size:      2,
+			expected:  []string{"card0-0", "card1-0"},
+		},
+		{
+			name:      "GPUs in the same root complex",
+			available: all,
+			size:      3,
+			expected:  []string{"card0-0", "card1-0", "card2-0"},
+		},
+		{
+			name:        "GPUs close to required device",
+			available:   all,
+			mustInclude: []string{"card4-0"},
+			size:        2,
+			expected:    []string{"card3-0", "card4-0"},
+		},
+		{
+			name:        "closest GPU to required device",
+			available:   []string{"card0-0", "card2-0", "card3-0"},
+			mustInclude: []string{"card2-0"},
+			size:        2,
+			expected:    []string{"card0-0", "card2-0"},
+		},
+		{
+			name:      "no GPUs in the same root complex",
+			available: all,
+			size:      4,
+			expected:  nil,
+		},
+	}
+
+	for _, tc := range tcases {
+		response, err := plugin.GetPreferredAllocation(&v1beta1.PreferredAllocationRequest{
+			ContainerRequests: []*v1beta1.ContainerPreferredAllocationRequest{
+				{AvailableDeviceIDs: slices.Clone(tc.available), MustIncludeDeviceIDs: tc.mustInclude, AllocationSize: tc.size},
+			},
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %+v", tc.name, err)
+		}
+
+		deviceIDs := response.ContainerResponses[0].DeviceIDs
+		sort.Strings(deviceIDs)
+
+		if len(deviceIDs) != int(tc.size) || (tc.expected != nil && !reflect.DeepEqual(deviceIDs, tc.expected)) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, deviceIDs)
+		}
+	}
+}
+
+// mockPodResources lists the given pod resources.
+type mockPodResources struct {
+	podresourcesv1.PodResourcesListerClient
+	resources []*podresourcesv1.PodResources
+}
+
+func (m *mockPodResources) List(context.Context, *podresourcesv1.ListPodResourcesRequest, ...grpc.CallOption) (*podresourcesv1.ListPodResourcesResponse, error) {
+	return &podresourcesv1.ListPodResourcesResponse{PodResources: m.resources}, nil
+}
+
+func TestReconcileUsage(t *testing.T) {
+	plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 2, preferredAllocationPolicy: "balanced", trackUsage: true})
+	now := time.Now()
+
+	plugin.recordUsage(&v1beta1.AllocateRequest{
+		ContainerRequests: []*v1beta1.ContainerAllocateRequest{{DevicesIDs: []string{"card1-tile-0"}}},
+	}, now.Add(-time.Minute))
+	plugin.recordUsage(&v1beta1.AllocateRequest{
+		ContainerRequests: []*v1beta1.ContainerAllocateRequest{{DevicesIDs: []string{"card0-mem-0", "card0-mem-1", "all"}}},
+	}, now)
+
+	client := &mockPodResources{
+		resources: []*podresourcesv1.PodResources{{
+			Name: "pod", Namespace: "default",
+			Containers: []*podresourcesv1.ContainerResources{{
+				Name: "container",
+				Devices: []*podresourcesv1.ContainerDevices{
+					{ResourceName: "gpu.intel.com/i915_memory", DeviceIds: []string{"card0-mem-0"}},
+					{ResourceName: "gpu.intel.com/i915_monitoring", DeviceIds: []string{"all"}},
+					{ResourceName: "example.com/device", DeviceIds: []string{"card9-0"}},
+				},
+			}},
+		}},
+	}
+
+	released, err := plugin.reconcileUsage(client, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	if expected := []string{"card1"}; !reflect.DeepEqual(released, expected) {
+		t.Errorf("Expected %v to be released, got %v", expected, released)
+	}
+
+	// Listed and just allocated devices are in use, the released tile is not.
+	inUse := []string{}
+	for deviceID := range plugin.inUse {
+		inUse = append(inUse, deviceID)
+	}
+
+	sort.Strings(inUse)
+
+	if expected := []string{"card0-mem-0", "card0-mem-1"}; !reflect.DeepEqual(inUse, expected) {
+		t.Errorf("Expected %v in use, got %v", expected, inUse)
+	}
+
+	response, err := plugin.GetPreferredAllocation(&v1beta1.PreferredAllocationRequest{
+		ContainerRequests: []*v1beta1.ContainerPreferredAllocationRequest{
+			{AvailableDeviceIDs: []string{"card0-0", "card0-1", "card1-0", "card1-1"}, AllocationSize: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	// card0 memory is in use, so card1 is less used.
+	if deviceIDs := response.ContainerResponses[0].DeviceIDs; !reflect.DeepEqual(deviceIDs, []string{"card1-0"}) {
+		t.Errorf("Expected card1-0 to be allocated, got %v", deviceIDs)
+	}
+}
+
+func TestUsageCheckpoint(t *testing.T) {
+	checkpointFile := path.Join(t.TempDir(), "gpu", "checkpoint")
+	options := cliOptions{sharedDevNum: 2, trackUsage: true, checkpointFile: checkpointFile}
+	now := time.Now()
+
+	plugin := newDevicePlugin("", "", options)
+	plugin.recordUsage(&v1beta1.AllocateRequest{
+		ContainerRequests: []*v1beta1.ContainerAllocateRequest{{DevicesIDs: []string{"card0-0", "card1-mem-0", "all"}}},
+	}, now)
+
+	// Restarted plugin restores the usage.
+	restarted := newDevicePlugin("", "", options)
+
+	if len(restarted.inUse) != 2 {
+		t.Fatalf("Expected 2 devices in use after restart, got %v", restarted.inUse)
+	}
+
+	for deviceID, allocated := range plugin.inUse {
+		if !restarted.inUse[deviceID].Equal(allocated) {
+			t.Errorf("Expected %s allocated at %v after restart, got %v", deviceID, allocated, restarted.inUse[deviceID])
+		}
+	}
+
+	// Corrupted checkpoint is ignored.
+	data, err := os.ReadFile(checkpointFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	if err = os.WriteFile(checkpointFile, bytes.Replace(data, []byte("card0-0"), []byte("card0-1"), 1), 0600); err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	if restarted = newDevicePlugin("", "", options); len(restarted.inUse) != 0 {
+		t.Errorf("Expected no devices in use from corrupted checkpoint, got %v", restarted.inUse)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	root := t.TempDir()
+	sysfs := filepath.Join(root, "class/drm")
+	device := filepath.Join(root, "devices/pci0000:00/0000:03:00.0")
+
+	if err := os.MkdirAll(filepath.Join(device, "drm/card1/device"), 0750); err != nil {
+		t.Fatalf("Failed to create device dirs: %+v", err)
+	}
+
+	if err := os.MkdirAll(sysfs, 0750); err != nil {
+		t.Fatalf("Failed to create sysfs dir: %+v", err)
+	}
+
+	if err := os.Symlink("../../devices/pci0000:00/0000:03:00.0/drm/card1", filepath.Join(sysfs, "card1")); err != nil {
+		t.Fatalf("Failed to create card link: %+v", err)
+	}
+
+	plugin := newDevicePlugin(sysfs, "", cliOptions{sharedDevNum: 1, trackUsage: true, releaseCleanup: cleanupReset})
+	plugin.cleanupReleased([]string{"card1"})
+
+	reset, err := os.ReadFile(filepath.Join(sysfs, "card1/device/reset"))
+	if err != nil || string(reset) != "1" {
+		t.Errorf("Expected GPU to be reset, got '%s' (%v)", reset, err)
+	}
+
+	// Cleanup command gets the card name and PCI address, and is skipped
+	// for GPUs allocated again.
+	output := filepath.Join(root, "output")
+	command := filepath.Join(root, "cleanup.sh")
+
+	if err = os.WriteFile(command, []byte("#!/bin/sh\necho \"$@\" >> "+output+"\n"), 0700); err != nil {
+		t.Fatalf("Failed to create cleanup command: %+v", err)
+	}
+
+	plugin.options.releaseCleanup = command
+	plugin.recordUsage(&v1beta1.AllocateRequest{
+		ContainerRequests: []*v1beta1.ContainerAllocateRequest{{DevicesIDs: []string{"card2-0"}}},
+	}, time.Now())
+	plugin.cleanupReleased([]string{"card1", "card2"})
+
+	args, err := os.ReadFile(output)
+	if err != nil || string(args) != "card1 0000:03:00.0\n" {
+		t.Errorf("Expected cleanup command args 'card1 0000:03:00.0', got '%s' (%v)", args, err)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 2, resourceManagement: false})
+
+	_, err := plugin.Allocate(&v1beta1.AllocateRequest{})
+	if _, ok := err.(*dpapi.UseDefaultMethodError); !ok {
+		t.Errorf("Unexpected return value: %+v", err)
+	}
+
+	// mock the rm
+	plugin.resMan = &mockResourceManager{}
+
+	_, err = plugin.Allocate(&v1beta1.AllocateRequest{})
+	if _, ok := err.(*dpapi.UseDefaultMethodError); !ok {
+		t.Errorf("Unexpected return value: %+v", err)
+	}
+}
+
+func TestPostAllocate(t *testing.T) {
+	newResponse := func() *v1beta1.AllocateResponse {
+		return &v1beta1.AllocateResponse{
+			ContainerResponses: []*v1beta1.ContainerAllocateResponse{
+				{
+					Devices:    []*v1beta1.DeviceSpec{{HostPath: "/dev/dri/card0"}, {HostPath: "/dev/dri/card1"}},
+					Mounts:     []*v1beta1.Mount{{HostPath: "/dev/dri/by-path/pci-0000:00:02.0-card"}},
+					CDIDevices: []*v1beta1.CDIDevice{{Name: "intel.cdi.k8s.io/gpu=card0"}, {Name: "intel.cdi.k8s.io/gpu=card1"}},
+				},
+				{
+					// Monitoring resource has no CDI devices.
+					Devices: []*v1beta1.DeviceSpec{{HostPath: "/dev/dri/card0"}},
+				},
+			},
+		}
+	}
+
+	for _, mode := range []string{cdiModeBoth, cdiModeDevices, cdiModeAnnotations} {
+		plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 1, cdiMode: mode})
+		response := newResponse()
+
+		if err := plugin.PostAllocate(response); err != nil {
+			t.Fatalf("%s: unexpected error: %+v", mode, err)
+		}
+
+		cresp := response.ContainerResponses[0]
+
+		if (mode == cdiModeBoth) != (len(cresp.Devices) == 2 && len(cresp.Mounts) == 1) {
+			t.Errorf("%s: unexpected device specs %v and mounts %v", mode, cresp.Devices, cresp.Mounts)
+		}
+
+		if (mode == cdiModeAnnotations) != (len(cresp.CDIDevices) == 0) {
+			t.Errorf("%s: unexpected CDI devices %v", mode, cresp.CDIDevices)
+		}
+
+		annotation := cresp.Annotations["cdi.k8s.io/intel.gpu_devices"]
+		if (mode == cdiModeAnnotations) != (annotation == "intel.cdi.k8s.io/gpu=card0,intel.cdi.k8s.io/gpu=card1") {
+			t.Errorf("%s: unexpected CDI annotations %v", mode, cresp.Annotations)
+		}
+
+		if len(response.ContainerResponses[1].Devices) != 1 {
+			t.Errorf("%s: device specs of a response without CDI devices were removed", mode)
+		}
+	}
+}
+
+func TestFitPolicy(t *testing.T) {
+	available := []string{}
+	for i := 0; i < 8; i++ {
+		available = append(available, fmt.Sprintf("card1-mem-%d", i))
+	}
+
+	for i := 0; i < 4; i++ {
+		available = append(available, fmt.Sprintf("card0-mem-%d", i))
+	}
+
+	tcases := []struct {
+		name     string
+		must     []string
+		size     int32
+		expected map[string]int
+	}{
+		{
+			name:     "fits to the fuller GPU",
+			size:     3,
+			expected: map[string]int{"card0": 3},
+		},
+		{
+			name:     "fits only to the emptier GPU",
+			size:     6,
+			expected: map[string]int{"card1": 6},
+		},
+		{
+			name:     "does not fit to one GPU",
+			size:     10,
+			expected: map[string]int{"card1": 8, "card0": 2},
+		},
+		{
+			name:     "must include",
+			must:     []string{"card1-mem-0"},
+			size:     2,
+			expected: map[string]int{"card1": 1, "card0": 1},
+		},
+	}
+
+	for _, tc := range tcases {
+		deviceIDs := fitPolicy(&v1beta1.ContainerPreferredAllocationRequest{
+			AvailableDeviceIDs:   available,
+			MustIncludeDeviceIDs: tc.must,
+			AllocationSize:       tc.size,
+		})
+
+		counts := map[string]int{}
+		for _, deviceID := range deviceIDs {
+			counts[strings.Split(deviceID, "-")[0]]++
+		}
+
+		if !reflect.DeepEqual(counts, tc.expected) {
+			t.Errorf("%s: expected %v IDs per GPU, got %v", tc.name, tc.expected, deviceIDs)
+		}
+	}
+}
+
+func TestPostAllocateMemory(t *testing.T) {
+	cresp := &v1beta1.ContainerAllocateResponse{
+		Envs: map[string]string{memoryUnitEnv: "512"},
+	}
+
+	for i := 0; i < 3; i++ {
+		cresp.Devices = append(cresp.Devices,
+			&v1beta1.DeviceSpec{HostPath: "/dev/dri/card0", ContainerPath: "/dev/dri/card0"},
+			&v1beta1.DeviceSpec{HostPath: "/dev/dri/renderD128", ContainerPath: "/dev/dri/renderD128"})
+		cresp.CDIDevices = append(cresp.CDIDevices, &v1beta1.CDIDevice{Name: "intel.cdi.k8s.io/gpu=card0"})
+	}
+
+	plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 1, memoryUnit: 512})
+
+	if err := plugin.PostAllocate(&v1beta1.AllocateResponse{ContainerResponses: []*v1beta1.ContainerAllocateResponse{cresp}}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if len(cresp.Devices) != 2 || len(cresp.CDIDevices) != 1 {
+		t.Errorf("duplicate devices were not removed: %v, %v", cresp.Devices, cresp.CDIDevices)
+	}
+
+	if cresp.Envs[memoryTotalEnv] != "1536" || cresp.Envs[memoryCardsEnv] != "card0" {
+		t.Errorf("unexpected memory envs: %v", cresp.Envs)
+	}
+}
+
+func TestPostAllocateMillicores(t *testing.T) {
+	cresp := &v1beta1.ContainerAllocateResponse{
+		Envs: map[string]string{millicoreUnitEnv: "100"},
+	}
+
+	for _, card := range []string{"card0", "card0", "card1"} {
+		cresp.Devices = append(cresp.Devices,
+			&v1beta1.DeviceSpec{HostPath: "/dev/dri/" + card, ContainerPath: "/dev/dri/" + card})
+	}
+
+	plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 1, millicoreUnit: 100})
+
+	if err := plugin.PostAllocate(&v1beta1.AllocateResponse{ContainerResponses: []*v1beta1.ContainerAllocateResponse{cresp}}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if len(cresp.Devices) != 2 {
+		t.Errorf("duplicate devices were not removed: %v", cresp.Devices)
+	}
+
+	if cresp.Envs[millicoreTotalEnv] != "300" || cresp.Envs[millicoreCardsEnv] != "card0,card1" {
+		t.Errorf("unexpected millicore envs: %v", cresp.Envs)
+	}
+}
+
+func TestPostAllocateRenderNodesOnly(t *testing.T) {
+	sysfs := t.TempDir()
+
+	for render, card := range map[string]string{"renderD128": "card0", "renderD129": "card1"} {
+		if err := os.MkdirAll(path.Join(sysfs, render, "device/drm", card), 0750); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.MkdirAll(path.Join(sysfs, render, "device/drm", render), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cresp := &v1beta1.ContainerAllocateResponse{
+		Envs: map[string]string{memoryUnitEnv: "512", millicoreUnitEnv: "100"},
+	}
+
+	// Two memory and millicore units of card0, and one of card1.
+	for _, render := range []string{"renderD128", "renderD128", "renderD129"} {
+		cresp.Devices = append(cresp.Devices,
+			&v1beta1.DeviceSpec{HostPath: "/dev/dri/" + render, ContainerPath: "/dev/dri/" + render})
+	}
+
+	plugin := newDevicePlugin(sysfs, "", cliOptions{sharedDevNum: 1, memoryUnit: 512, millicoreUnit: 100, renderNodesOnly: true})
+
+	if err := plugin.PostAllocate(&v1beta1.AllocateResponse{ContainerResponses: []*v1beta1.ContainerAllocateResponse{cresp}}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	for env, expected := range map[string]string{
+		memoryTotalEnv:    "1536",
+		memoryCardsEnv:    "card0,card1",
+		millicoreTotalEnv: "300",
+		millicoreCardsEnv: "card0,card1",
+	} {
+		if cresp.Envs[env] != expected {
+			t.Errorf("expected %s=%s, got %v", env, expected, cresp.Envs)
+		}
+	}
+}
+
+func TestPostAllocateTiles(t *testing.T) {
+	cresp := &v1beta1.ContainerAllocateResponse{
+		Envs: map[string]string{
+			tileEnvPrefix + "card2_1": "2",
+			tileEnvPrefix + "card0_1": "2",
+			tileEnvPrefix + "card0_0": "2",
+		},
+	}
+
+	plugin := newDevicePlugin("", "", cliOptions{sharedDevNum: 1, tileResources: true})
+
+	if err := plugin.PostAllocate(&v1beta1.AllocateResponse{ContainerResponses: []*v1beta1.ContainerAllocateResponse{cresp}}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	expected := map[string]string{levelZeroAffinityMaskEnv: "0,1,3"}
+	if !reflect.DeepEqual(cresp.Envs, expected) {
+		t.Errorf("expected envs %v, got %v", expected, cresp.Envs)
+	}
+}
+
+func TestDeviceSelectorEnvs(t *testing.T) {
+	root := t.TempDir()
+
+	sysfs := path.Join(root, "class/drm")
+
+	// Level Zero enumerates the GPUs in PCI address order: card2, card10
+	// (denied with 2 tiles), card0 (2 tiles) and card1. card3 is not an
+	// Intel GPU.
+	createSymlinks(t, root, []symlinkItem{
+		{"devices/0000:03:00.0", "class/drm/card0/device"},
+		{"devices/0000:04:00.0", "class/drm/card1/device"},
+		{"devices/0000:01:00.0", "class/drm/card2/device"},
+		{"devices/0000:00:02.0", "class/drm/card3/device"},
+		{"devices/0000:02:00.0", "class/drm/card10/device"},
+	})
+	createDirs(t, sysfs, []string{"card0/gt/gt0", "card0/gt/gt1", "card10/device/tile0", "card10/device/tile1"})
+
+	for _, card := range []string{"card0", "card1", "card2", "card3", "card10"} {
+		vendor := vendorString
+		if card == "card3" {
+			vendor = "0x10de"
+		}
+
+		if err := os.WriteFile(path.Join(sysfs, card, "device/vendor"), []byte(vendor+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin := newDevicePlugin(sysfs, "", cliOptions{sharedDevNum: 1, deviceSelectorEnvs: true})
+
+	tcases := []struct {
+		envs     map[string]string
+		expected map[string]string
+		name     string
+	}{
+		{
+			name:     "whole GPUs",
+			envs:     map[string]string{cardEnvPrefix + "card1": "1", cardEnvPrefix + "card0": "1"},
+			expected: map[string]string{levelZeroAffinityMaskEnv: "3,4,5", oneAPIDeviceSelectorEnv: levelZeroDeviceSelector},
+		},
+		{
+			name:     "memory of one GPU",
+			envs:     map[string]string{memoryUnitEnv: "1024", cardEnvPrefix + "card2": "1"},
+			expected: map[string]string{memoryUnitEnv: "1024", levelZeroAffinityMaskEnv: "0", oneAPIDeviceSelectorEnv: levelZeroDeviceSelector},
+		},
+		{
+			name:     "tiles",
+			envs:     map[string]string{tileEnvPrefix + "card10_1": "2", tileEnvPrefix + "card0_0": "2"},
+			expected: map[string]string{levelZeroAffinityMaskEnv: "2,3", oneAPIDeviceSelectorEnv: levelZeroDeviceSelector},
+		},
+		{
+			name:     "whole GPU and its tile",
+			envs:     map[string]string{cardEnvPrefix + "card0": "1", tileEnvPrefix + "card0_1": "1", cardEnvPrefix + "card2": "1"},
+			expected: map[string]string{levelZeroAffinityMaskEnv: "0,3,4", oneAPIDeviceSelectorEnv: levelZeroDeviceSelector},
+		},
+		{
+			name:     "monitoring",
+			envs:     map[string]string{},
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tc := range tcases {
+		cresp := &v1beta1.ContainerAllocateResponse{Envs: tc.envs}
+
+		plugin.setDeviceSelectorEnvs(cresp)
+
+		if !reflect.DeepEqual(cresp.Envs, tc.expected) {
+			t.Errorf("%s: expected envs %v, got %v", tc.name, tc.expected, cresp.Envs)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	root := t.TempDir()
+
+	createSymlinks(t, root, []symlinkItem{{"sys/bus/pci/drivers/i915", "sys/class/drm/card0/device/driver"}})
+	createDirs(t, root, []string{"sys/class/drm/card1/device"})
+
+	plugin := newDevicePlugin(path.Join(root, "sys/class/drm"), path.Join(root, "dev/dri"), cliOptions{sharedDevNum: 1, healthMonitoring: true})
+	plugin.healthCards = []string{"card0", "card1"}
+
+	start := time.Now()
+
+	tcases := []struct {
+		name      string
+		wedged    string
+		resets    int
+		minutes   int
+		changed   bool
+		unhealthy bool
+	}{
+		{name: "resets before monitoring", wedged: "0", resets: 5, changed: true},
+		{name: "two new resets", wedged: "0", resets: 7, minutes: 1},
+		{name: "reset storm", wedged: "0", resets: 8, minutes: 2, changed: true, unhealthy: true},
+		{name: "no resets within window", wedged: "0", resets: 8, minutes: 7, changed: true},
+		{name: "wedged", wedged: "1", resets: 8, minutes: 8, changed: true, unhealthy: true},
 	}
 
-	// mock the rm
-	plugin.resMan = &mockResourceManager{}
+	for _, tc := range tcases {
+		createFiles(t, root, map[string][]byte{
+			"sys/kernel/debug/dri/0/i915_wedged":     []byte(tc.wedged + "\n"),
+			"sys/kernel/debug/dri/0/i915_reset_info": []byte(fmt.Sprintf("full gpu reset = %d\nengine reset = 0\n", tc.resets)),
+		})
 
-	_, err = plugin.Allocate(&v1beta1.AllocateRequest{})
-	if _, ok := err.(*dpapi.UseDefaultMethodError); !ok {
-		t.Errorf("Unexpected return value: %+v", err)
+		if changed := plugin.updateHealth(start.Add(time.Duration(tc.minutes) * time.Minute)); changed != tc.changed {
+			t.Errorf("%s: expected health change %v, got %v", tc.name, tc.changed, changed)
+		}
+
+		expected := v1beta1.Healthy
+		if tc.unhealthy {
+			expected = v1beta1.Unhealthy
+		}
+
+		if health := plugin.cardHealth("card0"); health != expected {
+			t.Errorf("%s: expected card0 to be %s, got %s", tc.name, expected, health)
+		}
+
+		// card1 has no driver bound.
+		if health := plugin.cardHealth("card1"); health != v1beta1.Unhealthy {
+			t.Errorf("%s: expected card1 to be %s, got %s", tc.name, v1beta1.Unhealthy, health)
+		}
 	}
 }
 
@@ -252,6 +1003,24 @@ func TestScan(t *testing.T) {
 			},
 			expectedI915Devs: 1,
 		},
+		{
+			name:      "two devices with allow and deny lists",
+			sysfsdirs: []string{"card0/device/drm/card0", "card1/device/drm/card1", "card2/device/drm/card2"},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor": []byte("0x8086"),
+				"card0/device/device": []byte("0x46a6"),
+				"card1/device/vendor": []byte("0x8086"),
+				"card1/device/device": []byte("0x56C0"),
+				"card2/device/vendor": []byte("0x8086"),
+				"card2/device/device": []byte("0x56c1"),
+			},
+			devfsdirs: []string{"card0", "card1", "card2"},
+			options: cliOptions{
+				allowIDs: []string{"0x46a6", "0x56c0"},
+				denyIDs:  []string{"0x46a6"},
+			},
+			expectedI915Devs: 1,
+		},
 		{
 			name:      "one device with xe driver",
 			sysfsdirs: []string{"card0/device/drm/card0", "card0/device/drm/controlD64"},
@@ -291,6 +1060,26 @@ func TestScan(t *testing.T) {
 			expectedXeDevs:     2,
 			expectedXeMonitors: 1,
 		},
+		{
+			name: "two-tile device with xe driver, 2 shares and 1 GiB memory units",
+			sysfsdirs: []string{
+				"card0/device/drm/card0",
+				"card0/device/tile0/gt0",
+				"card0/device/tile1/gt1",
+			},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor":                         []byte("0x8086"),
+				"card0/device/tile0/physical_vram_size_bytes": []byte("2147483648"),
+				"card0/device/tile1/physical_vram_size_bytes": []byte("2147483648"),
+			},
+			symlinkfiles: map[string]string{
+				"card0/device/driver": "drivers/xe",
+			},
+			devfsdirs:        []string{"card0"},
+			options:          cliOptions{sharedDevNum: 2, memoryUnit: 1024},
+			expectedXeDevs:   2,
+			expectedXeMemory: 4,
+		},
 		{
 			name:      "two devices with xe and i915 drivers",
 			sysfsdirs: []string{"card0/device/drm/card0", "card0/device/drm/controlD64", "card1/device/drm/card1"},
@@ -372,6 +1161,90 @@ func TestScan(t *testing.T) {
 			expectedI915Devs:     26,
 			expectedI915Monitors: 1,
 		},
+		{
+			name: "two devices with 1 GiB memory units",
+			sysfsdirs: []string{
+				"card0/device/drm/card0",
+				"card1/device/drm/card1",
+			},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor":    []byte("0x8086"),
+				"card0/lmem_total_bytes": []byte("4294967296"),
+				"card1/device/vendor":    []byte("0x8086"),
+			},
+			devfsdirs:          []string{"card0", "card1"},
+			options:            cliOptions{memoryUnit: 1024},
+			expectedI915Devs:   2,
+			expectedI915Memory: 4,
+		},
+		{
+			name:      "two devices with 250 millicore units",
+			sysfsdirs: []string{"card0/device/drm/card0", "card1/device/drm/card1"},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor": []byte("0x8086"),
+				"card1/device/vendor": []byte("0x8086"),
+			},
+			devfsdirs:          []string{"card0", "card1"},
+			options:            cliOptions{millicoreUnit: 250},
+			expectedI915Devs:   2,
+			expectedI915Mcores: 8,
+		},
+		{
+			name: "two-tile and one-tile devices with tile resources",
+			sysfsdirs: []string{
+				"card0/device/drm/card0",
+				"card0/gt/gt0",
+				"card0/gt/gt1",
+				"card1/device/drm/card1",
+			},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor": []byte("0x8086"),
+				"card1/device/vendor": []byte("0x8086"),
+			},
+			devfsdirs:         []string{"card0", "card1"},
+			options:           cliOptions{tileResources: true},
+			expectedI915Devs:  2,
+			expectedI915Tiles: 3,
+		},
+		{
+			name:      "flex and integrated GPU with family resources instead of driver resource",
+			sysfsdirs: []string{"card0/device/drm/card0", "card1/device/drm/card1"},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor": []byte("0x8086"),
+				"card0/device/device": []byte("0x46a6"),
+				"card1/device/vendor": []byte("0x8086"),
+				"card1/device/device": []byte("0x56c0"),
+			},
+			devfsdirs:        []string{"card0", "card1"},
+			options:          cliOptions{sharedDevNum: 2, familyResources: familyResourcesInstead},
+			expectedI915Devs: 2,
+			expectedFlexDevs: 2,
+		},
+		{
+			name:      "flex GPU with family resources alongside driver resource",
+			sysfsdirs: []string{"card0/device/drm/card0"},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor": []byte("0x8086"),
+				"card0/device/device": []byte("0x56C0"),
+			},
+			devfsdirs:        []string{"card0"},
+			options:          cliOptions{familyResources: familyResourcesAlongside},
+			expectedI915Devs: 1,
+			expectedFlexDevs: 1,
+		},
+		{
+			name:      "flex GPU with resource name prefix + family resources + monitoring",
+			sysfsdirs: []string{"card0/device/drm/card0"},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor": []byte("0x8086"),
+				"card0/device/device": []byte("0x56c0"),
+			},
+			devfsdirs:            []string{"card0"},
+			options:              cliOptions{resourcePrefix: "test-", familyResources: familyResourcesAlongside, enableMonitoring: true},
+			expectedI915Devs:     1,
+			expectedI915Monitors: 1,
+			expectedFlexDevs:     1,
+		},
 		{
 			name:      "wrong vendor",
 			sysfsdirs: []string{"card0/device/drm/card0"},
@@ -416,7 +1289,8 @@ func TestScan(t *testing.T) {
 			plugin := newDevicePlugin(sysfs, devfs, tc.options)
 
 			notifier := &mockNotifier{
-				scanDone: plugin.scanDone,
+				scanDone:       plugin.scanDone,
+				resourcePrefix: tc.options.resourcePrefix,
 			}
 
 			err = plugin.Scan(notifier)
@@ -440,10 +1314,180 @@ func TestScan(t *testing.T) {
 				t.Errorf("Expected %d, discovered %d monitors (XE)",
 					tc.expectedXeMonitors, notifier.xeMonitorCount)
 			}
+			if tc.expectedXeMemory != notifier.xeMemoryCount {
+				t.Errorf("Expected %d, discovered %d memory units (XE)",
+					tc.expectedXeMemory, notifier.xeMemoryCount)
+			}
+			if tc.expectedI915Mcores != notifier.i915Millicores {
+				t.Errorf("Expected %d, discovered %d millicore units (i915)",
+					tc.expectedI915Mcores, notifier.i915Millicores)
+			}
+			if tc.expectedI915Memory != notifier.i915MemoryCount {
+				t.Errorf("Expected %d, discovered %d memory units (i915)",
+					tc.expectedI915Memory, notifier.i915MemoryCount)
+			}
+			if tc.expectedI915Tiles != notifier.i915TileCount {
+				t.Errorf("Expected %d, discovered %d tiles (i915)",
+					tc.expectedI915Tiles, notifier.i915TileCount)
+			}
+			if tc.expectedFlexDevs != notifier.flexCount {
+				t.Errorf("Expected %d, discovered %d devices (flex)",
+					tc.expectedFlexDevs, notifier.flexCount)
+			}
 		})
 	}
 }
 
+// hotplugNotifier passes the i915 device counts of the scans to the test.
+type hotplugNotifier struct {
+	counts chan int
+}
+
+func (n *hotplugNotifier) Notify(newDeviceTree dpapi.DeviceTree) {
+	n.counts <- len(newDeviceTree[deviceTypeI915])
+}
+
+func TestHotplug(t *testing.T) {
+	tc := TestCaseDetails{
+		sysfsdirs:    []string{"card0/device/drm/card0"},
+		sysfsfiles:   map[string][]byte{"card0/device/vendor": []byte("0x8086")},
+		symlinkfiles: map[string]string{"card0/device/driver": "drivers/i915"},
+		devfsdirs:    []string{"card0"},
+	}
+
+	sysfs, devfs, err := createTestFiles(t.TempDir(), tc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	plugin := newDevicePlugin(sysfs, devfs, cliOptions{sharedDevNum: 1})
+	notifier := &hotplugNotifier{counts: make(chan int, 1)}
+	scanErr := make(chan error, 1)
+
+	go func() {
+		scanErr <- plugin.Scan(notifier)
+	}()
+
+	// Scans need to be triggered by the devfs changes, not by the scan period.
+	expectScan := func(step string, expected int) {
+		select {
+		case count := <-notifier.counts:
+			if count != expected {
+				t.Errorf("%s: expected %d devices, got %d", step, expected, count)
+			}
+		case <-time.After(scanPeriod / 2):
+			t.Fatalf("%s: no scan", step)
+		}
+	}
+
+	expectScan("initial scan", 1)
+
+	createDirs(t, sysfs, []string{"card1/device/drm/card1"})
+	createFiles(t, sysfs, map[string][]byte{"card1/device/vendor": []byte("0x8086")})
+	createSymlinks(t, sysfs, []symlinkItem{{"drivers/i915", "card1/device/driver"}})
+	createDirs(t, devfs, []string{"card1"})
+
+	expectScan("GPU added", 2)
+
+	if err = os.RemoveAll(path.Join(sysfs, "card1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.RemoveAll(path.Join(devfs, "card1")); err != nil {
+		t.Fatal(err)
+	}
+
+	expectScan("GPU removed", 1)
+
+	plugin.scanDone <- true
+
+	if err = <-scanErr; err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+}
+
+func TestScanPeriod(t *testing.T) {
+	tc := TestCaseDetails{
+		sysfsdirs:    []string{"card0/device/drm/card0"},
+		sysfsfiles:   map[string][]byte{"card0/device/vendor": []byte("0x8086")},
+		symlinkfiles: map[string]string{"card0/device/driver": "drivers/i915"},
+	}
+
+	sysfs, devfs, err := createTestFiles(t.TempDir(), tc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	// devfs DRI dir is created only after plugin start.
+	if err = os.RemoveAll(devfs); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := newDevicePlugin(sysfs, devfs, cliOptions{sharedDevNum: 1, scanPeriod: 10 * time.Millisecond})
+	notifier := &hotplugNotifier{counts: make(chan int, 1)}
+	scanErr := make(chan error, 1)
+
+	go func() {
+		scanErr <- plugin.Scan(notifier)
+	}()
+
+	if count := <-notifier.counts; count != 0 {
+		t.Errorf("Expected no devices without devfs, got %d", count)
+	}
+
+	createDirs(t, devfs, []string{"card0"})
+
+	// Periodic scans find the device well before the default scan period.
+	timeout := time.After(scanPeriod / 2)
+
+	for count := 0; count != 1; {
+		select {
+		case count = <-notifier.counts:
+		case <-timeout:
+			t.Fatal("No periodic scan found the device")
+		}
+	}
+
+	plugin.scanDone <- true
+
+	for {
+		select {
+		case err = <-scanErr:
+			if err != nil {
+				t.Errorf("Unexpected error: %+v", err)
+			}
+
+			return
+		case <-notifier.counts:
+		}
+	}
+}
+
+func TestParsePciDeviceIDs(t *testing.T) {
+	tcases := []struct {
+		name      string
+		list      string
+		expected  []string
+		expectErr bool
+	}{
+		{name: "empty list"},
+		{name: "valid IDs", list: "0x56C0, 0x46a6", expected: []string{"0x56c0", "0x46a6"}},
+		{name: "ID without 0x prefix", list: "56c0", expectErr: true},
+		{name: "too long ID", list: "0x56c00", expectErr: true},
+	}
+
+	for _, tc := range tcases {
+		ids, err := parsePciDeviceIDs(tc.list)
+		if (err != nil) != tc.expectErr {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+
+		if !reflect.DeepEqual(ids, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, ids)
+		}
+	}
+}
+
 func TestScanFails(t *testing.T) {
 	tc := TestCaseDetails{
 		name:      "xe and i915 devices with rm will fail",
@@ -715,6 +1759,202 @@ func TestBypath(t *testing.T) {
 	}
 }
 
+func TestBypathScan(t *testing.T) {
+	root := t.TempDir()
+	sysfs := path.Join(root, "sys/class/drm")
+	devfs := path.Join(root, "dev/dri")
+	device := path.Join(root, "sys/devices/pci0000:00/0000:0f:05.0")
+
+	for _, dir := range []string{path.Join(device, "drm/card0/device/drm/card0"), sysfs, devfs} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatalf("Failed to create %s: %+v", dir, err)
+		}
+	}
+
+	if err := os.WriteFile(path.Join(device, "drm/card0/device/vendor"), []byte("0x8086"), 0600); err != nil {
+		t.Fatalf("Failed to create vendor file: %+v", err)
+	}
+
+	if err := os.WriteFile(path.Join(devfs, "card0"), []byte{0}, 0600); err != nil {
+		t.Fatalf("Failed to create device node: %+v", err)
+	}
+
+	if err := os.Symlink("../../devices/pci0000:00/0000:0f:05.0/drm/card0", path.Join(sysfs, "card0")); err != nil {
+		t.Fatalf("Failed to create card link: %+v", err)
+	}
+
+	plugin := newDevicePlugin(sysfs, devfs, cliOptions{sharedDevNum: 1, enableMonitoring: true})
+	if plugin.bypathFound {
+		t.Fatal("by-path dir found before it was created")
+	}
+
+	// by-path links created after plugin startup are mounted.
+	byPath := path.Join(devfs, "by-path")
+	if err := os.MkdirAll(byPath, 0750); err != nil {
+		t.Fatalf("Failed to create by-path dir: %+v", err)
+	}
+
+	mounts := []v1beta1.Mount{}
+
+	for _, link := range []string{"pci-0000:0f:05.0-card", "pci-0000:0f:05.0-render"} {
+		if err := os.Symlink("../card0", path.Join(byPath, link)); err != nil {
+			t.Fatalf("Failed to create by-path link: %+v", err)
+		}
+
+		mounts = append(mounts, v1beta1.Mount{
+			ContainerPath: path.Join(byPath, link),
+			HostPath:      path.Join(byPath, link),
+			ReadOnly:      true,
+		})
+	}
+
+	tree, err := plugin.scan()
+	if err != nil {
+		t.Fatalf("Unexpected scan error: %+v", err)
+	}
+
+	if !plugin.bypathFound {
+		t.Error("by-path dir not found after it was created")
+	}
+
+	// Monitoring resource gets the by-path mounts of all GPUs.
+	devSpecs := []v1beta1.DeviceSpec{{HostPath: path.Join(devfs, "card0"), ContainerPath: path.Join(devfs, "card0"), Permissions: "rw"}}
+	expected := dpapi.NewDeviceInfo(v1beta1.Healthy, devSpecs, mounts, nil, nil, nil)
+
+	if monitor := tree["i915_monitoring"][monitorID]; !reflect.DeepEqual(monitor, expected) {
+		t.Errorf("Expected monitoring device %+v, got %+v", expected, monitor)
+	}
+
+	if gpuMounts, _ := plugin.createMountsAndCDIDevices(path.Join(sysfs, "card0"), "card0", devSpecs); !reflect.DeepEqual(gpuMounts, mounts) {
+		t.Errorf("Expected GPU mounts %+v, got %+v", mounts, gpuMounts)
+	}
+}
+
+func TestMixedDrivers(t *testing.T) {
+	tc := TestCaseDetails{
+		sysfsdirs: []string{"card0/device/drm/card0", "card1/device/drm/card1"},
+		sysfsfiles: map[string][]byte{
+			"card0/device/vendor": []byte("0x8086"),
+			"card1/device/vendor": []byte("0x8086"),
+		},
+		symlinkfiles: map[string]string{
+			"card0/device/driver": "drivers/i915",
+			"card1/device/driver": "drivers/xe",
+		},
+		devfsdirs: []string{"card0", "card1"},
+	}
+
+	sysfs, devfs, err := createTestFiles(t.TempDir(), tc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	plugin := newDevicePlugin(sysfs, devfs, cliOptions{sharedDevNum: 1, enableMonitoring: true})
+
+	tree, err := plugin.scan()
+	if err != nil {
+		t.Fatalf("Unexpected scan error: %+v", err)
+	}
+
+	if _, found := tree[deviceTypeI915]["card0-0"]; !found || len(tree[deviceTypeI915]) != 1 {
+		t.Errorf("Expected i915 resource with card0, got %v", tree[deviceTypeI915])
+	}
+
+	if _, found := tree[deviceTypeXe]["card1-0"]; !found || len(tree[deviceTypeXe]) != 1 {
+		t.Errorf("Expected xe resource with card1, got %v", tree[deviceTypeXe])
+	}
+
+	// Both monitoring resources give access to all the GPUs.
+	devSpecs := []v1beta1.DeviceSpec{
+		{HostPath: path.Join(devfs, "card0"), ContainerPath: path.Join(devfs, "card0"), Permissions: "rw"},
+		{HostPath: path.Join(devfs, "card1"), ContainerPath: path.Join(devfs, "card1"), Permissions: "rw"},
+	}
+	expected := dpapi.NewDeviceInfo(v1beta1.Healthy, devSpecs, []v1beta1.Mount{}, nil, nil, nil)
+
+	for _, resourceName := range []string{deviceTypeI915 + monitorSuffix, deviceTypeXe + monitorSuffix} {
+		if monitor := tree[resourceName][monitorID]; !reflect.DeepEqual(monitor, expected) {
+			t.Errorf("Expected %s device %+v, got %+v", resourceName, expected, monitor)
+		}
+	}
+}
+
+func TestDevicePermissions(t *testing.T) {
+	for permissions, valid := range map[string]bool{"rw": true, "r": true, "mwr": true, "": false, "rr": false, "rx": false} {
+		if isValidDevicePermissions(permissions) != valid {
+			t.Errorf("Expected '%s' permissions to be valid: %v", permissions, valid)
+		}
+	}
+
+	tc := TestCaseDetails{
+		sysfsdirs:    []string{"card0/device/drm/card0", "card0/device/drm/renderD128"},
+		sysfsfiles:   map[string][]byte{"card0/device/vendor": []byte("0x8086")},
+		symlinkfiles: map[string]string{"card0/device/driver": "drivers/i915"},
+		devfsdirs:    []string{"card0", "renderD128"},
+	}
+
+	sysfs, devfs, err := createTestFiles(t.TempDir(), tc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+
+	plugin := newDevicePlugin(sysfs, devfs, cliOptions{sharedDevNum: 1, enableMonitoring: true, devicePermissions: "r", monitorPermissions: "rw"})
+
+	tree, err := plugin.scan()
+	if err != nil {
+		t.Fatalf("Unexpected scan error: %+v", err)
+	}
+
+	devSpecs := []v1beta1.DeviceSpec{
+		{HostPath: path.Join(devfs, "card0"), ContainerPath: path.Join(devfs, "card0"), Permissions: "r"},
+		{HostPath: path.Join(devfs, "renderD128"), ContainerPath: path.Join(devfs, "renderD128"), Permissions: "r"},
+	}
+
+	if gpuSpecs := plugin.createDeviceSpecsFromDrmFiles(path.Join(sysfs, "card0")); !reflect.DeepEqual(gpuSpecs, devSpecs) {
+		t.Errorf("Expected GPU device specs %+v, got %+v", devSpecs, gpuSpecs)
+	}
+
+	expected := dpapi.NewDeviceInfo(v1beta1.Healthy, withPermissions(devSpecs, "rw"), []v1beta1.Mount{}, nil, nil, nil)
+
+	if monitor := tree["i915_monitoring"][monitorID]; !reflect.DeepEqual(monitor, expected) {
+		t.Errorf("Expected monitoring device %+v, got %+v", expected, monitor)
+	}
+}
+
+func TestRenderNodesOnly(t *testing.T) {
+	root := t.TempDir()
+	sysfs := path.Join(root, "sys")
+	devfs := path.Join(root, "dev")
+	byPath := path.Join(devfs, "by-path")
+
+	for _, dir := range []string{path.Join(sysfs, "card0/device/drm/card0"), path.Join(sysfs, "card0/device/drm/renderD128"), byPath} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatalf("Failed to create %s: %+v", dir, err)
+		}
+	}
+
+	for _, file := range []string{"card0", "renderD128", "by-path/pci-0000:00:02.0-card", "by-path/pci-0000:00:02.0-render"} {
+		if err := os.WriteFile(path.Join(devfs, file), []byte{0}, 0600); err != nil {
+			t.Fatalf("Failed to create %s: %+v", file, err)
+		}
+	}
+
+	plugin := newDevicePlugin(sysfs, devfs, cliOptions{sharedDevNum: 1, renderNodesOnly: true})
+
+	render := path.Join(devfs, "renderD128")
+	expectedSpecs := []v1beta1.DeviceSpec{{HostPath: render, ContainerPath: render, Permissions: "rw"}}
+
+	if specs := plugin.createDeviceSpecsFromDrmFiles(path.Join(sysfs, "card0")); !reflect.DeepEqual(specs, expectedSpecs) {
+		t.Errorf("Expected device specs %+v, got %+v", expectedSpecs, specs)
+	}
+
+	link := path.Join(byPath, "pci-0000:00:02.0-render")
+	expectedMounts := []v1beta1.Mount{{HostPath: link, ContainerPath: link, ReadOnly: true}}
+
+	if mounts := plugin.bypathMountsForPci("0000:00:02.0", byPath); !reflect.DeepEqual(mounts, expectedMounts) {
+		t.Errorf("Expected mounts %+v, got %+v", expectedMounts, mounts)
+	}
+}
+
 func TestPciDeviceForCard(t *testing.T) {
 	root, err := os.MkdirTemp("", "test_pci_device_for_card")
 	if err != nil {
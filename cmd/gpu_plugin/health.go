@@ -0,0 +1,156 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	// Period of GPU health checks.
+	healthPeriod = time.Second
+
+	// GPU is unhealthy while it has been reset at least resetStormCount
+	// times within resetStormWindow.
+	resetStormCount  = 3
+	resetStormWindow = 5 * time.Minute
+
+	// i915 debugfs files under "/sys/kernel/debug/dri/<card number>".
+	wedgedFile    = "i915_wedged"
+	resetInfoFile = "i915_reset_info"
+)
+
+// gpuHealth is the health state of a GPU.
+type gpuHealth struct {
+	// Reason why the GPU is unhealthy, empty when it is healthy.
+	reason string
+	// Times of the GPU resets within resetStormWindow.
+	resets []time.Time
+	// Full GPU reset count read last time, -1 before the first read.
+	resetCount int
+}
+
+// checkHealth returns why the given GPU is unhealthy, or empty string when
+// it is healthy, and tracks its recent resets.
+func (dp *devicePlugin) checkHealth(card string, health *gpuHealth, now time.Time) string {
+	debugfs := path.Join(dp.debugfsDir, strings.TrimPrefix(card, "card"))
+
+	if data, err := os.ReadFile(path.Join(debugfs, resetInfoFile)); err == nil {
+		var count int
+
+		if _, err := fmt.Sscanf(string(data), "full gpu reset = %d", &count); err == nil {
+			for i := health.resetCount; i >= 0 && i < count; i++ {
+				health.resets = append(health.resets, now)
+			}
+
+			health.resetCount = count
+		}
+	}
+
+	health.resets = slices.DeleteFunc(health.resets, func(reset time.Time) bool {
+		return now.Sub(reset) >= resetStormWindow
+	})
+
+	if _, err := os.Readlink(path.Join(dp.sysfsDir, card, "device/driver")); err != nil {
+		return "driver unbound"
+	}
+
+	if data, err := os.ReadFile(path.Join(debugfs, wedgedFile)); err == nil {
+		if wedged := strings.TrimSpace(string(data)); wedged != "" && wedged != "0" {
+			return "wedged"
+		}
+	}
+
+	if len(health.resets) >= resetStormCount {
+		return fmt.Sprintf("%d resets within %v", len(health.resets), resetStormWindow)
+	}
+
+	return ""
+}
+
+// updateHealth checks the health of the GPUs found by the latest scan, and
+// returns true if any of them changed.
+func (dp *devicePlugin) updateHealth(now time.Time) bool {
+	dp.healthLock.Lock()
+	defer dp.healthLock.Unlock()
+
+	changed := false
+	health := make(map[string]*gpuHealth, len(dp.healthCards))
+
+	for _, card := range dp.healthCards {
+		prev, found := dp.health[card]
+		if !found {
+			prev = &gpuHealth{resetCount: -1}
+		}
+
+		health[card] = prev
+
+		reason := dp.checkHealth(card, prev, now)
+		if reason == prev.reason {
+			continue
+		}
+
+		if reason != "" {
+			klog.Warningf("GPU %s is unhealthy: %s", card, reason)
+		} else {
+			klog.Infof("GPU %s is healthy again", card)
+		}
+
+		prev.reason = reason
+		changed = true
+	}
+
+	dp.health = health
+
+	return changed
+}
+
+// monitorHealth checks the GPU health periodically until stopped, and
+// triggers a device scan when it changes.
+func (dp *devicePlugin) monitorHealth(stop <-chan struct{}) {
+	ticker := time.NewTicker(healthPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if dp.updateHealth(now) {
+				dp.triggerScan()
+			}
+		}
+	}
+}
+
+// cardHealth returns the device health for the devices of the given GPU.
+func (dp *devicePlugin) cardHealth(card string) string {
+	dp.healthLock.Lock()
+	defer dp.healthLock.Unlock()
+
+	if health, found := dp.health[card]; found && health.reason != "" {
+		return pluginapi.Unhealthy
+	}
+
+	return pluginapi.Healthy
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+)
+
+// Device nodes of a hot-plugged GPU (card, render node, by-path links) are
+// created in a burst, so scan is done once there have been no new events
+// for hotplugSettleTime.
+const hotplugSettleTime = 100 * time.Millisecond
+
+// triggerScan makes Scan to rescan the devices without waiting for the next
+// scan period.
+func (dp *devicePlugin) triggerScan() {
+	select {
+	case dp.scanTrigger <- true:
+	default:
+	}
+}
+
+// watchDevfs returns a watcher for the devfs DRI dir, or nil if it can not
+// be watched. sysfs does not support inotify, but devfs nodes are created
+// and removed together with the sysfs DRM devices, e.g. when VFs are
+// enabled or a GPU is hot-plugged. Without the watcher, devices are still
+// rescanned every scan period, and the dir is watched once it appears.
+func (dp *devicePlugin) watchDevfs() *fsnotify.Watcher {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		klog.Warningf("Failed to create devfs watcher, using only periodic scans: %+v", err)
+		return nil
+	}
+
+	if err = watcher.Add(dp.devfsDir); err != nil {
+		klog.Warningf("Failed to watch %s, using only periodic scans: %+v", dp.devfsDir, err)
+		watcher.Close()
+
+		return nil
+	}
+
+	return watcher
+}
+
+// devfsDirExists tells whether the devfs DRI dir exists.
+func (dp *devicePlugin) devfsDirExists() bool {
+	_, err := os.Stat(dp.devfsDir)
+
+	return err == nil
+}
+
+// startDevfsWatch starts handling the devfs events until stopped. Returns
+// false if the devfs dir can not be watched.
+func (dp *devicePlugin) startDevfsWatch(stop <-chan struct{}) bool {
+	watcher := dp.watchDevfs()
+	if watcher == nil {
+		return false
+	}
+
+	go dp.handleDevfsEvents(watcher, stop)
+
+	return true
+}
+
+// handleDevfsEvents triggers a device scan when device nodes are added to
+// or removed from the watched devfs dir, until stopped.
+func (dp *devicePlugin) handleDevfsEvents(watcher *fsnotify.Watcher, stop <-chan struct{}) {
+	defer watcher.Close()
+
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-stop:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				klog.V(4).Infof("devfs event: %s", event)
+
+				settled = time.After(hotplugSettleTime)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			klog.Warning("devfs watch error: ", err)
+		case <-settled:
+			settled = nil
+
+			dp.triggerScan()
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/labeler"
+	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
+)
+
+const (
+	// GPU memory resource settings. Each device ID of the "<driver>_memory"
+	// resource is one memory unit of a GPU: "<card>-mem-<index>".
+	memorySuffix   = "_memory"
+	memoryIDInfix  = "-mem-"
+	memoryUnitEnv  = "INTEL_GPU_MEMORY_UNIT_MIB"
+	memoryTotalEnv = "INTEL_GPU_MEMORY_MIB"
+	memoryCardsEnv = "INTEL_GPU_MEMORY_CARDS"
+	mib            = 1024 * 1024
+)
+
+func (d *DeviceProperties) memoryResource() string {
+	return d.currentDriver + memorySuffix
+}
+
+func isMemoryID(deviceID string) bool {
+	return strings.Contains(deviceID, memoryIDInfix)
+}
+
+// addMemoryDevices adds memory unit devices of the given GPU to the device tree.
+// Memory size from Level Zero is used when it is known (non-zero).
+func (dp *devicePlugin) addMemoryDevices(devTree dpapi.DeviceTree, devProps *DeviceProperties, cardPath, name string,
+	devSpecs []pluginapi.DeviceSpec, mounts []pluginapi.Mount, cdiSpec *cdispec.Spec, levelZeroMemory uint64) {
+	memory := labeler.GetMemoryAmount(dp.sysfsDir, name, labeler.GetTileCount(cardPath), levelZeroMemory)
+	units := int(memory / mib / uint64(dp.options.memoryUnit))
+
+	if units == 0 {
+		klog.Warningf("No local memory found for %s, not adding it to %s resource", name, dp.resourceName(devProps.memoryResource()))
+		return
+	}
+
+	klog.V(4).Infof("Adding %d x %d MiB of %s memory", units, dp.options.memoryUnit, name)
+
+	envs := map[string]string{memoryUnitEnv: strconv.Itoa(dp.options.memoryUnit)}
+	maps.Copy(envs, dp.selectorEnvs(name))
+	deviceInfo := dpapi.NewDeviceInfo(dp.cardHealth(name), devSpecs, mounts, envs, nil, cdiSpec, prefix+"/dev")
+
+	for i := 0; i < units; i++ {
+		devTree.AddDevice(dp.resourceName(devProps.memoryResource()), fmt.Sprintf("%s%s%d", name, memoryIDInfix, i), deviceInfo)
+	}
+}
+
+// allocatedUnits returns the GPUs of the allocated units, and the number of
+// units. Each allocated unit adds the GPU device nodes to the response, so
+// the count of the primary (card) nodes, or with render nodes only, of the
+// render nodes, is the number of units allocated.
+func (dp *devicePlugin) allocatedUnits(cresp *pluginapi.ContainerAllocateResponse) ([]string, int) {
+	cards := []string{}
+	units := 0
+
+	for _, dev := range cresp.Devices {
+		card := filepath.Base(dev.ContainerPath)
+
+		switch {
+		case dp.options.renderNodesOnly && strings.HasPrefix(card, "renderD"):
+			card = dp.cardForRenderNode(card)
+		case dp.options.renderNodesOnly || !dp.gpuDeviceReg.MatchString(card):
+			continue
+		}
+
+		if !slices.Contains(cards, card) {
+			cards = append(cards, card)
+		}
+
+		units++
+	}
+
+	return cards, units
+}
+
+// cardForRenderNode returns the name of the primary node of the GPU with the
+// render node, or the render node name when it is not found.
+func (dp *devicePlugin) cardForRenderNode(renderNode string) string {
+	drmFiles, err := os.ReadDir(filepath.Join(dp.sysfsDir, renderNode, "device/drm"))
+	if err != nil {
+		klog.Warningf("Failed to find the GPU of %s: %v", renderNode, err)
+		return renderNode
+	}
+
+	for _, drmFile := range drmFiles {
+		if dp.gpuDeviceReg.MatchString(drmFile.Name()) {
+			return drmFile.Name()
+		}
+	}
+
+	return renderNode
+}
+
+// setMemoryEnvs tells the GPUs, and the total amount of memory allocated from
+// them, to the container.
+func (dp *devicePlugin) setMemoryEnvs(cresp *pluginapi.ContainerAllocateResponse) {
+	unit, err := strconv.Atoi(cresp.Envs[memoryUnitEnv])
+	if err != nil {
+		return
+	}
+
+	cards, units := dp.allocatedUnits(cresp)
+
+	cresp.Envs[memoryCardsEnv] = strings.Join(cards, ",")
+	cresp.Envs[memoryTotalEnv] = strconv.Itoa(units * unit)
+}
+
+// dedupe removes items with duplicate keys, keeping the first ones.
+func dedupe[T any](items []T, key func(T) string) []T {
+	seen := map[string]bool{}
+
+	return slices.DeleteFunc(items, func(item T) bool {
+		k := key(item)
+		if seen[k] {
+			return true
+		}
+
+		seen[k] = true
+
+		return false
+	})
+}
+
+// dedupeResponse removes the duplicate device specs, mounts and CDI devices
+// added by several device IDs of the same GPU.
+func dedupeResponse(cresp *pluginapi.ContainerAllocateResponse) {
+	cresp.Devices = dedupe(cresp.Devices, func(dev *pluginapi.DeviceSpec) string { return dev.HostPath })
+	cresp.Mounts = dedupe(cresp.Mounts, func(mount *pluginapi.Mount) string { return mount.HostPath })
+	cresp.CDIDevices = dedupe(cresp.CDIDevices, func(dev *pluginapi.CDIDevice) string { return dev.Name })
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
+)
+
+const (
+	// GPU millicore resource settings. Each device ID of the
+	// "<driver>_millicores" resource is one unit of GPU time share:
+	// "<card>-mc-<index>".
+	millicoreSuffix   = "_millicores"
+	millicoreIDInfix  = "-mc-"
+	millicoreUnitEnv  = "INTEL_GPU_MILLICORE_UNIT"
+	millicoreTotalEnv = "INTEL_GPU_MILLICORES"
+	millicoreCardsEnv = "INTEL_GPU_MILLICORE_CARDS"
+	millicoresPerCard = 1000
+)
+
+func (d *DeviceProperties) millicoreResource() string {
+	return d.currentDriver + millicoreSuffix
+}
+
+func isMillicoreID(deviceID string) bool {
+	return strings.Contains(deviceID, millicoreIDInfix)
+}
+
+// addMillicoreDevices adds millicore unit devices of the given GPU to the device tree.
+func (dp *devicePlugin) addMillicoreDevices(devTree dpapi.DeviceTree, devProps *DeviceProperties, name string,
+	devSpecs []pluginapi.DeviceSpec, mounts []pluginapi.Mount, cdiSpec *cdispec.Spec) {
+	units := millicoresPerCard / dp.options.millicoreUnit
+
+	klog.V(4).Infof("Adding %d x %d millicores of %s", units, dp.options.millicoreUnit, name)
+
+	envs := map[string]string{millicoreUnitEnv: strconv.Itoa(dp.options.millicoreUnit)}
+	maps.Copy(envs, dp.selectorEnvs(name))
+
+	deviceInfo := dpapi.NewDeviceInfo(dp.cardHealth(name), devSpecs, mounts, envs, nil, cdiSpec, prefix+"/dev")
+
+	for i := 0; i < units; i++ {
+		devTree.AddDevice(dp.resourceName(devProps.millicoreResource()), fmt.Sprintf("%s%s%d", name, millicoreIDInfix, i), deviceInfo)
+	}
+}
+
+// setMillicoreEnvs tells the GPUs, and the total amount of millicores
+// allocated from them, to the container.
+func (dp *devicePlugin) setMillicoreEnvs(cresp *pluginapi.ContainerAllocateResponse) {
+	unit, err := strconv.Atoi(cresp.Envs[millicoreUnitEnv])
+	if err != nil {
+		return
+	}
+
+	cards, units := dp.allocatedUnits(cresp)
+
+	cresp.Envs[millicoreCardsEnv] = strings.Join(cards, ",")
+	cresp.Envs[millicoreTotalEnv] = strconv.Itoa(units * unit)
+}
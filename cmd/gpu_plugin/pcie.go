@@ -0,0 +1,135 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// pciePath returns the PCI hierarchy of the given sysfs DRM card, from the
+// root complex (e.g. "pci0000:00") through the root port and PCIe switch
+// ports to the GPU, as given by the symbolic link the card points to:
+// ../../devices/pci0000:00/0000:00:01.0/0000:01:00.0/0000:02:01.0/0000:03:00.0/drm/card0.
+func pciePath(cardPath string) []string {
+	link, err := os.Readlink(cardPath)
+	if err != nil {
+		return nil
+	}
+
+	parts := strings.Split(link, "/")
+
+	start := slices.IndexFunc(parts, func(part string) bool { return strings.HasPrefix(part, "pci") })
+	end := slices.Index(parts, "drm")
+
+	if start < 0 || end <= start+1 {
+		return nil
+	}
+
+	return parts[start:end]
+}
+
+// updatePciePaths reads the PCI hierarchy of the scanned cards.
+func (dp *devicePlugin) updatePciePaths(cards []string) map[string][]string {
+	paths := map[string][]string{}
+
+	for _, card := range cards {
+		if pciPath := pciePath(path.Join(dp.sysfsDir, card)); pciPath != nil {
+			paths[card] = pciPath
+		}
+	}
+
+	return paths
+}
+
+// pcieLocalityPolicy is used for allocating multiple GPU devices from GPUs
+// that are close to each other in the PCI hierarchy, one device ID per GPU.
+// GPUs behind the same PCIe switch are preferred over ones behind the same
+// root port, which are preferred over ones in the same root complex, as
+// peer-to-peer traffic between them needs to cross fewer links. The GPUs of
+// MustIncludeDeviceIDs are always included, other GPUs are taken in card
+// number order. Returns nil when the GPUs are in different root complexes,
+// or their PCI hierarchy is not known.
+func (dp *devicePlugin) pcieLocalityPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	size := int(req.AllocationSize)
+	if size < 2 {
+		return nil
+	}
+
+	dp.topologyLock.Lock()
+	paths := dp.pciePaths
+	dp.topologyLock.Unlock()
+
+	if len(paths) == 0 {
+		return nil
+	}
+
+	cardIDs, required, candidates := cardDeviceIDs(req)
+	if cardIDs == nil || len(required) > size {
+		return nil
+	}
+
+	// GPUs behind each PCI hierarchy node, required ones first.
+	groups := map[string][]string{}
+	depths := map[string]int{}
+
+	for _, card := range append(required, candidates...) {
+		pciPath := paths[card]
+
+		// The GPU itself is excluded, SR-IOV VFs of a GPU share its parent.
+		for depth := 1; depth < len(pciPath); depth++ {
+			node := strings.Join(pciPath[:depth], "/")
+			groups[node] = append(groups[node], card)
+			depths[node] = depth
+		}
+	}
+
+	var (
+		best      []string
+		bestNode  string
+		bestDepth int
+	)
+
+	for node, cards := range groups {
+		// Required GPUs are first in the groups that include them.
+		if len(cards) < size || !slices.Equal(cards[:len(required)], required) {
+			continue
+		}
+
+		if depths[node] > bestDepth || depths[node] == bestDepth && node < bestNode {
+			best, bestNode, bestDepth = cards[:size], node, depths[node]
+		}
+	}
+
+	if best == nil {
+		klog.V(2).Infof("No %d GPUs available in the same PCIe root complex", size)
+
+		return nil
+	}
+
+	klog.V(2).Infof("Allocating from GPUs %v under PCI %s", best, bestNode)
+
+	deviceIDs := make([]string, 0, size)
+	for _, card := range best {
+		deviceIDs = append(deviceIDs, cardIDs[card])
+	}
+
+	return deviceIDs
+}
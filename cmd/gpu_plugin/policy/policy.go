@@ -0,0 +1,108 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy is the registry of GPU plugin preferred allocation policies.
+//
+// Custom policies are compiled into the plugin by registering them in an
+// init function of a package the plugin imports, e.g. with a blank import
+// in an additional file of the plugin main package:
+//
+//	package mypolicy
+//
+//	func init() {
+//		policy.Register("mypolicy", policy.Func(selectDevices))
+//	}
+//
+// and selected with the plugin "-allocation-policy=mypolicy" argument.
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Policy selects the preferred GPU devices for a container.
+type Policy interface {
+	// Select returns req.AllocationSize device IDs from req.AvailableDeviceIDs,
+	// including req.MustIncludeDeviceIDs. Device IDs are "card<N>-<index>",
+	// where index is from 0 to shared-dev-num - 1.
+	Select(req *pluginapi.ContainerPreferredAllocationRequest) []string
+}
+
+// Func is an adapter to use ordinary functions as policies.
+type Func func(req *pluginapi.ContainerPreferredAllocationRequest) []string
+
+// Select calls f(req).
+func (f Func) Select(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	return f(req)
+}
+
+var (
+	policies = map[string]Policy{}
+	lock     sync.Mutex
+)
+
+// Register makes a policy available with the given name. It panics if
+// the name is empty, or a policy is already registered with it.
+func Register(name string, policy Policy) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if name == "" || policy == nil {
+		panic("policy: invalid policy registration")
+	}
+
+	if _, found := policies[name]; found {
+		panic(fmt.Sprintf("policy: Register called twice for policy %s", name))
+	}
+
+	policies[name] = policy
+}
+
+// Unregister removes the policy registered with the given name, e.g. after
+// a test has registered one.
+func Unregister(name string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	delete(policies, name)
+}
+
+// Get returns the policy registered with the given name.
+func Get(name string) (Policy, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	policy, found := policies[name]
+
+	return policy, found
+}
+
+// Names returns the sorted names of the registered policies.
+func Names() []string {
+	lock.Lock()
+	defer lock.Unlock()
+
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func firstDevices(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	return req.AvailableDeviceIDs[:req.AllocationSize]
+}
+
+func TestRegister(t *testing.T) {
+	Register("first", Func(firstDevices))
+	Register("another", Func(firstDevices))
+
+	t.Cleanup(func() {
+		Unregister("first")
+		Unregister("another")
+
+		if names := Names(); len(names) != 0 {
+			t.Errorf("unexpected policy names after unregistering: %v", names)
+		}
+	})
+
+	if names := Names(); !reflect.DeepEqual(names, []string{"another", "first"}) {
+		t.Errorf("unexpected policy names: %v", names)
+	}
+
+	policy, found := Get("first")
+	if !found {
+		t.Fatal("registered policy not found")
+	}
+
+	req := &pluginapi.ContainerPreferredAllocationRequest{
+		AvailableDeviceIDs: []string{"card0-0", "card0-1", "card1-0"},
+		AllocationSize:     2,
+	}
+
+	if deviceIDs := policy.Select(req); !reflect.DeepEqual(deviceIDs, []string{"card0-0", "card0-1"}) {
+		t.Errorf("unexpected device IDs: %v", deviceIDs)
+	}
+
+	if _, found = Get("missing"); found {
+		t.Error("unregistered policy found")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering policy twice did not panic")
+		}
+	}()
+
+	Register("first", Func(firstDevices))
+}
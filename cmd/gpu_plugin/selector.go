@@ -0,0 +1,174 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/labeler"
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/levelzero"
+)
+
+const (
+	// With device selector envs, GPU and memory device IDs have
+	// "INTEL_GPU_CARD_<card>=1" env, which PostAllocate replaces (like the
+	// tile envs) with Level Zero device selection envs.
+	cardEnvPrefix = "INTEL_GPU_CARD_"
+	// oneAPI (SYCL) workloads are limited to the Level Zero backend, as
+	// other backends do not honor the affinity mask.
+	oneAPIDeviceSelectorEnv = "ONEAPI_DEVICE_SELECTOR"
+	levelZeroDeviceSelector = "level_zero:*"
+)
+
+// levelZeroDevices are the Level Zero device indexes of a GPU, one for each
+// tile in the (default) FLAT device hierarchy.
+type levelZeroDevices struct {
+	first int
+	count int
+}
+
+func byCardNumber(a, b string) int {
+	return cardNumber(a) - cardNumber(b)
+}
+
+// selectorEnvs returns the envs for the GPU and memory device IDs of the
+// given GPU, if device selector envs are enabled.
+func (dp *devicePlugin) selectorEnvs(card string) map[string]string {
+	if !dp.options.deviceSelectorEnvs {
+		return nil
+	}
+
+	return map[string]string{cardEnvPrefix + card: "1"}
+}
+
+// levelZeroIndexes returns the Level Zero device indexes of the Intel GPUs
+// of the node, for a container seeing all of them. Level Zero enumerates the
+// GPUs in PCI address order, also the ones the plugin does not advertise.
+func (dp *devicePlugin) levelZeroIndexes() map[string]levelZeroDevices {
+	files, err := os.ReadDir(dp.sysfsDir)
+	if err != nil {
+		klog.Warningf("Can't read sysfs folder: %v", err)
+		return nil
+	}
+
+	cards := []string{}
+	pciAddresses := map[string]string{}
+
+	for _, f := range files {
+		name := f.Name()
+		cardPath := path.Join(dp.sysfsDir, name)
+
+		if !dp.gpuDeviceReg.MatchString(name) {
+			continue
+		}
+
+		vendor, err := os.ReadFile(path.Join(cardPath, "device/vendor"))
+		if err != nil || strings.TrimSpace(string(vendor)) != vendorString {
+			continue
+		}
+
+		cards = append(cards, name)
+		pciAddresses[name] = levelzero.PciAddress(cardPath)
+	}
+
+	slices.SortFunc(cards, func(a, b string) int {
+		return cmp.Or(strings.Compare(pciAddresses[a], pciAddresses[b]), byCardNumber(a, b))
+	})
+
+	indexes := make(map[string]levelZeroDevices, len(cards))
+	first := 0
+
+	for _, card := range cards {
+		count := int(labeler.GetTileCount(path.Join(dp.sysfsDir, card)))
+		indexes[card] = levelZeroDevices{first: first, count: count}
+		first += count
+	}
+
+	return indexes
+}
+
+// setDeviceSelectorEnvs replaces the card and tile envs of the allocated
+// devices with Level Zero device selection envs. Unlike the plain tile
+// affinity mask, the mask uses the node-wide device indexes, so workloads
+// use only the allocated devices also when more GPUs are visible to them,
+// e.g. with the monitoring resource or in privileged containers.
+func (dp *devicePlugin) setDeviceSelectorEnvs(cresp *pluginapi.ContainerAllocateResponse) {
+	indexes := dp.levelZeroIndexes()
+	mask := []int{}
+
+	for _, c := range takeTileEnvs(cresp) {
+		card := fmt.Sprintf("card%d", c.card)
+
+		dev, found := indexes[card]
+		if !found {
+			klog.Warningf("No Level Zero device indexes for %s", card)
+			continue
+		}
+
+		for _, tile := range c.tiles {
+			mask = append(mask, dev.first+tile)
+		}
+	}
+
+	cards := []string{}
+
+	for key := range cresp.Envs {
+		if strings.HasPrefix(key, cardEnvPrefix) {
+			delete(cresp.Envs, key)
+
+			cards = append(cards, strings.TrimPrefix(key, cardEnvPrefix))
+		}
+	}
+
+	slices.SortFunc(cards, byCardNumber)
+
+	for _, card := range cards {
+		dev, found := indexes[card]
+		if !found {
+			klog.Warningf("No Level Zero device indexes for %s", card)
+			continue
+		}
+
+		for i := 0; i < dev.count; i++ {
+			mask = append(mask, dev.first+i)
+		}
+	}
+
+	if len(mask) == 0 {
+		return
+	}
+
+	// In the Level Zero enumeration order, without the tiles of the whole
+	// GPUs allocated to the container also as tiles.
+	slices.Sort(mask)
+	mask = slices.Compact(mask)
+
+	devices := make([]string, 0, len(mask))
+	for _, index := range mask {
+		devices = append(devices, strconv.Itoa(index))
+	}
+
+	cresp.Envs[levelZeroAffinityMaskEnv] = strings.Join(devices, ",")
+	cresp.Envs[oneAPIDeviceSelectorEnv] = levelZeroDeviceSelector
+}
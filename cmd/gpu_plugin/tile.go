@@ -0,0 +1,137 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/labeler"
+	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	cdispec "tags.cncf.io/container-device-interface/specs-go"
+)
+
+const (
+	// GPU tile resource settings. Each device ID of the "<driver>_tile"
+	// resource is one tile of a GPU: "<card>-tile-<index>".
+	tileSuffix  = "_tile"
+	tileIDInfix = "-tile-"
+	// Tile device IDs have "INTEL_GPU_TILE_<card>_<tile>=<tile count>" env,
+	// which PostAllocate replaces with Level Zero affinity mask env.
+	tileEnvPrefix            = "INTEL_GPU_TILE_"
+	levelZeroAffinityMaskEnv = "ZE_AFFINITY_MASK"
+)
+
+func (d *DeviceProperties) tileResource() string {
+	return d.currentDriver + tileSuffix
+}
+
+func isTileID(deviceID string) bool {
+	return strings.Contains(deviceID, tileIDInfix)
+}
+
+// addTileDevices adds tile devices of the given GPU to the device tree.
+func (dp *devicePlugin) addTileDevices(devTree dpapi.DeviceTree, devProps *DeviceProperties, cardPath, name string,
+	devSpecs []pluginapi.DeviceSpec, mounts []pluginapi.Mount, cdiSpec *cdispec.Spec) {
+	tiles := int(labeler.GetTileCount(cardPath))
+
+	klog.V(4).Infof("Adding %d tiles of %s", tiles, name)
+
+	for i := 0; i < tiles; i++ {
+		envs := map[string]string{fmt.Sprintf("%s%s_%d", tileEnvPrefix, name, i): strconv.Itoa(tiles)}
+		deviceInfo := dpapi.NewDeviceInfo(dp.cardHealth(name), devSpecs, mounts, envs, nil, cdiSpec, prefix+"/dev")
+
+		devTree.AddDevice(dp.resourceName(devProps.tileResource()), fmt.Sprintf("%s%s%d", name, tileIDInfix, i), deviceInfo)
+	}
+}
+
+// cardTiles are the allocated tiles of a GPU.
+type cardTiles struct {
+	tiles []int
+	card  int
+	count int
+}
+
+// takeTileEnvs removes the tile envs of the allocated tiles, and returns the
+// tiles of each GPU in card number order.
+func takeTileEnvs(cresp *pluginapi.ContainerAllocateResponse) []*cardTiles {
+	cards := map[int]*cardTiles{}
+
+	for key, value := range cresp.Envs {
+		if !strings.HasPrefix(key, tileEnvPrefix) {
+			continue
+		}
+
+		delete(cresp.Envs, key)
+
+		var card, tile int
+
+		count, err := strconv.Atoi(value)
+		if err == nil {
+			_, err = fmt.Sscanf(strings.TrimPrefix(key, tileEnvPrefix), "card%d_%d", &card, &tile)
+		}
+
+		if err != nil {
+			klog.Warningf("invalid tile env %s=%s", key, value)
+			continue
+		}
+
+		if cards[card] == nil {
+			cards[card] = &cardTiles{card: card, count: count}
+		}
+
+		cards[card].tiles = append(cards[card].tiles, tile)
+	}
+
+	sorted := make([]*cardTiles, 0, len(cards))
+	for _, c := range cards {
+		slices.Sort(c.tiles)
+
+		sorted = append(sorted, c)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].card < sorted[j].card })
+
+	return sorted
+}
+
+// setTileAffinityMask replaces the tile envs of the allocated tiles with
+// Level Zero affinity mask selecting them. The mask uses (default) FLAT
+// device hierarchy, where each tile of the container GPUs is a device.
+func setTileAffinityMask(cresp *pluginapi.ContainerAllocateResponse) {
+	cards := takeTileEnvs(cresp)
+	if len(cards) == 0 {
+		return
+	}
+
+	mask := []string{}
+	offset := 0
+
+	for _, c := range cards {
+		for _, tile := range c.tiles {
+			mask = append(mask, strconv.Itoa(offset+tile))
+		}
+
+		offset += c.count
+	}
+
+	cresp.Envs[levelZeroAffinityMaskEnv] = strings.Join(mask, ",")
+}
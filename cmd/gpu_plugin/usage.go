@@ -0,0 +1,165 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/podresources"
+)
+
+const (
+	// Period of reconciling device usage with kubelet PodResources.
+	usagePeriod = time.Minute
+	// Devices allocated within usageGracePeriod before reconciliation are
+	// kept in use, as kubelet may not yet list them.
+	usageGracePeriod = 10 * time.Second
+)
+
+// resourceKind returns the resource name suffix of the given device ID, or
+// empty string for the whole GPU resources.
+func resourceKind(deviceID string) string {
+	switch {
+	case isMemoryID(deviceID):
+		return memorySuffix
+	case isTileID(deviceID):
+		return tileSuffix
+	case isMillicoreID(deviceID):
+		return millicoreSuffix
+	}
+
+	return ""
+}
+
+// recordUsage marks the allocated device IDs as in use. Plugin does not get
+// a call when they are released, so usage is reconciled periodically.
+func (dp *devicePlugin) recordUsage(request *pluginapi.AllocateRequest, now time.Time) {
+	dp.usageLock.Lock()
+	defer dp.usageLock.Unlock()
+
+	for _, creq := range request.ContainerRequests {
+		for _, deviceID := range creq.DevicesIDs {
+			if deviceID != monitorID {
+				dp.inUse[deviceID] = now
+			}
+		}
+	}
+
+	dp.checkpointUsage()
+}
+
+// listUsedDevices returns the device IDs of the GPU resources, i.e. the ones
+// with the given full resource name prefix (excluding the monitoring
+// resources), allocated to the pods on the node.
+func listUsedDevices(client podresourcesv1.PodResourcesListerClient, resourcePrefix string) (map[string]bool, error) {
+	resp, err := podresources.List(client)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+
+	for _, podRes := range resp.PodResources {
+		for _, cont := range podRes.Containers {
+			for _, dev := range cont.Devices {
+				if !strings.HasPrefix(dev.ResourceName, resourcePrefix) || strings.HasSuffix(dev.ResourceName, monitorSuffix) {
+					continue
+				}
+
+				for _, deviceID := range dev.DeviceIds {
+					used[deviceID] = true
+				}
+			}
+		}
+	}
+
+	return used, nil
+}
+
+// reconcileUsage replaces the device usage with the devices kubelet has
+// allocated to the pods, dropping the released devices, and restoring the
+// usage after plugin restart. Devices allocated just before are kept.
+// Returns the GPUs having all their devices released.
+func (dp *devicePlugin) reconcileUsage(client podresourcesv1.PodResourcesListerClient, now time.Time) ([]string, error) {
+	used, err := listUsedDevices(client, dp.fullResourceName(""))
+	if err != nil {
+		return nil, err
+	}
+
+	dp.usageLock.Lock()
+	defer dp.usageLock.Unlock()
+
+	inUse := make(map[string]time.Time, len(used))
+
+	for deviceID := range used {
+		inUse[deviceID] = time.Time{}
+	}
+
+	for deviceID, allocated := range dp.inUse {
+		if _, found := inUse[deviceID]; !found && now.Sub(allocated) < usageGracePeriod {
+			inUse[deviceID] = allocated
+		}
+	}
+
+	klog.V(4).Infof("Reconciled GPU device usage: %d -> %d devices in use", len(dp.inUse), len(inUse))
+
+	released := releasedCards(dp.inUse, inUse)
+	dp.inUse = inUse
+
+	dp.checkpointUsage()
+
+	return released, nil
+}
+
+// trackUsage reconciles the device usage with kubelet PodResources at
+// startup and every usagePeriod, and cleans up the released GPUs.
+func (dp *devicePlugin) trackUsage() {
+	podresources.Poll(usagePeriod, "GPU device usage reconciliation", func(client podresourcesv1.PodResourcesListerClient) error {
+		released, err := dp.reconcileUsage(client, time.Now())
+		if err == nil && dp.options.releaseCleanup != cleanupNone {
+			dp.cleanupReleased(released)
+		}
+
+		return err
+	})
+}
+
+// otherUsage returns for each GPU the number of its devices in use by the
+// other GPU resources than the one of the given device IDs, e.g. memory
+// and tile resource usage for the whole GPU resource.
+func (dp *devicePlugin) otherUsage(deviceIDs []string) map[string]int {
+	if len(deviceIDs) == 0 {
+		return nil
+	}
+
+	kind := resourceKind(deviceIDs[0])
+	usage := map[string]int{}
+
+	dp.usageLock.Lock()
+	defer dp.usageLock.Unlock()
+
+	for deviceID := range dp.inUse {
+		if resourceKind(deviceID) != kind {
+			usage[strings.Split(deviceID, "-")[0]]++
+		}
+	}
+
+	return usage
+}
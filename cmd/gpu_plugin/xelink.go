@@ -0,0 +1,269 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/pluginutils"
+)
+
+const (
+	// Xe Link labels are "<namespace>/xe-links", and for connection lists
+	// not fitting to one label value, "<namespace>/xe-links2" etc. with
+	// values prefixed by xeLinkConcatChars.
+	xeLinkLabelName   = "xe-links"
+	xeLinkConcatChars = "Z"
+)
+
+// readXeLinks returns the Xe Link connected GPU index pairs from the xe-links
+// labels of the given NFD feature label file, as written by the XPU Manager
+// sidecar. The tile links between GPUs are reduced to GPU links.
+func readXeLinks(path string) ([][2]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := map[int]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		name, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+
+		name = name[strings.LastIndex(name, "/")+1:]
+		if !strings.HasPrefix(name, xeLinkLabelName) {
+			continue
+		}
+
+		index := 1
+
+		if suffix := strings.TrimPrefix(name, xeLinkLabelName); suffix != "" {
+			if index, err = strconv.Atoi(suffix); err != nil || index < 2 {
+				return nil, errors.Errorf("invalid Xe Link label name '%s'", name)
+			}
+		}
+
+		chunks[index] = value
+	}
+
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	ordered := make([]string, len(chunks))
+
+	for i := range ordered {
+		chunk, found := chunks[i+1]
+		if !found {
+			return nil, errors.Errorf("Xe Link label %d of %d missing", i+1, len(chunks))
+		}
+
+		ordered[i] = chunk
+	}
+
+	pairs := [][2]int{}
+
+	for _, link := range strings.Split(pluginutils.ConcatAlphaNumSplitChunks(ordered, xeLinkConcatChars), "_") {
+		var from, fromTile, to, toTile int
+
+		if _, err := fmt.Sscanf(link, "%d.%d-%d.%d", &from, &fromTile, &to, &toTile); err != nil {
+			return nil, errors.Wrapf(err, "invalid Xe Link '%s'", link)
+		}
+
+		if from != to {
+			pairs = append(pairs, [2]int{from, to})
+		}
+	}
+
+	return pairs, nil
+}
+
+// xeLinksByCard maps the GPU indexes of the Xe Link pairs to the given cards,
+// which are in the GPU index order, and returns the linked cards of each card.
+func xeLinksByCard(pairs [][2]int, cards []string) map[string]map[string]bool {
+	links := map[string]map[string]bool{}
+
+	for _, pair := range pairs {
+		if pair[0] >= len(cards) || pair[1] >= len(cards) {
+			klog.Warningf("Xe Link %d-%d to a GPU not found from the node (%d GPUs)", pair[0], pair[1], len(cards))
+			continue
+		}
+
+		from, to := cards[pair[0]], cards[pair[1]]
+
+		for _, link := range [][2]string{{from, to}, {to, from}} {
+			if links[link[0]] == nil {
+				links[link[0]] = map[string]bool{}
+			}
+
+			links[link[0]][link[1]] = true
+		}
+	}
+
+	return links
+}
+
+// cardNumber returns the number of "card<number>" name.
+func cardNumber(card string) int {
+	number, _ := strconv.Atoi(strings.TrimPrefix(card, "card"))
+
+	return number
+}
+
+// updateXeLinks reads the Xe Link topology for the scanned cards. XPU Manager
+// GPU indexes follow the PCI device order, like the card numbers.
+func (dp *devicePlugin) updateXeLinks(cards []string) map[string]map[string]bool {
+	pairs, err := readXeLinks(dp.options.xeLinkFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Warningf("Failed to read Xe Link topology from %s: %+v", dp.options.xeLinkFile, err)
+		}
+
+		return nil
+	}
+
+	sort.Slice(cards, func(i, j int) bool { return cardNumber(cards[i]) < cardNumber(cards[j]) })
+
+	return xeLinksByCard(pairs, cards)
+}
+
+// cardDeviceIDs returns the first available, or required, device ID of
+// each GPU, the GPUs of MustIncludeDeviceIDs, and the other GPUs in card
+// number order. Returns nil device IDs, if multiple device IDs of a GPU
+// are required.
+func cardDeviceIDs(req *pluginapi.ContainerPreferredAllocationRequest) (cardIDs map[string]string, required, candidates []string) {
+	cardIDs = map[string]string{}
+
+	for _, deviceID := range req.MustIncludeDeviceIDs {
+		card := strings.Split(deviceID, "-")[0]
+		if _, found := cardIDs[card]; found {
+			return nil, nil, nil
+		}
+
+		cardIDs[card] = deviceID
+		required = append(required, card)
+	}
+
+	deviceIDs := slices.Clone(req.AvailableDeviceIDs)
+
+	sort.Strings(deviceIDs)
+
+	for _, deviceID := range deviceIDs {
+		card := strings.Split(deviceID, "-")[0]
+		if _, found := cardIDs[card]; !found {
+			cardIDs[card] = deviceID
+			candidates = append(candidates, card)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return cardNumber(candidates[i]) < cardNumber(candidates[j]) })
+
+	return cardIDs, required, candidates
+}
+
+// xeLinkPolicy is used for allocating multiple GPU devices from GPUs that
+// are all Xe Link connected to each other, one device ID per GPU. The GPUs
+// of MustIncludeDeviceIDs are always included, other GPUs are tried in card
+// number order. Returns nil when there is no such set of GPUs available.
+func (dp *devicePlugin) xeLinkPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	size := int(req.AllocationSize)
+	if size < 2 {
+		return nil
+	}
+
+	dp.topologyLock.Lock()
+	links := dp.xeLinks
+	dp.topologyLock.Unlock()
+
+	if len(links) == 0 {
+		return nil
+	}
+
+	cardIDs, required, candidates := cardDeviceIDs(req)
+	if cardIDs == nil {
+		return nil
+	}
+
+	connected := func(card string, selected []string) bool {
+		for _, other := range selected {
+			if !links[card][other] {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	var search func(selected, rest []string) []string
+
+	search = func(selected, rest []string) []string {
+		if len(selected) == size {
+			return selected
+		}
+
+		for i, card := range rest {
+			if !connected(card, selected) {
+				continue
+			}
+
+			if found := search(append(slices.Clone(selected), card), rest[i+1:]); found != nil {
+				return found
+			}
+		}
+
+		return nil
+	}
+
+	for i, card := range required {
+		if !connected(card, required[:i]) {
+			return nil
+		}
+	}
+
+	cards := []string(nil)
+	if len(required) <= size {
+		cards = search(required, candidates)
+	}
+
+	if cards == nil {
+		klog.V(2).Infof("No %d Xe Link connected GPUs available", size)
+
+		return nil
+	}
+
+	klog.V(2).Infof("Allocating from Xe Link connected GPUs %v", cards)
+
+	deviceIDs := make([]string, 0, size)
+	for _, card := range cards {
+		deviceIDs = append(deviceIDs, cardIDs[card])
+	}
+
+	return deviceIDs
+}
@@ -17,6 +17,7 @@ package main
 import (
 	"flag"
 	"os"
+	"path"
 
 	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/idxd"
@@ -31,12 +32,26 @@ const (
 	devDir = "/dev/iax"
 	// Glob pattern for the state sysfs entry.
 	statePattern = "/sys/bus/dsa/devices/iax*/wq*/state"
+	// Node labels.
+	nfdFeatureDir = "/etc/kubernetes/node-feature-discovery/features.d"
+	labelFilename = "intel-iaa-labels.txt"
+	labelPrefix   = namespace + "/capability."
 )
 
+// Opcodes of the IAA operations of the capabilities.
+var capabilities = map[string][]int{
+	// Decompress and Compress.
+	"compress": {0x42, 0x43},
+	// Decrypt and Encrypt, since IAA 2.0.
+	"crypto": {0x40, 0x41},
+}
+
 func main() {
 	var sharedDevNum int
 
 	flag.IntVar(&sharedDevNum, "shared-dev-num", 1, "number of containers sharing the same work queue")
+	splitResources := flag.Bool("capability-resources", false, "advertise the work queues with a single capability (compress or crypto) as resources of their own")
+	nodeLabels := flag.Bool("node-labels", false, "write the work queue capabilities as node labels to NFD feature file")
 	flag.Parse()
 
 	if sharedDevNum < 1 {
@@ -49,6 +64,20 @@ func main() {
 		klog.Fatal("Cannot create device plugin, please check above error messages.")
 	}
 
+	if *splitResources || *nodeLabels {
+		caps := &idxd.Capabilities{
+			Opcodes:        capabilities,
+			LabelPrefix:    labelPrefix,
+			SplitResources: *splitResources,
+		}
+
+		if *nodeLabels {
+			caps.NFDFeatureFile = path.Join(nfdFeatureDir, labelFilename)
+		}
+
+		plugin.SetCapabilities(caps)
+	}
+
 	manager := dpapi.NewManager(namespace, plugin)
 
 	manager.Run()
@@ -29,8 +29,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/levelzero"
 	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/pluginutils"
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
 )
 
@@ -42,6 +44,13 @@ const (
 	pciGroupLabelName   = "pci-groups"
 	tilesLabelName      = "tiles"
 	numaMappingName     = "numa-gpu-map"
+	subslicesLabelName  = "subslices"
+	driverVersionName   = "driver-version"
+	firmwareVersionName = "firmware-version"
+	familyLabelName     = "gpu-family"
+	sriovRoleLabelName  = "sriov-role"
+	xeLinksLabelName    = "xe-links.present"
+	xeLinksFileLabel    = "xe-links"
 	millicoresPerGPU    = 1000
 	memoryOverrideEnv   = "GPU_MEMORY_OVERRIDE"
 	memoryReservedEnv   = "GPU_MEMORY_RESERVED"
@@ -59,14 +68,17 @@ type labeler struct {
 	gpuDeviceReg     *regexp.Regexp
 	controlDeviceReg *regexp.Regexp
 	labels           labelMap
+	levelZero        levelzero.Client
 
 	sysfsDRMDir   string
+	xeLinkFile    string
 	labelsChanged bool
 }
 
-func newLabeler(sysfsDRMDir string) *labeler {
+func newLabeler(sysfsDRMDir string, levelZero levelzero.Client) *labeler {
 	return &labeler{
 		sysfsDRMDir:      sysfsDRMDir,
+		levelZero:        levelZero,
 		gpuDeviceReg:     regexp.MustCompile(gpuDeviceRE),
 		controlDeviceReg: regexp.MustCompile(controlDeviceRE),
 		labels:           labelMap{},
@@ -163,14 +175,52 @@ func fallback() uint64 {
 	return getEnvVarNumber(memoryOverrideEnv)
 }
 
-func GetMemoryAmount(sysfsDrmDir, gpuName string, numTiles uint64) uint64 {
+// getXeMemoryAmount returns the sum of the Xe driver per-tile VRAM sizes,
+// or zero if there are none.
+func getXeMemoryAmount(sysfsDrmDir, gpuName string) uint64 {
+	paths, _ := filepath.Glob(filepath.Join(sysfsDrmDir, gpuName, "device/tile?/physical_vram_size_bytes"))
+
+	total := uint64(0)
+
+	for _, filePath := range paths {
+		dat, err := os.ReadFile(filePath)
+		if err != nil {
+			klog.Warning("Can't read file: ", err)
+			return 0
+		}
+
+		size, err := strconv.ParseUint(strings.TrimSpace(string(dat)), 0, 64)
+		if err != nil {
+			klog.Warning("Can't convert physical_vram_size_bytes: ", err)
+			return 0
+		}
+
+		total += size
+	}
+
+	return total
+}
+
+// GetMemoryAmount returns the GPU memory amount. Memory size from Level Zero,
+// when known (non-zero), takes precedence over sysfs.
+func GetMemoryAmount(sysfsDrmDir, gpuName string, numTiles, levelZeroMemory uint64) uint64 {
 	reserved := getEnvVarNumber(memoryReservedEnv)
 
+	if levelZeroMemory > 0 {
+		return levelZeroMemory - reserved
+	}
+
 	filePath := filepath.Join(sysfsDrmDir, gpuName, "lmem_total_bytes")
 
 	dat, err := os.ReadFile(filePath)
 	if err != nil {
+		// Xe driver has the memory size per tile.
+		if total := getXeMemoryAmount(sysfsDrmDir, gpuName); total > 0 {
+			return total - reserved
+		}
+
 		klog.Warning("Can't read file: ", err)
+
 		return fallback()
 	}
 
@@ -238,6 +288,99 @@ func (lm labelMap) addNumericLabel(labelName string, valueToAdd int64) {
 	lm[labelName] = strconv.FormatInt(value, 10)
 }
 
+// addCommonLabel creates a label with the value all GPUs have. Label is not
+// created if the values differ, or are not valid label values.
+func (lm labelMap) addCommonLabel(labelName string, values []string) {
+	if len(values) == 0 || values[0] == "" {
+		return
+	}
+
+	for _, value := range values[1:] {
+		if value != values[0] {
+			klog.V(2).Infof("GPUs have different %s values, not labeling: %q", labelName, values)
+			return
+		}
+	}
+
+	if errs := validation.IsValidLabelValue(values[0]); len(errs) > 0 {
+		klog.Warningf("Invalid %s label value '%s': %s", labelName, values[0], strings.Join(errs, ", "))
+		return
+	}
+
+	lm[labelName] = values[0]
+}
+
+// getFamily returns the family name of the GPU, or empty string if it is not
+// in any family.
+func (l *labeler) getFamily(gpuName string) string {
+	dat, err := os.ReadFile(path.Join(l.sysfsDRMDir, gpuName, "device/device"))
+	if err != nil {
+		return ""
+	}
+
+	return pluginutils.GpuFamily(string(dat))
+}
+
+// getSriovRole returns "vf" for SR-IOV virtual function GPUs, "pf" for
+// SR-IOV capable physical function GPUs, or empty string for other GPUs.
+// PFs with VFs enabled have been skipped by scan.
+func (l *labeler) getSriovRole(gpuName string) string {
+	devicePath := path.Join(l.sysfsDRMDir, gpuName, "device")
+
+	if _, err := os.Stat(path.Join(devicePath, "physfn")); err == nil {
+		return "vf"
+	}
+
+	dat, err := os.ReadFile(path.Join(devicePath, "sriov_totalvfs"))
+	if err != nil {
+		return ""
+	}
+
+	if totalVfs, err := strconv.Atoi(strings.TrimSpace(string(dat))); err == nil && totalVfs > 0 {
+		return "pf"
+	}
+
+	return ""
+}
+
+// hasXeLinks tells whether the Xe Link label file has Xe Link connections,
+// i.e. a non-empty xe-links label, as written by the XPU Manager sidecar.
+func (l *labeler) hasXeLinks() bool {
+	if l.xeLinkFile == "" {
+		return false
+	}
+
+	dat, err := os.ReadFile(l.xeLinkFile)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(dat), "\n") {
+		name, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if found && value != "" && name[strings.LastIndex(name, "/")+1:] == xeLinksFileLabel {
+			return true
+		}
+	}
+
+	return false
+}
+
+// levelZeroDevices returns the Level Zero details of the GPUs, or nil if
+// they are not available.
+func (l *labeler) levelZeroDevices() map[string]levelzero.DeviceDetails {
+	if l.levelZero == nil {
+		return nil
+	}
+
+	devices, err := l.levelZero.Devices()
+	if err != nil {
+		klog.Warningf("Level Zero details not available: %+v", err)
+		return nil
+	}
+
+	return devices
+}
+
 // Stores a long string to labels so that it's possibly split into multiple
 // keys: foobar="<something very long>", foobar2="<equally long>", foobar3="The end."
 func (lm labelMap) addSplittableString(labelBase, fullValue string) {
@@ -306,6 +449,12 @@ func (l *labeler) createLabels() error {
 
 	numaMapping := make(map[int][]string)
 
+	devices := l.levelZeroDevices()
+	driverVersions := []string{}
+	firmwareVersions := []string{}
+	families := []string{}
+	sriovRoles := []string{}
+
 	for _, gpuName := range gpuNameList {
 		gpuNum := ""
 		// extract gpu number as a string. scan() has already checked name syntax
@@ -314,10 +463,25 @@ func (l *labeler) createLabels() error {
 			return errors.Wrap(err, "gpu name parsing error")
 		}
 
+		families = append(families, l.getFamily(gpuName))
+		sriovRoles = append(sriovRoles, l.getSriovRole(gpuName))
+
 		numTiles := GetTileCount(filepath.Join(l.sysfsDRMDir, gpuName))
 		tileCount += int(numTiles)
 
-		memoryAmount := GetMemoryAmount(l.sysfsDRMDir, gpuName, numTiles)
+		details := levelzero.DeviceDetails{}
+		if devices != nil {
+			details = devices[levelzero.PciAddress(filepath.Join(l.sysfsDRMDir, gpuName))]
+
+			driverVersions = append(driverVersions, details.DriverVersion)
+			firmwareVersions = append(firmwareVersions, details.FirmwareVersion)
+		}
+
+		if details.SubsliceCount > 0 {
+			l.labels.addNumericLabel(labelNamespace+subslicesLabelName, int64(details.SubsliceCount))
+		}
+
+		memoryAmount := GetMemoryAmount(l.sysfsDRMDir, gpuName, numTiles, details.MemorySize)
 		gpuNumList = append(gpuNumList, gpuName[4:])
 
 		// get numa node of the GPU
@@ -339,6 +503,14 @@ func (l *labeler) createLabels() error {
 	gpuCount := len(gpuNumList)
 
 	l.labels.addNumericLabel(labelNamespace+tilesLabelName, int64(tileCount))
+	l.labels.addCommonLabel(labelNamespace+driverVersionName, driverVersions)
+	l.labels.addCommonLabel(labelNamespace+firmwareVersionName, firmwareVersions)
+	l.labels.addCommonLabel(labelNamespace+familyLabelName, families)
+	l.labels.addCommonLabel(labelNamespace+sriovRoleLabelName, sriovRoles)
+
+	if gpuCount > 0 && l.hasXeLinks() {
+		l.labels[labelNamespace+xeLinksLabelName] = "true"
+	}
 
 	if gpuCount > 0 {
 		// add gpu list label (example: "card0.card1.card2") - deprecated
@@ -431,7 +603,7 @@ func (l *labeler) printLabelsToFile(labelFile string) error {
 }
 
 func CreateAndPrintLabels(sysfsDRMDir string) {
-	l := newLabeler(sysfsDRMDir)
+	l := newLabeler(sysfsDRMDir, nil)
 
 	if err := l.createLabels(); err != nil {
 		klog.Warningf("failed to create labels: %+v", err)
@@ -445,9 +617,11 @@ func CreateAndPrintLabels(sysfsDRMDir string) {
 }
 
 // Gathers node's GPU labels on channel trigger or timeout, and write them to a file.
-// The created label file is deleted on exit (process dying).
-func Run(sysfsDrmDir, nfdFeatureFile string, updateInterval time.Duration, scanResources chan bool) {
-	l := newLabeler(sysfsDrmDir)
+// The created label file is deleted on exit (process dying). Level Zero client
+// and Xe Link label file are optional.
+func Run(sysfsDrmDir, nfdFeatureFile string, updateInterval time.Duration, scanResources chan bool, levelZero levelzero.Client, xeLinkFile string) {
+	l := newLabeler(sysfsDrmDir, levelZero)
+	l.xeLinkFile = xeLinkFile
 
 	interruptChan := make(chan os.Signal, 1)
 	signal.Notify(interruptChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
@@ -21,6 +21,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/levelzero"
 	"github.com/intel/intel-device-plugins-for-kubernetes/cmd/internal/pluginutils"
 )
 
@@ -576,6 +577,75 @@ func getTestCases() []testcase {
 				"gpu.intel.com/numa-gpu-map": "1-0.1",
 			},
 		},
+		{
+			sysfsdirs: []string{
+				"card0/device/drm/card0",
+				"card0/device/tile0/gt0",
+				"card0/device/tile1/gt1",
+			},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor":                         []byte("0x8086"),
+				"card0/device/tile0/physical_vram_size_bytes": []byte("8000"),
+				"card0/device/tile1/physical_vram_size_bytes": []byte("8000"),
+			},
+			name:           "successful labeling via xe driver physical_vram_size_bytes",
+			memoryReserved: 1000,
+			expectedRetval: nil,
+			expectedLabels: labelMap{
+				"gpu.intel.com/millicores":  "1000",
+				"gpu.intel.com/memory.max":  "15000",
+				"gpu.intel.com/gpu-numbers": "0",
+				"gpu.intel.com/cards":       "card0",
+				"gpu.intel.com/tiles":       "2",
+			},
+		},
+		{
+			sysfsdirs: []string{
+				"card0/device/drm/card0",
+				"card1/device/drm/card1",
+			},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor":         []byte("0x8086"),
+				"card0/device/device":         []byte("0x56C0"),
+				"card0/device/sriov_totalvfs": []byte("16"),
+				"card1/device/vendor":         []byte("0x8086"),
+				"card1/device/device":         []byte("0x56c1"),
+				"card1/device/sriov_totalvfs": []byte("16"),
+			},
+			name:           "successful labeling of family and SR-IOV PF role",
+			expectedRetval: nil,
+			expectedLabels: labelMap{
+				"gpu.intel.com/millicores":  "2000",
+				"gpu.intel.com/memory.max":  "0",
+				"gpu.intel.com/gpu-numbers": "0.1",
+				"gpu.intel.com/cards":       "card0.card1",
+				"gpu.intel.com/tiles":       "2",
+				"gpu.intel.com/gpu-family":  "flex",
+				"gpu.intel.com/sriov-role":  "pf",
+			},
+		},
+		{
+			sysfsdirs: []string{
+				"card0/device/drm/card0",
+				"card0/device/physfn",
+				"card1/device/drm/card1",
+			},
+			sysfsfiles: map[string][]byte{
+				"card0/device/vendor": []byte("0x8086"),
+				"card0/device/device": []byte("0x0bd5"),
+				"card1/device/vendor": []byte("0x8086"),
+				"card1/device/device": []byte("0x56c0"),
+			},
+			name:           "no family and SR-IOV role labels for different GPUs",
+			expectedRetval: nil,
+			expectedLabels: labelMap{
+				"gpu.intel.com/millicores":  "2000",
+				"gpu.intel.com/memory.max":  "0",
+				"gpu.intel.com/gpu-numbers": "0.1",
+				"gpu.intel.com/cards":       "card0.card1",
+				"gpu.intel.com/tiles":       "2",
+			},
+		},
 	}
 }
 
@@ -651,7 +721,7 @@ func TestLabeling(t *testing.T) {
 			os.Setenv(memoryReservedEnv, strconv.FormatUint(tc.memoryReserved, 10))
 			os.Setenv(pciGroupingEnv, strconv.FormatUint(tc.pciGroupLevel, 10))
 
-			labeler := newLabeler(sysfs)
+			labeler := newLabeler(sysfs, nil)
 			err = labeler.createLabels()
 			if err != nil && tc.expectedRetval == nil ||
 				err == nil && tc.expectedRetval != nil {
@@ -663,3 +733,110 @@ func TestLabeling(t *testing.T) {
 		})
 	}
 }
+
+type mockLevelZero struct {
+	devices map[string]levelzero.DeviceDetails
+}
+
+func (m *mockLevelZero) Devices() (map[string]levelzero.DeviceDetails, error) {
+	return m.devices, nil
+}
+
+func TestCreateLabelsWithLevelZero(t *testing.T) {
+	sysfs := t.TempDir()
+
+	for i, address := range []string{"0000:03:00.0", "0000:04:00.0"} {
+		device := path.Join(sysfs, "devices", address)
+		card := path.Join(sysfs, "card"+strconv.Itoa(i))
+
+		if err := os.MkdirAll(path.Join(device, "drm"), 0750); err != nil {
+			t.Fatalf("Failed to create fake sysfs directory: %+v", err)
+		}
+
+		if err := os.WriteFile(path.Join(device, "vendor"), []byte("0x8086"), 0600); err != nil {
+			t.Fatalf("Failed to create fake vendor file: %+v", err)
+		}
+
+		if err := os.MkdirAll(card, 0750); err != nil {
+			t.Fatalf("Failed to create fake sysfs directory: %+v", err)
+		}
+
+		if err := os.Symlink(device, path.Join(card, "device")); err != nil {
+			t.Fatalf("Failed to create fake device link: %+v", err)
+		}
+	}
+
+	os.Setenv(memoryOverrideEnv, "0")
+	os.Setenv(memoryReservedEnv, "0")
+	os.Setenv(pciGroupingEnv, "0")
+
+	client := &mockLevelZero{
+		devices: map[string]levelzero.DeviceDetails{
+			"0000:03:00.0": {DriverVersion: "1.3.29735", FirmwareVersion: "DG02_2.2282", MemorySize: 8000, SubsliceCount: 128},
+			"0000:04:00.0": {DriverVersion: "1.3.29735", FirmwareVersion: "DG02_2.2268", MemorySize: 4000, SubsliceCount: 64},
+		},
+	}
+
+	labeler := newLabeler(sysfs, client)
+	if err := labeler.createLabels(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	// Firmware versions differ, so there is no label for them.
+	expected := labelMap{
+		"gpu.intel.com/millicores":     "2000",
+		"gpu.intel.com/memory.max":     "12000",
+		"gpu.intel.com/gpu-numbers":    "0.1",
+		"gpu.intel.com/cards":          "card0.card1",
+		"gpu.intel.com/tiles":          "2",
+		"gpu.intel.com/subslices":      "192",
+		"gpu.intel.com/driver-version": "1.3.29735",
+	}
+
+	if !reflect.DeepEqual(labeler.labels, expected) {
+		t.Errorf("label mismatch with expectation:\n%v\n%v\n", labeler.labels, expected)
+	}
+}
+
+func TestXeLinksLabel(t *testing.T) {
+	root := t.TempDir()
+	sysfs := path.Join(root, "sys")
+	xeLinkFile := path.Join(root, "xpum-sidecar-labels.txt")
+
+	tc := testcase{
+		sysfsdirs:  []string{"card0/device/drm/card0"},
+		sysfsfiles: map[string][]byte{"card0/device/vendor": []byte("0x8086")},
+	}
+	tc.createFiles(t, sysfs, root)
+
+	if err := os.WriteFile(xeLinkFile, []byte("gpu.intel.com/xe-links=0.0-1.0\n"), 0600); err != nil {
+		t.Fatalf("Failed to create Xe Link label file: %+v", err)
+	}
+
+	os.Setenv(memoryOverrideEnv, "0")
+	os.Setenv(memoryReservedEnv, "0")
+	os.Setenv(pciGroupingEnv, "0")
+
+	labeler := newLabeler(sysfs, nil)
+	labeler.xeLinkFile = xeLinkFile
+
+	if err := labeler.createLabels(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if value := labeler.labels["gpu.intel.com/xe-links.present"]; value != "true" {
+		t.Errorf("expected xe-links.present label 'true', got '%s'", value)
+	}
+
+	if err := os.WriteFile(xeLinkFile, []byte("gpu.intel.com/xe-links=\n"), 0600); err != nil {
+		t.Fatalf("Failed to update Xe Link label file: %+v", err)
+	}
+
+	if err := labeler.createLabels(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if value, found := labeler.labels["gpu.intel.com/xe-links.present"]; found {
+		t.Errorf("expected no xe-links.present label, got '%s'", value)
+	}
+}
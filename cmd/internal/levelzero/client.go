@@ -0,0 +1,121 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package levelzero is a client for a Level Zero service (e.g. a sidecar
+// container), which reports GPU properties that are not available in sysfs.
+//
+// The service listens on a unix socket, and responds to "GET /devices" with
+// a JSON list of the GPUs:
+//
+//	[{"pciAddress": "0000:03:00.0", "memorySize": 17179869184, "subsliceCount": 128,
+//	  "driverVersion": "1.3.29735", "firmwareVersion": "DG02_2.2282"}]
+package levelzero
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+const (
+	devicesURL     = "http://levelzero/devices"
+	requestTimeout = 5 * time.Second
+)
+
+var errStatus = errors.New("unexpected Level Zero service response")
+
+// DeviceDetails are the Level Zero properties of a GPU.
+type DeviceDetails struct {
+	PciAddress      string `json:"pciAddress"`
+	DriverVersion   string `json:"driverVersion"`
+	FirmwareVersion string `json:"firmwareVersion"`
+	MemorySize      uint64 `json:"memorySize"`
+	SubsliceCount   uint64 `json:"subsliceCount"`
+}
+
+// Client gets the GPU details from the Level Zero service.
+type Client interface {
+	// Devices returns the details of the GPUs by their PCI addresses.
+	Devices() (map[string]DeviceDetails, error)
+}
+
+type client struct {
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the Level Zero service listening on the
+// given unix socket.
+func NewClient(socketPath string) Client {
+	dialer := &net.Dialer{}
+
+	return &client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+func (c *client) Devices() (map[string]DeviceDetails, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, devicesURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Level Zero request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Level Zero devices: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", errStatus, resp.Status)
+	}
+
+	list := []DeviceDetails{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid Level Zero devices: %w", err)
+	}
+
+	devices := make(map[string]DeviceDetails, len(list))
+	for _, dev := range list {
+		devices[dev.PciAddress] = dev
+	}
+
+	return devices, nil
+}
+
+// PciAddress returns the PCI address of the given sysfs DRM card, which
+// the device details are keyed with, or empty string if it is not known.
+func PciAddress(cardPath string) string {
+	devicePath, err := filepath.EvalSymlinks(filepath.Join(cardPath, "device"))
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Base(devicePath)
+}
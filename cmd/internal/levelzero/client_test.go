@@ -0,0 +1,96 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package levelzero
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDevices(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "levelzero.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %+v", socket, err)
+	}
+
+	body := `[{"pciAddress": "0000:03:00.0", "memorySize": 17179869184, "subsliceCount": 128,
+		"driverVersion": "1.3.29735", "firmwareVersion": "DG02_2.2282"}]`
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/devices" {
+				http.NotFound(w, r)
+				return
+			}
+
+			_, _ = w.Write([]byte(body))
+		}),
+	}
+
+	go func() { _ = server.Serve(listener) }()
+
+	defer server.Close()
+
+	devices, err := NewClient(socket).Devices()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	expected := map[string]DeviceDetails{
+		"0000:03:00.0": {
+			PciAddress:      "0000:03:00.0",
+			DriverVersion:   "1.3.29735",
+			FirmwareVersion: "DG02_2.2282",
+			MemorySize:      17179869184,
+			SubsliceCount:   128,
+		},
+	}
+
+	if !reflect.DeepEqual(devices, expected) {
+		t.Errorf("expected devices %v, got %v", expected, devices)
+	}
+
+	if _, err = NewClient(filepath.Join(t.TempDir(), "missing.sock")).Devices(); err == nil {
+		t.Error("expected error for missing socket")
+	}
+}
+
+func TestPciAddress(t *testing.T) {
+	root := t.TempDir()
+	device := filepath.Join(root, "devices/pci0000:00/0000:03:00.0")
+	card := filepath.Join(device, "drm/card0")
+
+	if err := os.MkdirAll(card, 0o750); err != nil {
+		t.Fatalf("failed to create %s: %+v", card, err)
+	}
+
+	if err := os.Symlink("../../../0000:03:00.0", filepath.Join(card, "device")); err != nil {
+		t.Fatalf("failed to create device link: %+v", err)
+	}
+
+	if address := PciAddress(card); address != "0000:03:00.0" {
+		t.Errorf("expected PCI address 0000:03:00.0, got '%s'", address)
+	}
+
+	if address := PciAddress(root); address != "" {
+		t.Errorf("expected no PCI address, got '%s'", address)
+	}
+}
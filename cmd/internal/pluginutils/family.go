@@ -0,0 +1,56 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginutils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	FamilyFlex = "flex"
+	FamilyMax  = "max"
+	FamilyArc  = "arc"
+)
+
+// gpuFamilies maps the PCI device IDs of the discrete GPU families to the
+// family names.
+var gpuFamilies = func() map[string]string {
+	families := map[string]string{}
+
+	add := func(family string, first, last int) {
+		for id := first; id <= last; id++ {
+			families[fmt.Sprintf("0x%04x", id)] = family
+		}
+	}
+
+	// Data Center GPU Flex series (ATS-M).
+	add(FamilyFlex, 0x56c0, 0x56c2)
+	// Data Center GPU Max series (PVC).
+	add(FamilyMax, 0x0b69, 0x0b69)
+	add(FamilyMax, 0x0b6e, 0x0b6e)
+	add(FamilyMax, 0x0bd0, 0x0bdb)
+	// Arc A-series (DG2) and B-series (BMG) GPUs.
+	add(FamilyArc, 0x5690, 0x56bf)
+	add(FamilyArc, 0xe202, 0xe216)
+
+	return families
+}()
+
+// GpuFamily returns the family name of the GPU with the given PCI device ID
+// (e.g. "0x56c0"), or empty string if the GPU is not in any family.
+func GpuFamily(pciDeviceID string) string {
+	return gpuFamilies[strings.ToLower(strings.TrimSpace(pciDeviceID))]
+}
@@ -42,6 +42,7 @@ import (
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/controllers/sgx"
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpgacontroller"
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fpgacontroller/patcher"
+	gpuwebhook "github.com/intel/intel-device-plugins-for-kubernetes/pkg/webhooks/gpu"
 	sgxwebhook "github.com/intel/intel-device-plugins-for-kubernetes/pkg/webhooks/sgx"
 )
 
@@ -103,6 +104,7 @@ func main() {
 		probeAddr             string
 		devicePluginNamespace string
 		enableLeaderElection  bool
+		gpuQuotas             bool
 		pm                    *patcher.Manager
 	)
 
@@ -116,6 +118,7 @@ func main() {
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.Var(&devices, "devices", "Device(s) to set up.")
+	flag.BoolVar(&gpuQuotas, "gpu-quotas", false, "Enforce the per-namespace GPU device caps and monitoring resource approvals of the namespace annotations.")
 	flag.Parse()
 
 	ctrl.SetLogger(textlogger.NewLogger(tlConf))
@@ -185,6 +188,13 @@ func main() {
 		}
 	}
 
+	if contains(devices, "gpu") {
+		if err = (&gpuwebhook.Validator{Client: mgr.GetClient(), Quotas: gpuQuotas}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			os.Exit(1)
+		}
+	}
+
 	if contains(devices, "fpga") {
 		pm = patcher.NewPatcherManager(mgr.GetLogger().WithName("webhooks").WithName("Fpga"))
 
@@ -19,11 +19,14 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-ini/ini"
@@ -42,6 +45,7 @@ const (
 	uioMountPath       = "/sys/class/uio"
 	pciDeviceDirectory = "/sys/bus/pci/devices"
 	pciDriverDirectory = "/sys/bus/pci/drivers"
+	debugfsDirectory   = "/sys/kernel/debug"
 	uioSuffix          = "uio"
 	iommuGroupSuffix   = "iommu_group"
 	vendorPrefix       = "8086 "
@@ -55,6 +59,9 @@ const (
 
 	// Resource name to use when device capabilities are not available.
 	defaultCapabilities = "generic"
+
+	// Resource name prefix of the VFs left to the kernel QAT VF driver.
+	kernelPrefix = "kernel-"
 )
 
 // QAT PCI VF Device ID -> kernel QAT VF device driver mappings.
@@ -111,6 +118,80 @@ func packedPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
 	return deviceIds
 }
 
+// pfGroupedPolicy is used for allocating the QAT VF devices from a single
+// QAT PF device when possible, for better isolation and locality. The PF
+// devices of MustIncludeDeviceIDs are used first, then the PF device with
+// the fewest available VFs which fit the request, so that the PF devices
+// with more VFs remain available for larger requests. If none fits, the VFs
+// are taken from the PF devices with the most available VFs. Falls back to
+// nonePolicy when the PF devices of the VFs are not known, e.g. in VMs.
+func (dp *DevicePlugin) pfGroupedPolicy(req *pluginapi.ContainerPreferredAllocationRequest) []string {
+	dp.vfLock.Lock()
+	vfPfs := dp.vfPfs
+	dp.vfLock.Unlock()
+
+	size := int(req.AllocationSize)
+	deviceIds := slices.Clone(req.MustIncludeDeviceIDs)
+	required := map[string]bool{}
+	groups := map[string][]string{}
+
+	for _, id := range deviceIds {
+		required[vfPfs[id]] = true
+	}
+
+	for _, id := range req.AvailableDeviceIDs {
+		pf, found := vfPfs[id]
+		if !found {
+			return nonePolicy(req)
+		}
+
+		if !slices.Contains(deviceIds, id) {
+			groups[pf] = append(groups[pf], id)
+		}
+	}
+
+	needed := size - len(deviceIds)
+
+	pfs := slices.Collect(maps.Keys(groups))
+	slices.SortFunc(pfs, func(a, b string) int {
+		fitA, fitB := len(groups[a]) >= needed, len(groups[b]) >= needed
+
+		switch {
+		case required[a] != required[b]:
+			return boolOrder(required[a])
+		case fitA != fitB:
+			return boolOrder(fitA)
+		case fitA && len(groups[a]) != len(groups[b]):
+			return len(groups[a]) - len(groups[b])
+		case len(groups[a]) != len(groups[b]):
+			return len(groups[b]) - len(groups[a])
+		}
+
+		return strings.Compare(a, b)
+	})
+
+	for _, pf := range pfs {
+		ids := groups[pf]
+		sort.Strings(ids)
+
+		deviceIds = append(deviceIds, ids[:min(len(ids), size-len(deviceIds))]...)
+		if len(deviceIds) >= size {
+			break
+		}
+	}
+
+	return deviceIds
+}
+
+// boolOrder returns the sort order of the true values first.
+func boolOrder(first bool) int {
+	if first {
+		return -1
+	}
+
+	return 1
+}
+
 // DevicePlugin represents vfio based QAT plugin.
 type DevicePlugin struct {
 	scanTicker *time.Ticker
@@ -119,39 +200,97 @@ type DevicePlugin struct {
 	// Note: If restarting the plugin with a new policy, the allocations for existing pods remain with old policy.
 	policy preferredAllocationPolicyFunc
 
+	// Health of the PF devices found by the previous scan.
+	pfHealth map[string]string
+
+	// Node labels written to nfdFeatureFile by the previous scan.
+	labels map[string]string
+
+	// PF device BDFs and resource names of the VF device BDFs found by
+	// the previous scan.
+	vfPfs       map[string]string
+	vfResources map[string]string
+	vfLock      sync.Mutex
+
+	metrics *metrics
+
 	pciDriverDir    string
 	pciDeviceDir    string
+	debugfsDir      string
 	dpdkDriver      string
+	nfdFeatureFile  string
 	kernelVfDrivers []string
 	maxDevices      int
+	kernelVfs       int
+	pfSharedDevNum  int
+	autoReset       bool
+}
+
+// Options configures the vfio based QAT plugin.
+type Options struct {
+	// Comma separated kernel VF drivers of the QAT devices, e.g. "4xxxvf".
+	KernelVfDrivers string
+	// DPDK driver the VF devices are bound to, e.g. "vfio-pci".
+	DpdkDriver string
+	// Preferred allocation policy, "balanced" or "packed".
+	AllocationPolicy string
+	// NFD feature file the node labels of the QAT devices are written to, if set.
+	NFDFeatureFile string
+	// Maximum number of the advertised devices.
+	MaxDevices int
+	// Number of VFs of each PF device left to the kernel QAT VF driver.
+	KernelVfs int
+	// Number of containers sharing a PF device without SR-IOV, 0 disables them.
+	PFSharedDevNum int
+	// Set the kernel driver to reset the PF devices on fatal errors,
+	// e.g. heartbeat failures.
+	AutoReset bool
 }
 
 // NewDevicePlugin returns new instance of vfio based QAT plugin.
-func NewDevicePlugin(maxDevices int, kernelVfDrivers string, dpdkDriver string, preferredAllocationPolicy string) (*DevicePlugin, error) {
-	if !isValidDpdkDeviceDriver(dpdkDriver) {
-		return nil, errors.Errorf("wrong DPDK device driver: %s", dpdkDriver)
+func NewDevicePlugin(opts Options) (*DevicePlugin, error) {
+	if !isValidDpdkDeviceDriver(opts.DpdkDriver) {
+		return nil, errors.Errorf("wrong DPDK device driver: %s", opts.DpdkDriver)
+	}
+
+	if opts.KernelVfs < 0 {
+		return nil, errors.Errorf("wrong number of kernel VFs: %d", opts.KernelVfs)
+	}
+
+	if opts.PFSharedDevNum < 0 {
+		return nil, errors.Errorf("wrong number of containers sharing a PF device: %d", opts.PFSharedDevNum)
 	}
 
-	kernelDrivers := strings.Split(kernelVfDrivers, ",")
+	kernelDrivers := strings.Split(opts.KernelVfDrivers, ",")
 	for _, driver := range kernelDrivers {
 		if !isValidKernelDriver(driver) {
 			return nil, errors.Errorf("wrong kernel VF driver: %s", driver)
 		}
 	}
 
-	allocationPolicyFunc := getAllocationPolicy(preferredAllocationPolicy)
-	if allocationPolicyFunc == nil {
-		return nil, errors.Errorf("wrong allocation policy: %s", preferredAllocationPolicy)
+	dp := newDevicePlugin(pciDriverDirectory, pciDeviceDirectory, opts.MaxDevices, kernelDrivers, opts.DpdkDriver, nil)
+
+	dp.policy = dp.getAllocationPolicy(opts.AllocationPolicy)
+	if dp.policy == nil {
+		return nil, errors.Errorf("wrong allocation policy: %s", opts.AllocationPolicy)
+	}
+	dp.autoReset = opts.AutoReset
+	dp.kernelVfs = opts.KernelVfs
+	dp.nfdFeatureFile = opts.NFDFeatureFile
+	dp.pfSharedDevNum = opts.PFSharedDevNum
+
+	if opts.NFDFeatureFile != "" {
+		go removeLabelsOnExit(opts.NFDFeatureFile)
 	}
 
-	return newDevicePlugin(pciDriverDirectory, pciDeviceDirectory, maxDevices, kernelDrivers, dpdkDriver, allocationPolicyFunc), nil
+	return dp, nil
 }
 
-// getAllocationPolicy returns a func that fits the policy given as a parameter. It returns nonePolicy when the flag is not set, and it returns nil when the policy is not valid value.
-func getAllocationPolicy(preferredAllocationPolicy string) preferredAllocationPolicyFunc {
+// getAllocationPolicy returns a func that fits the policy given as a parameter. It returns pfGroupedPolicy when the flag is not set, and it returns nil when the policy is not valid value.
+func (dp *DevicePlugin) getAllocationPolicy(preferredAllocationPolicy string) preferredAllocationPolicyFunc {
 	switch {
 	case !isFlagSet("allocation-policy"):
-		return nonePolicy
+		return dp.pfGroupedPolicy
 	case preferredAllocationPolicy == "packed":
 		return packedPolicy
 	case preferredAllocationPolicy == "balanced":
@@ -179,11 +318,16 @@ func newDevicePlugin(pciDriverDir, pciDeviceDir string, maxDevices int, kernelVf
 		maxDevices:      maxDevices,
 		pciDriverDir:    pciDriverDir,
 		pciDeviceDir:    pciDeviceDir,
+		debugfsDir:      debugfsDirectory,
 		kernelVfDrivers: kernelVfDrivers,
 		dpdkDriver:      dpdkDriver,
 		scanTicker:      time.NewTicker(scanPeriod),
 		scanDone:        make(chan bool, 1),
 		policy:          preferredAllocationPolicyFunc,
+		pfHealth:        map[string]string{},
+		vfPfs:           map[string]string{},
+		vfResources:     map[string]string{},
+		metrics:         newMetrics(),
 	}
 }
 
@@ -448,28 +592,45 @@ func getDeviceCapabilities(device string) (string, error) {
 		return defaultCapabilities, nil
 	}
 
-	switch readDeviceConfiguration(pfDev) {
-	case "sym;asym":
-		return "cy", nil
-	case "asym;sym":
-		return "cy", nil
-	case "dc":
-		return "dc", nil
-	case "sym":
-		return "sym", nil
-	case "asym":
-		return "asym", nil
-	case "asym;dc":
-		return "asym-dc", nil
-	case "dc;asym":
-		return "asym-dc", nil
-	case "sym;dc":
-		return "sym-dc", nil
-	case "dc;sym":
-		return "sym-dc", nil
-	default:
-		return defaultCapabilities, nil
+	return servicesResourceName(readDeviceConfiguration(pfDev)), nil
+}
+
+// servicesResourceName returns the resource name for the services enabled
+// on a QAT Gen4 device, i.e. the services in a fixed order separated by
+// '-', "cy" standing for both "sym" and "asym". For example "asym;dc" and
+// "dc;asym" are "asym-dc", and "sym;asym;dc" (420xx) is "cy-dc". Unset
+// services, and those already failed to read, are "generic".
+func servicesResourceName(services string) string {
+	if services == "" || services == defaultCapabilities {
+		return defaultCapabilities
 	}
+
+	order := []string{"sym", "asym", "dc", "dcc", "decomp"}
+	enabled := map[string]bool{}
+
+	for _, service := range strings.Split(services, ";") {
+		if !slices.Contains(order, service) || enabled[service] {
+			klog.Warningf("unsupported QAT services %q", services)
+			return defaultCapabilities
+		}
+
+		enabled[service] = true
+	}
+
+	names := []string{}
+
+	if enabled["sym"] && enabled["asym"] {
+		names = append(names, "cy")
+		order = order[2:]
+	}
+
+	for _, service := range order {
+		if enabled[service] {
+			names = append(names, service)
+		}
+	}
+
+	return strings.Join(names, "-")
 }
 
 func getDeviceID(device string) (string, error) {
@@ -522,6 +683,62 @@ func (dp *DevicePlugin) isValidVfDeviceID(vfDevID string) bool {
 	return false
 }
 
+// checkVf checks that the PF device of the VF is up, and still has the
+// services of the resource the VF was advertised for. PF devices not
+// reporting their state, e.g. before QAT Gen4, are not checked.
+func (dp *DevicePlugin) checkVf(vfBdf, pfBdf, resource string) error {
+	if pfBdf == "" {
+		return nil
+	}
+
+	pfDev, err := filepath.EvalSymlinks(filepath.Join(dp.pciDeviceDir, pfBdf))
+	if err != nil {
+		return errors.Wrapf(err, "PF device %s of VF %s not found", pfBdf, vfBdf)
+	}
+
+	state, err := os.ReadFile(filepath.Join(pfDev, "qat/state"))
+	if err != nil {
+		return nil
+	}
+
+	if strings.TrimSpace(string(state)) != "up" {
+		return errors.Errorf("PF device %s of VF %s is %s", pfBdf, vfBdf, strings.TrimSpace(string(state)))
+	}
+
+	cap, err := getDeviceCapabilities(filepath.Join(dp.pciDeviceDir, vfBdf))
+	if err != nil {
+		return err
+	}
+
+	if cap != strings.TrimPrefix(resource, kernelPrefix) {
+		return errors.Errorf("PF device %s of VF %s has %s services, VF was advertised for %s", pfBdf, vfBdf, cap, resource)
+	}
+
+	return nil
+}
+
+// Allocate implements Allocator interface for vfio based QAT plugin. It fails
+// the allocation of the VFs whose PF devices are not up, or have had their
+// services reconfigured since the previous scan, instead of giving the
+// workloads unusable VFs. Otherwise the default allocation is used.
+func (dp *DevicePlugin) Allocate(request *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
+	dp.vfLock.Lock()
+	vfPfs, vfResources := dp.vfPfs, dp.vfResources
+	dp.vfLock.Unlock()
+
+	for _, creq := range request.ContainerRequests {
+		for _, vfBdf := range creq.DevicesIDs {
+			if err := dp.checkVf(vfBdf, vfPfs[vfBdf], vfResources[vfBdf]); err != nil {
+				klog.Warningf("Failing allocation: %v", err)
+
+				return nil, err
+			}
+		}
+	}
+
+	return nil, &dpapi.UseDefaultMethodError{}
+}
+
 // PostAllocate implements PostAllocator interface for vfio based QAT plugin.
 func (dp *DevicePlugin) PostAllocate(response *pluginapi.AllocateResponse) error {
 	tempMap := make(map[string]string)
@@ -562,17 +779,67 @@ func getPciDevicesWithPattern(pattern string) (pciDevices []string) {
 	return
 }
 
-func (dp *DevicePlugin) getVfDevices() []string {
+// getPfDevices returns the PF devices bound to a known QAT PF driver.
+func (dp *DevicePlugin) getPfDevices() []string {
 	qatPfDevices := make([]string, 0)
-	qatVfDevices := make([]string, 0)
 
-	// Get PF BDFs bound to a known QAT PF driver
 	for _, vfDriver := range dp.kernelVfDrivers {
 		pfDriver := strings.TrimSuffix(vfDriver, "vf")
 		pattern := filepath.Join(dp.pciDriverDir, pfDriver, "????:??:??.?")
 		qatPfDevices = append(qatPfDevices, getPciDevicesWithPattern(pattern)...)
 	}
 
+	return qatPfDevices
+}
+
+// enableAutoReset sets the kernel driver to reset the PF device on fatal
+// errors, and to restore its VFs after that. Kernels before 6.8 do not
+// support it.
+func enableAutoReset(pfDev string) {
+	autoResetFile := filepath.Join(pfDev, "qat/auto_reset")
+
+	data, err := os.ReadFile(autoResetFile)
+	if err != nil {
+		klog.V(4).Infof("auto reset not supported for %s: %q", filepath.Base(pfDev), err)
+		return
+	}
+
+	if strings.TrimSpace(string(data)) == "on" {
+		return
+	}
+
+	if err = os.WriteFile(autoResetFile, []byte("on"), 0600); err != nil {
+		klog.Warningf("failed to enable auto reset for %s: %q", filepath.Base(pfDev), err)
+		return
+	}
+
+	klog.V(1).Infof("Enabled auto reset for %s", filepath.Base(pfDev))
+}
+
+// updatePfHealth logs the health changes of the PF devices.
+func (dp *DevicePlugin) updatePfHealth(pfHealth map[string]string) {
+	for pfDev, healthiness := range pfHealth {
+		if previous, found := dp.pfHealth[pfDev]; found && previous == healthiness {
+			continue
+		}
+
+		if healthiness == pluginapi.Unhealthy {
+			klog.Warningf("Heartbeat of %s failed, its VFs are unhealthy", filepath.Base(pfDev))
+			dp.metrics.heartbeatFailed(pfDev)
+		} else if dp.pfHealth[pfDev] == pluginapi.Unhealthy {
+			klog.Infof("Heartbeat of %s recovered, its VFs are healthy", filepath.Base(pfDev))
+		}
+	}
+
+	dp.pfHealth = pfHealth
+}
+
+func (dp *DevicePlugin) getVfDevices() []string {
+	qatVfDevices := make([]string, 0)
+
+	// Get PF BDFs bound to a known QAT PF driver
+	qatPfDevices := dp.getPfDevices()
+
 	// Get VF devices belonging to a valid QAT PF device
 	for _, qatPfDevice := range qatPfDevices {
 		pattern := filepath.Join(qatPfDevice, "virtfn*")
@@ -608,6 +875,48 @@ func (dp *DevicePlugin) getVfDevices() []string {
 	return qatVfDevices
 }
 
+// getKernelVfDevices returns the VF devices left to the kernel QAT VF driver,
+// i.e. the first kernelVfs VFs of each PF device, for the in-kernel crypto
+// users like IPsec and dm-crypt.
+func (dp *DevicePlugin) getKernelVfDevices() map[string]bool {
+	kernelVfDevices := map[string]bool{}
+
+	if dp.kernelVfs == 0 {
+		return kernelVfDevices
+	}
+
+	for _, qatPfDevice := range dp.getPfDevices() {
+		for i := 0; i < dp.kernelVfs; i++ {
+			vfDevice, err := filepath.EvalSymlinks(filepath.Join(qatPfDevice, fmt.Sprintf("virtfn%d", i)))
+			if err != nil {
+				break
+			}
+
+			kernelVfDevices[vfDevice] = true
+		}
+	}
+
+	return kernelVfDevices
+}
+
+// bindDriver binds the device to the driver, if it is not bound to it already.
+func (dp *DevicePlugin) bindDriver(device, driver string) error {
+	bdf := filepath.Base(device)
+
+	drv := getCurrentDriver(device)
+	if drv == driver {
+		return nil
+	}
+
+	if drv != "" {
+		if err := writeToDriver(filepath.Join(dp.pciDriverDir, drv, "unbind"), bdf); err != nil {
+			return err
+		}
+	}
+
+	return writeToDriver(filepath.Join(dp.pciDriverDir, driver, "bind"), bdf)
+}
+
 func getCurrentDriver(device string) string {
 	symlink := filepath.Join(device, "driver")
 
@@ -626,25 +935,35 @@ func (dp *DevicePlugin) scan() (dpapi.DeviceTree, error) {
 
 	pfHealthLookup := map[string]string{}
 
+	// VF counts by resource and health, and PF device resource names, for
+	// metrics and node labels.
+	vfCounts := map[string]map[string]int{}
+	pfServices := map[string]string{}
+	vfPfs := map[string]string{}
+	vfResources := map[string]string{}
+
+	if dp.autoReset {
+		for _, pfDev := range dp.getPfDevices() {
+			enableAutoReset(pfDev)
+		}
+	}
+
+	kernelVfDevices := dp.getKernelVfDevices()
+
 	for _, vfDevice := range dp.getVfDevices() {
 		vfBdf := filepath.Base(vfDevice)
+		driver := dp.dpdkDriver
 
-		if drv := getCurrentDriver(vfDevice); drv != dp.dpdkDriver {
-			if drv != "" {
-				err := writeToDriver(filepath.Join(dp.pciDriverDir, drv, "unbind"), vfBdf)
-				if err != nil {
-					return nil, err
-				}
-			}
-
-			err := writeToDriver(filepath.Join(dp.pciDriverDir, dp.dpdkDriver, "bind"), vfBdf)
+		if kernelVfDevices[vfDevice] {
+			devID, err := getDeviceID(vfDevice)
 			if err != nil {
 				return nil, err
 			}
+
+			driver = qatDeviceDriver[devID]
 		}
 
-		dpdkDeviceName, err := dp.getDpdkDevice(vfBdf)
-		if err != nil {
+		if err := dp.bindDriver(vfDevice, driver); err != nil {
 			return nil, err
 		}
 
@@ -655,17 +974,68 @@ func (dp *DevicePlugin) scan() (dpapi.DeviceTree, error) {
 
 		healthiness := getDeviceHealthiness(vfDevice, pfHealthLookup)
 
-		klog.V(1).Infof("Device %s with %s capabilities found (%s)", vfBdf, cap, healthiness)
+		resource := cap
+		if kernelVfDevices[vfDevice] {
+			resource = kernelPrefix + cap
+		}
+
+		if vfCounts[resource] == nil {
+			vfCounts[resource] = map[string]int{}
+		}
+
+		vfCounts[resource][healthiness]++
+		vfResources[vfBdf] = resource
+
+		if pfDev, err := filepath.EvalSymlinks(filepath.Join(vfDevice, "physfn")); err == nil {
+			pfServices[pfDev] = cap
+			vfPfs[vfBdf] = filepath.Base(pfDev)
+		}
 
 		n = n + 1
 		envs := map[string]string{
 			fmt.Sprintf("%s%d", envVarPrefix, n): vfBdf,
 		}
 
+		// The kernel VFs are used through the kernel crypto API, so
+		// the containers get no device nodes for them.
+		if kernelVfDevices[vfDevice] {
+			klog.V(1).Infof("Kernel device %s with %s capabilities found (%s)", vfBdf, cap, healthiness)
+
+			devTree.AddDevice(resource, vfBdf, dpapi.NewDeviceInfo(healthiness, nil, nil, envs, nil, nil))
+
+			continue
+		}
+
+		klog.V(1).Infof("Device %s with %s capabilities found (%s)", vfBdf, cap, healthiness)
+
+		dpdkDeviceName, err := dp.getDpdkDevice(vfBdf)
+		if err != nil {
+			return nil, err
+		}
+
 		devinfo := dpapi.NewDeviceInfo(healthiness, dp.getDpdkDeviceSpecs(dpdkDeviceName), dp.getDpdkMounts(dpdkDeviceName), envs, nil, nil)
 
 		devTree.AddDevice(cap, vfBdf, devinfo)
 	}
 
+	if dp.pfSharedDevNum > 0 {
+		if err := dp.addSharedPfDevices(devTree, n); err != nil {
+			return nil, err
+		}
+
+		if count := devTree.DeviceTypeCount(sharedPfResource); count > 0 {
+			vfCounts[sharedPfResource] = map[string]int{pluginapi.Healthy: count}
+		}
+	}
+
+	dp.updatePfHealth(pfHealthLookup)
+	dp.metrics.updateDevices(vfCounts, pfServices)
+	dp.updateLabels(pfServices)
+
+	dp.vfLock.Lock()
+	dp.vfPfs = vfPfs
+	dp.vfResources = vfResources
+	dp.vfLock.Unlock()
+
 	return devTree, nil
 }
@@ -15,6 +15,7 @@
 package dpdkdrv
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -23,8 +24,12 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
 
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
 
 	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
 )
@@ -68,6 +73,7 @@ func TestNewDevicePlugin(t *testing.T) {
 		name            string
 		dpdkDriver      string
 		kernelVfDrivers string
+		kernelVfs       int
 		expectedErr     bool
 	}{
 		{
@@ -88,6 +94,13 @@ func TestNewDevicePlugin(t *testing.T) {
 			kernelVfDrivers: "c6xxvf:d15xxvf",
 			expectedErr:     true,
 		},
+		{
+			name:            "Negative number of kernel VFs",
+			dpdkDriver:      "vfio-pci",
+			kernelVfDrivers: "4xxxvf",
+			kernelVfs:       -1,
+			expectedErr:     true,
+		},
 		{
 			name:            "No errors",
 			dpdkDriver:      "vfio-pci",
@@ -97,7 +110,12 @@ func TestNewDevicePlugin(t *testing.T) {
 	}
 	for _, tt := range tcases {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewDevicePlugin(1, tt.kernelVfDrivers, tt.dpdkDriver, "")
+			_, err := NewDevicePlugin(Options{
+				KernelVfDrivers: tt.kernelVfDrivers,
+				DpdkDriver:      tt.dpdkDriver,
+				MaxDevices:      1,
+				KernelVfs:       tt.kernelVfs,
+			})
 
 			if tt.expectedErr && err == nil {
 				t.Errorf("Test case '%s': expected error", tt.name)
@@ -161,6 +179,68 @@ func TestGetPreferredAllocation(t *testing.T) {
 	}
 }
 
+func TestPfGroupedPolicy(t *testing.T) {
+	plugin := newDevicePlugin("", "", 8, []string{""}, "", nil)
+	plugin.vfPfs = map[string]string{
+		"0000:02:00.1": "0000:02:00.0", "0000:02:00.2": "0000:02:00.0", "0000:02:00.3": "0000:02:00.0",
+		"0000:03:00.1": "0000:03:00.0", "0000:03:00.2": "0000:03:00.0",
+		"0000:04:00.1": "0000:04:00.0",
+	}
+
+	available := []string{"0000:04:00.1", "0000:02:00.3", "0000:03:00.1", "0000:02:00.1", "0000:03:00.2", "0000:02:00.2"}
+
+	tcases := []struct {
+		name        string
+		mustInclude []string
+		expected    []string
+		size        int32
+	}{
+		{
+			name:     "single VF from the PF with fewest VFs",
+			size:     1,
+			expected: []string{"0000:04:00.1"},
+		},
+		{
+			name:     "VFs from the smallest PF that fits",
+			size:     2,
+			expected: []string{"0000:03:00.1", "0000:03:00.2"},
+		},
+		{
+			name:     "VFs from the largest PFs when none fits",
+			size:     4,
+			expected: []string{"0000:02:00.1", "0000:02:00.2", "0000:02:00.3", "0000:03:00.1"},
+		},
+		{
+			name:        "VFs from the PF of the required VF",
+			size:        2,
+			mustInclude: []string{"0000:02:00.2"},
+			expected:    []string{"0000:02:00.2", "0000:02:00.1"},
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ids := plugin.pfGroupedPolicy(&pluginapi.ContainerPreferredAllocationRequest{
+				AvailableDeviceIDs:   available,
+				MustIncludeDeviceIDs: tc.mustInclude,
+				AllocationSize:       tc.size,
+			})
+
+			if !reflect.DeepEqual(ids, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, ids)
+			}
+		})
+	}
+
+	// PF devices of the VFs are not known.
+	plugin.vfPfs = map[string]string{}
+
+	ids := plugin.pfGroupedPolicy(&pluginapi.ContainerPreferredAllocationRequest{AvailableDeviceIDs: available, AllocationSize: 2})
+	if !reflect.DeepEqual(ids, available[:2]) {
+		t.Errorf("expected %v, got %v", available[:2], ids)
+	}
+}
+
 func TestScan(t *testing.T) {
 	tcases := []struct {
 		name                 string
@@ -684,6 +764,432 @@ func TestScan(t *testing.T) {
 		})
 	}
 }
+func TestHeartbeatRecovery(t *testing.T) {
+	tmpdir := t.TempDir()
+	pfDev := path.Join(tmpdir, "sys/devices/pci0000:02/0000:02:00.0")
+	hbStatusFile := path.Join(tmpdir, "sys/kernel/debug/qat_4xxx_0000:02:00.0/heartbeat/status")
+
+	err := createTestFiles(tmpdir,
+		[]string{
+			"sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/drivers/vfio-pci",
+			"sys/devices/pci0000:02/0000:02:00.0/qat",
+			"sys/kernel/debug/qat_4xxx_0000:02:00.0/heartbeat",
+			"sys/bus/pci/devices/0000:02:01.0",
+		},
+		map[string][]byte{
+			"sys/devices/pci0000:02/0000:02:00.0/device":              []byte("0x4940"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/state":           []byte("up"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/cfg_services":    []byte("sym;asym"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/auto_reset":      []byte("off"),
+			"sys/bus/pci/devices/0000:02:01.0/device":                 []byte("0x4941"),
+			"sys/kernel/debug/qat_4xxx_0000:02:00.0/heartbeat/status": []byte("-1"),
+		},
+		map[string]string{
+			"sys/bus/pci/devices/0000:02:01.0/iommu_group": "sys/kernel/iommu_groups/vfiotestfile",
+			"sys/bus/pci/devices/0000:02:01.0/physfn":      "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/drivers/4xxx/0000:02:00.0":        "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/devices/0000:02:00.0":             "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/devices/pci0000:02/0000:02:00.0/virtfn0":  "sys/bus/pci/devices/0000:02:01.0",
+			"sys/devices/pci0000:02/0000:02:00.0/driver":   "sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/devices/0000:02:01.0/driver":      "sys/bus/pci/drivers/vfio-pci",
+		})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	dp := newDevicePlugin(path.Join(tmpdir, "sys/bus/pci/drivers"), path.Join(tmpdir, "sys/bus/pci/devices"),
+		1, []string{"4xxxvf"}, "vfio-pci", nil)
+	dp.autoReset = true
+
+	expectHealth := func(step, expected string) {
+		tree, err := dp.scan()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %+v", step, err)
+		}
+
+		if healthiness := fmt.Sprintf("%+v", reflect.ValueOf(tree["cy"]["0000:02:01.0"]).FieldByName("state")); healthiness != expected {
+			t.Errorf("%s: expected VF to be %s, got %s", step, expected, healthiness)
+		}
+	}
+
+	expectHealth("heartbeat failed", pluginapi.Unhealthy)
+
+	if data, err := os.ReadFile(path.Join(pfDev, "qat/auto_reset")); err != nil || string(data) != "on" {
+		t.Errorf("expected auto reset to be enabled, got %q (%v)", data, err)
+	}
+
+	if err = os.WriteFile(hbStatusFile, []byte("0"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expectHealth("heartbeat recovered", pluginapi.Healthy)
+
+	if failures := metricValue(t, dp.metrics.heartbeatFailures.WithLabelValues("0000:02:00.0")); failures != 1 {
+		t.Errorf("expected 1 heartbeat failure, got %v", failures)
+	}
+}
+
+func TestKernelVfs(t *testing.T) {
+	tmpdir := t.TempDir()
+
+	err := createTestFiles(tmpdir,
+		[]string{
+			"sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/drivers/4xxxvf",
+			"sys/bus/pci/drivers/vfio-pci",
+			"sys/devices/pci0000:02/0000:02:00.0/qat",
+			"sys/bus/pci/devices/0000:02:01.0",
+			"sys/bus/pci/devices/0000:02:01.1",
+		},
+		map[string][]byte{
+			"sys/devices/pci0000:02/0000:02:00.0/device":           []byte("0x4940"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/state":        []byte("up"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/cfg_services": []byte("sym;asym"),
+			"sys/bus/pci/devices/0000:02:01.0/device":              []byte("0x4941"),
+			"sys/bus/pci/devices/0000:02:01.1/device":              []byte("0x4941"),
+		},
+		map[string]string{
+			"sys/bus/pci/devices/0000:02:01.0/iommu_group": "sys/kernel/iommu_groups/vfiotestfile",
+			"sys/bus/pci/devices/0000:02:01.1/iommu_group": "sys/kernel/iommu_groups/vfiotestfile2",
+			"sys/bus/pci/devices/0000:02:01.0/physfn":      "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/devices/0000:02:01.1/physfn":      "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/drivers/4xxx/0000:02:00.0":        "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/devices/0000:02:00.0":             "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/devices/pci0000:02/0000:02:00.0/virtfn0":  "sys/bus/pci/devices/0000:02:01.0",
+			"sys/devices/pci0000:02/0000:02:00.0/virtfn1":  "sys/bus/pci/devices/0000:02:01.1",
+			"sys/devices/pci0000:02/0000:02:00.0/driver":   "sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/devices/0000:02:01.0/driver":      "sys/bus/pci/drivers/vfio-pci",
+			"sys/bus/pci/devices/0000:02:01.1/driver":      "sys/bus/pci/drivers/4xxxvf",
+		})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	dp := newDevicePlugin(path.Join(tmpdir, "sys/bus/pci/drivers"), path.Join(tmpdir, "sys/bus/pci/devices"),
+		2, []string{"4xxxvf"}, "vfio-pci", nil)
+	dp.kernelVfs = 1
+
+	tree, err := dp.scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if len(tree["kernel-cy"]) != 1 || len(tree["cy"]) != 1 {
+		t.Fatalf("expected one kernel-cy and one cy device, got %v", tree)
+	}
+
+	if specs := reflect.ValueOf(tree["kernel-cy"]["0000:02:01.0"]).FieldByName("nodes"); specs.Len() != 0 {
+		t.Errorf("expected no device nodes for kernel VF, got %d", specs.Len())
+	}
+
+	for _, resource := range []string{"cy", "kernel-cy"} {
+		if advertised := metricValue(t, dp.metrics.advertised.WithLabelValues(resource, pluginapi.Healthy)); advertised != 1 {
+			t.Errorf("expected 1 advertised %s VF, got %v", resource, advertised)
+		}
+	}
+
+	if pfDevices := metricValue(t, dp.metrics.pfServices.WithLabelValues("cy")); pfDevices != 1 {
+		t.Errorf("expected 1 cy PF device, got %v", pfDevices)
+	}
+
+	for file, expected := range map[string]string{
+		"sys/bus/pci/drivers/vfio-pci/unbind": "0000:02:01.0",
+		"sys/bus/pci/drivers/4xxxvf/bind":     "0000:02:01.0",
+		"sys/bus/pci/drivers/4xxxvf/unbind":   "0000:02:01.1",
+		"sys/bus/pci/drivers/vfio-pci/bind":   "0000:02:01.1",
+	} {
+		if data, err := os.ReadFile(path.Join(tmpdir, file)); err != nil || string(data) != expected {
+			t.Errorf("expected %s to be written to %s, got %q (%v)", expected, file, data, err)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tmpdir := t.TempDir()
+	pfDev := path.Join(tmpdir, "sys/devices/pci0000:02/0000:02:00.0")
+
+	err := createTestFiles(tmpdir,
+		[]string{
+			"sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/drivers/vfio-pci",
+			"sys/devices/pci0000:02/0000:02:00.0/qat",
+			"sys/bus/pci/devices/0000:02:01.0",
+		},
+		map[string][]byte{
+			"sys/devices/pci0000:02/0000:02:00.0/device":           []byte("0x4940"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/state":        []byte("up"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/cfg_services": []byte("sym;asym"),
+			"sys/bus/pci/devices/0000:02:01.0/device":              []byte("0x4941"),
+		},
+		map[string]string{
+			"sys/bus/pci/devices/0000:02:01.0/iommu_group": "sys/kernel/iommu_groups/vfiotestfile",
+			"sys/bus/pci/devices/0000:02:01.0/physfn":      "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/drivers/4xxx/0000:02:00.0":        "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/devices/0000:02:00.0":             "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/devices/pci0000:02/0000:02:00.0/virtfn0":  "sys/bus/pci/devices/0000:02:01.0",
+			"sys/devices/pci0000:02/0000:02:00.0/driver":   "sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/devices/0000:02:01.0/driver":      "sys/bus/pci/drivers/vfio-pci",
+		})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	dp := newDevicePlugin(path.Join(tmpdir, "sys/bus/pci/drivers"), path.Join(tmpdir, "sys/bus/pci/devices"),
+		1, []string{"4xxxvf"}, "vfio-pci", nil)
+
+	if _, err = dp.scan(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	request := &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"0000:02:01.0"}}},
+	}
+
+	tcases := []struct {
+		name        string
+		file        string
+		value       string
+		expectedErr bool
+	}{
+		{
+			name: "PF device up with the advertised services",
+		},
+		{
+			name:        "PF device services reconfigured",
+			file:        "qat/cfg_services",
+			value:       "dc",
+			expectedErr: true,
+		},
+		{
+			name:        "PF device down",
+			file:        "qat/state",
+			value:       "down",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.file != "" {
+				if err := os.WriteFile(path.Join(pfDev, tc.file), []byte(tc.value), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := dp.Allocate(request)
+
+			var defaultErr *dpapi.UseDefaultMethodError
+
+			if isDefault := errors.As(err, &defaultErr); isDefault == tc.expectedErr {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestSharedPfDevices(t *testing.T) {
+	tmpdir := t.TempDir()
+
+	err := createTestFiles(tmpdir,
+		[]string{
+			"sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/drivers/vfio-pci",
+			"sys/bus/pci/devices",
+			"sys/devices/pci0000:02/0000:02:00.0",
+			"sys/devices/pci0000:03/0000:03:00.0",
+		},
+		map[string][]byte{
+			"sys/devices/pci0000:02/0000:02:00.0/device":         []byte("0x4940"),
+			"sys/devices/pci0000:03/0000:03:00.0/device":         []byte("0x4940"),
+			"sys/devices/pci0000:03/0000:03:00.0/sriov_totalvfs": []byte("16"),
+		},
+		map[string]string{
+			"sys/bus/pci/devices/0000:02:00.0":                "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/devices/0000:03:00.0":                "sys/devices/pci0000:03/0000:03:00.0",
+			"sys/devices/pci0000:02/0000:02:00.0/driver":      "sys/bus/pci/drivers/4xxx",
+			"sys/devices/pci0000:03/0000:03:00.0/driver":      "sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/drivers/4xxx/0000:02:00.0":           "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/drivers/4xxx/0000:03:00.0":           "sys/devices/pci0000:03/0000:03:00.0",
+			"sys/devices/pci0000:02/0000:02:00.0/iommu_group": "sys/kernel/iommu_groups/vfiotestfile",
+		})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	dp := newDevicePlugin(path.Join(tmpdir, "sys/bus/pci/drivers"), path.Join(tmpdir, "sys/bus/pci/devices"),
+		4, []string{"4xxxvf"}, "vfio-pci", nil)
+	dp.pfSharedDevNum = 2
+
+	tree, err := dp.scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if len(tree) != 1 || len(tree[sharedPfResource]) != 2 {
+		t.Fatalf("expected 2 shared PF devices of the PF without SR-IOV, got %v", tree)
+	}
+
+	if _, found := tree[sharedPfResource]["0000:02:00.0-1"]; !found {
+		t.Errorf("expected device ID 0000:02:00.0-1, got %v", tree[sharedPfResource])
+	}
+
+	for file, expected := range map[string]string{
+		"sys/devices/pci0000:02/0000:02:00.0/driver_override": "vfio-pci",
+		"sys/bus/pci/drivers/4xxx/unbind":                     "0000:02:00.0",
+		"sys/bus/pci/drivers/vfio-pci/bind":                   "0000:02:00.0",
+	} {
+		if data, err := os.ReadFile(path.Join(tmpdir, file)); err != nil || string(data) != expected {
+			t.Errorf("expected %s to be written to %s, got %q (%v)", expected, file, data, err)
+		}
+	}
+}
+
+func TestNodeLabels(t *testing.T) {
+	tmpdir := t.TempDir()
+	labelFile := path.Join(tmpdir, "features.d/intel-qat-labels.txt")
+
+	err := createTestFiles(tmpdir,
+		[]string{
+			"sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/drivers/vfio-pci",
+			"sys/devices/pci0000:02/0000:02:00.0/qat",
+			"sys/devices/pci0000:03/0000:03:00.0/qat",
+			"sys/kernel/debug/qat_4xxx_0000:02:00.0/version",
+			"sys/kernel/debug/qat_4xxx_0000:03:00.0/version",
+			"sys/bus/pci/devices/0000:02:01.0",
+			"sys/bus/pci/devices/0000:03:01.0",
+		},
+		map[string][]byte{
+			"sys/devices/pci0000:02/0000:02:00.0/device":           []byte("0x4940"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/state":        []byte("up"),
+			"sys/devices/pci0000:02/0000:02:00.0/qat/cfg_services": []byte("sym;asym"),
+			"sys/devices/pci0000:03/0000:03:00.0/device":           []byte("0x4940"),
+			"sys/devices/pci0000:03/0000:03:00.0/qat/state":        []byte("up"),
+			"sys/devices/pci0000:03/0000:03:00.0/qat/cfg_services": []byte("dc"),
+			"sys/kernel/debug/qat_4xxx_0000:02:00.0/version/fw":    []byte("4.7.0\n"),
+			"sys/kernel/debug/qat_4xxx_0000:03:00.0/version/fw":    []byte("4.7.0\n"),
+			"sys/bus/pci/devices/0000:02:01.0/device":              []byte("0x4941"),
+			"sys/bus/pci/devices/0000:03:01.0/device":              []byte("0x4941"),
+		},
+		map[string]string{
+			"sys/bus/pci/devices/0000:02:01.0/iommu_group": "sys/kernel/iommu_groups/vfiotestfile",
+			"sys/bus/pci/devices/0000:03:01.0/iommu_group": "sys/kernel/iommu_groups/vfiotestfile2",
+			"sys/bus/pci/devices/0000:02:01.0/physfn":      "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/devices/0000:03:01.0/physfn":      "sys/devices/pci0000:03/0000:03:00.0",
+			"sys/bus/pci/drivers/4xxx/0000:02:00.0":        "sys/devices/pci0000:02/0000:02:00.0",
+			"sys/bus/pci/drivers/4xxx/0000:03:00.0":        "sys/devices/pci0000:03/0000:03:00.0",
+			"sys/devices/pci0000:02/0000:02:00.0/virtfn0":  "sys/bus/pci/devices/0000:02:01.0",
+			"sys/devices/pci0000:03/0000:03:00.0/virtfn0":  "sys/bus/pci/devices/0000:03:01.0",
+			"sys/devices/pci0000:02/0000:02:00.0/driver":   "sys/bus/pci/drivers/4xxx",
+			"sys/devices/pci0000:03/0000:03:00.0/driver":   "sys/bus/pci/drivers/4xxx",
+			"sys/bus/pci/devices/0000:02:01.0/driver":      "sys/bus/pci/drivers/vfio-pci",
+			"sys/bus/pci/devices/0000:03:01.0/driver":      "sys/bus/pci/drivers/vfio-pci",
+		})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	dp := newDevicePlugin(path.Join(tmpdir, "sys/bus/pci/drivers"), path.Join(tmpdir, "sys/bus/pci/devices"),
+		2, []string{"4xxxvf"}, "vfio-pci", nil)
+	dp.nfdFeatureFile = labelFile
+	dp.debugfsDir = path.Join(tmpdir, "sys/kernel/debug")
+
+	if _, err = dp.scan(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	expected := "qat.intel.com/firmware-version=4.7.0\n" +
+		"qat.intel.com/generation=4xxx\n" +
+		"qat.intel.com/services.cy=true\n" +
+		"qat.intel.com/services.dc=true\n"
+
+	if data, err := os.ReadFile(labelFile); err != nil || string(data) != expected {
+		t.Errorf("expected labels:\n%s\ngot (%v):\n%s", expected, err, data)
+	}
+}
+
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := metric.Write(m); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if m.Counter != nil {
+		return m.Counter.GetValue()
+	}
+
+	return m.Gauge.GetValue()
+}
+
+// mockPodResources lists the given pod resources.
+type mockPodResources struct {
+	podresourcesv1.PodResourcesListerClient
+	resources []*podresourcesv1.PodResources
+}
+
+func (m *mockPodResources) List(context.Context, *podresourcesv1.ListPodResourcesRequest, ...grpc.CallOption) (*podresourcesv1.ListPodResourcesResponse, error) {
+	return &podresourcesv1.ListPodResourcesResponse{PodResources: m.resources}, nil
+}
+
+func TestAllocatedMetrics(t *testing.T) {
+	m := newMetrics()
+
+	client := &mockPodResources{
+		resources: []*podresourcesv1.PodResources{{
+			Name: "pod",
+			Containers: []*podresourcesv1.ContainerResources{{
+				Name: "container",
+				Devices: []*podresourcesv1.ContainerDevices{
+					{ResourceName: "qat.intel.com/cy", DeviceIds: []string{"0000:02:01.0", "0000:02:01.1"}},
+					{ResourceName: "qat.intel.com/dc", DeviceIds: []string{"0000:03:01.0"}},
+					{ResourceName: "gpu.intel.com/i915", DeviceIds: []string{"card0-0"}},
+				},
+			}},
+		}},
+	}
+
+	if err := m.updateAllocated(client, "qat.intel.com/"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	for resource, expected := range map[string]float64{"cy": 2, "dc": 1, "gpu.intel.com/i915": 0} {
+		if allocated := metricValue(t, m.allocated.WithLabelValues(resource)); allocated != expected {
+			t.Errorf("expected %v allocated %s VFs, got %v", expected, resource, allocated)
+		}
+	}
+}
+
+func TestServicesResourceName(t *testing.T) {
+	tcases := map[string]string{
+		"sym;asym":    "cy",
+		"asym;sym":    "cy",
+		"dc":          "dc",
+		"sym":         "sym",
+		"asym":        "asym",
+		"dc;asym":     "asym-dc",
+		"sym;dc":      "sym-dc",
+		"sym;asym;dc": "cy-dc",
+		"dc;asym;sym": "cy-dc",
+		"dcc":         "dcc",
+		"decomp":      "decomp",
+		"sym;decomp":  "sym-decomp",
+		"asym;decomp": "asym-decomp",
+		"sym;sym":     "generic",
+		"sym;foo":     "generic",
+		"":            "generic",
+		"generic":     "generic",
+	}
+
+	for services, expected := range tcases {
+		if name := servicesResourceName(services); name != expected {
+			t.Errorf("services %q: expected %s, got %s", services, expected, name)
+		}
+	}
+}
+
 func eleInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
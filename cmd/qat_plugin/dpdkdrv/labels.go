@@ -0,0 +1,156 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dpdkdrv
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+const (
+	labelNamespace = "qat.intel.com/"
+
+	generationLabel = labelNamespace + "generation"
+	firmwareLabel   = labelNamespace + "firmware-version"
+	servicesLabel   = labelNamespace + "services."
+)
+
+// getFirmwareVersion returns the firmware version of the PF device from
+// debugfs, or empty string if the driver does not report it.
+func getFirmwareVersion(debugfsDir, pfDev string) string {
+	fwFile := filepath.Join(debugfsDir,
+		fmt.Sprintf("qat_%s_%s/version/fw", getCurrentDriver(pfDev), filepath.Base(pfDev)))
+
+	data, err := os.ReadFile(fwFile)
+	if err != nil {
+		klog.V(4).Infof("no firmware version for %s: %q", filepath.Base(pfDev), err)
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// addCommonLabel adds a label with the value all PF devices have. Label is
+// not added if the values differ, or are not valid label values.
+func addCommonLabel(labels map[string]string, name string, values []string) {
+	if len(values) == 0 || values[0] == "" {
+		return
+	}
+
+	for _, value := range values[1:] {
+		if value != values[0] {
+			klog.V(2).Infof("QAT devices have different %s values, not labeling: %q", name, values)
+			return
+		}
+	}
+
+	if errs := validation.IsValidLabelValue(values[0]); len(errs) > 0 {
+		klog.Warningf("Invalid %s label value '%s': %s", name, values[0], strings.Join(errs, ", "))
+		return
+	}
+
+	labels[name] = values[0]
+}
+
+// createLabels returns the node labels for the PF devices, given their
+// resource names: the device generation (i.e. PF driver name, e.g. "4xxx")
+// and firmware version common to all PF devices, and a label for each of
+// the configured services, e.g. "qat.intel.com/services.cy=true".
+func createLabels(debugfsDir string, pfServices map[string]string) map[string]string {
+	labels := map[string]string{}
+	generations := []string{}
+	firmwares := []string{}
+
+	for _, pfDev := range slices.Sorted(maps.Keys(pfServices)) {
+		generations = append(generations, getCurrentDriver(pfDev))
+		firmwares = append(firmwares, getFirmwareVersion(debugfsDir, pfDev))
+		labels[servicesLabel+pfServices[pfDev]] = "true"
+	}
+
+	addCommonLabel(labels, generationLabel, generations)
+	addCommonLabel(labels, firmwareLabel, firmwares)
+
+	return labels
+}
+
+// writeLabels atomically writes the labels to the NFD feature file.
+func writeLabels(labelFile string, labels map[string]string) error {
+	var sb strings.Builder
+
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		sb.WriteString(name + "=" + labels[name] + "\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(labelFile), 0755); err != nil {
+		return errors.Wrap(err, "failed to create NFD feature directory")
+	}
+
+	// NFD ignores the hidden files.
+	tmpFile := filepath.Join(filepath.Dir(labelFile), "."+filepath.Base(labelFile))
+
+	if err := os.WriteFile(tmpFile, []byte(sb.String()), 0644); err != nil {
+		return errors.Wrap(err, "failed to write labels")
+	}
+
+	return os.Rename(tmpFile, labelFile)
+}
+
+// updateLabels writes the node labels of the PF devices to the NFD feature
+// file, when they have changed.
+func (dp *DevicePlugin) updateLabels(pfServices map[string]string) {
+	if dp.nfdFeatureFile == "" {
+		return
+	}
+
+	labels := createLabels(dp.debugfsDir, pfServices)
+	if maps.Equal(labels, dp.labels) {
+		return
+	}
+
+	klog.V(1).Infof("Writing node labels %v", labels)
+
+	if err := writeLabels(dp.nfdFeatureFile, labels); err != nil {
+		klog.Warningf("failed to write node labels: %+v", err)
+		return
+	}
+
+	dp.labels = labels
+}
+
+// removeLabelsOnExit removes the NFD feature file, and so the node labels,
+// when the plugin is terminated.
+func removeLabelsOnExit(labelFile string) {
+	interruptChan := make(chan os.Signal, 1)
+	signal.Notify(interruptChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
+
+	interrupt := <-interruptChan
+	klog.V(2).Infof("Interrupt %d received, removing label file", interrupt)
+
+	if err := os.Remove(labelFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		klog.Errorf("Failed to cleanup label file: %+v", err)
+	}
+
+	os.Exit(0)
+}
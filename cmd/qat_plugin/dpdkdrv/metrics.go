@@ -0,0 +1,121 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dpdkdrv
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/podresources"
+)
+
+// Period of updating the VF allocation metrics from kubelet PodResources.
+const allocationPeriod = 30 * time.Second
+
+// metrics are the QAT VF metrics exposed in Prometheus format.
+type metrics struct {
+	registry          *prometheus.Registry
+	advertised        *prometheus.GaugeVec
+	allocated         *prometheus.GaugeVec
+	pfServices        *prometheus.GaugeVec
+	heartbeatFailures *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		advertised: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "qat_vfs_advertised",
+			Help: "Number of QAT VFs advertised to kubelet, by resource and health.",
+		}, []string{"resource", "health"}),
+		allocated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "qat_vfs_allocated",
+			Help: "Number of QAT VFs allocated to the pods on the node, by resource.",
+		}, []string{"resource"}),
+		pfServices: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "qat_pf_devices",
+			Help: "Number of QAT PF devices, by the services configured on them.",
+		}, []string{"services"}),
+		heartbeatFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "qat_heartbeat_failures_total",
+			Help: "Number of detected QAT PF device heartbeat failures, by PF device.",
+		}, []string{"device"}),
+	}
+
+	m.registry.MustRegister(m.advertised, m.allocated, m.pfServices, m.heartbeatFailures)
+
+	return m
+}
+
+// updateDevices sets the advertised VF and PF device metrics from the scanned
+// VF counts by resource and health, and the PF device resource names.
+func (m *metrics) updateDevices(vfs map[string]map[string]int, pfServices map[string]string) {
+	m.advertised.Reset()
+
+	for resource, healthCounts := range vfs {
+		for health, count := range healthCounts {
+			m.advertised.WithLabelValues(resource, health).Set(float64(count))
+		}
+	}
+
+	m.pfServices.Reset()
+
+	for _, services := range pfServices {
+		m.pfServices.WithLabelValues(services).Inc()
+	}
+}
+
+// heartbeatFailed counts a heartbeat failure of the PF device.
+func (m *metrics) heartbeatFailed(pfDev string) {
+	m.heartbeatFailures.WithLabelValues(filepath.Base(pfDev)).Inc()
+}
+
+// updateAllocated sets the allocated VF metrics from the devices of the
+// resources with the given full resource name prefix, allocated to the pods.
+func (m *metrics) updateAllocated(client podresourcesv1.PodResourcesListerClient, resourcePrefix string) error {
+	resp, err := podresources.List(client)
+	if err != nil {
+		return err
+	}
+
+	m.allocated.Reset()
+
+	for _, podRes := range resp.PodResources {
+		for _, cont := range podRes.Containers {
+			for _, dev := range cont.Devices {
+				if resource, found := strings.CutPrefix(dev.ResourceName, resourcePrefix); found {
+					m.allocated.WithLabelValues(resource).Add(float64(len(dev.DeviceIds)))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ServeMetrics serves the QAT VF metrics at /metrics of the given address,
+// updating the allocated VF metrics of the resources in the given namespace
+// from kubelet PodResources every allocationPeriod.
+func (dp *DevicePlugin) ServeMetrics(address, namespace string) {
+	go podresources.Poll(allocationPeriod, "QAT VF allocation metrics update", func(client podresourcesv1.PodResourcesListerClient) error {
+		return dp.metrics.updateAllocated(client, namespace+"/")
+	})
+
+	podresources.ServeMetrics(address, dp.metrics.registry)
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dpdkdrv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+)
+
+// Resource name of the shared PF devices.
+const sharedPfResource = "pf"
+
+// QAT PCI PF Device ID -> kernel QAT PF device driver mappings.
+var qatPfDeviceDriver = map[string]string{
+	"0434": "dh895xcc",
+	"0435": "dh895xcc",
+	"18a0": "c4xxx",
+	"19e2": "c3xxx",
+	"4940": "4xxx",
+	"4942": "4xxx",
+	"4944": "4xxx",
+	"4946": "420xx",
+	"37c8": "c6xx",
+	"6f54": "d15xx",
+}
+
+// hasSriov tells whether the PF device supports SR-IOV VFs.
+func hasSriov(pfDev string) bool {
+	data, err := os.ReadFile(filepath.Join(pfDev, "sriov_totalvfs"))
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(data)) != "0"
+}
+
+// getSharedPfDevices returns the QAT PF devices of the enabled drivers, which
+// do not support SR-IOV, e.g. on client platforms.
+func (dp *DevicePlugin) getSharedPfDevices() []string {
+	pfDevices := []string{}
+
+	pattern := filepath.Join(dp.pciDeviceDir, "????:??:??.?")
+	for _, pciDev := range getPciDevicesWithPattern(pattern) {
+		devID, err := getDeviceID(pciDev)
+		if err != nil {
+			continue
+		}
+
+		driver, ok := qatPfDeviceDriver[devID]
+		if !ok || hasSriov(pciDev) {
+			continue
+		}
+
+		for _, vfDriver := range dp.kernelVfDrivers {
+			if driver+"vf" == vfDriver {
+				pfDevices = append(pfDevices, pciDev)
+				break
+			}
+		}
+	}
+
+	return pfDevices
+}
+
+// addSharedPfDevices binds the QAT PF devices without SR-IOV to the DPDK
+// driver, and adds them to the device tree, each with pfSharedDevNum device
+// IDs for the containers sharing it. n is the number of devices added before.
+func (dp *DevicePlugin) addSharedPfDevices(devTree dpapi.DeviceTree, n int) error {
+	for _, pfDev := range dp.getSharedPfDevices() {
+		pfBdf := filepath.Base(pfDev)
+
+		if getCurrentDriver(pfDev) != dp.dpdkDriver {
+			// The DPDK driver does not know the PF device IDs.
+			if err := writeToDriver(filepath.Join(pfDev, "driver_override"), dp.dpdkDriver); err != nil {
+				return err
+			}
+
+			if err := dp.bindDriver(pfDev, dp.dpdkDriver); err != nil {
+				return err
+			}
+		}
+
+		dpdkDeviceName, err := dp.getDpdkDevice(pfBdf)
+		if err != nil {
+			return err
+		}
+
+		klog.V(1).Infof("Shared PF device %s found", pfBdf)
+
+		for i := 0; i < dp.pfSharedDevNum; i++ {
+			n = n + 1
+			envs := map[string]string{
+				fmt.Sprintf("%s%d", envVarPrefix, n): pfBdf,
+			}
+
+			devinfo := dpapi.NewDeviceInfo(pluginapi.Healthy, dp.getDpdkDeviceSpecs(dpdkDeviceName), dp.getDpdkMounts(dpdkDeviceName), envs, nil, nil)
+
+			devTree.AddDevice(sharedPfResource, fmt.Sprintf("%s-%d", pfBdf, i), devinfo)
+		}
+	}
+
+	return nil
+}
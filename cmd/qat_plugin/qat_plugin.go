@@ -18,6 +18,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path"
 
 	"github.com/pkg/errors"
 
@@ -29,6 +30,9 @@ import (
 
 const (
 	namespace = "qat.intel.com"
+
+	nfdFeatureDir = "/etc/kubernetes/node-feature-discovery/features.d"
+	labelFilename = "intel-qat-labels.txt"
 )
 
 func main() {
@@ -43,11 +47,30 @@ func main() {
 	kernelVfDrivers := flag.String("kernel-vf-drivers", "4xxxvf,420xxvf", "Comma separated VF Device Driver of the QuickAssist Devices in the system. Devices supported: DH895xCC, C62x, C3xxx, C4xxx, 4xxx, 420xxx, and D15xx")
 	preferredAllocationPolicy := flag.String("allocation-policy", "", "Modes of allocating QAT devices: balanced and packed")
 	maxNumDevices := flag.Int("max-num-devices", 64, "maximum number of QAT devices to be provided to the QuickAssist device plugin")
+	autoReset := flag.Bool("auto-reset", false, "enable automatic reset of the QAT devices on fatal errors, e.g. heartbeat failures (Linux 6.8+)")
+	kernelVfs := flag.Int("kernel-vfs", 0, "number of VFs of each QAT device left to the kernel QAT VF driver for in-kernel crypto users, advertised as kernel-<services> resources (dpdk mode only)")
+	metricsAddress := flag.String("metrics-address", "", "address to serve Prometheus metrics of the QAT VFs at, e.g. :8080 (dpdk mode only, default: disabled)")
+	nodeLabels := flag.Bool("node-labels", false, "write QAT node labels (device generation, firmware version and services) to NFD feature file (dpdk mode only)")
+	pfSharedDevNum := flag.Int("pf-shared-dev-num", 0, "number of containers sharing a QAT PF device without SR-IOV, e.g. on client platforms, 0 disables using such PF devices (dpdk mode only)")
 	flag.Parse()
 
+	nfdFeatureFile := ""
+	if *nodeLabels {
+		nfdFeatureFile = path.Join(nfdFeatureDir, labelFilename)
+	}
+
 	switch *mode {
 	case "dpdk":
-		plugin, err = dpdkdrv.NewDevicePlugin(*maxNumDevices, *kernelVfDrivers, *dpdkDriver, *preferredAllocationPolicy)
+		plugin, err = dpdkdrv.NewDevicePlugin(dpdkdrv.Options{
+			KernelVfDrivers:  *kernelVfDrivers,
+			DpdkDriver:       *dpdkDriver,
+			AllocationPolicy: *preferredAllocationPolicy,
+			NFDFeatureFile:   nfdFeatureFile,
+			MaxDevices:       *maxNumDevices,
+			KernelVfs:        *kernelVfs,
+			PFSharedDevNum:   *pfSharedDevNum,
+			AutoReset:        *autoReset,
+		})
 	case "kernel":
 		plugin = kerneldrv.NewDevicePlugin()
 	default:
@@ -61,6 +84,10 @@ func main() {
 
 	klog.V(1).Infof("QAT device plugin started in '%s' mode", *mode)
 
+	if dpdkPlugin, ok := plugin.(*dpdkdrv.DevicePlugin); ok && *metricsAddress != "" {
+		dpdkPlugin.ServeMetrics(*metricsAddress, namespace)
+	}
+
 	manager := deviceplugin.NewManager(namespace, plugin)
 
 	manager.Run()
@@ -19,22 +19,27 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"syscall"
 
-	"github.com/klauspost/cpuid/v2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/sgx"
 )
 
 const (
 	namespace = "sgx.intel.com"
 	epc       = "epc"
 	capable   = "capable"
+	epcNode   = "epc-node"
 )
 
 type patchNodeOp struct {
@@ -55,13 +60,7 @@ func main() {
 	klog.Infof("starting sgx_epchook")
 
 	// get the EPC size
-	var epcSize uint64
-
-	if cpuid.CPU.SGX.Available {
-		for _, s := range cpuid.CPU.SGX.EPCSections {
-			epcSize += s.EPCSize
-		}
-	}
+	epcSize := sgx.CPUIDEPC()
 
 	klog.Infof("epc capacity: %d bytes", epcSize)
 
@@ -69,13 +68,22 @@ func main() {
 		klog.Fatal("SGX EPC is not available")
 	}
 
-	if err := updateNode(epcSize, register, label); err != nil {
+	nodeEPC := sgx.NumaEPC(sgx.SysfsNodeDirectory)
+	for _, node := range slices.Sorted(maps.Keys(nodeEPC)) {
+		klog.Infof("epc capacity of NUMA node %d: %d bytes", node, nodeEPC[node])
+	}
+
+	if err := updateNode(epcSize, nodeEPC, register, label); err != nil {
 		klog.Fatal(err.Error())
 	}
 
 	// if the "register" flag is FALSE, we assume that sgx_epchook is used as NFD hook
 	if !register {
-		fmt.Printf("%s/%s=%d", namespace, epc, epcSize)
+		fmt.Printf("%s/%s=%d\n", namespace, epc, epcSize)
+
+		for _, node := range slices.Sorted(maps.Keys(nodeEPC)) {
+			fmt.Printf("%s/%s%d=%d\n", namespace, epcNode, node, nodeEPC[node])
+		}
 	}
 
 	if daemon {
@@ -88,8 +96,9 @@ func main() {
 	}
 }
 
-func updateNode(epcSize uint64, register, label bool) error {
-	// create patch payload
+// nodePatch returns the node patch registering the EPC as extended resource,
+// and labeling the node with the EPC capacity of its NUMA nodes.
+func nodePatch(epcSize uint64, nodeEPC map[int]uint64, register, label bool) []patchNodeOp {
 	payload := []patchNodeOp{}
 	if register {
 		payload = append(payload, patchNodeOp{
@@ -105,8 +114,23 @@ func updateNode(epcSize uint64, register, label bool) error {
 			Path:  fmt.Sprintf("/metadata/labels/%s~1%s", namespace, capable),
 			Value: "true",
 		})
+
+		// per NUMA node EPC capacity, e.g. sgx.intel.com/epc-node0=<bytes>
+		for _, node := range slices.Sorted(maps.Keys(nodeEPC)) {
+			payload = append(payload, patchNodeOp{
+				Op:    "add",
+				Path:  fmt.Sprintf("/metadata/labels/%s~1%s%d", namespace, epcNode, node),
+				Value: strconv.FormatUint(nodeEPC[node], 10),
+			})
+		}
 	}
 
+	return payload
+}
+
+func updateNode(epcSize uint64, nodeEPC map[int]uint64, register, label bool) error {
+	// create patch payload
+	payload := nodePatch(epcSize, nodeEPC, register, label)
 	if len(payload) == 0 {
 		return nil
 	}
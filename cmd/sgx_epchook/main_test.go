@@ -0,0 +1,102 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/sgx"
+)
+
+func TestNodePatch(t *testing.T) {
+	tcases := []struct {
+		nodeFiles map[string]string
+		name      string
+		expected  []patchNodeOp
+		epcSize   uint64
+		register  bool
+		label     bool
+	}{
+		{
+			name:     "nothing to patch",
+			epcSize:  12582912,
+			expected: []patchNodeOp{},
+		},
+		{
+			name:     "register EPC",
+			epcSize:  12582912,
+			register: true,
+			expected: []patchNodeOp{
+				{Op: "add", Path: "/status/capacity/sgx.intel.com~1epc", Value: uint64(12582912)},
+			},
+		},
+		{
+			name:     "no EPC to label",
+			label:    true,
+			expected: []patchNodeOp{},
+		},
+		{
+			name:    "label without NUMA information",
+			epcSize: 12582912,
+			label:   true,
+			expected: []patchNodeOp{
+				{Op: "add", Path: "/metadata/labels/sgx.intel.com~1capable", Value: "true"},
+			},
+		},
+		{
+			name: "register and label NUMA nodes",
+			nodeFiles: map[string]string{
+				"node0/x86/sgx_total_bytes": "8388608\n",
+				"node1/x86/sgx_total_bytes": "4194304\n",
+				"node2/x86/sgx_total_bytes": "0\n",
+			},
+			epcSize:  12582912,
+			register: true,
+			label:    true,
+			expected: []patchNodeOp{
+				{Op: "add", Path: "/status/capacity/sgx.intel.com~1epc", Value: uint64(12582912)},
+				{Op: "add", Path: "/metadata/labels/sgx.intel.com~1capable", Value: "true"},
+				{Op: "add", Path: "/metadata/labels/sgx.intel.com~1epc-node0", Value: "8388608"},
+				{Op: "add", Path: "/metadata/labels/sgx.intel.com~1epc-node1", Value: "4194304"},
+			},
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+
+			for name, content := range tc.nodeFiles {
+				file := filepath.Join(root, name)
+
+				if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			payload := nodePatch(tc.epcSize, sgx.NumaEPC(root), tc.register, tc.label)
+			if !reflect.DeepEqual(payload, tc.expected) {
+				t.Errorf("expected patch %+v, got %+v", tc.expected, payload)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+
+	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/sgx"
+)
+
+const (
+	deviceTypeEPC = "epc_units"
+
+	// NUMA node of the EPC when the NUMA nodes of EPC sections are not known.
+	unknownNode = -1
+)
+
+// epcSizes returns the EPC size in bytes of each NUMA node, or the total
+// EPC size for unknownNode, when the kernel does not report the NUMA nodes.
+func (dp *devicePlugin) epcSizes() map[int]uint64 {
+	if sizes := sgx.NumaEPC(dp.sysfsNodeDir); len(sizes) > 0 {
+		return sizes
+	}
+
+	if size := dp.hostEPC(); size > 0 {
+		return map[int]uint64{unknownNode: size}
+	}
+
+	return nil
+}
+
+// addEPCUnits adds the EPC sizes of the NUMA nodes to the device tree as units
+// of epcUnit bytes, with the NUMA node of the EPC as the topology hint, so that
+// the enclaves can be aligned with the CPUs of the socket owning the EPC.
+func (dp *devicePlugin) addEPCUnits(devTree dpapi.DeviceTree, sgxEnclavePath string, epcSizes map[int]uint64) {
+	nodes := []pluginapi.DeviceSpec{{HostPath: sgxEnclavePath, ContainerPath: sgxEnclavePath, Permissions: "rw"}}
+
+	for node, size := range epcSizes {
+		var topology *pluginapi.TopologyInfo
+
+		prefix := "epc"
+
+		if node != unknownNode {
+			topology = &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: int64(node)}}}
+			prefix = fmt.Sprintf("epc-node%d", node)
+		}
+
+		units := size / dp.epcUnit
+
+		klog.V(2).Infof("EPC of %d bytes on NUMA node %d advertised as %d units", size, node, units)
+
+		for i := uint64(0); i < units; i++ {
+			devID := fmt.Sprintf("%s-%d", prefix, i)
+			devTree.AddDevice(deviceTypeEPC, devID, dpapi.NewDeviceInfoWithTopologyHints(pluginapi.Healthy, nodes, nil, nil, nil, topology, nil))
+		}
+	}
+}
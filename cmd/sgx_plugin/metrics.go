@@ -0,0 +1,153 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/podresources"
+)
+
+const (
+	// Period of updating the allocation metrics from kubelet PodResources.
+	allocationPeriod = 30 * time.Second
+
+	// NUMA node label value of the EPC without NUMA information.
+	unknownNodeLabel = "unknown"
+)
+
+// metrics are the SGX resource metrics exposed in Prometheus format.
+type metrics struct {
+	registry     *prometheus.Registry
+	advertised   *prometheus.GaugeVec
+	allocated    *prometheus.GaugeVec
+	epc          *prometheus.GaugeVec
+	epcAllocated *prometheus.GaugeVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		advertised: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "sgx_devices_advertised",
+			Help: "Number of SGX devices advertised to kubelet, by resource.",
+		}, []string{"resource"}),
+		allocated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "sgx_devices_allocated",
+			Help: "Number of SGX devices allocated to the pods on the node, by resource.",
+		}, []string{"resource"}),
+		epc: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "sgx_epc_bytes",
+			Help: "Size of the EPC advertised as EPC units, by NUMA node.",
+		}, []string{"numa_node"}),
+		epcAllocated: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "sgx_epc_allocated_bytes",
+			Help: "Size of the EPC units allocated to the pods on the node, by NUMA node.",
+		}, []string{"numa_node"}),
+	}
+
+	m.registry.MustRegister(m.advertised, m.allocated, m.epc, m.epcAllocated)
+
+	return m
+}
+
+// nodeLabel returns the NUMA node label value of the EPC.
+func nodeLabel(node int) string {
+	if node == unknownNode {
+		return unknownNodeLabel
+	}
+
+	return strconv.Itoa(node)
+}
+
+// epcUnitNode returns the NUMA node label value of the EPC unit device ID.
+func epcUnitNode(devID string) string {
+	node, found := strings.CutPrefix(devID, "epc-node")
+	if !found {
+		return unknownNodeLabel
+	}
+
+	node, _, _ = strings.Cut(node, "-")
+
+	return node
+}
+
+// updateDevices sets the advertised device metrics from the scanned device
+// tree, and the EPC metrics from the EPC sizes of the NUMA nodes.
+func (m *metrics) updateDevices(devTree dpapi.DeviceTree, epcSizes map[int]uint64) {
+	m.advertised.Reset()
+
+	for resource, devices := range devTree {
+		m.advertised.WithLabelValues(resource).Set(float64(len(devices)))
+	}
+
+	m.epc.Reset()
+
+	for node, size := range epcSizes {
+		m.epc.WithLabelValues(nodeLabel(node)).Set(float64(size))
+	}
+}
+
+// updateAllocated sets the allocated device and EPC metrics from the devices
+// of the SGX resources allocated to the pods.
+func (m *metrics) updateAllocated(client podresourcesv1.PodResourcesListerClient, epcUnit uint64) error {
+	resp, err := podresources.List(client)
+	if err != nil {
+		return err
+	}
+
+	m.allocated.Reset()
+	m.epcAllocated.Reset()
+
+	for _, podRes := range resp.PodResources {
+		for _, cont := range podRes.Containers {
+			for _, dev := range cont.Devices {
+				resource, found := strings.CutPrefix(dev.ResourceName, namespace+"/")
+				if !found {
+					continue
+				}
+
+				m.allocated.WithLabelValues(resource).Add(float64(len(dev.DeviceIds)))
+
+				if resource != deviceTypeEPC {
+					continue
+				}
+
+				for _, devID := range dev.DeviceIds {
+					m.epcAllocated.WithLabelValues(epcUnitNode(devID)).Add(float64(epcUnit))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// serveMetrics serves the SGX resource metrics at /metrics of the given
+// address, updating the allocation metrics from kubelet PodResources every
+// allocationPeriod.
+func (dp *devicePlugin) serveMetrics(address string) {
+	go podresources.Poll(allocationPeriod, "SGX allocation metrics update", func(client podresourcesv1.PodResourcesListerClient) error {
+		return dp.metrics.updateAllocated(client, dp.epcUnit)
+	})
+
+	podresources.ServeMetrics(address, dp.metrics.registry)
+}
@@ -23,6 +23,8 @@ import (
 	"strconv"
 
 	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/sgx"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/klog/v2"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
@@ -35,21 +37,41 @@ const (
 	devicePath                  = "/dev"
 	podsPerCoreEnvVariable      = "PODS_PER_CORE"
 	defaultPodCount        uint = 110
+
+	// Default path of the DCAP quote provider library configuration, which
+	// holds the PCCS endpoint.
+	qcnlConfigPath = "/etc/sgx_default_qcnl.conf"
+
+	// Minimum size of the EPC units, which keeps the number of advertised
+	// devices reasonable, e.g. 256 units for 256MiB of EPC.
+	minEPCUnit = 1024 * 1024
 )
 
 type devicePlugin struct {
-	scanDone   chan bool
-	devfsDir   string
+	scanDone     chan bool
+	metrics      *metrics
+	hostEPC      func() uint64
+	devfsDir     string
+	sysfsNodeDir string
+	// Host paths of the DCAP quote provider library and its configuration
+	// mounted to the containers using "provision" resources.
+	qplLibrary string
+	qcnlConfig string
 	nEnclave   uint
 	nProvision uint
+	// Size of the advertised EPC units in bytes, 0 disables EPC units.
+	epcUnit uint64
 }
 
 func newDevicePlugin(devfsDir string, nEnclave, nProvision uint) *devicePlugin {
 	return &devicePlugin{
-		devfsDir:   devfsDir,
-		nEnclave:   nEnclave,
-		nProvision: nProvision,
-		scanDone:   make(chan bool, 1),
+		devfsDir:     devfsDir,
+		sysfsNodeDir: sgx.SysfsNodeDirectory,
+		hostEPC:      sgx.CPUIDEPC,
+		nEnclave:     nEnclave,
+		nProvision:   nProvision,
+		scanDone:     make(chan bool, 1),
+		metrics:      newMetrics(),
 	}
 }
 
@@ -90,15 +112,51 @@ func (dp *devicePlugin) scan() (dpapi.DeviceTree, error) {
 		devTree.AddDevice(deviceTypeEnclave, devID, dpapi.NewDeviceInfoWithTopologyHints(pluginapi.Healthy, nodes, nil, nil, nil, nil, nil))
 	}
 
+	mounts := dp.attestationMounts()
+
 	for i := uint(0); i < dp.nProvision; i++ {
 		devID := fmt.Sprintf("%s-%d", "sgx-provision", i)
 		nodes := []pluginapi.DeviceSpec{{HostPath: sgxProvisionPath, ContainerPath: sgxProvisionPath, Permissions: "rw"}}
-		devTree.AddDevice(deviceTypeProvision, devID, dpapi.NewDeviceInfoWithTopologyHints(pluginapi.Healthy, nodes, nil, nil, nil, nil, nil))
+		devTree.AddDevice(deviceTypeProvision, devID, dpapi.NewDeviceInfoWithTopologyHints(pluginapi.Healthy, nodes, mounts, nil, nil, nil, nil))
+	}
+
+	var epcSizes map[int]uint64
+
+	if dp.epcUnit > 0 {
+		epcSizes = dp.epcSizes()
+		dp.addEPCUnits(devTree, sgxEnclavePath, epcSizes)
 	}
 
+	dp.metrics.updateDevices(devTree, epcSizes)
+
 	return devTree, nil
 }
 
+// attestationMounts returns the read-only mounts of the DCAP quote provider
+// library and its configuration for generating quotes in the containers. The
+// files missing from the host are not mounted.
+func (dp *devicePlugin) attestationMounts() []pluginapi.Mount {
+	var mounts []pluginapi.Mount
+
+	for _, mount := range []pluginapi.Mount{
+		{HostPath: dp.qplLibrary, ContainerPath: dp.qplLibrary, ReadOnly: true},
+		{HostPath: dp.qcnlConfig, ContainerPath: qcnlConfigPath, ReadOnly: true},
+	} {
+		if mount.HostPath == "" {
+			continue
+		}
+
+		if _, err := os.Stat(mount.HostPath); err != nil {
+			klog.Warningf("Not mounting %s to the containers: %v", mount.HostPath, err)
+			continue
+		}
+
+		mounts = append(mounts, mount)
+	}
+
+	return mounts
+}
+
 func getDefaultPodCount(nCPUs uint) uint {
 	// By default we provide as many enclave resources as there can be pods
 	// running on the node. The problem is that this value is configurable
@@ -118,18 +176,59 @@ func getDefaultPodCount(nCPUs uint) uint {
 	return defaultPodCount
 }
 
+// parseEPCUnit returns the EPC unit size in bytes, or 0 when the EPC units
+// are disabled.
+func parseEPCUnit(epcUnit string) (uint64, error) {
+	if epcUnit == "" {
+		return 0, nil
+	}
+
+	quantity, err := resource.ParseQuantity(epcUnit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", epcUnit, err)
+	}
+
+	if quantity.Value() < minEPCUnit {
+		return 0, fmt.Errorf("%s is below the minimum of 1Mi", epcUnit)
+	}
+
+	return uint64(quantity.Value()), nil
+}
+
 func main() {
-	var enclaveLimit, provisionLimit uint
+	var (
+		enclaveLimit, provisionLimit    uint
+		epcUnit, qplLibrary, qcnlConfig string
+		metricsAddress                  string
+	)
 
 	podCount := getDefaultPodCount(uint(runtime.NumCPU()))
 
 	flag.UintVar(&enclaveLimit, "enclave-limit", podCount, "Number of \"enclave\" resources")
 	flag.UintVar(&provisionLimit, "provision-limit", podCount, "Number of \"provision\" resources")
+	flag.StringVar(&epcUnit, "epc-unit", "", "Size of the \"epc_units\" resources advertising the EPC per NUMA node, e.g. \"4Mi\" (default: disabled)")
+	flag.StringVar(&qplLibrary, "qpl-library", "", "Host path of the DCAP quote provider library mounted to the containers using \"provision\" resources")
+	flag.StringVar(&qcnlConfig, "qcnl-config", "", "Host path of the DCAP quote provider library configuration with the PCCS endpoint, mounted to the containers using \"provision\" resources as "+qcnlConfigPath)
+	flag.StringVar(&metricsAddress, "metrics-address", "", "Address to serve Prometheus metrics of the SGX resources at, e.g. :8080 (default: disabled)")
 	flag.Parse()
 
+	epcUnitBytes, err := parseEPCUnit(epcUnit)
+	if err != nil {
+		klog.Errorf("Invalid EPC unit size: %v", err)
+		os.Exit(1)
+	}
+
 	klog.V(4).Infof("SGX device plugin started with %d \"%s/enclave\" resources and %d \"%s/provision\" resources.", enclaveLimit, namespace, provisionLimit, namespace)
 
 	plugin := newDevicePlugin(devicePath, enclaveLimit, provisionLimit)
+	plugin.epcUnit = epcUnitBytes
+	plugin.qplLibrary = qplLibrary
+	plugin.qcnlConfig = qcnlConfig
+
+	if metricsAddress != "" {
+		plugin.serveMetrics(metricsAddress)
+	}
+
 	manager := dpapi.NewManager(namespace, plugin)
 	manager.Run()
 }
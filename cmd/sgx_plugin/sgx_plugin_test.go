@@ -15,11 +15,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+
 	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
 )
 
@@ -86,6 +93,29 @@ func TestPodCount(t *testing.T) {
 	}
 }
 
+func TestParseEPCUnit(t *testing.T) {
+	tcases := []struct {
+		epcUnit     string
+		expected    uint64
+		expectedErr bool
+	}{
+		{epcUnit: "", expected: 0},
+		{epcUnit: "4Mi", expected: 4194304},
+		{epcUnit: "1Mi", expected: 1048576},
+		{epcUnit: "1Ki", expectedErr: true},
+		{epcUnit: "1", expectedErr: true},
+		{epcUnit: "-4Mi", expectedErr: true},
+		{epcUnit: "four", expectedErr: true},
+	}
+
+	for _, tc := range tcases {
+		size, err := parseEPCUnit(tc.epcUnit)
+		if (err != nil) != tc.expectedErr || size != tc.expected {
+			t.Errorf("%q: expected %d (error: %v), got %d (%v)", tc.epcUnit, tc.expected, tc.expectedErr, size, err)
+		}
+	}
+}
+
 func TestScan(t *testing.T) {
 	tcases := []struct {
 		name                   string
@@ -178,3 +208,159 @@ func TestScan(t *testing.T) {
 		})
 	}
 }
+
+func TestEPCUnits(t *testing.T) {
+	root := t.TempDir()
+	devfs := path.Join(root, "dev")
+	sysfs := path.Join(root, "sys/devices/system/node")
+
+	for _, dir := range []string{devfs, path.Join(sysfs, "node0/x86"), path.Join(sysfs, "node1/x86")} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, data := range map[string]string{
+		path.Join(devfs, "sgx_enclave"):               "",
+		path.Join(devfs, "sgx_provision"):             "",
+		path.Join(sysfs, "node0/x86/sgx_total_bytes"): "8388608\n",
+		path.Join(sysfs, "node1/x86/sgx_total_bytes"): "4194304\n",
+	} {
+		if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin := newDevicePlugin(devfs, 1, 1)
+	plugin.sysfsNodeDir = sysfs
+	plugin.epcUnit = 2 * 1024 * 1024
+	plugin.hostEPC = func() uint64 { return 6 * 1024 * 1024 }
+
+	tree, err := plugin.scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if units := len(tree[deviceTypeEPC]); units != 6 {
+		t.Errorf("expected 6 EPC units, got %d", units)
+	}
+
+	topology := reflect.ValueOf(tree[deviceTypeEPC]["epc-node1-1"]).FieldByName("topology")
+	if topology.IsNil() || topology.Elem().FieldByName("Nodes").Len() != 1 ||
+		topology.Elem().FieldByName("Nodes").Index(0).Elem().FieldByName("ID").Int() != 1 {
+		t.Errorf("expected EPC unit on NUMA node 1, got %+v", topology)
+	}
+
+	// NUMA nodes of the EPC are not known.
+	plugin.sysfsNodeDir = path.Join(root, "missing")
+
+	if tree, err = plugin.scan(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if _, found := tree[deviceTypeEPC]["epc-2"]; !found || len(tree[deviceTypeEPC]) != 3 {
+		t.Errorf("expected 3 EPC units without NUMA nodes, got %v", tree[deviceTypeEPC])
+	}
+}
+
+func TestAttestationMounts(t *testing.T) {
+	root := t.TempDir()
+	devfs := path.Join(root, "dev")
+	qplLibrary := path.Join(root, "usr/lib/libdcap_quoteprov.so.1")
+
+	for _, dir := range []string{devfs, path.Dir(qplLibrary)} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, file := range []string{path.Join(devfs, "sgx_enclave"), path.Join(devfs, "sgx_provision"), qplLibrary} {
+		if err := os.WriteFile(file, []byte{}, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin := newDevicePlugin(devfs, 1, 1)
+	plugin.qplLibrary = qplLibrary
+	plugin.qcnlConfig = path.Join(root, "etc/missing_qcnl.conf")
+
+	tree, err := plugin.scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	mounts := reflect.ValueOf(tree[deviceTypeProvision]["sgx-provision-0"]).FieldByName("mounts")
+	if mounts.Len() != 1 || mounts.Index(0).FieldByName("HostPath").String() != qplLibrary {
+		t.Errorf("expected only the quote provider library mount, got %+v", mounts)
+	}
+
+	if mounts := reflect.ValueOf(tree[deviceTypeEnclave]["sgx-enclave-0"]).FieldByName("mounts"); mounts.Len() != 0 {
+		t.Errorf("expected no enclave mounts, got %+v", mounts)
+	}
+}
+
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := metric.Write(m); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	return m.Gauge.GetValue()
+}
+
+// mockPodResources lists the given pod resources.
+type mockPodResources struct {
+	podresourcesv1.PodResourcesListerClient
+	resources []*podresourcesv1.PodResources
+}
+
+func (m *mockPodResources) List(context.Context, *podresourcesv1.ListPodResourcesRequest, ...grpc.CallOption) (*podresourcesv1.ListPodResourcesResponse, error) {
+	return &podresourcesv1.ListPodResourcesResponse{PodResources: m.resources}, nil
+}
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics()
+
+	m.updateDevices(dpapi.DeviceTree{
+		deviceTypeEnclave:   {"sgx-enclave-0": {}, "sgx-enclave-1": {}},
+		deviceTypeProvision: {"sgx-provision-0": {}},
+	}, map[int]uint64{0: 8388608, 1: 4194304})
+
+	client := &mockPodResources{
+		resources: []*podresourcesv1.PodResources{{
+			Name: "pod",
+			Containers: []*podresourcesv1.ContainerResources{{
+				Name: "container",
+				Devices: []*podresourcesv1.ContainerDevices{
+					{ResourceName: "sgx.intel.com/enclave", DeviceIds: []string{"sgx-enclave-0"}},
+					{ResourceName: "sgx.intel.com/epc_units", DeviceIds: []string{"epc-node1-0", "epc-node1-1", "epc-node0-3"}},
+					{ResourceName: "qat.intel.com/cy", DeviceIds: []string{"0000:02:01.0"}},
+				},
+			}},
+		}},
+	}
+
+	if err := m.updateAllocated(client, 1048576); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		metric   prometheus.Metric
+		name     string
+		expected float64
+	}{
+		{name: "advertised enclaves", metric: m.advertised.WithLabelValues(deviceTypeEnclave), expected: 2},
+		{name: "advertised provisions", metric: m.advertised.WithLabelValues(deviceTypeProvision), expected: 1},
+		{name: "node 1 EPC", metric: m.epc.WithLabelValues("1"), expected: 4194304},
+		{name: "allocated enclaves", metric: m.allocated.WithLabelValues(deviceTypeEnclave), expected: 1},
+		{name: "allocated EPC units", metric: m.allocated.WithLabelValues(deviceTypeEPC), expected: 3},
+		{name: "allocated node 1 EPC", metric: m.epcAllocated.WithLabelValues("1"), expected: 2097152},
+		{name: "allocated node 0 EPC", metric: m.epcAllocated.WithLabelValues("0"), expected: 1048576},
+	} {
+		if value := metricValue(t, tc.metric); value != tc.expected {
+			t.Errorf("expected %v %s, got %v", tc.expected, tc.name, value)
+		}
+	}
+}
@@ -20,6 +20,13 @@ for i in $(accel-config list | jq -r '.[].dev' | grep ${OPT} "dsa"); do
 
 done
 
+# The workqueue configuration of the DsaDevicePlugin CR, passed by the operator.
+if [ -n "${IDXD_CONFIG:-}" ]; then
+
+    echo "$IDXD_CONFIG" > scratch/"$DEV".conf
+
+fi
+
 for i in $(accel-config list --idle | jq -r '.[].dev' | grep ${OPT} "dsa" | sed -e 's/.*\([0-9]\+\)/\1/'); do
 
     config="$DEV.conf"
@@ -28,6 +35,8 @@ for i in $(accel-config list --idle | jq -r '.[].dev' | grep ${OPT} "dsa" | sed
 
     [ -f "conf/$DEV-$NODE_NAME.conf" ] && config="conf/$DEV-$NODE_NAME.conf"
 
+    [ -n "${IDXD_CONFIG:-}" ] && config="scratch/$DEV.conf"
+
     sed "s/X/${i}/g" < "$config" > scratch/"$DEV${i}.conf"
 
     cmd accel-config load-config -e -c scratch/"$DEV${i}.conf"
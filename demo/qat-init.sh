@@ -3,54 +3,86 @@
 NODE_NAME="${NODE_NAME:-}"
 ENABLED_QAT_PF_PCIIDS=${ENABLED_QAT_PF_PCIIDS:-37c8 4940 4942 4944 4946}
 DEVS=$(for pf in $ENABLED_QAT_PF_PCIIDS; do lspci -n | grep -e "$pf" | grep -o -e "^\\S*"; done)
-SERVICES_LIST="sym asym sym;asym dc sym;dc asym;dc"
+SERVICES_LIST="sym asym sym;asym dc sym;dc asym;dc sym;asym;dc dcc decomp sym;decomp asym;decomp"
 QAT_4XXX_DEVICE_PCI_ID="0x4940"
 QAT_401XX_DEVICE_PCI_ID="0x4942"
 QAT_402XX_DEVICE_PCI_ID="0x4944"
 QAT_420XX_DEVICE_PCI_ID="0x4946"
 SERVICES_ENABLED="NONE"
 SERVICES_ENABLED_FOUND="FALSE"
+# Services set by the operator: for all devices, and per device as
+# space separated "<PCI address>=<services>" entries.
+QAT_SERVICES="${QAT_SERVICES:-}"
+QAT_DEVICE_SERVICES="${QAT_DEVICE_SERVICES:-}"
+# Number of VFs to enable on each device, all VFs by default.
+QAT_NUMVFS="${QAT_NUMVFS:-}"
+
+is_valid_services() {
+  for SERVICE in $SERVICES_LIST
+  do
+    if [ "$SERVICE" = "$1" ]; then
+      return 0
+    fi
+  done
+  return 1
+}
 
 check_config() {
-  [ -f "conf/qat.conf" ] && SERVICES_ENABLED=$(cut -d= -f 2 conf/qat.conf | grep '\S')
-  [ -f "conf/qat-$NODE_NAME.conf" ] && SERVICES_ENABLED=$(cut -d= -f 2 conf/qat-$NODE_NAME.conf | grep '\S')
+  if [ -n "$QAT_SERVICES" ]; then
+    SERVICES_ENABLED="$QAT_SERVICES"
+  else
+    [ -f "conf/qat.conf" ] && SERVICES_ENABLED=$(cut -d= -f 2 conf/qat.conf | grep '\S')
+    [ -f "conf/qat-$NODE_NAME.conf" ] && SERVICES_ENABLED=$(cut -d= -f 2 conf/qat-$NODE_NAME.conf | grep '\S')
+  fi
 
-  if [ "$SERVICES_ENABLED" != "NONE" ]; then
-    SERVICES_ENABLED_FOUND="FALSE"
-    for SERVICE in $SERVICES_LIST
-    do
-      if [ "$SERVICE" = "$SERVICES_ENABLED" ]; then
-        SERVICES_ENABLED_FOUND="TRUE"
-        break
-      fi
-    done
+  if [ "$SERVICES_ENABLED" != "NONE" ] && is_valid_services "$SERVICES_ENABLED"; then
+    SERVICES_ENABLED_FOUND="TRUE"
   fi
 }
 
-sysfs_config() {
+device_services() {
+  for ENTRY in $QAT_DEVICE_SERVICES; do
+    if [ "${ENTRY%%=*}" = "0000:$1" ]; then
+      is_valid_services "${ENTRY#*=}" && echo "${ENTRY#*=}"
+      return
+    fi
+  done
   if [ "$SERVICES_ENABLED_FOUND" = "TRUE" ]; then
-    for dev in $DEVS; do
-      DEVPATH="/sys/bus/pci/devices/0000:$dev"
-      PCI_DEV=$(cat "$DEVPATH"/device 2> /dev/null)
-      if [ "$PCI_DEV" != "$QAT_4XXX_DEVICE_PCI_ID" ] && [ "$PCI_DEV" != "$QAT_401XX_DEVICE_PCI_ID" ] && [ "$PCI_DEV" != "$QAT_402XX_DEVICE_PCI_ID" ] && [ "$PCI_DEV" != "$QAT_420XX_DEVICE_PCI_ID" ]; then
-        continue
-      fi
+    echo "$SERVICES_ENABLED"
+  fi
+}
 
-      CURRENT_SERVICES=$(cat "$DEVPATH"/qat/cfg_services)
-      if [ "$CURRENT_SERVICES" != "$SERVICES_ENABLED" ]; then
-        CURRENT_STATE=$(cat "$DEVPATH"/qat/state)
-        if [ "$CURRENT_STATE" = "up" ]; then
-          echo down > "$DEVPATH"/qat/state
-        fi
-        echo "$SERVICES_ENABLED" > "$DEVPATH"/qat/cfg_services
-        CURRENT_SERVICES=$(cat "$DEVPATH"/qat/cfg_services)
+sysfs_config() {
+  for dev in $DEVS; do
+    DEVPATH="/sys/bus/pci/devices/0000:$dev"
+    PCI_DEV=$(cat "$DEVPATH"/device 2> /dev/null)
+    if [ "$PCI_DEV" != "$QAT_4XXX_DEVICE_PCI_ID" ] && [ "$PCI_DEV" != "$QAT_401XX_DEVICE_PCI_ID" ] && [ "$PCI_DEV" != "$QAT_402XX_DEVICE_PCI_ID" ] && [ "$PCI_DEV" != "$QAT_420XX_DEVICE_PCI_ID" ]; then
+      continue
+    fi
+
+    DEV_SERVICES=$(device_services "$dev")
+    if [ -z "$DEV_SERVICES" ]; then
+      continue
+    fi
+
+    CURRENT_SERVICES=$(cat "$DEVPATH"/qat/cfg_services)
+    if [ "$CURRENT_SERVICES" != "$DEV_SERVICES" ]; then
+      CURRENT_STATE=$(cat "$DEVPATH"/qat/state)
+      if [ "$CURRENT_STATE" = "up" ]; then
+        echo down > "$DEVPATH"/qat/state
       fi
-      echo "Device $dev configured with services: $CURRENT_SERVICES"
-    done
-  fi
+      echo "$DEV_SERVICES" > "$DEVPATH"/qat/cfg_services
+      CURRENT_SERVICES=$(cat "$DEVPATH"/qat/cfg_services)
+    fi
+    echo "Device $dev configured with services: $CURRENT_SERVICES"
+  done
 }
 
 enable_sriov() {
+  if [ -n "$QAT_NUMVFS" ] && ! [ "$QAT_NUMVFS" -gt 0 ] 2> /dev/null; then
+    echo "error: invalid number of VFs: $QAT_NUMVFS"
+    exit 1
+  fi
   for dev in $DEVS; do
   DEVPATH="/sys/bus/pci/devices/0000:$dev"
   NUMVFS="$DEVPATH/sriov_numvfs"
@@ -58,11 +90,21 @@ enable_sriov() {
     echo "error: $NUMVFS is not found or not writable. Check if QAT driver module is loaded"
     exit 1
   fi
-  if [ "$(cat "$NUMVFS")" -ne 0 ]; then
+  TOTALVFS=$(cat "$DEVPATH/sriov_totalvfs")
+  REQUESTED_VFS="$TOTALVFS"
+  if [ -n "$QAT_NUMVFS" ] && [ "$QAT_NUMVFS" -lt "$TOTALVFS" ]; then
+    REQUESTED_VFS="$QAT_NUMVFS"
+  fi
+  CURRENT_VFS=$(cat "$NUMVFS")
+  if [ "$CURRENT_VFS" -eq "$REQUESTED_VFS" ] || { [ "$CURRENT_VFS" -ne 0 ] && [ -z "$QAT_NUMVFS" ]; }; then
     echo "$DEVPATH already configured"
-  else
-    tee "$NUMVFS" < "$DEVPATH/sriov_totalvfs"
+    continue
+  fi
+  # The number of VFs can be changed only by disabling them first.
+  if [ "$CURRENT_VFS" -ne 0 ]; then
+    echo 0 > "$NUMVFS"
   fi
+  echo "$REQUESTED_VFS" | tee "$NUMVFS"
   done
 }
 
@@ -40,6 +40,11 @@ type DsaDevicePluginSpec struct {
 	// Specialized nodes (e.g., with accelerators) can be Tainted to make sure unwanted pods are not scheduled on them. Tolerations can be set for the plugin pod to neutralize the Taint.
 	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
 
+	// WorkQueues is the workqueue configuration provisioned on all DSA devices by the idxd-config
+	// initcontainer, instead of the ProvisioningConfig. The engines of the devices are distributed
+	// evenly to the groups of the workqueues.
+	WorkQueues []DsaWorkQueue `json:"workQueues,omitempty"`
+
 	// SharedDevNum is a number of containers that can share the same DSA device.
 	// +kubebuilder:validation:Minimum=1
 	SharedDevNum int `json:"sharedDevNum,omitempty"`
@@ -49,6 +54,33 @@ type DsaDevicePluginSpec struct {
 	LogLevel int `json:"logLevel,omitempty"`
 }
 
+// DsaWorkQueue defines the configuration of a DSA workqueue.
+type DsaWorkQueue struct {
+	// Mode is the workqueue mode.
+	// +kubebuilder:validation:Enum=dedicated;shared
+	Mode string `json:"mode"`
+
+	// Type is the workqueue type. The plugin advertises only the user type workqueues.
+	// +kubebuilder:validation:Enum=user;kernel
+	// +kubebuilder:default=user
+	Type string `json:"type,omitempty"`
+
+	// Size is the number of the workqueue's descriptor entries.
+	// +kubebuilder:validation:Minimum=1
+	Size int `json:"size"`
+
+	// Group is the group of the engines processing the workqueue.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=3
+	Group int `json:"group,omitempty"`
+
+	// Priority is the workqueue's priority in its group.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=15
+	// +kubebuilder:default=10
+	Priority int `json:"priority,omitempty"`
+}
+
 // DsaDevicePluginStatus defines the observed state of DsaDevicePlugin.
 type DsaDevicePluginStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -32,6 +32,12 @@ var (
 	dsaMinVersion = controllers.ImageMinVersion
 )
 
+const (
+	// Maximum number of workqueues and their total size on a DSA device.
+	dsaMaxWorkQueues     = 8
+	dsaMaxWorkQueuesSize = 128
+)
+
 // SetupWebhookWithManager sets up a webhook for DsaDevicePlugin custom resources.
 func (r *DsaDevicePlugin) SetupWebhookWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewWebhookManagedBy(mgr).
@@ -86,9 +92,38 @@ func (r *DsaDevicePlugin) validatePlugin() error {
 		return errors.Errorf("ProvisioningConfig is set with no InitImage")
 	}
 
+	if err := validateWorkQueues(r.Spec.WorkQueues); err != nil {
+		return err
+	}
+
+	if len(r.Spec.WorkQueues) > 0 && len(r.Spec.InitImage) == 0 {
+		return errors.Errorf("WorkQueues is set with no InitImage")
+	}
+
+	if len(r.Spec.WorkQueues) > 0 && len(r.Spec.ProvisioningConfig) > 0 {
+		return errors.Errorf("only one of WorkQueues and ProvisioningConfig can be set")
+	}
+
 	if len(r.Spec.InitImage) > 0 {
 		return validatePluginImage(r.Spec.InitImage, "intel-idxd-config-initcontainer", dsaMinVersion)
 	}
 
 	return nil
 }
+
+func validateWorkQueues(wqs []DsaWorkQueue) error {
+	if len(wqs) > dsaMaxWorkQueues {
+		return errors.Errorf("%d workqueues exceed the maximum of %d", len(wqs), dsaMaxWorkQueues)
+	}
+
+	size := 0
+	for _, wq := range wqs {
+		size += wq.Size
+	}
+
+	if size > dsaMaxWorkQueuesSize {
+		return errors.Errorf("total workqueue size %d exceeds the maximum of %d", size, dsaMaxWorkQueuesSize)
+	}
+
+	return nil
+}
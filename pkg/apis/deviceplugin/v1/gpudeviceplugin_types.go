@@ -34,10 +34,27 @@ type GpuDevicePluginSpec struct {
 	// InitImage is a container image with tools (e.g., GPU NFD source hook) installed on each node.
 	InitImage string `json:"initImage,omitempty"`
 
+	// AllowIDs is a comma separated list of PCI device IDs of the GPUs to advertise.
+	// GPUs with other IDs are skipped.
+	// +kubebuilder:validation:Pattern=`^0x[0-9a-f]{4}(,0x[0-9a-f]{4})*$`
+	AllowIDs string `json:"allowIDs,omitempty"`
+
+	// DenyIDs is a comma separated list of PCI device IDs of the GPUs to skip.
+	// +kubebuilder:validation:Pattern=`^0x[0-9a-f]{4}(,0x[0-9a-f]{4})*$`
+	DenyIDs string `json:"denyIDs,omitempty"`
+
+	// ResourceNamespace overrides the namespace ('gpu.intel.com') of the advertised GPU resources.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	ResourceNamespace string `json:"resourceNamespace,omitempty"`
+
+	// ResourcePrefix is a prefix for the advertised GPU resource names, e.g. 'test-' for 'test-i915'.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9][-A-Za-z0-9_.]*$`
+	ResourcePrefix string `json:"resourcePrefix,omitempty"`
+
 	// PreferredAllocationPolicy sets the mode of allocating GPU devices on a node.
-	// See documentation for detailed description of the policies. Only valid when SharedDevNum > 1 is set.
-	// Not applicable with ResourceManager.
-	// +kubebuilder:validation:Enum=balanced;packed;none
+	// See documentation for detailed description of the policies. Only valid when SharedDevNum > 1 is set,
+	// except for numa. Not applicable with ResourceManager.
+	// +kubebuilder:validation:Enum=balanced;packed;numa;none
 	PreferredAllocationPolicy string `json:"preferredAllocationPolicy,omitempty"`
 
 	// Specialized nodes (e.g., with accelerators) can be Tainted to make sure unwanted pods are not scheduled on them. Tolerations can be set for the plugin pod to neutralize the Taint.
@@ -57,6 +74,10 @@ type GpuDevicePluginSpec struct {
 	// EnableMonitoring enables the monitoring resource ('i915_monitoring')
 	// which gives access to all GPU devices on given node. Typically used with Intel XPU-Manager.
 	EnableMonitoring bool `json:"enableMonitoring,omitempty"`
+
+	// RenderNodesOnly gives containers only the GPU render nodes, without the
+	// primary (card) nodes needed for modesetting.
+	RenderNodesOnly bool `json:"renderNodesOnly,omitempty"`
 }
 
 // GpuDevicePluginStatus defines the observed state of GpuDevicePlugin.
@@ -109,8 +109,8 @@ func (r *GpuDevicePlugin) crossCheckResourceManagement() bool {
 }
 
 func (r *GpuDevicePlugin) validatePlugin() error {
-	if r.Spec.SharedDevNum == 1 && r.Spec.PreferredAllocationPolicy != "none" {
-		return errors.Errorf("PreferredAllocationPolicy is valid only when setting sharedDevNum > 1")
+	if r.Spec.SharedDevNum == 1 && r.Spec.PreferredAllocationPolicy != "none" && r.Spec.PreferredAllocationPolicy != "numa" {
+		return errors.Errorf("PreferredAllocationPolicy other than numa is valid only when setting sharedDevNum > 1")
 	}
 
 	if r.Spec.SharedDevNum == 1 && r.Spec.ResourceManager {
@@ -26,6 +26,21 @@ import (
 // KernelVfDriver is a VF device driver for QuickAssist devices.
 type KernelVfDriver string
 
+// +kubebuilder:validation:Enum={"sym","asym","sym;asym","dc","sym;dc","asym;dc","sym;asym;dc","dcc","decomp","sym;decomp","asym;decomp"}
+
+// QatServices is a cfg_services configuration of QuickAssist devices.
+type QatServices string
+
+// QatDeviceServices is a cfg_services configuration of a QuickAssist PF device.
+type QatDeviceServices struct {
+	// PciAddress is the PCI address of the PF device, e.g. "0000:6b:00.0".
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{4}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`
+	PciAddress string `json:"pciAddress"`
+
+	// Services are the services enabled on the PF device.
+	Services QatServices `json:"services"`
+}
+
 // QatDevicePluginSpec defines the desired state of QatDevicePlugin.
 type QatDevicePluginSpec struct {
 	// Important: Run "make generate" to regenerate code after modifying this file.
@@ -48,12 +63,20 @@ type QatDevicePluginSpec struct {
 	// +kubebuilder:validation:Enum=igb_uio;vfio-pci
 	DpdkDriver string `json:"dpdkDriver,omitempty"`
 
+	// Services are the services enabled on the 4xxx and 420xx QAT PF devices of the nodes,
+	// configured by the initcontainer before enabling the VFs. Overrides the ProvisioningConfig.
+	// Node pools needing different services can be configured with CRs having different NodeSelectors.
+	Services QatServices `json:"services,omitempty"`
+
 	// NodeSelector provides a simple way to constrain device plugin pods to nodes with particular labels.
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
 
 	// KernelVfDrivers is a list of VF device drivers for the QuickAssist devices in the system.
 	KernelVfDrivers []KernelVfDriver `json:"kernelVfDrivers,omitempty"`
 
+	// DeviceServices are the services enabled on individual QAT PF devices, overriding Services.
+	DeviceServices []QatDeviceServices `json:"deviceServices,omitempty"`
+
 	// Specialized nodes (e.g., with accelerators) can be Tainted to make sure unwanted pods are not scheduled on them. Tolerations can be set for the plugin pod to neutralize the Taint.
 	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
 
@@ -61,6 +84,11 @@ type QatDevicePluginSpec struct {
 	// +kubebuilder:validation:Minimum=1
 	MaxNumDevices int `json:"maxNumDevices,omitempty"`
 
+	// NumVfs is the number of VFs the initcontainer enables on each QAT PF device of the nodes,
+	// at most the sriov_totalvfs of the device. By default, all the VFs are enabled.
+	// +kubebuilder:validation:Minimum=1
+	NumVfs int `json:"numVfs,omitempty"`
+
 	// LogLevel sets the plugin's log level.
 	// +kubebuilder:validation:Minimum=0
 	LogLevel int `json:"logLevel,omitempty"`
@@ -84,9 +84,9 @@ func (r *QatDevicePlugin) validatePlugin() error {
 		}
 	}
 
-	if len(r.Spec.ProvisioningConfig) > 0 {
+	if len(r.Spec.ProvisioningConfig) > 0 || len(r.Spec.Services) > 0 || len(r.Spec.DeviceServices) > 0 {
 		if len(r.Spec.InitImage) == 0 {
-			return errors.Errorf("ProvisioningConfig is set with no InitImage")
+			return errors.Errorf("ProvisioningConfig or Services is set with no InitImage")
 		}
 
 		// check if 4xxxvf is enabled
@@ -104,9 +104,23 @@ func (r *QatDevicePlugin) validatePlugin() error {
 		}
 
 		if !contains {
-			return errors.Errorf("ProvisioningConfig is available only for 4xxx and 420xx devices")
+			return errors.Errorf("ProvisioningConfig and Services are available only for 4xxx and 420xx devices")
 		}
 	}
 
+	if r.Spec.NumVfs > 0 && len(r.Spec.InitImage) == 0 {
+		return errors.Errorf("NumVfs is set with no InitImage")
+	}
+
+	addresses := map[string]bool{}
+
+	for _, device := range r.Spec.DeviceServices {
+		if addresses[device.PciAddress] {
+			return errors.Errorf("DeviceServices has duplicate entries for %s", device.PciAddress)
+		}
+
+		addresses[device.PciAddress] = true
+	}
+
 	return validatePluginImage(r.Spec.Image, "intel-qat-plugin", qatMinVersion)
 }
@@ -208,6 +208,11 @@ func (in *DsaDevicePluginSpec) DeepCopyInto(out *DsaDevicePluginSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.WorkQueues != nil {
+		in, out := &in.WorkQueues, &out.WorkQueues
+		*out = make([]DsaWorkQueue, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DsaDevicePluginSpec.
@@ -241,6 +246,21 @@ func (in *DsaDevicePluginStatus) DeepCopy() *DsaDevicePluginStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DsaWorkQueue) DeepCopyInto(out *DsaWorkQueue) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DsaWorkQueue.
+func (in *DsaWorkQueue) DeepCopy() *DsaWorkQueue {
+	if in == nil {
+		return nil
+	}
+	out := new(DsaWorkQueue)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FpgaDevicePlugin) DeepCopyInto(out *FpgaDevicePlugin) {
 	*out = *in
@@ -642,6 +662,11 @@ func (in *QatDevicePluginSpec) DeepCopyInto(out *QatDevicePluginSpec) {
 		*out = make([]KernelVfDriver, len(*in))
 		copy(*out, *in)
 	}
+	if in.DeviceServices != nil {
+		in, out := &in.DeviceServices, &out.DeviceServices
+		*out = make([]QatDeviceServices, len(*in))
+		copy(*out, *in)
+	}
 	if in.Tolerations != nil {
 		in, out := &in.Tolerations, &out.Tolerations
 		*out = make([]corev1.Toleration, len(*in))
@@ -682,6 +707,21 @@ func (in *QatDevicePluginStatus) DeepCopy() *QatDevicePluginStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QatDeviceServices) DeepCopyInto(out *QatDeviceServices) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QatDeviceServices.
+func (in *QatDeviceServices) DeepCopy() *QatDeviceServices {
+	if in == nil {
+		return nil
+	}
+	out := new(QatDeviceServices)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SgxDevicePlugin) DeepCopyInto(out *SgxDevicePlugin) {
 	*out = *in
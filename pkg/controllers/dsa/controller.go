@@ -143,6 +143,14 @@ func addInitContainer(ds *apps.DaemonSet, dp *devicepluginv1.DsaDevicePlugin) {
 			},
 		},
 	})
+	if len(dp.Spec.WorkQueues) > 0 {
+		initcontainer := &ds.Spec.Template.Spec.InitContainers[len(ds.Spec.Template.Spec.InitContainers)-1]
+		initcontainer.Env = append(initcontainer.Env, v1.EnvVar{
+			Name:  workQueueConfigEnv,
+			Value: workQueueConfig(dp.Spec.WorkQueues),
+		})
+	}
+
 	ds.Spec.Template.Spec.Volumes = append(ds.Spec.Template.Spec.Volumes, v1.Volume{
 		Name: "sys-bus-dsa",
 		VolumeSource: v1.VolumeSource{
@@ -221,6 +229,15 @@ func provisioningUpdate(ds *apps.DaemonSet, dp *devicepluginv1.DsaDevicePlugin)
 				update = true
 			}
 
+			wqConfig := ""
+			if len(dp.Spec.WorkQueues) > 0 {
+				wqConfig = workQueueConfig(dp.Spec.WorkQueues)
+			}
+
+			if getEnv(container, workQueueConfigEnv) != wqConfig {
+				update = true
+			}
+
 			found = true
 
 			break
@@ -181,3 +181,50 @@ func TestNewDaemonSetDSA(t *testing.T) {
 		t.Errorf("expected and actuall daemonsets differ: %+s", diff.ObjectGoPrintDiff(expected, actual))
 	}
 }
+
+func TestWorkQueueConfig(t *testing.T) {
+	wqs := []devicepluginv1.DsaWorkQueue{
+		{Mode: "dedicated", Size: 16},
+		{Mode: "shared", Type: "user", Size: 32, Group: 1, Priority: 5},
+		{Mode: "dedicated", Size: 16},
+	}
+	expected := `[{"dev":"dsaX","groups":[` +
+		`{"dev":"groupX.0","grouped_workqueues":[` +
+		`{"dev":"wqX.0","mode":"dedicated","type":"user","name":"appX0","size":16,"group_id":0,"priority":10,"block_on_fault":1},` +
+		`{"dev":"wqX.2","mode":"dedicated","type":"user","name":"appX2","size":16,"group_id":0,"priority":10,"block_on_fault":1}],` +
+		`"grouped_engines":[{"dev":"engineX.0","group_id":0},{"dev":"engineX.2","group_id":0}]},` +
+		`{"dev":"groupX.1","grouped_workqueues":[` +
+		`{"dev":"wqX.1","mode":"shared","type":"user","name":"appX1","size":32,"group_id":1,"priority":5,"block_on_fault":1,"threshold":32}],` +
+		`"grouped_engines":[{"dev":"engineX.1","group_id":1},{"dev":"engineX.3","group_id":1}]}]}]`
+
+	if config := workQueueConfig(wqs); config != expected {
+		t.Errorf("expected config\n%s\ngot\n%s", expected, config)
+	}
+}
+
+func TestUpdateDaemonSetWorkQueues(t *testing.T) {
+	plugin := &devicepluginv1.DsaDevicePlugin{}
+	plugin.Name = "testing"
+	plugin.Spec.InitImage = "intel/intel-idxd-config-initcontainer:devel"
+	c := &controller{}
+
+	ds := c.NewDaemonSet(plugin)
+
+	if c.UpdateDaemonSet(plugin, ds) {
+		t.Error("daemonset updated without changes")
+	}
+
+	plugin.Spec.WorkQueues = []devicepluginv1.DsaWorkQueue{{Mode: "shared", Size: 64}}
+
+	if !c.UpdateDaemonSet(plugin, ds) {
+		t.Fatal("daemonset not updated with the workqueues")
+	}
+
+	if getEnv(ds.Spec.Template.Spec.InitContainers[0], workQueueConfigEnv) != workQueueConfig(plugin.Spec.WorkQueues) {
+		t.Errorf("workqueue configuration not passed to the initcontainer: %+v", ds.Spec.Template.Spec.InitContainers[0].Env)
+	}
+
+	if c.UpdateDaemonSet(plugin, ds) {
+		t.Error("daemonset updated again without changes")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsa
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	v1 "k8s.io/api/core/v1"
+
+	devicepluginv1 "github.com/intel/intel-device-plugins-for-kubernetes/pkg/apis/deviceplugin/v1"
+)
+
+const (
+	// Environment variable passing the accel-config configuration of the
+	// workqueues to the initcontainer.
+	workQueueConfigEnv = "IDXD_CONFIG"
+
+	// Number of engines of a DSA device.
+	dsaEngines = 4
+
+	defaultWorkQueueType     = "user"
+	defaultWorkQueuePriority = 10
+)
+
+// The accel-config configuration of a device, where the initcontainer
+// replaces the "X" in the names with the device number.
+type idxdDevice struct {
+	Dev    string      `json:"dev"`
+	Groups []idxdGroup `json:"groups"`
+}
+
+type idxdGroup struct {
+	Dev        string          `json:"dev"`
+	WorkQueues []idxdWorkQueue `json:"grouped_workqueues"`
+	Engines    []idxdEngine    `json:"grouped_engines"`
+}
+
+type idxdWorkQueue struct {
+	Dev          string `json:"dev"`
+	Mode         string `json:"mode"`
+	Type         string `json:"type"`
+	Name         string `json:"name"`
+	Size         int    `json:"size"`
+	GroupID      int    `json:"group_id"`
+	Priority     int    `json:"priority"`
+	BlockOnFault int    `json:"block_on_fault"`
+	Threshold    int    `json:"threshold,omitempty"`
+}
+
+type idxdEngine struct {
+	Dev     string `json:"dev"`
+	GroupID int    `json:"group_id"`
+}
+
+// workQueueConfig returns the accel-config configuration of the workqueues,
+// with the engines distributed evenly to the groups of the workqueues.
+func workQueueConfig(wqs []devicepluginv1.DsaWorkQueue) string {
+	groupIDs := []int{}
+
+	for _, wq := range wqs {
+		if !slices.Contains(groupIDs, wq.Group) {
+			groupIDs = append(groupIDs, wq.Group)
+		}
+	}
+
+	slices.Sort(groupIDs)
+
+	groups := make([]idxdGroup, len(groupIDs))
+	for i, id := range groupIDs {
+		groups[i] = idxdGroup{Dev: fmt.Sprintf("groupX.%d", id), WorkQueues: []idxdWorkQueue{}, Engines: []idxdEngine{}}
+	}
+
+	for i, wq := range wqs {
+		idxdWq := idxdWorkQueue{
+			Dev:          fmt.Sprintf("wqX.%d", i),
+			Mode:         wq.Mode,
+			Type:         wq.Type,
+			Name:         fmt.Sprintf("appX%d", i),
+			Size:         wq.Size,
+			GroupID:      wq.Group,
+			Priority:     wq.Priority,
+			BlockOnFault: 1,
+		}
+
+		if idxdWq.Type == "" {
+			idxdWq.Type = defaultWorkQueueType
+		}
+
+		if idxdWq.Priority == 0 {
+			idxdWq.Priority = defaultWorkQueuePriority
+		}
+
+		if wq.Mode == "shared" {
+			idxdWq.Threshold = wq.Size
+		}
+
+		g := slices.Index(groupIDs, wq.Group)
+		groups[g].WorkQueues = append(groups[g].WorkQueues, idxdWq)
+	}
+
+	for e := 0; e < dsaEngines && len(groups) > 0; e++ {
+		g := e % len(groups)
+		groups[g].Engines = append(groups[g].Engines, idxdEngine{Dev: fmt.Sprintf("engineX.%d", e), GroupID: groupIDs[g]})
+	}
+
+	// Marshaling the plain structs does not fail.
+	data, _ := json.Marshal([]idxdDevice{{Dev: "dsaX", Groups: groups}})
+
+	return string(data)
+}
+
+// getEnv returns the value of the container's environment variable.
+func getEnv(container v1.Container, name string) string {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return env.Value
+		}
+	}
+
+	return ""
+}
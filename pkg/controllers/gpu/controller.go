@@ -407,6 +407,26 @@ func getPodArgs(gdp *devicepluginv1.GpuDevicePlugin) []string {
 		args = append(args, "-resource-manager")
 	}
 
+	if gdp.Spec.RenderNodesOnly {
+		args = append(args, "-render-nodes-only")
+	}
+
+	if gdp.Spec.AllowIDs != "" {
+		args = append(args, "-allow-ids", gdp.Spec.AllowIDs)
+	}
+
+	if gdp.Spec.DenyIDs != "" {
+		args = append(args, "-deny-ids", gdp.Spec.DenyIDs)
+	}
+
+	if gdp.Spec.ResourceNamespace != "" {
+		args = append(args, "-resource-namespace", gdp.Spec.ResourceNamespace)
+	}
+
+	if gdp.Spec.ResourcePrefix != "" {
+		args = append(args, "-resource-prefix", gdp.Spec.ResourcePrefix)
+	}
+
 	if gdp.Spec.PreferredAllocationPolicy != "" {
 		args = append(args, "-allocation-policy", gdp.Spec.PreferredAllocationPolicy)
 	} else {
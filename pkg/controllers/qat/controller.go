@@ -130,7 +130,8 @@ func (c *controller) UpdateDaemonSet(rawObj client.Object, ds *apps.DaemonSet) (
 		}
 	} else {
 		containers := ds.Spec.Template.Spec.InitContainers
-		if len(containers) != 1 || containers[0].Image != dp.Spec.InitImage {
+		if len(containers) != 1 || containers[0].Image != dp.Spec.InitImage ||
+			!reflect.DeepEqual(envValues(containers[0].Env), envValues(initContainerEnv(dp.Spec))) {
 			setInitContainer(&ds.Spec.Template.Spec, dp.Spec)
 
 			updated = true
@@ -204,9 +205,24 @@ func removeVolume(volumes []v1.Volume, name string) []v1.Volume {
 	return newVolumes
 }
 
-func setInitContainer(dsSpec *v1.PodSpec, dpSpec devicepluginv1.QatDevicePluginSpec) {
-	yes := true
+// envValues returns the values of the environment variables set with a value.
+// The API server defaults the field references, so NODE_NAME is left out.
+func envValues(env []v1.EnvVar) map[string]string {
+	values := map[string]string{}
+
+	for _, envVar := range env {
+		if envVar.ValueFrom == nil {
+			values[envVar.Name] = envVar.Value
+		}
+	}
 
+	return values
+}
+
+// initContainerEnv returns the environment of the initcontainer, telling
+// the PF devices to enable, the services to configure on them and the
+// number of VFs to enable.
+func initContainerEnv(dpSpec devicepluginv1.QatDevicePluginSpec) []v1.EnvVar {
 	qatDeviceDriver := map[string]string{
 		"dh895xccvf": "0434 0435",
 		"c3xxxvf":    "19e2",
@@ -222,25 +238,50 @@ func setInitContainer(dsSpec *v1.PodSpec, dpSpec devicepluginv1.QatDevicePluginS
 		enablingPfPciIDs = append(enablingPfPciIDs, qatDeviceDriver[string(v)])
 	}
 
+	env := []v1.EnvVar{
+		{
+			Name:  "ENABLED_QAT_PF_PCIIDS",
+			Value: strings.Join(enablingPfPciIDs, " "),
+		},
+		{
+			Name: "NODE_NAME",
+			ValueFrom: &v1.EnvVarSource{
+				FieldRef: &v1.ObjectFieldSelector{
+					FieldPath: "spec.nodeName",
+				},
+			},
+		},
+	}
+
+	if dpSpec.Services != "" {
+		env = append(env, v1.EnvVar{Name: "QAT_SERVICES", Value: string(dpSpec.Services)})
+	}
+
+	if dpSpec.NumVfs > 0 {
+		env = append(env, v1.EnvVar{Name: "QAT_NUMVFS", Value: strconv.Itoa(dpSpec.NumVfs)})
+	}
+
+	if len(dpSpec.DeviceServices) > 0 {
+		deviceServices := make([]string, 0, len(dpSpec.DeviceServices))
+		for _, device := range dpSpec.DeviceServices {
+			deviceServices = append(deviceServices, device.PciAddress+"="+string(device.Services))
+		}
+
+		env = append(env, v1.EnvVar{Name: "QAT_DEVICE_SERVICES", Value: strings.Join(deviceServices, " ")})
+	}
+
+	return env
+}
+
+func setInitContainer(dsSpec *v1.PodSpec, dpSpec devicepluginv1.QatDevicePluginSpec) {
+	yes := true
+
 	dsSpec.InitContainers = []v1.Container{
 		{
 			Image:           dpSpec.InitImage,
 			ImagePullPolicy: "IfNotPresent",
 			Name:            initcontainerName,
-			Env: []v1.EnvVar{
-				{
-					Name:  "ENABLED_QAT_PF_PCIIDS",
-					Value: strings.Join(enablingPfPciIDs, " "),
-				},
-				{
-					Name: "NODE_NAME",
-					ValueFrom: &v1.EnvVarSource{
-						FieldRef: &v1.ObjectFieldSelector{
-							FieldPath: "spec.nodeName",
-						},
-					},
-				},
-			},
+			Env:             initContainerEnv(dpSpec),
 			SecurityContext: &v1.SecurityContext{
 				SELinuxOptions: &v1.SELinuxOptions{
 					Type: "container_device_plugin_init_t",
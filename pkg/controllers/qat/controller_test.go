@@ -191,3 +191,57 @@ func TestNewDaemonSetQAT(t *testing.T) {
 		t.Errorf("expected and actuall daemonsets differ: %+s", diff.ObjectGoPrintDiff(expected, actual))
 	}
 }
+
+func TestUpdateDaemonSetQATServices(t *testing.T) {
+	c := &controller{}
+
+	plugin := &devicepluginv1.QatDevicePlugin{}
+	plugin.Name = "testing"
+	plugin.Spec.InitImage = "intel/intel-qat-initcontainer:" + controllers.ImageMinVersion.String()
+	plugin.Spec.KernelVfDrivers = []devicepluginv1.KernelVfDriver{"4xxxvf"}
+
+	ds := c.NewDaemonSet(plugin)
+
+	plugin.Spec.Services = "sym;asym"
+	plugin.Spec.DeviceServices = []devicepluginv1.QatDeviceServices{
+		{PciAddress: "0000:6b:00.0", Services: "dc"},
+		{PciAddress: "0000:70:00.0", Services: "asym;dc"},
+	}
+	plugin.Spec.NumVfs = 8
+
+	if !c.UpdateDaemonSet(plugin, ds) {
+		t.Fatal("expected daemonset to be updated with the services")
+	}
+
+	env := map[string]string{}
+	for _, envVar := range ds.Spec.Template.Spec.InitContainers[0].Env {
+		env[envVar.Name] = envVar.Value
+	}
+
+	if env["QAT_SERVICES"] != "sym;asym" {
+		t.Errorf("expected QAT_SERVICES 'sym;asym', got '%s'", env["QAT_SERVICES"])
+	}
+
+	if expected := "0000:6b:00.0=dc 0000:70:00.0=asym;dc"; env["QAT_DEVICE_SERVICES"] != expected {
+		t.Errorf("expected QAT_DEVICE_SERVICES '%s', got '%s'", expected, env["QAT_DEVICE_SERVICES"])
+	}
+
+	if env["QAT_NUMVFS"] != "8" {
+		t.Errorf("expected QAT_NUMVFS '8', got '%s'", env["QAT_NUMVFS"])
+	}
+
+	if c.UpdateDaemonSet(plugin, ds) {
+		t.Error("expected no update with unchanged services")
+	}
+
+	// The API server defaults the NODE_NAME field reference.
+	for _, envVar := range ds.Spec.Template.Spec.InitContainers[0].Env {
+		if envVar.ValueFrom != nil {
+			envVar.ValueFrom.FieldRef.APIVersion = "v1"
+		}
+	}
+
+	if c.UpdateDaemonSet(plugin, ds) {
+		t.Error("expected no update with defaulted field reference")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// procfs DRM client SPECIFICATION
+//
+// proc/PID/fd/FD -> /dev/dri/renderD1XX (renderD node of the client device)
+// proc/PID/fdinfo/FD (DRM client usage stats, see kernel drm-usage-stats.rst)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultClientFd = 3
+
+// ClientOptions describe a fake DRM client, i.e. a process having given fake
+// device open, and its engine and memory usage.
+type ClientOptions struct {
+	Engines map[string]uint64 `yaml:"Engines,omitempty"` // busy time in ns per engine class
+	Memory  map[string]uint64 `yaml:"Memory,omitempty"`  // resident bytes per memory region
+	Pid     int               `yaml:"Pid"`
+	Fd      int               `yaml:"Fd,omitempty"` // defaults to 3
+	Device  int               `yaml:"Device"`       // device index
+}
+
+func (client *ClientOptions) fd() int {
+	if client.Fd > 0 {
+		return client.Fd
+	}
+
+	return defaultClientFd
+}
+
+func validateClients(opts *GenOptions) error {
+	seen := map[string]bool{}
+
+	for i, client := range opts.Clients {
+		if client.Pid <= 0 {
+			return fmt.Errorf("%w: client-%d: invalid PID %d", ErrInvalidOptions, i, client.Pid)
+		}
+
+		if client.Device < 0 || client.Device >= opts.DevCount {
+			return fmt.Errorf("%w: client-%d: invalid device index: 0 <= %d < %d", ErrInvalidOptions, i, client.Device, opts.DevCount)
+		}
+
+		key := fmt.Sprintf("%d/%d", client.Pid, client.fd())
+		if seen[key] {
+			return fmt.Errorf("%w: client-%d: duplicate PID/FD %s", ErrInvalidOptions, i, key)
+		}
+
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// WriteClientFdinfo (re-)writes the fake procfs fd symlink and fdinfo file
+// for client i, so that updated client usage can be simulated at runtime.
+func WriteClientFdinfo(opts *GenOptions, i int) error {
+	client := &opts.Clients[i]
+	fd := strconv.Itoa(client.fd())
+	base := filepath.Join(procfsPath, strconv.Itoa(client.Pid))
+
+	for _, dir := range []string{"fd", "fdinfo"} {
+		if err := opts.fsys().MkdirAll(filepath.Join(base, dir), dirMode); err != nil {
+			return err
+		}
+	}
+
+	link := filepath.Join(base, "fd", fd)
+	if _, err := opts.fsys().Lstat(link); err != nil {
+		if err = opts.fsys().Symlink(filepath.Join("/dev/dri", opts.renderName(client.Device)), link); err != nil {
+			return fmt.Errorf("client-%d fd symlink creation failed: %w", i, err)
+		}
+
+		opts.symls++
+	}
+
+	return writeFile(opts, filepath.Join(base, "fdinfo", fd), clientFdinfo(opts, i))
+}
+
+func clientFdinfo(opts *GenOptions, i int) string {
+	client := &opts.Clients[i]
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "pos:\t0\nflags:\t02100002\nmnt_id:\t26\n")
+	fmt.Fprintf(&sb, "drm-driver:\t%s\n", opts.Driver)
+	fmt.Fprintf(&sb, "drm-client-id:\t%d\n", i+1)
+	fmt.Fprintf(&sb, "drm-pdev:\t%s\n", opts.pciAddress(client.Device))
+
+	for _, engine := range sortedKeys(client.Engines) {
+		fmt.Fprintf(&sb, "drm-engine-%s:\t%d ns\n", engine, client.Engines[engine])
+	}
+
+	for _, region := range sortedKeys(client.Memory) {
+		kib := client.Memory[region] / 1024
+		fmt.Fprintf(&sb, "drm-total-%s:\t%d KiB\n", region, kib)
+		fmt.Fprintf(&sb, "drm-resident-%s:\t%d KiB\n", region, kib)
+	}
+
+	return sb.String()
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
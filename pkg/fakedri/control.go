@@ -0,0 +1,242 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// REST control API SPECIFICATION
+//
+// GET    /devices                list fake devices (JSON ControlDevice list)
+// POST   /devices/{index}        hot-plug device (GPU mode)
+// DELETE /devices/{index}        hot-unplug device (GPU mode)
+// PUT    /devices/{index}/health set device health (GPU mode, JSON HealthOptions body)
+// PUT    /sysfs/{path}           write request body to an existing fake sysfs file
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// maxControlBody limits the size of the control API request bodies.
+const maxControlBody = 1024 * 1024
+
+// ControlDevice describes a fake device in the control API device list.
+type ControlDevice struct {
+	Path       string // path that exists when device is present
+	Card       string `json:",omitempty"` // GPU mode only
+	PciAddress string `json:",omitempty"` // GPU mode only
+	Index      int
+	Present    bool
+}
+
+// ControlServer serves REST control API for changing an already generated
+// fake tree at runtime, e.g. from e2e tests. It serializes the changes done
+// through it and Respec.
+type ControlServer struct {
+	mux  *http.ServeMux
+	opts GenOptions
+	mu   sync.Mutex
+}
+
+// NewControlServer returns control API server for the fake tree generated
+// with given options.
+func NewControlServer(opts GenOptions) *ControlServer {
+	server := &ControlServer{opts: opts, mux: http.NewServeMux()}
+
+	server.mux.HandleFunc("GET /devices", server.listDevices)
+	server.mux.HandleFunc("POST /devices/{index}", server.addDevice)
+	server.mux.HandleFunc("DELETE /devices/{index}", server.removeDevice)
+	server.mux.HandleFunc("PUT /devices/{index}/health", server.setHealth)
+	server.mux.HandleFunc("PUT /sysfs/{path...}", server.setSysfsValue)
+
+	return server
+}
+
+// Options returns the current options of the server.
+func (server *ControlServer) Options() GenOptions {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.opts
+}
+
+// Respec updates the fake tree to match given new options (see Respec),
+// and returns the resulting options.
+func (server *ControlServer) Respec(opts GenOptions) (GenOptions, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	opts, err := Respec(server.opts, opts)
+	server.opts = opts
+
+	return opts, err
+}
+
+// ServeHTTP serves the control API requests, one at a time.
+func (server *ControlServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.mux.ServeHTTP(w, r)
+}
+
+// writeError responds with HTTP status matching given error.
+func (server *ControlServer) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, ErrInvalidOptions):
+		status = http.StatusBadRequest
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, fs.ErrExist):
+		status = http.StatusConflict
+	}
+
+	server.opts.log().Info("Warning: control request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+
+	http.Error(w, err.Error(), status)
+}
+
+// deviceIndex returns the device index of the request.
+func (server *ControlServer) deviceIndex(r *http.Request) (int, error) {
+	i, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || i < 0 || i >= server.opts.DevCount {
+		return 0, fmt.Errorf("%w: invalid device index '%s', not within 0-%d", ErrInvalidOptions, r.PathValue("index"), server.opts.DevCount-1)
+	}
+
+	return i, nil
+}
+
+// hotplugIndex returns the device index of the request, if hot-plug is supported.
+func (server *ControlServer) hotplugIndex(r *http.Request) (int, error) {
+	if !server.opts.isGpuMode() {
+		return 0, fmt.Errorf("%w: device hot-plug is supported only in GPU mode", ErrInvalidOptions)
+	}
+
+	return server.deviceIndex(r)
+}
+
+func (server *ControlServer) listDevices(w http.ResponseWriter, r *http.Request) {
+	devices := make([]ControlDevice, server.opts.DevCount)
+
+	for i := range devices {
+		devices[i] = ControlDevice{
+			Path:    server.opts.devicePath(i),
+			Index:   i,
+			Present: server.opts.hasDevice(i),
+		}
+
+		if server.opts.isGpuMode() {
+			devices[i].Card = server.opts.cardName(i)
+			devices[i].PciAddress = server.opts.pciAddress(i)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(devices); err != nil {
+		server.opts.log().Info("Warning: writing control response failed", "err", err)
+	}
+}
+
+func (server *ControlServer) addDevice(w http.ResponseWriter, r *http.Request) {
+	i, err := server.hotplugIndex(r)
+	if err == nil {
+		err = AddDevice(&server.opts, i)
+	}
+
+	if err != nil {
+		server.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (server *ControlServer) removeDevice(w http.ResponseWriter, r *http.Request) {
+	i, err := server.hotplugIndex(r)
+	if err == nil {
+		err = RemoveDevice(&server.opts, i)
+	}
+
+	if err != nil {
+		server.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *ControlServer) setHealth(w http.ResponseWriter, r *http.Request) {
+	var health HealthOptions
+
+	i, err := server.deviceIndex(r)
+	if err == nil {
+		decoder := json.NewDecoder(io.LimitReader(r.Body, maxControlBody))
+		decoder.DisallowUnknownFields()
+
+		if err = decoder.Decode(&health); err != nil {
+			err = fmt.Errorf("%w: invalid health: %w", ErrInvalidOptions, err)
+		}
+	}
+
+	if err == nil {
+		err = SetDeviceHealth(&server.opts, i, health)
+	}
+
+	if err != nil {
+		server.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *ControlServer) setSysfsValue(w http.ResponseWriter, r *http.Request) {
+	// Cleaning the rooted path keeps it within the fake sysfs.
+	path := filepath.Join(sysfsPath, filepath.Clean("/"+r.PathValue("path")))
+
+	info, err := server.opts.fsys().Stat(path)
+	if err == nil && !info.Mode().IsRegular() {
+		err = fmt.Errorf("%w: '%s' is not a file", ErrInvalidOptions, path)
+	}
+
+	var data []byte
+
+	if err == nil {
+		data, err = io.ReadAll(io.LimitReader(r.Body, maxControlBody))
+	}
+
+	if err == nil {
+		err = server.opts.fsys().WriteFile(path, data, fileMode)
+	}
+
+	if err != nil {
+		server.writeError(w, r, err)
+		return
+	}
+
+	server.opts.log().V(1).Info("Set sysfs file value", "path", path, "value", string(data))
+
+	w.WriteHeader(http.StatusNoContent)
+}
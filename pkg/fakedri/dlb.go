@@ -0,0 +1,220 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs DLB SPECIFICATION (Mode: dlb)
+//
+// PCI device dirs for the PFs and VFs bound to DRIVER (see pci.go), with:
+// sys/devices/ROOT/BDF/dlb2/dlbX/device -> ../../../BDF
+// sys/devices/ROOT/BDF/sriov_numvfs (PF only, number of VFs)
+// sys/devices/ROOT/BDF/sriov_totalvfs (PF only, max number of VFs)
+// sys/devices/ROOT/BDF/virtfnN -> ../VF-BDF (PF only)
+// sys/devices/ROOT/BDF/vfN_resources/num_* (PF only, SR-IOV VF resources)
+// sys/devices/ROOT/BDF/vdevN_resources/num_* (PF only, SIOV vdev resources)
+// sys/devices/ROOT/BDF/physfn -> ../PF-BDF (VF only)
+// sys/class/dlb2/dlbX -> ../../devices/ROOT/BDF/dlb2/dlbX
+//---------------------------------------------------------------
+// devfs DLB SPECIFICATION
+//
+// dev/dlbX
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultDlbDriver   = "dlb2"
+	defaultDlbDeviceID = "0x2710"
+	defaultDlbVfID     = "0x2711"
+	dlbMaxVfs          = 16
+)
+
+// dlbResources are the DLB 2.0 device resources shared between its VFs / vdevs.
+var dlbResources = map[string]int{
+	"num_atomic_inflights":  2048,
+	"num_dir_credits":       4096,
+	"num_dir_ports":         64,
+	"num_hist_list_entries": 2048,
+	"num_ldb_credits":       8192,
+	"num_ldb_ports":         64,
+	"num_ldb_queues":        32,
+	"num_sched_domains":     32,
+	"num_sn0_slots":         2,
+	"num_sn1_slots":         2,
+}
+
+// DlbOptions describe the DLB specific options for the "dlb" mode.
+type DlbOptions struct {
+	// Vdevs is the number of Scalable IOV virtual devices per PF.
+	Vdevs int `yaml:"Vdevs,omitempty"`
+}
+
+func (opts *GenOptions) setDlbDefaults() {
+	if opts.Dlb == nil {
+		opts.Dlb = &DlbOptions{}
+	}
+
+	if opts.Driver == "" {
+		opts.Driver = defaultDlbDriver
+	}
+
+	if opts.DeviceID == "" {
+		opts.DeviceID = defaultDlbDeviceID
+	}
+
+	if opts.VfDeviceID == "" {
+		opts.VfDeviceID = defaultDlbVfID
+	}
+}
+
+func validateDlb(opts *GenOptions) error {
+	if opts.Mode != modeDlb {
+		if opts.Dlb != nil {
+			return fmt.Errorf("%w: Dlb options given for '%s' mode", ErrInvalidOptions, opts.Mode)
+		}
+
+		return nil
+	}
+
+	if opts.TilesPerDev > 0 || opts.DevMemSize > 0 || opts.Hwmon != nil || opts.Freq != nil || opts.MemRegions != nil ||
+		opts.XeLinks != nil || len(opts.Clients) > 0 {
+		return fmt.Errorf("%w: GPU specific options given for DLB mode", ErrInvalidOptions)
+	}
+
+	if opts.VfsPerPf > dlbMaxVfs || opts.TotalVfs > dlbMaxVfs {
+		return fmt.Errorf("%w: DLB supports max %d VFs", ErrInvalidOptions, dlbMaxVfs)
+	}
+
+	if opts.Dlb == nil {
+		return nil
+	}
+
+	if opts.Dlb.Vdevs < 0 || opts.Dlb.Vdevs > dlbMaxVfs {
+		return fmt.Errorf("%w: DLB Vdevs (%d) not within 0-%d", ErrInvalidOptions, opts.Dlb.Vdevs, dlbMaxVfs)
+	}
+
+	if opts.Dlb.Vdevs > 0 && opts.VfsPerPf > 0 {
+		return fmt.Errorf("%w: DLB SR-IOV VFs and SIOV Vdevs are mutually exclusive", ErrInvalidOptions)
+	}
+
+	return nil
+}
+
+// addDlbDevice generates the sysfs and devfs content for DLB device i.
+func addDlbDevice(opts *GenOptions, i int) error {
+	bdf := opts.pciAddress(i)
+	name := fmt.Sprintf("dlb%d", i)
+
+	base, err := addPciDeviceDir(opts, i, bdf, opts.Driver)
+	if err != nil {
+		return err
+	}
+
+	classDir := filepath.Join(base, "dlb2", name)
+	if err = opts.fsys().MkdirAll(classDir, dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs++
+
+	if err = addSymlink(opts, "../../../"+bdf, filepath.Join(classDir, "device")); err != nil {
+		return err
+	}
+
+	classLinks := filepath.Join(sysfsPath, "class", "dlb2")
+	if err = opts.fsys().MkdirAll(classLinks, dirMode); err != nil {
+		return err
+	}
+
+	target := filepath.Join("../../devices", opts.pciRoot(i), bdf, "dlb2", name)
+	if err = addSymlink(opts, target, filepath.Join(classLinks, name)); err != nil {
+		return err
+	}
+
+	if err = opts.fsys().MkdirAll(devfsPath, dirMode); err != nil {
+		return err
+	}
+
+	if err = addNullDeviceNode(opts, filepath.Join(devfsPath, name)); err != nil {
+		return err
+	}
+
+	pf := i - i%(opts.VfsPerPf+1)
+	if i != pf {
+		return addSymlink(opts, "../"+opts.pciAddress(pf), filepath.Join(base, "physfn"))
+	}
+
+	return addDlbPfFiles(base, opts, i)
+}
+
+func addDlbPfFiles(base string, opts *GenOptions, i int) error {
+	totalVfs := opts.TotalVfs
+	if totalVfs == 0 {
+		totalVfs = dlbMaxVfs
+	}
+
+	if err := writeFile(opts, filepath.Join(base, "sriov_numvfs"), strconv.Itoa(opts.VfsPerPf)); err != nil {
+		return err
+	}
+
+	if err := writeFile(opts, filepath.Join(base, "sriov_totalvfs"), strconv.Itoa(totalVfs)); err != nil {
+		return err
+	}
+
+	for vf := 0; vf < opts.VfsPerPf; vf++ {
+		link := filepath.Join(base, fmt.Sprintf("virtfn%d", vf))
+		if err := addSymlink(opts, "../"+opts.pciAddress(i+1+vf), link); err != nil {
+			return err
+		}
+	}
+
+	if err := addDlbResources(base, opts, "vf", opts.VfsPerPf); err != nil {
+		return err
+	}
+
+	return addDlbResources(base, opts, "vdev", opts.Dlb.Vdevs)
+}
+
+// addDlbResources adds resource dirs for given number of VFs / vdevs, with
+// the PF resources split evenly between them.
+func addDlbResources(base string, opts *GenOptions, prefix string, count int) error {
+	for n := 0; n < count; n++ {
+		dir := filepath.Join(base, fmt.Sprintf("%s%d_resources", prefix, n))
+		if err := opts.fsys().Mkdir(dir, dirMode); err != nil {
+			return err
+		}
+
+		opts.dirs++
+
+		for name, total := range dlbResources {
+			value := total / count
+			if strings.HasPrefix(name, "num_sn") {
+				// Sequence number slots are not split.
+				value = total
+			}
+
+			if err := writeFile(opts, filepath.Join(dir, name), strconv.Itoa(value)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
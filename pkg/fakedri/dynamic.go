@@ -0,0 +1,165 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	waveSine     = "sine"
+	waveSquare   = "square"
+	waveSawtooth = "sawtooth"
+	waveTrace    = "trace"
+
+	defaultDynamicInterval = time.Second
+)
+
+// DynamicOptions describe sysfs files whose values are periodically
+// rewritten by RunDynamic.
+type DynamicOptions struct {
+	Files    []DynamicFileOptions `yaml:"Files"`
+	Interval string               `yaml:"Interval,omitempty"` // update interval, defaults to 1s
+}
+
+// DynamicFileOptions describe how the value of a single sysfs file changes.
+// Value follows Waveform between Min and Max over Period, or for "trace"
+// waveform, goes through the Trace values, one per update interval.
+type DynamicFileOptions struct {
+	Trace    []int64 `yaml:"Trace,omitempty"`
+	Path     string  `yaml:"Path"` // relative to the fake sysfs root
+	Waveform string  `yaml:"Waveform"`
+	Period   string  `yaml:"Period,omitempty"`
+	Min      int64   `yaml:"Min,omitempty"`
+	Max      int64   `yaml:"Max,omitempty"`
+}
+
+func (dynamic *DynamicOptions) interval() time.Duration {
+	if interval, err := time.ParseDuration(dynamic.Interval); err == nil {
+		return interval
+	}
+
+	return defaultDynamicInterval
+}
+
+func (dynamic *DynamicOptions) validate() error {
+	if dynamic == nil {
+		return nil
+	}
+
+	if dynamic.Interval != "" {
+		if interval, err := time.ParseDuration(dynamic.Interval); err != nil || interval <= 0 {
+			return fmt.Errorf("%w: invalid dynamic update Interval '%s'", ErrInvalidOptions, dynamic.Interval)
+		}
+	}
+
+	for i, file := range dynamic.Files {
+		if err := file.validate(); err != nil {
+			return fmt.Errorf("dynamic file-%d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (file *DynamicFileOptions) validate() error {
+	if file.Path == "" || filepath.IsAbs(file.Path) || strings.HasPrefix(filepath.Clean(file.Path), "..") {
+		return fmt.Errorf("%w: Path '%s' is not relative to sysfs root", ErrInvalidOptions, file.Path)
+	}
+
+	switch file.Waveform {
+	case waveTrace:
+		if len(file.Trace) == 0 {
+			return fmt.Errorf("%w: '%s' waveform without Trace values", ErrInvalidOptions, file.Waveform)
+		}
+
+		return nil
+	case waveSine, waveSquare, waveSawtooth:
+	default:
+		return fmt.Errorf("%w: unknown Waveform '%s'", ErrInvalidOptions, file.Waveform)
+	}
+
+	if period, err := time.ParseDuration(file.Period); err != nil || period <= 0 {
+		return fmt.Errorf("%w: invalid '%s' waveform Period '%s'", ErrInvalidOptions, file.Waveform, file.Period)
+	}
+
+	if file.Min > file.Max {
+		return fmt.Errorf("%w: Min (%d) > Max (%d)", ErrInvalidOptions, file.Min, file.Max)
+	}
+
+	return nil
+}
+
+// value returns the file value at given time since start and update step.
+func (file *DynamicFileOptions) value(elapsed time.Duration, step int) int64 {
+	if file.Waveform == waveTrace {
+		return file.Trace[step%len(file.Trace)]
+	}
+
+	period, _ := time.ParseDuration(file.Period)
+	phase := float64(elapsed%period) / float64(period)
+	span := float64(file.Max - file.Min)
+
+	switch file.Waveform {
+	case waveSine:
+		return file.Min + int64(math.Round(span*(1+math.Sin(2*math.Pi*phase))/2))
+	case waveSquare:
+		if phase < 0.5 {
+			return file.Max
+		}
+
+		return file.Min
+	default: // sawtooth
+		return file.Min + int64(span*phase)
+	}
+}
+
+// RunDynamic periodically rewrites the files listed in the Dynamic options
+// according to their waveforms, until the context is canceled.
+func RunDynamic(ctx context.Context, opts GenOptions) error {
+	if opts.Dynamic == nil || len(opts.Dynamic.Files) == 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(opts.Dynamic.interval())
+	defer ticker.Stop()
+
+	opts.log().V(1).Info("Updating dynamic sysfs files", "files", len(opts.Dynamic.Files), "interval", opts.Dynamic.interval())
+
+	start := time.Now()
+
+	for step := 0; ; step++ {
+		elapsed := time.Since(start)
+
+		for _, file := range opts.Dynamic.Files {
+			value := strconv.FormatInt(file.value(elapsed, step), 10)
+			if err := opts.fsys().WriteFile(filepath.Join(sysfsPath, file.Path), []byte(value), fileMode); err != nil {
+				return fmt.Errorf("updating dynamic file '%s' failed: %w", file.Path, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
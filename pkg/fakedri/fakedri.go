@@ -15,216 +15,867 @@
 //---------------------------------------------------------------
 // sysfs SPECIFICATION
 //
-// sys/class/drm/cardX/
+// sys/class/drm/cardX -> ../../devices/ROOT/BDF/drm/cardX (ROOT and BDF, see pci.go)
 // sys/class/drm/cardX/lmem_total_bytes (gpu memory size, number)
-// sys/class/drm/cardX/device/
-// sys/class/drm/cardX/device/vendor (0x8086)
+// sys/class/drm/cardX/device -> ../../../BDF
+// sys/class/drm/cardX/device/vendor (PCI vendor ID, 0x8086 unless overridden or decoy)
+// sys/class/drm/cardX/device/device (PCI device ID, e.g. 0x56c0)
+// sys/class/drm/cardX/device/revision (PCI revision, e.g. 0x08)
 // sys/class/drm/cardX/device/sriov_numvfs (PF only, number of VF GPUs, number)
 // sys/class/drm/cardX/device/drm/
 // sys/class/drm/cardX/device/drm/cardX/
 // sys/class/drm/cardX/device/drm/renderD1XX/
 // sys/class/drm/cardX/device/numa_node (Numa node index[1], number)
 // [1] indexing these: /sys/devices/system/node/nodeX/
+// sys/bus/pci/drivers/DRIVER/BDF/{device,revision}
+// sys/bus/pci/drivers/DRIVER/BDF/drm/{cardX,renderD1XX}
 //---------------------------------------------------------------
 // devfs SPECIFICATION
 //
 // dev/dri/cardX
 // dev/dri/renderD1XX
+// dev/dri/by-path/pci-BDF-card -> ../cardX
+// dev/dri/by-path/pci-BDF-render -> ../renderD1XX
 //---------------------------------------------------------------
 
 package fakedri
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-logr/logr"
 	"golang.org/x/sys/unix"
 
-	"gopkg.in/yaml.v2"
-
 	"k8s.io/klog/v2"
 )
 
 const (
 	dirMode         = 0775
 	fileMode        = 0644
-	cardBase        = 0
 	renderBase      = 128
-	maxDevs         = 128
 	sysfsPath       = "/tmp/sys"
 	devfsPath       = "/tmp/dev"
+	procfsPath      = "/tmp/proc"
 	mib             = 1024.0 * 1024.0
 	devNullMajor    = 1
 	devNullMinor    = 3
 	devNullType     = unix.S_IFCHR
 	maxK8sLabelSize = 63
 	fullyConnected  = "FULL"
+	defaultDeviceID = "0x4905"
+	defaultRevision = "0x01"
+	intelVendorID   = "0x8086"
+	// decoyVendorID is the vendor of the non-Intel decoy devices (NVIDIA).
+	decoyVendorID = "0x10de"
+	// defaultNfdFeatureDir is where NFD reads the feature (label) files from.
+	defaultNfdFeatureDir = "/etc/kubernetes/node-feature-discovery/features.d"
+)
+
+// Fake device modes, i.e. which type of devices are generated.
+const (
+	modeGpu = "gpu"
+	modeQat = "qat"
+	modeSgx = "sgx"
+	modeDsa = "dsa"
+	modeIaa = "iaa"
+	modeDlb = "dlb"
+	modeNpu = "npu"
+)
+
+// DRM minor number ranges, see drivers/gpu/drm/drm_drv.c.
+const (
+	legacyMinors      = 64
+	extendedMinorBase = 192
+	maxMinor          = 1<<20 - 1
 )
 
+var (
+	// ErrInvalidOptions is wrapped by errors about invalid fake device spec / options.
+	ErrInvalidOptions = errors.New("invalid fake device options")
+	// ErrRealFilesystem is wrapped by errors about refusing to remove non-fake sysfs / devfs content.
+	ErrRealFilesystem = errors.New("refusing to remove what looks like real filesystem")
+	// ErrManifestMismatch is wrapped by errors about fake device tree not matching its manifest.
+	ErrManifestMismatch = errors.New("fake device tree does not match its manifest")
+	// ErrTreeMismatch is wrapped by errors about GPU plugin not discovering fake devices as specified.
+	ErrTreeMismatch = errors.New("fake device tree does not match its spec")
+	// ErrTmpfsFull is wrapped by errors about fake device tree exceeding its Tmpfs Size.
+	ErrTmpfsFull = errors.New("fake device tree would exceed its tmpfs size")
+)
+
+// DeviceOptions overrides GenOptions device properties for Count
+// consecutive devices. Zero values inherit the GenOptions values, and
+// Capabilities are merged to the GenOptions ones.
+type DeviceOptions struct {
+	Capabilities map[string]string `yaml:"Capabilities,omitempty"`
+	NumaNode     *int              `yaml:"NumaNode,omitempty"`
+	Hwmon        *HwmonOptions     `yaml:"Hwmon,omitempty"`
+	Freq         *FreqOptions      `yaml:"Freq,omitempty"`
+	Pcie         *PcieOptions      `yaml:"Pcie,omitempty"`
+	Health       *HealthOptions    `yaml:"Health,omitempty"`
+	MemRegions   *MemRegionOptions `yaml:"MemRegions,omitempty"`
+	Card         *int              `yaml:"Card,omitempty"`   // pinned card number of the first device, the rest follow it
+	Render       *int              `yaml:"Render,omitempty"` // pinned render node number of the first device
+	DeviceID     string            `yaml:"DeviceID,omitempty"`
+	Revision     string            `yaml:"Revision,omitempty"`
+	Vendor       string            `yaml:"Vendor,omitempty"`
+	Count        int               `yaml:"Count,omitempty"`
+	TilesPerDev  int               `yaml:"TilesPerDev,omitempty"`
+	DevMemSize   int               `yaml:"DevMemSize,omitempty"`
+	// Unbound devices have no driver symlink, as if unbound from the driver.
+	Unbound bool `yaml:"Unbound,omitempty"`
+}
+
+// FaultOptions list the indexes of devices for which the fake tree is
+// deliberately broken in the given way.
+type FaultOptions struct {
+	MissingLmem    []int `yaml:"MissingLmem,omitempty"`    // no lmem_total_bytes file
+	UnreadableNuma []int `yaml:"UnreadableNuma,omitempty"` // numa_node that cannot be read
+	DanglingDriver []int `yaml:"DanglingDriver,omitempty"` // driver symlink to non-existing driver
+	EmptyVendor    []int `yaml:"EmptyVendor,omitempty"`    // zero-byte vendor file
+}
+
 type GenOptions struct {
-	Capabilities map[string]string // map (pointer)
-	Info         string            // string (pointer)
-	Driver       string            // string (pointer)
-	Mode         string            // string (pointer)
-	Path         string            // string (pointer)
+	filesystem    Filesystem        // interface (pointers)
+	logger        logr.Logger       // struct with interface (pointers)
+	Capabilities  map[string]string // map (pointer)
+	Devices       []DeviceOptions   // slice (pointer)
+	Faults        FaultOptions      // struct of slices (pointers)
+	Clients       []ClientOptions   // slice (pointer)
+	Decoys        []int             // slice (pointer)
+	Dynamic       *DynamicOptions   // pointer
+	Hwmon         *HwmonOptions     // pointer
+	Freq          *FreqOptions      // pointer
+	Pcie          *PcieOptions      // pointer
+	XeLinks       *XeLinkOptions    // pointer
+	Qat           *QatOptions       // pointer
+	Sgx           *SgxOptions       // pointer
+	Idxd          *IdxdOptions      // pointer
+	Dlb           *DlbOptions       // pointer
+	Topology      *TopologyOptions  // pointer
+	Randomize     *RandomizeOptions // pointer
+	MemRegions    *MemRegionOptions // pointer
+	PrelimIov     *PrelimIovOptions // pointer
+	Mei           *MeiOptions       // pointer
+	Tmpfs         *TmpfsOptions     // pointer
+	Version       string            // string (pointer)
+	Info          string            // string (pointer)
+	Driver        string            // string (pointer)
+	Mode          string            // string (pointer)
+	Path          string            // string (pointer)
+	DeviceID      string            // string (pointer)
+	Revision      string            // string (pointer)
+	VfDeviceID    string            // string (pointer)
+	NfdFeatureDir string            // string (pointer)
+	PciAddress    string            // string (pointer)
+	Manifest      string            // string (pointer)
 
 	DevCount    int // int (non-pointer, 8 bytes on 64-bit systems)
+	CardBase    int // int
+	RenderBase  int // int
 	TilesPerDev int // int
 	DevMemSize  int // int
 	DevsPerNode int // int
 	VfsPerPf    int // int
-
-	files int // int (private fields)
-	dirs  int // int
-	devs  int // int
-	symls int // int
+	TotalVfs    int // int
+	Workers     int // int
+
+	files        int // int (private fields)
+	dirs         int // int
+	devs         int // int
+	symls        int // int
+	placeholders int // int
+
+	// Fail instead of using regular file placeholders for device nodes,
+	// when creating real char devices is not permitted.
+	RequireCharDevices bool // bool
+	// Add only the devices missing from an already generated fake tree,
+	// instead of replacing the whole tree.
+	Append bool // bool
+	// Discard all (info and warning) log messages, failures are returned
+	// as errors anyway.
+	Quiet bool // bool
 }
 
 // genOptionsWithTags represents the struct for our YAML data.
 type genOptionsWithTags struct {
-	Capabilities map[string]string `yaml:"Capabilities"`
-	Info         string            `yaml:"Info"`
-	Driver       string            `yaml:"Driver"`
-	Mode         string            `yaml:"Mode"`
-	Path         string            `yaml:"Path"`
-	DevCount     int               `yaml:"DevCount"`
-	TilesPerDev  int               `yaml:"TilesPerDev"`
-	DevMemSize   int               `yaml:"DevMemSize"`
-	DevsPerNode  int               `yaml:"DevsPerNode"`
-	VfsPerPf     int               `yaml:"VfsPerPf"`
+	Capabilities  map[string]string `yaml:"Capabilities,omitempty"`
+	Devices       []DeviceOptions   `yaml:"Devices,omitempty"`
+	Faults        FaultOptions      `yaml:"Faults,omitempty"`
+	Clients       []ClientOptions   `yaml:"Clients,omitempty"`
+	Decoys        []int             `yaml:"Decoys,omitempty"`
+	Dynamic       *DynamicOptions   `yaml:"Dynamic,omitempty"`
+	Hwmon         *HwmonOptions     `yaml:"Hwmon,omitempty"`
+	Freq          *FreqOptions      `yaml:"Freq,omitempty"`
+	Pcie          *PcieOptions      `yaml:"Pcie,omitempty"`
+	XeLinks       *XeLinkOptions    `yaml:"XeLinks,omitempty"`
+	Qat           *QatOptions       `yaml:"Qat,omitempty"`
+	Sgx           *SgxOptions       `yaml:"Sgx,omitempty"`
+	Idxd          *IdxdOptions      `yaml:"Idxd,omitempty"`
+	Dlb           *DlbOptions       `yaml:"Dlb,omitempty"`
+	Topology      *TopologyOptions  `yaml:"Topology,omitempty"`
+	Randomize     *RandomizeOptions `yaml:"Randomize,omitempty"`
+	MemRegions    *MemRegionOptions `yaml:"MemRegions,omitempty"`
+	PrelimIov     *PrelimIovOptions `yaml:"PrelimIov,omitempty"`
+	Mei           *MeiOptions       `yaml:"Mei,omitempty"`
+	Tmpfs         *TmpfsOptions     `yaml:"Tmpfs,omitempty"`
+	Version       string            `yaml:"Version,omitempty"`
+	Info          string            `yaml:"Info,omitempty"`
+	Driver        string            `yaml:"Driver,omitempty"`
+	Mode          string            `yaml:"Mode,omitempty"`
+	Path          string            `yaml:"Path,omitempty"`
+	DeviceID      string            `yaml:"DeviceID,omitempty"`
+	Revision      string            `yaml:"Revision,omitempty"`
+	VfDeviceID    string            `yaml:"VfDeviceID,omitempty"`
+	NfdFeatureDir string            `yaml:"NfdFeatureDir,omitempty"`
+	PciAddress    string            `yaml:"PciAddress,omitempty"`
+	Manifest      string            `yaml:"Manifest,omitempty"`
+	DevCount      int               `yaml:"DevCount,omitempty"`
+	CardBase      int               `yaml:"CardBase,omitempty"`
+	RenderBase    int               `yaml:"RenderBase,omitempty"`
+	TilesPerDev   int               `yaml:"TilesPerDev,omitempty"`
+	DevMemSize    int               `yaml:"DevMemSize,omitempty"`
+	DevsPerNode   int               `yaml:"DevsPerNode,omitempty"`
+	VfsPerPf      int               `yaml:"VfsPerPf,omitempty"`
+	TotalVfs      int               `yaml:"TotalVfs,omitempty"`
+	Workers       int               `yaml:"Workers,omitempty"`
+
+	RequireCharDevices bool `yaml:"RequireCharDevices,omitempty"`
+	Append             bool `yaml:"Append,omitempty"`
+	Quiet              bool `yaml:"Quiet,omitempty"`
 }
 
 // Function to transform from GenOptionsWithTags to GenOptions.
 func convertToGenOptions(withTags genOptionsWithTags) GenOptions {
 	return GenOptions{
-		Capabilities: withTags.Capabilities,
-		Info:         withTags.Info,
-		Driver:       withTags.Driver,
-		Mode:         withTags.Mode,
-		Path:         withTags.Path,
-		DevCount:     withTags.DevCount,
-		TilesPerDev:  withTags.TilesPerDev,
-		DevMemSize:   withTags.DevMemSize,
-		DevsPerNode:  withTags.DevsPerNode,
-		VfsPerPf:     withTags.VfsPerPf,
+		Capabilities:  withTags.Capabilities,
+		Devices:       withTags.Devices,
+		Faults:        withTags.Faults,
+		Clients:       withTags.Clients,
+		Decoys:        withTags.Decoys,
+		Dynamic:       withTags.Dynamic,
+		Hwmon:         withTags.Hwmon,
+		Freq:          withTags.Freq,
+		Pcie:          withTags.Pcie,
+		XeLinks:       withTags.XeLinks,
+		Qat:           withTags.Qat,
+		Sgx:           withTags.Sgx,
+		Idxd:          withTags.Idxd,
+		Dlb:           withTags.Dlb,
+		Topology:      withTags.Topology,
+		Randomize:     withTags.Randomize,
+		MemRegions:    withTags.MemRegions,
+		PrelimIov:     withTags.PrelimIov,
+		Mei:           withTags.Mei,
+		Tmpfs:         withTags.Tmpfs,
+		Version:       withTags.Version,
+		Info:          withTags.Info,
+		Driver:        withTags.Driver,
+		Mode:          withTags.Mode,
+		Path:          withTags.Path,
+		DeviceID:      withTags.DeviceID,
+		Revision:      withTags.Revision,
+		VfDeviceID:    withTags.VfDeviceID,
+		NfdFeatureDir: withTags.NfdFeatureDir,
+		PciAddress:    withTags.PciAddress,
+		Manifest:      withTags.Manifest,
+		DevCount:      withTags.DevCount,
+		CardBase:      withTags.CardBase,
+		RenderBase:    withTags.RenderBase,
+		TilesPerDev:   withTags.TilesPerDev,
+		DevMemSize:    withTags.DevMemSize,
+		DevsPerNode:   withTags.DevsPerNode,
+		VfsPerPf:      withTags.VfsPerPf,
+		TotalVfs:      withTags.TotalVfs,
+		Workers:       withTags.Workers,
+
+		RequireCharDevices: withTags.RequireCharDevices,
+		Append:             withTags.Append,
+		Quiet:              withTags.Quiet,
 		// Private fields are not copied
 	}
 }
 
+// Function to transform from GenOptions to GenOptionsWithTags.
+func convertFromGenOptions(opts GenOptions) genOptionsWithTags {
+	return genOptionsWithTags{
+		Capabilities:  opts.Capabilities,
+		Devices:       opts.Devices,
+		Faults:        opts.Faults,
+		Clients:       opts.Clients,
+		Decoys:        opts.Decoys,
+		Dynamic:       opts.Dynamic,
+		Hwmon:         opts.Hwmon,
+		Freq:          opts.Freq,
+		Pcie:          opts.Pcie,
+		XeLinks:       opts.XeLinks,
+		Qat:           opts.Qat,
+		Sgx:           opts.Sgx,
+		Idxd:          opts.Idxd,
+		Dlb:           opts.Dlb,
+		Topology:      opts.Topology,
+		Randomize:     opts.Randomize,
+		MemRegions:    opts.MemRegions,
+		PrelimIov:     opts.PrelimIov,
+		Mei:           opts.Mei,
+		Tmpfs:         opts.Tmpfs,
+		Version:       opts.Version,
+		Info:          opts.Info,
+		Driver:        opts.Driver,
+		Mode:          opts.Mode,
+		Path:          opts.Path,
+		DeviceID:      opts.DeviceID,
+		Revision:      opts.Revision,
+		VfDeviceID:    opts.VfDeviceID,
+		NfdFeatureDir: opts.NfdFeatureDir,
+		PciAddress:    opts.PciAddress,
+		Manifest:      opts.Manifest,
+		DevCount:      opts.DevCount,
+		CardBase:      opts.CardBase,
+		RenderBase:    opts.RenderBase,
+		TilesPerDev:   opts.TilesPerDev,
+		DevMemSize:    opts.DevMemSize,
+		DevsPerNode:   opts.DevsPerNode,
+		VfsPerPf:      opts.VfsPerPf,
+		TotalVfs:      opts.TotalVfs,
+		Workers:       opts.Workers,
+
+		RequireCharDevices: opts.RequireCharDevices,
+		Append:             opts.Append,
+		Quiet:              opts.Quiet,
+	}
+}
+
+func hasFault(devs []int, i int) bool {
+	return slices.Contains(devs, i)
+}
+
+func (faults *FaultOptions) validate(devCount int) error {
+	for name, devs := range map[string][]int{
+		"MissingLmem":    faults.MissingLmem,
+		"UnreadableNuma": faults.UnreadableNuma,
+		"DanglingDriver": faults.DanglingDriver,
+		"EmptyVendor":    faults.EmptyVendor,
+	} {
+		for _, i := range devs {
+			if i < 0 || i >= devCount {
+				return fmt.Errorf("%w: invalid %s fault device index: 0 <= %d < %d", ErrInvalidOptions, name, i, devCount)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (dev *DeviceOptions) count() int {
+	if dev.Count > 0 {
+		return dev.Count
+	}
+
+	return 1
+}
+
+// devCount returns the number of devices described by the Devices list.
+func (opts *GenOptions) devCount() int {
+	count := 0
+	for i := range opts.Devices {
+		count += opts.Devices[i].count()
+	}
+
+	return count
+}
+
+// device returns the effective properties of device i, i.e. the global
+// options with the overrides from the matching Devices entry applied.
+func (opts *GenOptions) device(i int) DeviceOptions {
+	node := 0
+	if opts.DevsPerNode > 0 {
+		node = i / opts.DevsPerNode
+	}
+
+	dev := DeviceOptions{
+		Capabilities: opts.Capabilities,
+		NumaNode:     &node,
+		Hwmon:        opts.Hwmon,
+		Freq:         opts.Freq,
+		Pcie:         opts.Pcie,
+		MemRegions:   opts.MemRegions,
+		DeviceID:     opts.DeviceID,
+		Revision:     opts.Revision,
+		Vendor:       intelVendorID,
+		Count:        1,
+		TilesPerDev:  opts.TilesPerDev,
+		DevMemSize:   opts.DevMemSize,
+	}
+
+	if opts.VfsPerPf > 0 && i%(opts.VfsPerPf+1) != 0 && opts.VfDeviceID != "" {
+		dev.DeviceID = opts.VfDeviceID
+	}
+
+	if dev.DeviceID == "" {
+		dev.DeviceID = defaultDeviceID
+	}
+
+	if dev.Revision == "" {
+		dev.Revision = defaultRevision
+	}
+
+	if slices.Contains(opts.Decoys, i) {
+		dev.Vendor = decoyVendorID
+	}
+
+	for _, override := range opts.Devices {
+		if i >= override.count() {
+			i -= override.count()
+			continue
+		}
+
+		if override.Capabilities != nil {
+			dev.Capabilities = maps.Clone(opts.Capabilities)
+			if dev.Capabilities == nil {
+				dev.Capabilities = map[string]string{}
+			}
+
+			maps.Copy(dev.Capabilities, override.Capabilities)
+		}
+
+		if override.NumaNode != nil {
+			dev.NumaNode = override.NumaNode
+		}
+
+		if override.Hwmon != nil {
+			dev.Hwmon = override.Hwmon
+		}
+
+		if override.Freq != nil {
+			dev.Freq = override.Freq
+		}
+
+		if override.Pcie != nil {
+			dev.Pcie = override.Pcie
+		}
+
+		if override.Health != nil {
+			dev.Health = override.Health
+		}
+
+		if override.MemRegions != nil {
+			dev.MemRegions = override.MemRegions
+		}
+
+		dev.Unbound = override.Unbound
+
+		if override.DeviceID != "" {
+			dev.DeviceID = override.DeviceID
+		}
+
+		if override.Revision != "" {
+			dev.Revision = override.Revision
+		}
+
+		if override.Vendor != "" {
+			dev.Vendor = override.Vendor
+		}
+
+		if override.TilesPerDev > 0 {
+			dev.TilesPerDev = override.TilesPerDev
+		}
+
+		if override.DevMemSize > 0 {
+			dev.DevMemSize = override.DevMemSize
+		}
+
+		break
+	}
+
+	return dev
+}
+
+// addSysfsDriTree adds the PCI device dir for device i, with its DRM card dir
+// linked from the DRM class dir.
 func addSysfsDriTree(root string, opts *GenOptions, i int) error {
-	card := fmt.Sprintf("card%d", cardBase+i)
-	base := filepath.Join(root, "class", "drm", card)
+	card := opts.cardName(i)
+	bdf := opts.pciAddress(i)
+	pciDir := filepath.Join(root, "devices", opts.pciRoot(i), bdf)
+	base := filepath.Join(pciDir, "drm", card)
 
-	if err := os.MkdirAll(base, dirMode); err != nil {
+	if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
 		return err
 	}
 
-	opts.dirs++
+	opts.dirs += 2
 
-	data := []byte(strconv.Itoa(opts.DevMemSize))
-	file := filepath.Join(base, "lmem_total_bytes")
+	classDir := filepath.Join(root, "class", "drm")
+	if err := opts.fsys().MkdirAll(classDir, dirMode); err != nil {
+		return err
+	}
 
-	if err := os.WriteFile(file, data, fileMode); err != nil {
+	target, err := filepath.Rel(classDir, base)
+	if err != nil {
 		return err
 	}
 
-	opts.files++
+	if err = addSymlink(opts, target, filepath.Join(classDir, card)); err != nil {
+		return err
+	}
 
-	path := filepath.Join(base, "device", "drm", card)
-	if err := os.MkdirAll(path, dirMode); err != nil {
+	if err = addSymlink(opts, "../../../"+bdf, filepath.Join(base, "device")); err != nil {
 		return err
 	}
 
-	opts.dirs++
+	dev := opts.device(i)
+
+	if !hasFault(opts.Faults.MissingLmem, i) {
+		data := []byte(strconv.Itoa(dev.DevMemSize))
+		file := filepath.Join(base, "lmem_total_bytes")
 
-	path = filepath.Join(base, "device", "drm", fmt.Sprintf("renderD%d", renderBase+i))
-	if err := os.Mkdir(path, dirMode); err != nil {
+		if err := opts.fsys().WriteFile(file, data, fileMode); err != nil {
+			return err
+		}
+
+		opts.files++
+	}
+
+	path := filepath.Join(pciDir, "drm", opts.renderName(i))
+	if err := opts.fsys().Mkdir(path, dirMode); err != nil {
 		return err
 	}
 
 	opts.dirs++
 
-	file = filepath.Join(base, "device", "driver")
-	if err := os.Symlink(fmt.Sprintf("../../../../bus/pci/drivers/%s", opts.Driver), file); err != nil {
-		klog.Fatalf("symlink creation failed '%s': %v",
-			file, err)
+	if err := addSysfsPciDevice(pciDir, opts, dev, i); err != nil {
+		return err
 	}
 
-	opts.symls++
+	for tile := 0; tile < dev.TilesPerDev; tile++ {
+		path := filepath.Join(base, "gt", fmt.Sprintf("gt%d", tile))
+		if err := opts.fsys().MkdirAll(path, dirMode); err != nil {
+			return err
+		}
 
-	data = []byte("0x8086")
-	file = filepath.Join(base, "device", "vendor")
+		opts.dirs++
+	}
 
-	if err := os.WriteFile(file, data, fileMode); err != nil {
-		return err
+	return nil
+}
+
+// driverTarget returns the driver symlink target for GPU device i.
+func (opts *GenOptions) driverTarget(i int) string {
+	driverDir := "drivers"
+	if hasFault(opts.Faults.DanglingDriver, i) {
+		driverDir = "drivers-missing"
 	}
 
-	opts.files++
+	return fmt.Sprintf("../../../bus/pci/%s/%s", driverDir, opts.Driver)
+}
 
-	node := 0
-	if opts.DevsPerNode > 0 {
-		node = i / opts.DevsPerNode
+// addSysfsPciDevice adds the PCI device files for device i to given PCI device dir.
+func addSysfsPciDevice(base string, opts *GenOptions, dev DeviceOptions, i int) error {
+	file := filepath.Join(base, "driver")
+
+	if !dev.Unbound {
+		if err := opts.fsys().Symlink(opts.driverTarget(i), file); err != nil {
+			return fmt.Errorf("symlink creation failed '%s': %w", file, err)
+		}
+
+		opts.symls++
+	}
+
+	data := []byte(dev.Vendor)
+	if hasFault(opts.Faults.EmptyVendor, i) {
+		data = []byte{}
 	}
 
-	data = []byte(strconv.Itoa(node))
-	file = filepath.Join(base, "device", "numa_node")
+	file = filepath.Join(base, "vendor")
 
-	if err := os.WriteFile(file, data, fileMode); err != nil {
+	if err := opts.fsys().WriteFile(file, data, fileMode); err != nil {
 		return err
 	}
 
 	opts.files++
 
-	if opts.VfsPerPf > 0 && i%(opts.VfsPerPf+1) == 0 {
-		data = []byte(strconv.Itoa(opts.VfsPerPf))
-		file = filepath.Join(base, "device", "sriov_numvfs")
+	if err := addPciIDFiles(base, opts, dev); err != nil {
+		return err
+	}
+
+	if err := addPciConfigFiles(base, opts, dev, i); err != nil {
+		return err
+	}
+
+	file = filepath.Join(base, "numa_node")
+
+	if hasFault(opts.Faults.UnreadableNuma, i) {
+		// Directory, so that reading it fails also for root.
+		if err := opts.fsys().Mkdir(file, dirMode); err != nil {
+			return err
+		}
 
-		if err := os.WriteFile(file, data, fileMode); err != nil {
+		opts.dirs++
+	} else {
+		data = []byte(strconv.Itoa(*dev.NumaNode))
+		if err := opts.fsys().WriteFile(file, data, fileMode); err != nil {
 			return err
 		}
 
 		opts.files++
 	}
 
-	for tile := 0; tile < opts.TilesPerDev; tile++ {
-		path := filepath.Join(base, "gt", fmt.Sprintf("gt%d", tile))
-		if err := os.MkdirAll(path, dirMode); err != nil {
+	if err := addLocalCpulist(base, opts, *dev.NumaNode); err != nil {
+		return err
+	}
+
+	if opts.VfsPerPf > 0 {
+		return addSriovFiles(base, opts, i)
+	}
+
+	return nil
+}
+
+// writeFile writes given content to a new sysfs file and counts it.
+func writeFile(opts *GenOptions, file, content string) error {
+	if err := opts.fsys().WriteFile(file, []byte(content), fileMode); err != nil {
+		return err
+	}
+
+	opts.files++
+
+	return nil
+}
+
+// writeNfdFeatureFile writes given "name=value" label lines to the named
+// NFD feature file.
+func writeNfdFeatureFile(opts *GenOptions, name string, labels []string) error {
+	dir := opts.NfdFeatureDir
+	if dir == "" {
+		dir = defaultNfdFeatureDir
+	}
+
+	if err := opts.fsys().MkdirAll(dir, dirMode); err != nil {
+		return fmt.Errorf("failed to create NFD feature directory: %w", err)
+	}
+
+	for _, label := range labels {
+		opts.log().V(1).Info("NFD feature label", "file", name, "label", label)
+	}
+
+	file := filepath.Join(dir, name)
+	if err := opts.fsys().WriteFile(file, []byte(strings.Join(labels, "\n")+"\n"), fileMode); err != nil {
+		return fmt.Errorf("failed to write NFD feature file '%s': %w", file, err)
+	}
+
+	return nil
+}
+
+// addPciIDFiles writes the PCI device ID and revision files to given PCI device dir.
+func addPciIDFiles(base string, opts *GenOptions, dev DeviceOptions) error {
+	for name, value := range map[string]string{
+		"device":   dev.DeviceID,
+		"revision": dev.Revision,
+	} {
+		if err := opts.fsys().WriteFile(filepath.Join(base, name), []byte(value), fileMode); err != nil {
 			return err
 		}
 
-		opts.dirs++
+		opts.files++
 	}
 
 	return nil
 }
 
+// minorPins returns the card and render node minor numbers pinned by the
+// Devices entries, by the index of their first device.
+func (opts *GenOptions) minorPins() (cards, renders map[int]int) {
+	i := 0
+
+	for _, dev := range opts.Devices {
+		if dev.Card != nil {
+			if cards == nil {
+				cards = map[int]int{}
+			}
+
+			cards[i] = *dev.Card
+		}
+
+		if dev.Render != nil {
+			if renders == nil {
+				renders = map[int]int{}
+			}
+
+			renders[i] = *dev.Render
+		}
+
+		i += dev.count()
+	}
+
+	return cards, renders
+}
+
+// allocMinors calls fn with the DRM primary (card) and render node minor
+// numbers of devices 0 - last. Like the kernel, they are allocated from the
+// legacy ranges (CardBase-63 and RenderBase-191, or from the numbers pinned
+// in Devices entries) first, and once those run out, from the shared extended
+// range starting at 192, render node first for each device.
+func (opts *GenOptions) allocMinors(last int, fn func(i, card, render int)) {
+	cardPins, renderPins := opts.minorPins()
+
+	nextRender := opts.RenderBase
+	if nextRender == 0 {
+		nextRender = renderBase
+	}
+
+	nextCard := opts.CardBase
+	next := extendedMinorBase
+
+	for j := 0; j <= last; j++ {
+		if pin, ok := renderPins[j]; ok {
+			nextRender = pin
+		}
+
+		if pin, ok := cardPins[j]; ok {
+			nextCard = pin
+		}
+
+		render := nextRender
+		if render >= renderBase+legacyMinors {
+			render = next
+			next++
+		}
+
+		card := nextCard
+		if card >= legacyMinors {
+			card = next
+			next++
+		}
+
+		nextRender++
+		nextCard++
+
+		fn(j, card, render)
+	}
+}
+
+// minorRange is a run of consecutive legacy minor numbers, starting from
+// minor for device first, up to the first device of the next range.
+type minorRange struct {
+	first, minor int
+}
+
+// minorRanges returns the legacy minor number ranges starting from base, and
+// from the pinned numbers, sorted by their first device.
+func minorRanges(base int, pins map[int]int) []minorRange {
+	ranges := []minorRange{{first: 0, minor: base}}
+
+	for _, first := range slices.Sorted(maps.Keys(pins)) {
+		if first == 0 {
+			ranges[0].minor = pins[first]
+			continue
+		}
+
+		ranges = append(ranges, minorRange{first: first, minor: pins[first]})
+	}
+
+	return ranges
+}
+
+// legacyMinor returns the legacy minor number of device i, which is beyond
+// limit when the legacy range has run out.
+func legacyMinor(ranges []minorRange, i int) int {
+	k, _ := slices.BinarySearchFunc(ranges, i+1, func(r minorRange, target int) int {
+		return r.first - target
+	})
+	r := ranges[k-1]
+
+	return r.minor + i - r.first
+}
+
+// overflows returns the number of the devices before device i whose legacy
+// minor numbers are not below limit.
+func overflows(ranges []minorRange, limit, i int) int {
+	count := 0
+
+	for k, r := range ranges {
+		if r.first >= i {
+			break
+		}
+
+		end := i
+		if k+1 < len(ranges) && ranges[k+1].first < i {
+			end = ranges[k+1].first
+		}
+
+		// Devices from r.first + limit - r.minor on overflow.
+		count += max(0, end-max(r.first, r.first+limit-r.minor))
+	}
+
+	return count
+}
+
+// minors returns the DRM primary (card) and render node minor numbers for
+// device i, as allocMinors does, but without going through the preceding
+// devices: the extended numbers are counted from the legacy ranges.
+func (opts *GenOptions) minors(i int) (card, render int) {
+	cardPins, renderPins := opts.minorPins()
+
+	base := opts.RenderBase
+	if base == 0 {
+		base = renderBase
+	}
+
+	renders := minorRanges(base, renderPins)
+	cards := minorRanges(opts.CardBase, cardPins)
+	next := extendedMinorBase +
+		overflows(renders, renderBase+legacyMinors, i) +
+		overflows(cards, legacyMinors, i)
+
+	render = legacyMinor(renders, i)
+	if render >= renderBase+legacyMinors {
+		render = next
+		next++
+	}
+
+	card = legacyMinor(cards, i)
+	if card >= legacyMinors {
+		card = next
+	}
+
+	return card, render
+}
+
+func (opts *GenOptions) cardName(i int) string {
+	card, _ := opts.minors(i)
+	return fmt.Sprintf("card%d", card)
+}
+
+func (opts *GenOptions) renderName(i int) string {
+	_, render := opts.minors(i)
+	return fmt.Sprintf("renderD%d", render)
+}
+
 func addSysfsBusTree(root string, opts *GenOptions, i int) error {
-	pciName := fmt.Sprintf("0000:00:0%d.0", i)
-	base := filepath.Join(root, "bus", "pci", "drivers", opts.Driver, pciName)
+	base := filepath.Join(root, "bus", "pci", "drivers", opts.Driver, opts.pciAddress(i))
 
-	if err := os.MkdirAll(base, dirMode); err != nil {
+	if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
 		return err
 	}
 
 	opts.dirs++
 
-	data := []byte("0x4905")
-	file := filepath.Join(base, "device")
-
-	if err := os.WriteFile(file, data, fileMode); err != nil {
+	if err := addPciIDFiles(base, opts, opts.device(i)); err != nil {
 		return err
 	}
 
-	opts.files++
-
 	drm := filepath.Join(base, "drm")
-	if err := os.MkdirAll(drm, dirMode); err != nil {
+	if err := opts.fsys().MkdirAll(drm, dirMode); err != nil {
 		return err
 	}
 
@@ -233,22 +884,29 @@ func addSysfsBusTree(root string, opts *GenOptions, i int) error {
 	return addDeviceNodes(drm, opts, i)
 }
 
-func addDeviceNodes(base string, opts *GenOptions, i int) error {
+// addNullDeviceNode creates a NULL device node to given path, and counts it.
+func addNullDeviceNode(opts *GenOptions, file string) error {
+	return addCharDeviceNode(opts, file, devNullMajor, devNullMinor)
+}
+
+// addCharDeviceNode creates a character device node with given major and
+// minor numbers to given path, and counts it. If that is not permitted
+// (no CAP_MKNOD), an empty regular file is created instead, unless real
+// char devices are required.
+func addCharDeviceNode(opts *GenOptions, file string, major, minor int) error {
 	mode := uint32(fileMode | devNullType)
-	devid := int(unix.Mkdev(uint32(devNullMajor), uint32(devNullMinor)))
+	devid := int(unix.Mkdev(uint32(major), uint32(minor)))
 
-	file := filepath.Join(base, fmt.Sprintf("card%d", cardBase+i))
-	if err := unix.Mknod(file, mode, devid); err != nil {
-		klog.Fatalf("NULL device (%d:%d) node creation failed for '%s': %v",
-			devNullMajor, devNullMinor, file, err)
+	err := opts.fsys().Mknod(file, mode, devid)
+	if err != nil && errors.Is(err, fs.ErrPermission) && !opts.RequireCharDevices {
+		if err = opts.fsys().WriteFile(file, nil, fileMode); err == nil {
+			opts.placeholders++
+		}
 	}
 
-	opts.devs++
-
-	file = filepath.Join(base, fmt.Sprintf("renderD%d", renderBase+i))
-	if err := unix.Mknod(file, mode, devid); err != nil {
-		klog.Fatalf("NULL device (%d:%d) node creation failed for '%s': %v",
-			devNullMajor, devNullMinor, file, err)
+	if err != nil {
+		return fmt.Errorf("device (%d:%d) node creation failed for '%s': %w",
+			major, minor, file, err)
 	}
 
 	opts.devs++
@@ -256,19 +914,29 @@ func addDeviceNodes(base string, opts *GenOptions, i int) error {
 	return nil
 }
 
+func addDeviceNodes(base string, opts *GenOptions, i int) error {
+	if err := addNullDeviceNode(opts, filepath.Join(base, opts.cardName(i))); err != nil {
+		return err
+	}
+
+	return addNullDeviceNode(opts, filepath.Join(base, opts.renderName(i)))
+}
+
+func (opts *GenOptions) byPathName(i int, node string) string {
+	return fmt.Sprintf("by-path/pci-%s-%s", opts.pciAddress(i), node)
+}
+
 func addDeviceSymlinks(base string, opts *GenOptions, i int) error {
-	target := filepath.Join(base, fmt.Sprintf("by-path/pci-0000:%02d:02.0-card", i))
-	if err := os.Symlink(fmt.Sprintf("../card%d", cardBase+i), target); err != nil {
-		klog.Fatalf("symlink creation failed '%s': %v",
-			target, err)
+	target := filepath.Join(base, opts.byPathName(i, "card"))
+	if err := opts.fsys().Symlink("../"+opts.cardName(i), target); err != nil {
+		return fmt.Errorf("symlink creation failed '%s': %w", target, err)
 	}
 
 	opts.symls++
 
-	target = filepath.Join(base, fmt.Sprintf("by-path/pci-0000:%02d:02.0-render", i))
-	if err := os.Symlink(fmt.Sprintf("../renderD%d", renderBase+i), target); err != nil {
-		klog.Fatalf("symlink creation failed '%s': %v",
-			target, err)
+	target = filepath.Join(base, opts.byPathName(i, "render"))
+	if err := opts.fsys().Symlink("../"+opts.renderName(i), target); err != nil {
+		return fmt.Errorf("symlink creation failed '%s': %w", target, err)
 	}
 
 	opts.symls++
@@ -278,11 +946,11 @@ func addDeviceSymlinks(base string, opts *GenOptions, i int) error {
 
 func addDevfsDriTree(root string, opts *GenOptions, i int) error {
 	base := filepath.Join(root, "dri")
-	if err := os.MkdirAll(base, dirMode); err != nil {
+	if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(filepath.Join(root, "dri/by-path"), dirMode); err != nil {
+	if err := opts.fsys().MkdirAll(filepath.Join(root, "dri/by-path"), dirMode); err != nil {
 		return err
 	}
 
@@ -296,234 +964,639 @@ func addDevfsDriTree(root string, opts *GenOptions, i int) error {
 }
 
 func addDebugfsDriTree(root string, opts *GenOptions, i int) error {
-	base := filepath.Join(root, "kernel", "debug", "dri", strconv.Itoa(i))
-	if err := os.MkdirAll(base, dirMode); err != nil {
+	card, _ := opts.minors(i)
+	base := filepath.Join(root, "kernel", "debug", "dri", strconv.Itoa(card))
+	if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
 		return err
 	}
 
 	opts.dirs++
 
-	path := filepath.Join(base, "i915_capabilities")
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fileMode)
+	var capabilities strings.Builder
 
-	if err != nil {
-		return err
+	for key, value := range opts.device(i).Capabilities {
+		fmt.Fprintf(&capabilities, "%s: %s\n", key, value)
 	}
 
-	defer f.Close()
+	return writeFile(opts, filepath.Join(base, "i915_capabilities"), capabilities.String())
+}
 
-	opts.files++
+// fakeSysfsEntries lists the sysfs entries generated by the different modes.
+var fakeSysfsEntries = []string{"bus", "class", "dev", "devices", "kernel"}
 
-	for key, value := range opts.Capabilities {
-		line := fmt.Sprintf("%s: %s\n", key, value)
-		if _, err = f.WriteString(line); err != nil {
-			return err
+// fakeDevfsEntries lists the devfs entries generated by the different modes.
+var fakeDevfsEntries = []string{"dri", "vfio", "sgx_enclave", "sgx_provision", "dsa", "iax", "char", "accel"}
+
+func removeExistingDir(opts *GenOptions, path, name string) error {
+	entries, err := opts.fsys().ReadDir(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("ReadDir() failed on fake %s path '%s': %w", name, path, err)
+	}
+
+	if len(entries) == 0 {
+		return unmountTmpfs(opts, path)
+	}
+
+	if name == "sysfs" {
+		for _, entry := range entries {
+			if !slices.Contains(fakeSysfsEntries, entry.Name()) {
+				return fmt.Errorf("%w: '%s' in '%s' is not one of %v - real sysfs?", ErrRealFilesystem, entry.Name(), path, fakeSysfsEntries)
+			}
+		}
+	}
+
+	if name == "devfs" {
+		for _, entry := range entries {
+			if !slices.Contains(fakeDevfsEntries, entry.Name()) && !strings.HasPrefix(entry.Name(), "dlb") &&
+				!strings.HasPrefix(entry.Name(), "mei") {
+				return fmt.Errorf("%w: '%s' in '%s' is not one of %v - real devfs?", ErrRealFilesystem, entry.Name(), path, fakeDevfsEntries)
+			}
 		}
 	}
 
+	if name == "procfs" {
+		for _, entry := range entries {
+			if _, err = strconv.Atoi(entry.Name()); err != nil {
+				return fmt.Errorf("%w: non-PID entry '%s' in '%s' - real procfs?", ErrRealFilesystem, entry.Name(), path)
+			}
+		}
+	}
+
+	opts.log().V(1).Info("Removing already existing fake tree", "name", name, "path", path)
+
+	err = opts.fsys().RemoveAll(path)
+	if errors.Is(err, unix.EBUSY) && opts.Tmpfs != nil {
+		// Dedicated tmpfs mount point itself can not be removed.
+		err = unmountTmpfs(opts, path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("removing existing %s in '%s' failed: %w", name, path, err)
+	}
+
 	return nil
 }
 
-func removeExistingDir(path, name string) {
-	entries, err := os.ReadDir(path)
-	if err != nil && !errors.Is(err, fs.ErrNotExist) {
-		klog.Fatalf("ReadDir() failed on fake %s path '%s': %v", name, path, err)
+// addDevice generates the sysfs, devfs and debugfs content for device i.
+func addDevice(opts *GenOptions, i int) error {
+	switch opts.Mode {
+	case modeQat:
+		if err := addQatDevice(opts, i); err != nil {
+			return fmt.Errorf("dev-%d QAT tree generation failed: %w", i, err)
+		}
+
+		return nil
+	case modeSgx:
+		if err := addSgxDevice(opts); err != nil {
+			return fmt.Errorf("SGX device generation failed: %w", err)
+		}
+
+		return nil
+	case modeDsa, modeIaa:
+		if err := addIdxdDevice(opts, i); err != nil {
+			return fmt.Errorf("dev-%d %s tree generation failed: %w", i, opts.Mode, err)
+		}
+
+		return nil
+	case modeDlb:
+		if err := addDlbDevice(opts, i); err != nil {
+			return fmt.Errorf("dev-%d DLB tree generation failed: %w", i, err)
+		}
+
+		return nil
+	case modeNpu:
+		if err := addNpuDevice(opts, i); err != nil {
+			return fmt.Errorf("dev-%d NPU tree generation failed: %w", i, err)
+		}
+
+		return nil
 	}
 
-	if len(entries) == 0 {
-		return
+	if err := addSysfsBusTree(sysfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d sysfs bus tree generation failed: %w", i, err)
+	}
+
+	if err := addSysfsDriTree(sysfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d sysfs tree generation failed: %w", i, err)
+	}
+
+	if err := addSysfsTileFiles(sysfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d sysfs tile files generation failed: %w", i, err)
+	}
+
+	if err := addDevfsDriTree(devfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d devfs tree generation failed: %w", i, err)
+	}
+
+	if err := addDebugfsDriTree(sysfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d debugfs tree generation failed: %w", i, err)
+	}
+
+	if err := addSysfsHwmonTree(sysfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d sysfs hwmon tree generation failed: %w", i, err)
+	}
+
+	if err := addSysfsFreqFiles(sysfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d sysfs GT frequency files generation failed: %w", i, err)
 	}
 
-	if name == "sysfs" && len(entries) > 3 {
-		klog.Fatalf(">3 entries in '%s' - real sysfs?", path)
+	if err := addHealthFiles(opts, i); err != nil {
+		return fmt.Errorf("dev-%d health files generation failed: %w", i, err)
 	}
 
-	if name == "devfs" && (entries[0].Name() != "dri" || len(entries) > 1) {
-		klog.Fatalf(">1 entries in '%s', or '%s' != 'dri' - real devfs?", path, entries[0].Name())
+	if err := addSysfsMemRegions(sysfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d sysfs memory regions generation failed: %w", i, err)
 	}
 
-	klog.Warningf("Removing already existing fake %s path '%s'", name, path)
+	if err := addPrelimIovFiles(sysfsPath, opts, i); err != nil {
+		return fmt.Errorf("dev-%d sysfs prelim SR-IOV files generation failed: %w", i, err)
+	}
 
-	if err = os.RemoveAll(path); err != nil {
-		klog.Fatalf("Removing existing %s in '%s' failed: %v", name, path, err)
+	if err := addMeiDevice(opts, i); err != nil {
+		return fmt.Errorf("dev-%d MEI GSC device generation failed: %w", i, err)
 	}
+
+	return nil
 }
 
-func GenerateDriFiles(opts GenOptions) {
-	if opts.Info != "" {
-		klog.V(1).Infof("Config: '%s'", opts.Info)
+// addDevices generates all devices (in append mode, the ones not already
+// generated) with given number of parallel workers (default being CPU count).
+// Each worker counts the items it creates to its own copy of the options, and
+// those counts are summed to opts at the end. Returns the status of each device.
+func addDevices(opts *GenOptions) ([]DeviceResult, error) {
+	workers := opts.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+
+	workers = min(workers, opts.DevCount)
+
+	indexes := make(chan int)
+	copies := make([]GenOptions, workers)
+	errs := make([]error, workers)
+	results := make([]DeviceResult, opts.DevCount)
+
+	var wg sync.WaitGroup
+
+	for w := range copies {
+		copies[w] = *opts
+
+		wg.Add(1)
+
+		go func(opts *GenOptions, err *error) {
+			defer wg.Done()
+
+			// After an error, just drain the remaining indexes.
+			for i := range indexes {
+				if *err != nil {
+					results[i].Status = DeviceSkipped
+					continue
+				}
+
+				if *err = addDevice(opts, i); *err != nil {
+					results[i].Status, results[i].Err = DeviceFailed, *err
+				} else {
+					results[i].Status = DeviceGenerated
+				}
+			}
+		}(&copies[w], &errs[w])
 	}
 
-	removeExistingDir(devfsPath, "devfs")
-	removeExistingDir(sysfsPath, "sysfs")
-	klog.V(1).Infof("Generating fake DRI device(s) sysfs, debugfs and devfs content under '%s' & '%s'",
-		sysfsPath, devfsPath)
+	existing := 0
 
-	opts.dirs, opts.files, opts.devs, opts.symls = 0, 0, 0, 0
 	for i := 0; i < opts.DevCount; i++ {
-		if err := addSysfsBusTree(sysfsPath, &opts, i); err != nil {
-			klog.Fatalf("Dev-%d sysfs bus tree generation failed: %v", i, err)
-		}
+		results[i].Index, results[i].Path = i, opts.devicePath(i)
+
+		if opts.Append && opts.hasDevice(i) {
+			results[i].Status = DeviceExisting
+			existing++
 
-		if err := addSysfsDriTree(sysfsPath, &opts, i); err != nil {
-			klog.Fatalf("Dev-%d sysfs tree generation failed: %v", i, err)
+			continue
 		}
 
-		if err := addDevfsDriTree(devfsPath, &opts, i); err != nil {
-			klog.Fatalf("Dev-%d devfs tree generation failed: %v", i, err)
+		indexes <- i
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	if existing > 0 {
+		opts.log().V(1).Info("Appending", "existing", existing, "devices", opts.DevCount)
+	}
+
+	for _, c := range copies {
+		opts.dirs += c.dirs
+		opts.files += c.files
+		opts.devs += c.devs
+		opts.symls += c.symls
+		opts.placeholders += c.placeholders
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// GenerateDriFiles generates the fake device files, and exits on failure.
+// Returns what was generated.
+func GenerateDriFiles(opts GenOptions) GenerationResult {
+	result, err := GenerateDriFilesWithResult(opts)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	return result
+}
+
+// GenerateDriFilesE generates the fake device files, replacing any previously
+// generated ones (or in Append mode, adding to them), and returns an error on
+// failure.
+func GenerateDriFilesE(opts GenOptions) error {
+	_, err := GenerateDriFilesWithResult(opts)
+
+	return err
+}
+
+// GenerateDriFilesWithResult is like GenerateDriFilesE, but returns also what
+// was generated, the device statuses telling which devices failed.
+func GenerateDriFilesWithResult(opts GenOptions) (GenerationResult, error) {
+	var devices []DeviceResult
+
+	start := time.Now()
+
+	if opts.Info != "" {
+		opts.log().V(1).Info("Config", "info", opts.Info)
+	}
+
+	if !opts.Append {
+		if err := RemoveDriFiles(opts); err != nil {
+			return opts.result(devices, start), err
 		}
+	}
+
+	opts.log().V(1).Info("Generating fake device sysfs, debugfs and devfs content", "sysfs", sysfsPath, "devfs", devfsPath)
+
+	if err := prepareTmpfs(&opts); err != nil {
+		return opts.result(devices, start), err
+	}
+
+	opts.dirs, opts.files, opts.devs, opts.symls, opts.placeholders = 0, 0, 0, 0, 0
+	if err := addNumaNodes(&opts); err != nil {
+		return opts.result(devices, start), fmt.Errorf("NUMA node generation failed: %w", err)
+	}
 
-		if err := addDebugfsDriTree(sysfsPath, &opts, i); err != nil {
-			klog.Fatalf("Dev-%d debugfs tree generation failed: %v", i, err)
+	devices, err := addDevices(&opts)
+	if err != nil {
+		return opts.result(devices, start), err
+	}
+
+	for i := range opts.Clients {
+		if err := WriteClientFdinfo(&opts, i); err != nil {
+			return opts.result(devices, start), err
 		}
 	}
 
-	klog.V(1).Infof("Done, created %d dirs, %d devices, %d files and %d symlinks.", opts.dirs, opts.devs, opts.files, opts.symls)
+	opts.log().V(1).Info("Done", "dirs", opts.dirs, "devnodes", opts.devs, "files", opts.files, "symlinks", opts.symls,
+		"duration", time.Since(start).Round(time.Millisecond))
+
+	if opts.placeholders > 0 {
+		opts.log().Info("Warning: creating device nodes not permitted, using regular file placeholders", "placeholders", opts.placeholders)
+	}
+
+	if err := makeXelinkSideCar(opts); err != nil {
+		return opts.result(devices, start), err
+	}
 
-	makeXelinkSideCar(opts)
+	return opts.result(devices, start), writeManifest(&opts)
 }
 
-func makeXelinkSideCar(opts GenOptions) {
-	topology := opts.Capabilities["connection-topology"]
-	gpus := opts.DevCount
-	tiles := opts.TilesPerDev
-	connections := opts.Capabilities["connections"]
+// RemoveDriFiles removes previously generated fake device files, refusing
+// to remove what looks like real sysfs / devfs content.
+func RemoveDriFiles(opts GenOptions) error {
+	if err := removeExistingDir(&opts, devfsPath, "devfs"); err != nil {
+		return err
+	}
 
-	if topology == fullyConnected {
-		saveSideCarFile(buildConnectionList(gpus, tiles))
-	} else if connections != "" {
-		saveSideCarFile(connections)
-	} else {
-		return
+	if err := removeExistingDir(&opts, sysfsPath, "sysfs"); err != nil {
+		return err
 	}
 
-	klog.V(1).Infof("XELINK: generated xelink sidecar label file, using (GPUs: %d, Tiles: %d, Topology: %s)", gpus, tiles, topology)
+	return removeExistingDir(&opts, procfsPath, "procfs")
 }
 
-func buildConnectionList(gpus, tiles int) string {
-	var nodes = make([]string, 0)
+// MakeOptions applies defaults to the options and validates them, exiting on
+// invalid options.
+func MakeOptions(opts GenOptions) GenOptions {
+	opts, err := MakeOptionsE(opts)
+	if err != nil {
+		klog.Fatal(err)
+	}
 
-	for mm := 0; mm < gpus; mm++ {
-		for nn := 0; nn < tiles; nn++ {
-			nodes = append(nodes, fmt.Sprintf("%d.%d", mm, nn))
-		}
+	return opts
+}
+
+// MakeOptionsE applies defaults to the options and validates them.
+func MakeOptionsE(opts GenOptions) (GenOptions, error) {
+	if err := opts.convertVersion(); err != nil {
+		return opts, err
 	}
 
-	var links = make(map[string]bool, 0)
+	opts.setDefaults()
 
-	var smap = make([]string, 0)
+	return opts, ValidateOptions(opts)
+}
 
-	for _, from := range nodes {
-		for _, to := range nodes {
-			if to == from {
-				continue
-			}
+func (opts *GenOptions) isGpuMode() bool {
+	return opts.Mode == "" || opts.Mode == modeGpu
+}
 
-			link := fmt.Sprintf("%s-%s", to, from)
+func (opts *GenOptions) setDefaults() {
+	if opts.isGpuMode() {
+		opts.randomize()
+	}
 
-			reverselink := fmt.Sprintf("%s-%s", from, to)
-			if _, exists := links[reverselink]; !exists {
-				links[link] = true
+	if opts.DevCount == 0 {
+		opts.DevCount = opts.devCount()
+	}
 
-				smap = append(smap, link)
-			}
+	switch opts.Mode {
+	case modeQat:
+		opts.setQatDefaults()
+	case modeSgx:
+		opts.setSgxDefaults()
+	case modeDsa, modeIaa:
+		opts.setIdxdDefaults()
+	case modeDlb:
+		opts.setDlbDefaults()
+	case modeNpu:
+		opts.setNpuDefaults()
+	}
+}
+
+// ValidateOptions returns an ErrInvalidOptions wrapping error describing the
+// problems found in the given options, or nil if they are valid.
+func ValidateOptions(opts GenOptions) error {
+	opts.setDefaults()
+
+	if specDevs := opts.devCount(); specDevs > opts.DevCount {
+		return fmt.Errorf("%w: Devices list describes more devices (%d) than DevCount (%d)", ErrInvalidOptions, specDevs, opts.DevCount)
+	}
+
+	if opts.DevCount < 1 {
+		return fmt.Errorf("%w: invalid device count: 1 <= %d (set DevCount or list Devices)", ErrInvalidOptions, opts.DevCount)
+	}
+
+	if modes := []string{modeGpu, modeQat, modeSgx, modeDsa, modeIaa, modeDlb, modeNpu}; !opts.isGpuMode() && !slices.Contains(modes, opts.Mode) {
+		return fmt.Errorf("%w: unknown Mode '%s', supported ones are: %v", ErrInvalidOptions, opts.Mode, modes)
+	}
+
+	if opts.DevsPerNode > opts.DevCount {
+		return fmt.Errorf("%w: DevsPerNode (%d) > DevCount (%d)", ErrInvalidOptions, opts.DevsPerNode, opts.DevCount)
+	}
+
+	var errs []error
+
+	for _, validate := range []func(*GenOptions) error{
+		validateRanges,
+		validateMinors,
+		validateSriov,
+		validateDevices,
+		validateDecoys,
+		validateClients,
+		validateXeLinks,
+		validateQat,
+		validateSgx,
+		validateIdxd,
+		validateDlb,
+		validateNpu,
+		validatePciAddress,
+		validateTopology,
+		validateRandomize,
+		validateHealth,
+		validateUnbound,
+		validatePcie,
+		validateManifest,
+		validatePrelimIov,
+		validateMei,
+		validateTmpfs,
+		func(opts *GenOptions) error { return opts.Faults.validate(opts.DevCount) },
+		func(opts *GenOptions) error { return opts.Dynamic.validate() },
+	} {
+		if err := validate(&opts); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return strings.Join(smap, "_")
+	return errors.Join(errs...)
 }
 
-func saveSideCarFile(connections string) {
-	// Get user-specific temp directory
-	filePath := filepath.Join("/etc/kubernetes/node-feature-discovery/features.d", "xpum-sidecar-labels.txt")
+func validateMinors(opts *GenOptions) error {
+	if opts.CardBase < 0 || opts.CardBase >= legacyMinors {
+		return fmt.Errorf("%w: CardBase (%d) not within 0-%d", ErrInvalidOptions, opts.CardBase, legacyMinors-1)
+	}
 
-	// Safely create file in the temp directory
-	f, err := os.Create(filePath)
-	if err != nil {
-		klog.Fatalf("Failed to create file: %v", err)
+	if opts.RenderBase != 0 && (opts.RenderBase < renderBase || opts.RenderBase >= renderBase+legacyMinors) {
+		return fmt.Errorf("%w: RenderBase (%d) not within %d-%d", ErrInvalidOptions, opts.RenderBase, renderBase, renderBase+legacyMinors-1)
 	}
-	defer f.Close()
 
-	line := fmt.Sprintf("xpumanager.intel.com/xe-links=%s", connections[:min(len(connections), maxK8sLabelSize)])
-	klog.V(1).Info(line)
+	if card, render := opts.minors(opts.DevCount - 1); max(card, render) > maxMinor {
+		return fmt.Errorf("%w: %d devices do not fit to DRM minor number space", ErrInvalidOptions, opts.DevCount)
+	}
+
+	return validateMinorPins(opts)
+}
+
+// validateMinorPins checks that the pinned minor numbers are within the
+// legacy ranges, and that they do not result in duplicate minor numbers.
+func validateMinorPins(opts *GenOptions) error {
+	cardPins, renderPins := opts.minorPins()
+	if cardPins == nil && renderPins == nil {
+		return nil
+	}
+
+	for i, card := range cardPins {
+		if card < 0 || card >= legacyMinors {
+			return fmt.Errorf("%w: dev-%d: Card (%d) not within 0-%d", ErrInvalidOptions, i, card, legacyMinors-1)
+		}
+	}
 
-	if _, err := f.WriteString(line + "\n"); err != nil {
-		panic(err)
+	for i, render := range renderPins {
+		if render < renderBase || render >= renderBase+legacyMinors {
+			return fmt.Errorf("%w: dev-%d: Render (%d) not within %d-%d", ErrInvalidOptions, i, render, renderBase, renderBase+legacyMinors-1)
+		}
 	}
 
-	index := 2
+	cards := map[int]int{}
+	renders := map[int]int{}
 
-	for i := maxK8sLabelSize; i < len(connections); i += (maxK8sLabelSize - 1) {
-		line := fmt.Sprintf("xpumanager.intel.com/xe-links%d=Z%s", index, connections[i:min(len(connections), i+maxK8sLabelSize-1)])
-		klog.V(1).Info(line)
+	var err error
+
+	opts.allocMinors(opts.DevCount-1, func(i, card, render int) {
+		if j, ok := cards[card]; ok && err == nil {
+			err = fmt.Errorf("%w: dev-%d and dev-%d both have card%d", ErrInvalidOptions, j, i, card)
+		}
 
-		if _, err := f.WriteString(line + "\n"); err != nil {
-			panic(err)
+		if j, ok := renders[render]; ok && err == nil {
+			err = fmt.Errorf("%w: dev-%d and dev-%d both have renderD%d", ErrInvalidOptions, j, i, render)
 		}
 
-		index++
+		cards[card], renders[render] = i, i
+	})
+
+	return err
+}
+
+func validateDevices(opts *GenOptions) error {
+	for i := 0; i < opts.DevCount; i++ {
+		dev := opts.device(i)
+
+		if dev.DevMemSize%mib != 0 {
+			return fmt.Errorf("%w: dev-%d: invalid memory size (%f mib), not even mib", ErrInvalidOptions, i, float64(dev.DevMemSize)/mib)
+		}
+
+		if !isPciID(dev.DeviceID, 16) {
+			return fmt.Errorf("%w: dev-%d: invalid PCI device ID '%s', expected 16-bit hex value (e.g. 0x56c0)", ErrInvalidOptions, i, dev.DeviceID)
+		}
+
+		if !isPciID(dev.Revision, 8) {
+			return fmt.Errorf("%w: dev-%d: invalid PCI revision '%s', expected 8-bit hex value (e.g. 0x08)", ErrInvalidOptions, i, dev.Revision)
+		}
+
+		if !isPciID(dev.Vendor, 16) {
+			return fmt.Errorf("%w: dev-%d: invalid PCI vendor ID '%s', expected 16-bit hex value (e.g. 0x8086)", ErrInvalidOptions, i, dev.Vendor)
+		}
+
+		if err := dev.MemRegions.validate(dev.DevMemSize); err != nil {
+			return fmt.Errorf("dev-%d: %w", i, err)
+		}
+
+		if err := dev.Freq.validate(); err != nil {
+			return fmt.Errorf("dev-%d: %w", i, err)
+		}
 	}
+
+	return nil
 }
 
-func MakeOptions(opts GenOptions) GenOptions {
-	if opts.DevCount < 1 || opts.DevCount > maxDevs {
-		klog.Fatalf("Invalid device count: 1 <= %d <= %d", opts.DevCount, maxDevs)
+func validateDecoys(opts *GenOptions) error {
+	if len(opts.Decoys) > 0 && opts.Mode == modeSgx {
+		return fmt.Errorf("%w: Decoys given for SGX mode", ErrInvalidOptions)
 	}
 
-	if opts.VfsPerPf > 0 {
-		if opts.TilesPerDev > 0 || opts.DevsPerNode > 0 {
-			klog.Fatalf("SR-IOV VFs (%d) with device tiles (%d) or Numa nodes (%d) is unsupported for faking",
-				opts.VfsPerPf, opts.TilesPerDev, opts.DevsPerNode)
+	for _, i := range opts.Decoys {
+		if i < 0 || i >= opts.DevCount {
+			return fmt.Errorf("%w: invalid Decoys device index: 0 <= %d < %d", ErrInvalidOptions, i, opts.DevCount)
 		}
+	}
+
+	return nil
+}
 
-		if opts.DevCount%(opts.VfsPerPf+1) != 0 {
-			klog.Fatalf("%d devices cannot be evenly split to between set of 1 SR-IOV PF + %d VFs",
-				opts.DevCount, opts.VfsPerPf)
+func validateSriov(opts *GenOptions) error {
+	if opts.VfsPerPf <= 0 {
+		return nil
+	}
+
+	for _, dev := range opts.Devices {
+		if dev.TilesPerDev > 0 || dev.NumaNode != nil {
+			return fmt.Errorf("%w: SR-IOV VFs (%d) with per-device tiles or Numa nodes is unsupported for faking", ErrInvalidOptions, opts.VfsPerPf)
 		}
 	}
 
-	if opts.DevsPerNode > opts.DevCount {
-		klog.Fatalf("DevsPerNode (%d) > DevCount (%d)", opts.DevsPerNode, opts.DevCount)
+	if opts.TilesPerDev > 0 || opts.DevsPerNode > 0 {
+		return fmt.Errorf("%w: SR-IOV VFs (%d) with device tiles (%d) or Numa nodes (%d) is unsupported for faking",
+			ErrInvalidOptions, opts.VfsPerPf, opts.TilesPerDev, opts.DevsPerNode)
 	}
 
-	if opts.DevMemSize%mib != 0 {
-		klog.Fatalf("Invalid memory size (%f mib), not even mib", float64(opts.DevMemSize)/mib)
+	if opts.DevCount%(opts.VfsPerPf+1) != 0 {
+		return fmt.Errorf("%w: %d devices cannot be evenly split to between set of 1 SR-IOV PF + %d VFs",
+			ErrInvalidOptions, opts.DevCount, opts.VfsPerPf)
 	}
 
-	return opts
+	if opts.TotalVfs != 0 && opts.TotalVfs < opts.VfsPerPf {
+		return fmt.Errorf("%w: TotalVfs (%d) < VfsPerPf (%d)", ErrInvalidOptions, opts.TotalVfs, opts.VfsPerPf)
+	}
+
+	if opts.VfDeviceID != "" && !isPciID(opts.VfDeviceID, 16) {
+		return fmt.Errorf("%w: invalid VF PCI device ID '%s'", ErrInvalidOptions, opts.VfDeviceID)
+	}
+
+	return nil
+}
+
+// isPciID checks that given value is a "0x" prefixed hex number of at most given bits.
+func isPciID(value string, bits int) bool {
+	if !strings.HasPrefix(value, "0x") {
+		return false
+	}
+
+	_, err := strconv.ParseUint(value[2:], 16, bits)
+
+	return err == nil
 }
 
+// GetOptions reads and validates options from the given JSON spec file,
+// exiting on failure.
 func GetOptions(name string) GenOptions {
+	opts, err := GetOptionsE(name)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	return opts
+}
+
+// GetOptionsE reads and validates options from the given JSON spec file.
+func GetOptionsE(name string) (GenOptions, error) {
+	var opts GenOptions
+
 	if name == "" {
-		klog.Fatalf("No fake device spec provided")
+		return opts, fmt.Errorf("%w: no fake device spec provided", ErrInvalidOptions)
 	}
 
 	data, err := os.ReadFile(name)
 	if err != nil {
-		klog.Fatalf("Reading JSON spec file '%s' failed: %v", name, err)
+		return opts, fmt.Errorf("reading JSON spec file '%s' failed: %w", name, err)
 	}
 
-	klog.V(1).Infof("Using fake device JSON spec: %v\n", string(data))
+	klog.V(1).InfoS("Using fake device JSON spec", "file", name, "spec", string(data))
 
-	var opts GenOptions
-	if err = json.Unmarshal(data, &opts); err != nil {
-		klog.Fatalf("Unmarshaling JSON spec file '%s' failed: %v", name, err)
+	if err = unmarshalJSONStrict(data, &opts); err != nil {
+		return opts, fmt.Errorf("%w: unmarshaling JSON spec file '%s' failed: %w", ErrInvalidOptions, name, err)
+	}
+
+	if err = opts.convertVersion(); err != nil {
+		return opts, err
 	}
 
-	return MakeOptions(opts)
+	opts.setDefaults()
+
+	return opts, ValidateOptions(opts)
 }
 
+// GetOptionsBySpec parses and validates options from the given YAML spec,
+// exiting on failure.
 func GetOptionsBySpec(data string) GenOptions {
+	opts, err := GetOptionsBySpecE(data)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	return opts
+}
+
+// GetOptionsBySpecE parses and validates options from the given YAML spec.
+func GetOptionsBySpecE(data string) (GenOptions, error) {
 	if data == "" {
-		klog.Fatalf("No fake device spec provided")
+		return GenOptions{}, fmt.Errorf("%w: no fake device spec provided", ErrInvalidOptions)
 	}
 
-	klog.V(1).Infof("Using fake device YAML spec: %v\n", data)
+	klog.V(1).InfoS("Using fake device YAML spec", "spec", data)
 
-	var opts genOptionsWithTags
-	if err := yaml.Unmarshal([]byte(data), &opts); err != nil {
-		klog.Fatalf("Unmarshaling YAML spec '%s' failed: %v", data, err)
+	opts, err := UnmarshalSpec([]byte(data))
+	if err != nil {
+		return opts, fmt.Errorf("%w: unmarshaling YAML spec '%s' failed: %w", ErrInvalidOptions, data, err)
 	}
 
-	return MakeOptions(convertToGenOptions(opts))
+	opts.setDefaults()
+
+	return opts, ValidateOptions(opts)
 }
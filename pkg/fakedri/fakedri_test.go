@@ -0,0 +1,1911 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+)
+
+const mixedSpec = `
+Info: "2x Flex 140 + 1x Max 1550"
+DevMemSize: 4294967296
+Driver: "i915"
+Devices:
+  - Count: 2
+    DeviceID: "0x56c1"
+    DevMemSize: 6442450944
+    NumaNode: 0
+  - DeviceID: "0x0bd5"
+    DevMemSize: 68719476736
+    TilesPerDev: 2
+    NumaNode: 1
+`
+
+func TestDeviceOverrides(t *testing.T) {
+	opts := GetOptionsBySpec(mixedSpec)
+
+	if opts.DevCount != 3 {
+		t.Fatalf("expected DevCount 3 from Devices list, got %d", opts.DevCount)
+	}
+
+	tcases := []struct {
+		deviceID string
+		memSize  int
+		tiles    int
+		node     int
+	}{
+		{deviceID: "0x56c1", memSize: 6442450944, tiles: 0, node: 0},
+		{deviceID: "0x56c1", memSize: 6442450944, tiles: 0, node: 0},
+		{deviceID: "0x0bd5", memSize: 68719476736, tiles: 2, node: 1},
+	}
+
+	for i, tc := range tcases {
+		dev := opts.device(i)
+
+		if dev.DeviceID != tc.deviceID || dev.DevMemSize != tc.memSize ||
+			dev.TilesPerDev != tc.tiles || *dev.NumaNode != tc.node {
+			t.Errorf("dev-%d: unexpected properties %+v (numa %d), expected %+v", i, dev, *dev.NumaNode, tc)
+		}
+	}
+}
+
+func TestDeviceDefaults(t *testing.T) {
+	opts := GenOptions{
+		DevCount:    4,
+		DevsPerNode: 2,
+		TilesPerDev: 1,
+		DevMemSize:  1024 * 1024,
+		Revision:    "0x08",
+		Devices:     []DeviceOptions{{DeviceID: "0x56c0", Revision: "0x0c"}},
+	}
+
+	if dev := opts.device(0); dev.DeviceID != "0x56c0" || dev.Revision != "0x0c" || dev.TilesPerDev != 1 {
+		t.Errorf("dev-0: override not applied: %+v", dev)
+	}
+
+	if dev := opts.device(3); dev.DeviceID != defaultDeviceID || dev.Revision != "0x08" || *dev.NumaNode != 1 {
+		t.Errorf("dev-3: expected global defaults, got %+v (numa %d)", dev, *dev.NumaNode)
+	}
+}
+
+func TestIsPciID(t *testing.T) {
+	tcases := []struct {
+		value    string
+		bits     int
+		expected bool
+	}{
+		{value: "0x56c0", bits: 16, expected: true},
+		{value: "0x08", bits: 8, expected: true},
+		{value: "56c0", bits: 16, expected: false},
+		{value: "0x156c0", bits: 16, expected: false},
+		{value: "0x108", bits: 8, expected: false},
+		{value: "0xzz", bits: 8, expected: false},
+	}
+
+	for _, tc := range tcases {
+		if isPciID(tc.value, tc.bits) != tc.expected {
+			t.Errorf("isPciID(%s, %d) != %v", tc.value, tc.bits, tc.expected)
+		}
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	one := 1
+
+	tcases := []struct {
+		name    string
+		opts    GenOptions
+		invalid bool
+	}{
+		{
+			name: "valid",
+			opts: GenOptions{DevCount: 2, DevMemSize: mib},
+		},
+		{
+			name: "device count from devices list",
+			opts: GenOptions{Devices: []DeviceOptions{{Count: 2}, {}}},
+		},
+		{
+			name:    "no devices",
+			opts:    GenOptions{},
+			invalid: true,
+		},
+		{
+			name:    "too many devices in list",
+			opts:    GenOptions{DevCount: 1, Devices: []DeviceOptions{{Count: 2}}},
+			invalid: true,
+		},
+		{
+			name:    "uneven memory",
+			opts:    GenOptions{DevCount: 1, Devices: []DeviceOptions{{DevMemSize: mib + 1}}},
+			invalid: true,
+		},
+		{
+			name:    "VFs with per-device numa node",
+			opts:    GenOptions{DevCount: 2, VfsPerPf: 1, Devices: []DeviceOptions{{NumaNode: &one}}},
+			invalid: true,
+		},
+		{
+			name:    "uneven VF split",
+			opts:    GenOptions{DevCount: 3, VfsPerPf: 1},
+			invalid: true,
+		},
+		{
+			name:    "invalid device ID",
+			opts:    GenOptions{DevCount: 1, DeviceID: "0x12345"},
+			invalid: true,
+		},
+		{
+			name:    "too much available device memory",
+			opts:    GenOptions{DevCount: 1, DevMemSize: mib, MemRegions: &MemRegionOptions{LmemAvail: 2 * mib}},
+			invalid: true,
+		},
+		{
+			name:    "fault index out of range",
+			opts:    GenOptions{DevCount: 1, Faults: FaultOptions{EmptyVendor: []int{1}}},
+			invalid: true,
+		},
+		{
+			name:    "negative worker count",
+			opts:    GenOptions{DevCount: 1, Workers: -1},
+			invalid: true,
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateOptions(tc.opts)
+			if tc.invalid && !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("expected ErrInvalidOptions, got: %v", err)
+			}
+
+			if !tc.invalid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetOptionsBySpecE(t *testing.T) {
+	if _, err := GetOptionsBySpecE(""); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions for empty spec, got: %v", err)
+	}
+
+	if _, err := GetOptionsBySpecE("DevCount: [1]"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions for malformed spec, got: %v", err)
+	}
+
+	if _, err := GetOptionsBySpecE(mixedSpec); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMinors(t *testing.T) {
+	tcases := []struct {
+		name   string
+		opts   GenOptions
+		dev    int
+		card   int
+		render int
+	}{
+		{name: "first device", opts: GenOptions{}, dev: 0, card: 0, render: 128},
+		{name: "last legacy device", opts: GenOptions{}, dev: 63, card: 63, render: 191},
+		{name: "first extended device", opts: GenOptions{}, dev: 64, card: 193, render: 192},
+		{name: "second extended device", opts: GenOptions{}, dev: 65, card: 195, render: 194},
+		{name: "card base", opts: GenOptions{CardBase: 62}, dev: 1, card: 63, render: 129},
+		{name: "card range exhausted first", opts: GenOptions{CardBase: 62}, dev: 2, card: 192, render: 130},
+		{name: "render base", opts: GenOptions{RenderBase: 190}, dev: 3, card: 3, render: 193},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			card, render := tc.opts.minors(tc.dev)
+			if card != tc.card || render != tc.render {
+				t.Errorf("expected card%d + renderD%d, got card%d + renderD%d", tc.card, tc.render, card, render)
+			}
+		})
+	}
+}
+
+func TestMinorsMatchAllocation(t *testing.T) {
+	pin := func(minor int) *int { return &minor }
+
+	for _, opts := range []GenOptions{
+		{},
+		{CardBase: 60, RenderBase: 180},
+		{Devices: []DeviceOptions{{Count: 3}, {Count: 70, Card: pin(10), Render: pin(130)}, {Count: 5, Card: pin(2)}}},
+		{Devices: []DeviceOptions{{Count: 2, Render: pin(190)}, {Count: 80, Card: pin(63)}, {Count: 4, Render: pin(128)}}},
+	} {
+		last := 150
+
+		opts.allocMinors(last, func(i, card, render int) {
+			if c, r := opts.minors(i); c != card || r != render {
+				t.Errorf("%+v device %d: expected card%d + renderD%d, got card%d + renderD%d", opts, i, card, render, c, r)
+			}
+		})
+	}
+}
+
+func TestClientFdinfo(t *testing.T) {
+	opts := GenOptions{
+		Driver:   "i915",
+		DevCount: 2,
+		Clients: []ClientOptions{
+			{Pid: 100, Device: 0},
+			{
+				Pid:     101,
+				Device:  1,
+				Engines: map[string]uint64{"render": 5000, "copy": 100},
+				Memory:  map[string]uint64{"local0": 4096},
+			},
+		},
+	}
+
+	if err := validateClients(&opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "pos:\t0\nflags:\t02100002\nmnt_id:\t26\n" +
+		"drm-driver:\ti915\n" +
+		"drm-client-id:\t2\n" +
+		"drm-pdev:\t0000:02:00.0\n" +
+		"drm-engine-copy:\t100 ns\n" +
+		"drm-engine-render:\t5000 ns\n" +
+		"drm-total-local0:\t4 KiB\n" +
+		"drm-resident-local0:\t4 KiB\n"
+
+	if fdinfo := clientFdinfo(&opts, 1); fdinfo != expected {
+		t.Errorf("unexpected fdinfo:\n%s\nexpected:\n%s", fdinfo, expected)
+	}
+
+	opts.Clients = append(opts.Clients, ClientOptions{Pid: 100, Fd: 3})
+	if err := validateClients(&opts); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected duplicate PID/FD error, got: %v", err)
+	}
+}
+
+func TestDynamicValue(t *testing.T) {
+	tcases := []struct {
+		name     string
+		file     DynamicFileOptions
+		elapsed  time.Duration
+		step     int
+		expected int64
+	}{
+		{
+			name:     "sine start",
+			file:     DynamicFileOptions{Path: "x", Waveform: "sine", Period: "4s", Min: 0, Max: 100},
+			expected: 50,
+		},
+		{
+			name:     "sine peak",
+			file:     DynamicFileOptions{Path: "x", Waveform: "sine", Period: "4s", Min: 0, Max: 100},
+			elapsed:  time.Second,
+			expected: 100,
+		},
+		{
+			name:     "square second half",
+			file:     DynamicFileOptions{Path: "x", Waveform: "square", Period: "4s", Min: 10, Max: 20},
+			elapsed:  7 * time.Second,
+			expected: 10,
+		},
+		{
+			name:     "sawtooth",
+			file:     DynamicFileOptions{Path: "x", Waveform: "sawtooth", Period: "10s", Min: 100, Max: 200},
+			elapsed:  13 * time.Second,
+			expected: 130,
+		},
+		{
+			name:     "trace wraps around",
+			file:     DynamicFileOptions{Path: "x", Waveform: "trace", Trace: []int64{1, 2, 3}},
+			step:     4,
+			expected: 2,
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.file.validate(); err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+
+			if value := tc.file.value(tc.elapsed, tc.step); value != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, value)
+			}
+		})
+	}
+}
+
+func TestStrictSpec(t *testing.T) {
+	_, err := GetOptionsBySpecE("DevCnt: 2\nDriver: i915\n")
+	if !errors.Is(err, ErrInvalidOptions) || !strings.Contains(err.Error(), "did you mean 'DevCount'?") {
+		t.Errorf("expected unknown field error with suggestion, got: %v", err)
+	}
+
+	_, err = GetOptionsBySpecE("DevCount: 2\nTilesPerDev: -1\nDevsPerNode: -1\n")
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected out of range error, got: %v", err)
+	}
+
+	_, err = GetOptionsBySpecE("DevCount: 2\nCapabilities:\n  connection-topology: FULL\n  connections: 0.0-1.0\n")
+	if !errors.Is(err, ErrInvalidOptions) || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Errorf("expected mutually exclusive options error, got: %v", err)
+	}
+}
+
+func TestXeLinks(t *testing.T) {
+	tiles := []int{2, 2}
+
+	full := &XeLinkOptions{Matrix: [][]int{
+		{0, 1, 1, 1},
+		{1, 0, 1, 1},
+		{1, 1, 0, 1},
+		{1, 1, 1, 0},
+	}}
+	if links := full.connectionList(tiles); links != buildConnectionList(tiles) {
+		t.Errorf("full matrix %q does not match fully connected topology %q", links, buildConnectionList(tiles))
+	}
+
+	ring := &XeLinkOptions{Links: []XeLink{
+		{From: "1.1", To: "0.0"},
+		{From: "0.0", To: "0.1"},
+		{From: "0.1", To: "1.0"},
+		{From: "1.0", To: "1.1"},
+	}}
+	if links := ring.connectionList(tiles); links != "0.1-0.0_1.1-0.0_1.0-0.1_1.1-1.0" {
+		t.Errorf("unexpected ring connections: %s", links)
+	}
+
+	opts := GenOptions{DevCount: 2, TilesPerDev: 2, XeLinks: &XeLinkOptions{Links: []XeLink{{From: "0.0", To: "2.0"}}}}
+	if err := validateXeLinks(&opts); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected invalid link error, got: %v", err)
+	}
+
+	opts.XeLinks = &XeLinkOptions{Matrix: [][]int{{0, 1}, {0, 0}}}
+	if err := validateXeLinks(&opts); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected invalid matrix error, got: %v", err)
+	}
+
+	values, err := splitXeLinkLabels(buildConnectionList([]int{2, 2, 2, 2}))
+	if err != nil {
+		t.Fatalf("unexpected split error: %v", err)
+	}
+
+	concat := values[0]
+
+	for _, value := range values[1:] {
+		if !strings.HasPrefix(value, labelControlChar+"_") || len(value) > maxK8sLabelSize {
+			t.Errorf("invalid continuation label value: %s", value)
+		}
+
+		concat += strings.TrimPrefix(value, labelControlChar)
+	}
+
+	if concat != buildConnectionList([]int{2, 2, 2, 2}) {
+		t.Errorf("label values %v do not concatenate back to connection list", values)
+	}
+
+	if _, err := splitXeLinkLabels(strings.Repeat("0.0-1.0_", 500) + "0.0-1.0"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected too many labels error, got: %v", err)
+	}
+
+	if _, err := splitXeLinkLabels("0.0-1.0_0.0/1.1"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected invalid label value error, got: %v", err)
+	}
+}
+
+func TestXeLinkSideCar(t *testing.T) {
+	opts := GenOptions{
+		DevCount:      2,
+		TilesPerDev:   2,
+		XeLinks:       &XeLinkOptions{FullyConnected: true},
+		NfdFeatureDir: filepath.Join(t.TempDir(), "features.d"),
+	}
+
+	if err := makeXelinkSideCar(opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(opts.NfdFeatureDir, sideCarFile))
+	if err != nil {
+		t.Fatalf("failed to read sidecar file: %v", err)
+	}
+
+	expected := xeLinkLabelName + "=" + buildConnectionList([]int{2, 2}) + "\n"
+	if string(data) != expected {
+		t.Errorf("unexpected sidecar file content:\n%s\nexpected:\n%s", data, expected)
+	}
+}
+
+func TestQatOptions(t *testing.T) {
+	opts, err := GetOptionsBySpecE("Mode: qat\nDevCount: 20\nVfsPerPf: 9\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.Driver != defaultQatDriver || opts.device(0).DeviceID != defaultQatDeviceID ||
+		opts.device(1).DeviceID != defaultQatVfID || opts.Qat.VfDriver != defaultQatVfDriver {
+		t.Errorf("QAT defaults not applied: %+v, %+v", opts, opts.Qat)
+	}
+
+	for i, bdf := range map[int]string{0: "0000:01:00.0", 7: "0000:01:00.7", 9: "0000:01:01.1", 10: "0000:02:00.0"} {
+		if name := opts.pciAddress(i); name != bdf {
+			t.Errorf("dev-%d: expected PCI address %s, got %s", i, bdf, name)
+		}
+	}
+
+	for _, spec := range []string{
+		"Mode: qat\nDevCount: 2\n",
+		"Mode: qat\nDevCount: 2\nVfsPerPf: 1\nQat:\n  Services: sym;foo\n",
+		"Mode: qat\nDevCount: 2\nVfsPerPf: 1\nQat:\n  Unhealthy: [1]\n",
+		"Mode: qat\nDevCount: 2\nVfsPerPf: 1\nTilesPerDev: 2\n",
+		"Mode: foo\nDevCount: 2\n",
+		"DevCount: 2\nQat:\n  State: up\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestSgxOptions(t *testing.T) {
+	opts, err := GetOptionsBySpecE("Mode: sgx\nSgx:\n  NumaNodes: 2\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.DevCount != 1 || opts.Sgx.EpcSize != 2*defaultEpcSize {
+		t.Errorf("SGX defaults not applied: %+v, %+v", opts, opts.Sgx)
+	}
+
+	for _, spec := range []string{
+		"Mode: sgx\nDevCount: 2\n",
+		"Mode: sgx\nSgx:\n  EpcSize: 1000\n",
+		"Mode: sgx\nSgx:\n  NumaNodes: -1\n",
+		"Mode: sgx\nTilesPerDev: 2\n",
+		"DevCount: 1\nSgx:\n  NumaNodes: 1\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestIdxdOptions(t *testing.T) {
+	opts, err := GetOptionsBySpecE("Mode: iaa\nDevCount: 2\nIdxd:\n  WorkQueues:\n  - Mode: shared\n  - Type: kernel\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.DeviceID != "0x0cfe" || opts.Idxd.Groups != 1 || opts.Idxd.Engines != 1 {
+		t.Errorf("IAA defaults not applied: %+v, %+v", opts, opts.Idxd)
+	}
+
+	expected := []IdxdWqOptions{
+		{Name: "user0", Mode: "shared", Type: "user", State: "enabled", Size: 64, Priority: 10},
+		{Name: "kernel1", Mode: "dedicated", Type: "kernel", State: "enabled", Size: 64, Priority: 10},
+	}
+	for i, wq := range opts.Idxd.WorkQueues {
+		if wq != expected[i] {
+			t.Errorf("wq%d: expected %+v, got %+v", i, expected[i], wq)
+		}
+	}
+
+	for _, spec := range []string{
+		"Mode: dsa\nDevCount: 1\nIdxd:\n  Groups: 5\n",
+		"Mode: dsa\nDevCount: 1\nIdxd:\n  Groups: 2\n  Engines: 1\n",
+		"Mode: dsa\nDevCount: 1\nIdxd:\n  WorkQueues:\n  - Mode: foo\n",
+		"Mode: dsa\nDevCount: 1\nIdxd:\n  WorkQueues:\n  - Size: 100\n  - Size: 100\n",
+		"Mode: dsa\nDevCount: 2\nVfsPerPf: 1\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestDlbOptions(t *testing.T) {
+	opts, err := GetOptionsBySpecE("Mode: dlb\nDevCount: 3\nVfsPerPf: 2\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.Driver != defaultDlbDriver || opts.device(0).DeviceID != defaultDlbDeviceID || opts.device(2).DeviceID != defaultDlbVfID {
+		t.Errorf("DLB defaults not applied: %+v", opts)
+	}
+
+	for _, spec := range []string{
+		"Mode: dlb\nDevCount: 3\nVfsPerPf: 2\nDlb:\n  Vdevs: 2\n",
+		"Mode: dlb\nDevCount: 1\nDlb:\n  Vdevs: 17\n",
+		"Mode: dlb\nDevCount: 18\nVfsPerPf: 17\n",
+		"Mode: dlb\nDevCount: 1\nDevMemSize: 1048576\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestNpuOptions(t *testing.T) {
+	opts, err := GetOptionsBySpecE("Mode: npu\nDevCount: 1\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.Driver != npuDriver || opts.device(0).DeviceID != defaultNpuDeviceID {
+		t.Errorf("NPU defaults not applied: %+v", opts)
+	}
+
+	for _, spec := range []string{
+		"Mode: npu\nDevCount: 2\nVfsPerPf: 1\n",
+		"Mode: npu\nDevCount: 1\nTilesPerDev: 2\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	opts, err := GetOptionsBySpecE(mixedSpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+	opts.NfdFeatureDir = "/features.d"
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	tree, err := fs.Sub(mem.FS(), strings.TrimPrefix(sysfsPath, "/"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = fstest.TestFS(tree, "devices/pci0000:00/0000:03:00.0/drm/card2/lmem_total_bytes",
+		"devices/pci0000:00/0000:03:00.0/vendor", "kernel/debug/dri/0/i915_capabilities"); err != nil {
+		t.Errorf("invalid fake sysfs tree: %v", err)
+	}
+
+	// Through the bus tree symlinks.
+	qat, err := GetOptionsBySpecE("Mode: qat\nDevCount: 2\nVfsPerPf: 1\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	qat.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(qat); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	data, err := fs.ReadFile(mem.FS(), "tmp/sys/bus/pci/devices/0000:01:00.1/physfn/qat/state")
+	if err != nil || string(data) != defaultQatState {
+		t.Errorf("unexpected QAT state '%s', error: %v", data, err)
+	}
+
+	if info, err := mem.Lstat(filepath.Join(devfsPath, "vfio", "1")); err != nil || info.Mode().Type() != fs.ModeDevice|fs.ModeCharDevice {
+		t.Errorf("VFIO device node missing: %v", err)
+	}
+}
+
+// noMknodFS fails device node creation like a container without CAP_MKNOD.
+type noMknodFS struct {
+	*MemFS
+}
+
+func (noMknodFS) Mknod(path string, mode uint32, dev int) error {
+	return &fs.PathError{Op: "mknod", Path: path, Err: syscall.EPERM}
+}
+
+func TestMknodFallback(t *testing.T) {
+	opts := GetOptionsBySpec("DevCount: 1\n")
+	mem := noMknodFS{NewMemFS()}
+	opts.SetFilesystem(mem)
+
+	if err := GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info, err := mem.Stat(filepath.Join(devfsPath, "dri", "card0")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("expected regular file placeholder for device node, got: %v", err)
+	}
+
+	opts.RequireCharDevices = true
+	if err := GenerateDriFilesE(opts); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected permission error with RequireCharDevices, got: %v", err)
+	}
+}
+
+func TestPciAddress(t *testing.T) {
+	for spec, addresses := range map[string]map[int]string{
+		"DevCount: 12\n": {0: "0000:01:00.0", 11: "0000:0c:00.0"},
+		"DevCount: 4\nVfsPerPf: 1\nPciAddress: 0000:ff:02.0\n": {
+			0: "0000:ff:02.0", 1: "0000:ff:02.1", 2: "0001:00:02.0", 3: "0001:00:02.1",
+		},
+	} {
+		opts, err := GetOptionsBySpecE(spec)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for i, bdf := range addresses {
+			if address := opts.pciAddress(i); address != bdf {
+				t.Errorf("dev-%d: expected PCI address %s, got %s", i, bdf, address)
+			}
+		}
+
+		if link := opts.byPathName(0, "card"); link != "by-path/pci-"+addresses[0]+"-card" {
+			t.Errorf("unexpected by-path link name: %s", link)
+		}
+	}
+
+	for _, spec := range []string{
+		"DevCount: 1\nPciAddress: 00:02.0\n",
+		"DevCount: 1\nPciAddress: 0000:00:20.0\n",
+		"DevCount: 2\nVfsPerPf: 1\nPciAddress: 0000:00:1f.7\n",
+		"DevCount: 2\nPciAddress: ffff:ff:00.0\n",
+		"Mode: npu\nDevCount: 1\nPciAddress: 0000:00:0b.0\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestTopology(t *testing.T) {
+	const spec = `
+DevCount: 4
+DevsPerNode: 2
+Topology:
+  CpusPerNode: 4
+  PciRoots:
+    - Bus: "0000:00"
+    - Bus: "0000:80"
+      NumaNode: 1
+    - Bus: "0000:c0"
+      NumaNode: 1
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i, bdf := range map[int]string{0: "0000:01:00.0", 1: "0000:02:00.0", 2: "0000:81:00.0", 3: "0000:c1:00.0"} {
+		if address := opts.pciAddress(i); address != bdf {
+			t.Errorf("dev-%d: expected PCI address %s, got %s", i, bdf, address)
+		}
+	}
+
+	if root := opts.pciRoot(3); root != "pci0000:c0" {
+		t.Errorf("dev-3: expected PCI root pci0000:c0, got %s", root)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+
+	for file, content := range map[string]string{
+		"devices/system/node/online":                    "0-1",
+		"devices/system/node/node1/cpulist":             "4-7",
+		"devices/pci0000:c0/0000:c1:00.0/local_cpulist": "4-7",
+		"class/drm/card1/device/local_cpulist":          "0-3",
+		"class/drm/card2/device/numa_node":              "1",
+	} {
+		data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+		if err != nil {
+			t.Errorf("reading '%s' failed: %v", file, err)
+		} else if string(data) != content {
+			t.Errorf("'%s': expected '%s', got '%s'", file, content, data)
+		}
+	}
+
+	for _, spec := range []string{
+		"Mode: sgx\nDevCount: 1\nTopology:\n  CpusPerNode: 2\n",
+		"DevCount: 1\nTopology:\n  CpusPerNode: -1\n",
+		"DevCount: 1\nPciAddress: 0000:01:00.0\nTopology:\n  PciRoots:\n    - Bus: \"0000:00\"\n",
+		"DevCount: 1\nTopology:\n  PciRoots:\n    - Bus: \"00:00\"\n",
+		"DevCount: 1\nTopology:\n  PciRoots:\n    - Bus: \"0000:00\"\n    - Bus: \"0000:00\"\n",
+		"DevCount: 2\nDevsPerNode: 1\nTopology:\n  PciRoots:\n    - Bus: \"0000:00\"\n",
+		"DevCount: 2\nTopology:\n  PciRoots:\n    - Bus: \"0000:fe\"\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestDeviceCapabilities(t *testing.T) {
+	const spec = `
+DevCount: 3
+Capabilities:
+  platform: DG2
+  gen: 12
+Devices:
+  - Count: 2
+  - Capabilities:
+      platform: METEORLAKE
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	for card, platform := range []string{"DG2", "DG2", "METEORLAKE"} {
+		path := filepath.Join(strings.TrimPrefix(sysfsPath, "/"), "kernel", "debug", "dri", strconv.Itoa(card), "i915_capabilities")
+
+		data, err := fs.ReadFile(mem.FS(), path)
+		if err != nil {
+			t.Fatalf("reading '%s' failed: %v", path, err)
+		}
+
+		if caps := string(data); !strings.Contains(caps, "platform: "+platform+"\n") || !strings.Contains(caps, "gen: 12\n") {
+			t.Errorf("card%d: expected platform %s capabilities, got:\n%s", card, platform, caps)
+		}
+	}
+
+	if opts.Capabilities["platform"] != "DG2" {
+		t.Errorf("device capabilities modified the global ones: %v", opts.Capabilities)
+	}
+}
+
+func TestRandomize(t *testing.T) {
+	const spec = `
+Randomize:
+  Seed: 42
+  DevCount: {Min: 2, Max: 8}
+  DevMemSize: {Min: 4294967296, Max: 68719476736}
+  TilesPerDev: {Max: 4}
+  LinkDensity: 0.5
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.DevCount < 2 || opts.DevCount > 8 || len(opts.Devices) != opts.DevCount || opts.XeLinks == nil {
+		t.Fatalf("unexpected randomized devices (%d): %+v", opts.DevCount, opts.Devices)
+	}
+
+	for i := 0; i < opts.DevCount; i++ {
+		if dev := opts.device(i); dev.TilesPerDev < 1 || dev.TilesPerDev > 4 || dev.DevMemSize < 4294967296 || dev.DevMemSize > 68719476736 {
+			t.Errorf("dev-%d: properties out of range: %+v", i, dev)
+		}
+	}
+
+	again, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(opts.Devices, again.Devices) || !reflect.DeepEqual(opts.XeLinks, again.XeLinks) {
+		t.Errorf("same seed gave different topologies")
+	}
+
+	// Randomized topology survives a spec round-trip.
+	data, err := MarshalSpec(opts)
+	if err != nil {
+		t.Fatalf("unexpected marshaling error: %v", err)
+	}
+
+	if reread, err := GetOptionsBySpecE(string(data)); err != nil || !reflect.DeepEqual(opts.Devices, reread.Devices) {
+		t.Errorf("randomized spec round-trip failed (%v):\n%s", err, data)
+	}
+
+	for _, spec := range []string{
+		"DevCount: 2\nRandomize:\n  Seed: 1\n",
+		"Randomize:\n  DevCount: {Min: 4, Max: 2}\n",
+		"Randomize:\n  TilesPerDev: {Max: 16}\n",
+		"Randomize:\n  LinkDensity: 1.5\n",
+		"Mode: qat\nVfsPerPf: 1\nRandomize:\n  Seed: 1\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	for _, spec := range []string{"DevCount: %d\n", "Mode: qat\nVfsPerPf: 1\nDevCount: %d\n", "Mode: dsa\nDevCount: %d\n"} {
+		opts, err := GetOptionsBySpecE(fmt.Sprintf(spec, 2))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		mem := NewMemFS()
+		opts.SetFilesystem(mem)
+
+		if err = GenerateDriFilesE(opts); err != nil {
+			t.Fatalf("generation to memory failed: %v", err)
+		}
+
+		// Marker for checking that existing devices are not re-generated.
+		marker := filepath.Join(opts.devicePath(0), "marker")
+		if err = mem.WriteFile(marker, nil, fileMode); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if opts, err = GetOptionsBySpecE(fmt.Sprintf(spec, 4) + "Append: true\n"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		opts.SetFilesystem(mem)
+
+		if err = GenerateDriFilesE(opts); err != nil {
+			t.Fatalf("appending to memory failed: %v\nspec:\n%s", err, spec)
+		}
+
+		if _, err = mem.Stat(marker); err != nil {
+			t.Errorf("existing device was re-generated: %v\nspec:\n%s", err, spec)
+		}
+
+		if !opts.hasDevice(3) {
+			t.Errorf("device was not appended, spec:\n%s", spec)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	const spec = `
+DevCount: 2
+Devices:
+  - Count: 1
+  - Health:
+      Wedged: true
+      Resets: 2
+      ErrorState: "GPU HANG: ecode 12:1:85dffffb\n"
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+	expected := map[string]string{
+		"class/drm/card1/error":              "GPU HANG: ecode 12:1:85dffffb\n",
+		"kernel/debug/dri/1/i915_wedged":     "1",
+		"kernel/debug/dri/1/i915_reset_info": "full gpu reset = 2\n",
+	}
+
+	check := func() {
+		for file, content := range expected {
+			data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+			if err != nil {
+				t.Errorf("reading '%s' failed: %v", file, err)
+			} else if string(data) != content {
+				t.Errorf("'%s': expected '%s', got '%s'", file, content, data)
+			}
+		}
+	}
+
+	check()
+
+	if _, err = mem.Stat(filepath.Join(sysfsPath, "class/drm/card0/error")); err == nil {
+		t.Errorf("health files generated for device without Health option")
+	}
+
+	if err = SetDeviceHealth(&opts, 1, HealthOptions{Resets: 3}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected = map[string]string{
+		"class/drm/card1/error":              noErrorState,
+		"kernel/debug/dri/1/i915_wedged":     "0",
+		"kernel/debug/dri/1/i915_reset_info": "full gpu reset = 3\n",
+	}
+
+	check()
+
+	// Health-only respec updates the files without re-plugging the device.
+	marker := filepath.Join(opts.devicePath(1), "marker")
+	if err = mem.WriteFile(marker, nil, fileMode); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	respec, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = Respec(opts, respec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = mem.Stat(marker); err != nil {
+		t.Errorf("device was re-plugged on health change: %v", err)
+	}
+
+	if err = SetDeviceHealth(&opts, 2, HealthOptions{}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions for non-existing device, got: %v", err)
+	}
+
+	if _, err = GetOptionsBySpecE("DevCount: 1\nDevices:\n  - Health: {Resets: -1}\n"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions for negative resets, got: %v", err)
+	}
+}
+
+func TestFreq(t *testing.T) {
+	const spec = `
+DevCount: 2
+Freq: {MinMhz: 300, MaxMhz: 2100}
+Devices:
+  - Count: 1
+  - TilesPerDev: 2
+    Freq: {MinMhz: 300, MaxMhz: 1600, ActMhz: 900, Throttle: [pl1, thermal]}
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+
+	for file, content := range map[string]string{
+		"class/drm/card0/gt/gt0/rps_max_freq_mhz":       "2100",
+		"class/drm/card0/gt/gt0/rps_act_freq_mhz":       "300",
+		"class/drm/card0/gt/gt0/throttle_reason_status": "0",
+		"class/drm/card1/gt/gt1/rps_RP0_freq_mhz":       "1600",
+		"class/drm/card1/gt/gt1/rps_cur_freq_mhz":       "900",
+		"class/drm/card1/gt/gt1/throttle_reason_status": "1",
+		"class/drm/card1/gt/gt1/throttle_reason_pl1":    "1",
+		"class/drm/card1/gt/gt1/throttle_reason_pl2":    "0",
+	} {
+		data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+		if err != nil {
+			t.Errorf("reading '%s' failed: %v", file, err)
+		} else if string(data) != content {
+			t.Errorf("'%s': expected '%s', got '%s'", file, content, data)
+		}
+	}
+
+	for _, spec := range []string{
+		"DevCount: 1\nFreq: {MinMhz: 300}\n",
+		"DevCount: 1\nFreq: {MinMhz: 300, MaxMhz: 600, ActMhz: 700}\n",
+		"DevCount: 1\nDevices:\n  - Freq: {MinMhz: 300, MaxMhz: 600, Throttle: [foo]}\n",
+		"Mode: qat\nDevCount: 2\nVfsPerPf: 1\nFreq: {MinMhz: 300, MaxMhz: 600}\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	const spec = "DevCount: 2\nTilesPerDev: 2\nManifest: /manifest.json\n"
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	if err = VerifyManifest(opts); err != nil {
+		t.Fatalf("unexpected verification error: %v", err)
+	}
+
+	other, err := GetOptionsBySpecE("DevCount: 3\nTilesPerDev: 2\nManifest: /manifest.json\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	other.SetFilesystem(mem)
+
+	if err = VerifyManifest(other); !errors.Is(err, ErrManifestMismatch) {
+		t.Errorf("expected ErrManifestMismatch for another spec, got: %v", err)
+	}
+
+	for name, modify := range map[string]func() error{
+		"changed file": func() error {
+			return mem.WriteFile(filepath.Join(sysfsPath, "class/drm/card0/lmem_total_bytes"), []byte("1"), fileMode)
+		},
+		"extra file": func() error {
+			return mem.WriteFile(filepath.Join(sysfsPath, "class/drm/card1/foo"), []byte("1"), fileMode)
+		},
+		"missing device": func() error {
+			return RemoveDevice(&opts, 1)
+		},
+	} {
+		if err = GenerateDriFilesE(opts); err != nil {
+			t.Fatalf("re-generation failed: %v", err)
+		}
+
+		if err = modify(); err != nil {
+			t.Fatalf("%s: tree modification failed: %v", name, err)
+		}
+
+		if err = VerifyManifest(opts); !errors.Is(err, ErrManifestMismatch) {
+			t.Errorf("%s: expected ErrManifestMismatch, got: %v", name, err)
+		}
+	}
+
+	for _, spec := range []string{
+		"DevCount: 1\nManifest: manifest.json\n",
+		"DevCount: 1\nManifest: " + sysfsPath + "/manifest.json\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const spec = `
+DevCount: 6
+VfsPerPf: 1
+Driver: i915
+Decoys: [4]
+Faults: {EmptyVendor: [5], DanglingDriver: [1]}
+Devices:
+  - Count: 3
+  - Count: 1
+    Unbound: true
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	for name, modify := range map[string]func() error{
+		"missing render node": func() error {
+			return mem.RemoveAll(filepath.Join(devfsPath, "dri", opts.renderName(1)))
+		},
+		"changed vendor": func() error {
+			return mem.WriteFile(filepath.Join(sysfsPath, "class/drm/card1/device/vendor"), []byte("0x1234"), fileMode)
+		},
+		"driver bound": func() error {
+			return mem.Symlink(opts.driverTarget(3), filepath.Join(sysfsPath, "class/drm/card3/device/driver"))
+		},
+		"missing device": func() error {
+			return RemoveDevice(&opts, 1)
+		},
+	} {
+		if err = GenerateDriFilesE(opts); err != nil {
+			t.Fatalf("generation to memory failed: %v", err)
+		}
+
+		if err = Verify(opts); err != nil {
+			t.Fatalf("unexpected verification error: %v", err)
+		}
+
+		if err = modify(); err != nil {
+			t.Fatalf("%s: tree modification failed: %v", name, err)
+		}
+
+		if err = Verify(opts); !errors.Is(err, ErrTreeMismatch) {
+			t.Errorf("%s: expected ErrTreeMismatch, got: %v", name, err)
+		}
+	}
+
+	qat, err := GetOptionsBySpecE("Mode: qat\nDevCount: 2\nVfsPerPf: 1\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = Verify(qat); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions for QAT mode, got: %v", err)
+	}
+}
+
+func TestTmpfs(t *testing.T) {
+	for spec, full := range map[string]bool{
+		"DevCount: 2\nTmpfs: {Size: 1073741824}\n": false,
+		"DevCount: 2\nTmpfs: {Size: 65536}\n":      true,
+	} {
+		opts, err := GetOptionsBySpecE(spec)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		opts.SetFilesystem(NewMemFS())
+
+		err = GenerateDriFilesE(opts)
+		if full && !errors.Is(err, ErrTmpfsFull) {
+			t.Errorf("expected ErrTmpfsFull for spec:\n%s\ngot: %v", spec, err)
+		}
+
+		if !full && err != nil {
+			t.Errorf("unexpected generation error for spec:\n%s\n%v", spec, err)
+		}
+	}
+
+	for _, spec := range []string{
+		"DevCount: 1\nTmpfs: {Mount: true}\n",
+		"DevCount: 1\nTmpfs: {Size: -1}\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestPrelimIov(t *testing.T) {
+	const spec = `
+DevCount: 6
+VfsPerPf: 2
+DevMemSize: 17179869184
+PrelimIov: {ExecQuantumMs: 20}
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+
+	for file, content := range map[string]string{
+		"class/drm/card0/prelim_iov/pf/auto_provisioning":                 "1",
+		"class/drm/card0/prelim_iov/pf/gt0/available/lmem_max_quota":      "17179869184",
+		"class/drm/card0/prelim_iov/pf/gt0/available/lmem_free":           "0",
+		"class/drm/card0/prelim_iov/vf1/gt0/lmem_quota":                   "8589934592",
+		"class/drm/card3/prelim_iov/vf2/gt0/exec_quantum_ms":              "20",
+		"class/drm/card3/prelim_iov/vf2/gt0/preempt_timeout_us":           "0",
+		"class/drm/card3/prelim_iov/pf/gt0/available/doorbells_max_quota": strconv.Itoa(iovDoorbells),
+		"class/drm/card3/prelim_iov/vf1/gt0/doorbells_quota":              strconv.Itoa(iovDoorbells / 2),
+	} {
+		data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+		if err != nil {
+			t.Errorf("reading '%s' failed: %v", file, err)
+		} else if string(data) != content {
+			t.Errorf("'%s': expected '%s', got '%s'", file, content, data)
+		}
+	}
+
+	// VFs do not have provisioning files.
+	if _, err = fs.Stat(mem.FS(), filepath.Join(sysfs, "class/drm/card1/prelim_iov")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no prelim_iov dir for VF, got: %v", err)
+	}
+
+	opts, err = GetOptionsBySpecE("DevCount: 2\nVfsPerPf: 1\nPrelimIov: {Manual: true}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	for file, content := range map[string]string{
+		"class/drm/card0/prelim_iov/pf/auto_provisioning":   "0",
+		"class/drm/card0/prelim_iov/vf1/gt0/ggtt_quota":     "0",
+		"class/drm/card0/prelim_iov/vf1/gt0/contexts_quota": "0",
+	} {
+		data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+		if err != nil {
+			t.Errorf("reading '%s' failed: %v", file, err)
+		} else if string(data) != content {
+			t.Errorf("'%s': expected '%s', got '%s'", file, content, data)
+		}
+	}
+
+	for _, spec := range []string{
+		"DevCount: 2\nPrelimIov: {}\n",
+		"Mode: qat\nDevCount: 2\nVfsPerPf: 1\nPrelimIov: {}\n",
+		"DevCount: 2\nVfsPerPf: 1\nPrelimIov: {PreemptTimeoutUs: -1}\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	for _, quiet := range []bool{false, true} {
+		opts, err := GetOptionsBySpecE(fmt.Sprintf("DevCount: 2\nQuiet: %v\n", quiet))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var messages []string
+
+		opts.SetFilesystem(NewMemFS())
+		opts.SetLogger(funcr.New(func(prefix, args string) {
+			messages = append(messages, args)
+		}, funcr.Options{Verbosity: 1}))
+
+		if err = GenerateDriFilesE(opts); err != nil {
+			t.Fatalf("generation to memory failed: %v", err)
+		}
+
+		if quiet && len(messages) > 0 {
+			t.Errorf("expected no messages in quiet mode, got: %v", messages)
+		}
+
+		if !quiet && !slices.ContainsFunc(messages, func(msg string) bool {
+			return strings.Contains(msg, `"msg"="Done"`) && strings.Contains(msg, `"devnodes"=8`)
+		}) {
+			t.Errorf("structured 'Done' message missing from: %v", messages)
+		}
+	}
+}
+
+func TestSpecVersion(t *testing.T) {
+	const v1Spec = `
+DevCount: 2
+TilesPerDev: 2
+Capabilities:
+  platform: fake_PVC
+  connections: ""
+  connection-topology: FULL
+`
+
+	opts, err := GetOptionsBySpecE(v1Spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"platform": "fake_PVC"}
+	if opts.Version != SpecVersion || opts.XeLinks == nil || !opts.XeLinks.FullyConnected || !reflect.DeepEqual(opts.Capabilities, expected) {
+		t.Errorf("v1 spec not converted to %s: %+v, XeLinks: %+v", SpecVersion, opts, opts.XeLinks)
+	}
+
+	opts, err = GetOptionsBySpecE("DevCount: 2\nCapabilities:\n  connection-topology: RAW\n  connections: 0.0-1.0\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.XeLinks == nil || opts.XeLinks.Connections != "0.0-1.0" || len(opts.Capabilities) != 0 {
+		t.Errorf("v1 connections not converted: %+v, XeLinks: %+v", opts, opts.XeLinks)
+	}
+
+	data, err := MarshalSpec(opts)
+	if err != nil {
+		t.Fatalf("spec marshaling failed: %v", err)
+	}
+
+	converted, err := GetOptionsBySpecE(string(data))
+	if err != nil {
+		t.Fatalf("unexpected error for converted spec:\n%s\n%v", data, err)
+	}
+
+	if !reflect.DeepEqual(converted.XeLinks, opts.XeLinks) || converted.Version != SpecVersion {
+		t.Errorf("converted spec does not round-trip:\n%s", data)
+	}
+
+	for _, spec := range []string{
+		"Version: v0\nDevCount: 1\n",
+		"Version: " + SpecVersion + "\nDevCount: 2\nCapabilities:\n  connection-topology: FULL\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestDriverBinding(t *testing.T) {
+	const spec = `
+DevCount: 3
+Devices:
+  - Count: 1
+  - Unbound: true
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	check := func(bound ...bool) {
+		for i, expected := range bound {
+			link := filepath.Join(sysfsPath, "class/drm", opts.cardName(i), "device/driver")
+
+			target, err := mem.Readlink(link)
+			if expected && (err != nil || target != "../../../bus/pci/drivers/"+opts.Driver) {
+				t.Errorf("dev-%d: expected driver symlink, got '%s', %v", i, target, err)
+			}
+
+			if !expected && !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("dev-%d: expected no driver symlink, got '%s', %v", i, target, err)
+			}
+		}
+	}
+
+	check(true, false, true)
+
+	if err = UnbindDevice(&opts, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = BindDevice(&opts, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	check(false, true, true)
+
+	// Binding-only respec does not re-plug the devices.
+	marker := filepath.Join(opts.devicePath(2), "marker")
+	if err = mem.WriteFile(marker, nil, fileMode); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	respec, err := GetOptionsBySpecE("DevCount: 3\nDevices:\n  - Count: 2\n  - Unbound: true\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts, err = Respec(opts, respec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = mem.Stat(marker); err != nil {
+		t.Errorf("device was re-plugged on binding change: %v", err)
+	}
+
+	// Runtime unbinding of the first device is not in the specs.
+	check(false, true, false)
+
+	if err = BindDevice(&opts, 3); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions for non-existing device, got: %v", err)
+	}
+
+	if _, err = GetOptionsBySpecE("Mode: npu\nDevCount: 1\nDevices:\n  - Unbound: true\n"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions for non-GPU mode, got: %v", err)
+	}
+}
+
+func TestGenerationResult(t *testing.T) {
+	opts, err := GetOptionsBySpecE("DevCount: 2\nTilesPerDev: 2\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	result, err := GenerateDriFilesWithResult(opts)
+	if err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	if result.Dirs == 0 || result.Files == 0 || result.Symlinks == 0 || result.DevNodes+result.Placeholders != 8 {
+		t.Errorf("unexpected generation counts: %+v", result)
+	}
+
+	expected := []DeviceResult{
+		{Index: 0, Path: filepath.Join(sysfsPath, "class/drm/card0"), Status: DeviceGenerated},
+		{Index: 1, Path: filepath.Join(sysfsPath, "class/drm/card1"), Status: DeviceGenerated},
+	}
+	if !reflect.DeepEqual(result.Devices, expected) {
+		t.Errorf("unexpected device results: %+v", result.Devices)
+	}
+
+	opts, err = GetOptionsBySpecE("DevCount: 3\nTilesPerDev: 2\nAppend: true\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts.SetFilesystem(mem)
+
+	if result, err = GenerateDriFilesWithResult(opts); err != nil {
+		t.Fatalf("appending to memory failed: %v", err)
+	}
+
+	for i, status := range []string{DeviceExisting, DeviceExisting, DeviceGenerated} {
+		if result.Devices[i].Status != status {
+			t.Errorf("dev-%d: expected status %s, got %+v", i, status, result.Devices[i])
+		}
+	}
+
+	// Device 1 generation fails, as its debugfs dir is a file.
+	opts, err = GetOptionsBySpecE("DevCount: 2\nWorkers: 1\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem = NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = mem.MkdirAll(filepath.Join(sysfsPath, "kernel/debug/dri"), dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = mem.WriteFile(filepath.Join(sysfsPath, "kernel/debug/dri/1"), nil, fileMode); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Append = true
+
+	result, err = GenerateDriFilesWithResult(opts)
+	if err == nil || len(result.Devices) != 2 {
+		t.Fatalf("expected generation failure with device results, got: %+v, %v", result, err)
+	}
+
+	if result.Devices[0].Status != DeviceGenerated || result.Devices[1].Status != DeviceFailed || result.Devices[1].Err == nil {
+		t.Errorf("unexpected device results: %+v", result.Devices)
+	}
+}
+
+func TestPcie(t *testing.T) {
+	const spec = `
+DevCount: 2
+DeviceID: "0x56c0"
+Devices:
+  - Count: 1
+  - Pcie: {Speed: "8.0", Width: 4, MaxSpeed: "16.0", MaxWidth: 16}
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+
+	for file, content := range map[string]string{
+		"class/drm/card0/device/max_link_speed":     "16.0 GT/s PCIe",
+		"class/drm/card0/device/current_link_width": "16",
+		"class/drm/card1/device/max_link_width":     "16",
+		"class/drm/card1/device/current_link_speed": "8.0 GT/s PCIe",
+		"class/drm/card1/device/current_link_width": "4",
+	} {
+		data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+		if err != nil {
+			t.Errorf("reading '%s' failed: %v", file, err)
+		} else if string(data) != content {
+			t.Errorf("'%s': expected '%s', got '%s'", file, content, data)
+		}
+	}
+
+	config, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, "class/drm/card1/device/config"))
+	if err != nil || len(config) != pciConfigSize {
+		t.Fatalf("reading config failed: %d bytes, %v", len(config), err)
+	}
+
+	// Vendor and device IDs, class code, and link status: 8 GT/s (3) x4.
+	if config[0] != 0x86 || config[1] != 0x80 || config[2] != 0xc0 || config[3] != 0x56 || config[0x0b] != 0x03 ||
+		config[pcieCapOffset+0x12] != 3|4<<4 {
+		t.Errorf("unexpected config space content: % x", config[:0x60])
+	}
+
+	resource, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, "class/drm/card1/device/resource"))
+	if err != nil {
+		t.Fatalf("reading resource failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(resource)), "\n")
+	if len(lines) != pciResources || lines[0] != "0x0000004040000000 0x0000004040ffffff 0x0000000000140204" {
+		t.Errorf("unexpected resource content:\n%s", resource)
+	}
+
+	opts, err = GetOptionsBySpecE("Mode: qat\nDevCount: 2\nVfsPerPf: 1\nPcie: {Speed: \"32.0\"}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, "bus/pci/devices/0000:01:00.1/max_link_speed"))
+	if err != nil || string(data) != "32.0 GT/s PCIe" {
+		t.Errorf("unexpected QAT VF link speed '%s': %v", data, err)
+	}
+
+	for _, spec := range []string{
+		"DevCount: 1\nPcie: {Speed: \"10.0\"}\n",
+		"DevCount: 1\nPcie: {Width: 3}\n",
+		"DevCount: 1\nDevices:\n  - Pcie: {Width: 16, MaxWidth: 8}\n",
+		"Mode: sgx\nPcie: {Width: 16}\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestMei(t *testing.T) {
+	opts, err := GetOptionsBySpecE("DevCount: 4\nVfsPerPf: 1\nMei: {FwVersion: \"100.4.0.1000\"}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+	devfs := strings.TrimPrefix(devfsPath, "/")
+
+	for file, content := range map[string]string{
+		"class/mei/mei0/dev":    "234:0",
+		"class/mei/mei0/kind":   "gsc",
+		"class/mei/mei1/dev":    "234:1",
+		"class/mei/mei1/fw_ver": "0:100.4.0.1000\n0:100.4.0.1000\n0:100.4.0.1000\n",
+		"devices/pci0000:00/0000:02:00.0/i915.mei-gsc.512/mei/mei1/kind": "gsc",
+	} {
+		data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+		if err != nil {
+			t.Errorf("reading '%s' failed: %v", file, err)
+		} else if string(data) != content {
+			t.Errorf("'%s': expected '%s', got '%s'", file, content, data)
+		}
+	}
+
+	// Only PFs have GSC devices.
+	for file, exists := range map[string]bool{
+		filepath.Join(devfs, "mei0"):                 true,
+		filepath.Join(devfs, "mei1"):                 true,
+		filepath.Join(devfs, "mei2"):                 false,
+		filepath.Join(sysfs, "class", "mei", "mei2"): false,
+	} {
+		if _, err = fs.Stat(mem.FS(), file); (err == nil) != exists {
+			t.Errorf("'%s' existence expected to be %v, got: %v", file, exists, err)
+		}
+	}
+
+	// Re-generation accepts the MEI devices as fake devfs content.
+	opts, err = GetOptionsBySpecE("DevCount: 1\nDriver: xe\nMei: {Kind: gscfi}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("re-generation to memory failed: %v", err)
+	}
+
+	data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, "devices/pci0000:00/0000:01:00.0/xe.mei-gscfi.256/mei/mei0/kind"))
+	if err != nil || string(data) != "gscfi" {
+		t.Errorf("unexpected xe GSC kind '%s': %v", data, err)
+	}
+
+	if err = RemoveDevice(&opts, 0); err != nil {
+		t.Fatalf("device removal failed: %v", err)
+	}
+
+	if _, err = fs.Stat(mem.FS(), filepath.Join(devfs, "mei0")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected MEI device node to be removed, got: %v", err)
+	}
+
+	for _, spec := range []string{
+		"DevCount: 1\nMei: {Kind: mei}\n",
+		"Mode: qat\nDevCount: 1\nMei: {}\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestVendor(t *testing.T) {
+	const spec = `
+DevCount: 3
+Decoys: [1]
+Devices:
+  - Count: 2
+  - Vendor: "0x1002"
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+
+	for card, vendor := range []string{"0x8086", "0x10de", "0x1002"} {
+		base := filepath.Join(sysfs, "class", "drm", fmt.Sprintf("card%d", card), "device")
+
+		data, err := fs.ReadFile(mem.FS(), filepath.Join(base, "vendor"))
+		if err != nil || string(data) != vendor {
+			t.Errorf("card%d: expected vendor '%s', got '%s': %v", card, vendor, data, err)
+		}
+
+		config, err := fs.ReadFile(mem.FS(), filepath.Join(base, "config"))
+		if err != nil || fmt.Sprintf("0x%02x%02x", config[1], config[0]) != vendor {
+			t.Errorf("card%d: expected config space vendor '%s', got: % x, %v", card, vendor, config[:2], err)
+		}
+	}
+
+	for _, spec := range []string{
+		"DevCount: 2\nDecoys: [2]\n",
+		"Mode: sgx\nDecoys: [0]\n",
+		"DevCount: 1\nDevices:\n  - Vendor: \"10de\"\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestPinnedMinors(t *testing.T) {
+	const spec = `
+Devices:
+  - Count: 2
+  - Count: 2
+    Card: 4
+    Render: 140
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	devfs := strings.TrimPrefix(devfsPath, "/")
+
+	for _, node := range []string{"card0", "card1", "card4", "card5", "renderD128", "renderD129", "renderD140", "renderD141"} {
+		if _, err = fs.Stat(mem.FS(), filepath.Join(devfs, "dri", node)); err != nil {
+			t.Errorf("expected device node '%s': %v", node, err)
+		}
+	}
+
+	// Changing a pin re-plugs the affected devices with their new numbers.
+	newOpts, err := GetOptionsBySpecE(strings.Replace(spec, "Card: 4", "Card: 10", 1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = Respec(opts, newOpts); err != nil {
+		t.Fatalf("respec failed: %v", err)
+	}
+
+	for node, exists := range map[string]bool{"card1": true, "card4": false, "card10": true, "card11": true} {
+		if _, err = fs.Stat(mem.FS(), filepath.Join(devfs, "dri", node)); (err == nil) != exists {
+			t.Errorf("'%s' existence expected to be %v, got: %v", node, exists, err)
+		}
+	}
+
+	for _, spec := range []string{
+		"Devices:\n  - Card: 64\n",
+		"Devices:\n  - Render: 127\n",
+		"Devices:\n  - Count: 2\n  - Card: 1\n",
+		"Devices:\n  - Render: 130\n  - Render: 129\n    Count: 2\n",
+	} {
+		if _, err := GetOptionsBySpecE(spec); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("expected ErrInvalidOptions for spec:\n%s\ngot: %v", spec, err)
+		}
+	}
+}
+
+func TestTileMemory(t *testing.T) {
+	mem := NewMemFS()
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+
+	for driver, files := range map[string][]string{
+		"i915": {"class/drm/card0/gt/gt0/lmem_total_bytes", "class/drm/card0/gt/gt1/lmem_total_bytes"},
+		"xe": {
+			"devices/pci0000:00/0000:01:00.0/tile0/physical_vram_size_bytes",
+			"devices/pci0000:00/0000:01:00.0/tile1/physical_vram_size_bytes",
+		},
+	} {
+		opts, err := GetOptionsBySpecE("DevCount: 2\nTilesPerDev: 2\nDevMemSize: 8589934592\nDriver: " + driver + "\n")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		opts.SetFilesystem(mem)
+
+		if err = GenerateDriFilesE(opts); err != nil {
+			t.Fatalf("generation to memory failed: %v", err)
+		}
+
+		for _, file := range files {
+			data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+			if err != nil || string(data) != "4294967296" {
+				t.Errorf("%s: unexpected '%s' content '%s': %v", driver, file, data, err)
+			}
+		}
+	}
+
+	// Single tile devices do not have tile memory files.
+	opts, err := GetOptionsBySpecE("DevCount: 1\nTilesPerDev: 1\nDriver: xe\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	if _, err = fs.Stat(mem.FS(), filepath.Join(sysfs, "devices/pci0000:00/0000:01:00.0/tile0")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected no tile dir for single tile device, got: %v", err)
+	}
+}
+
+func TestControlServer(t *testing.T) {
+	opts, err := GetOptionsBySpecE("DevCount: 2\nHwmon: {Temp1Input: 40000}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	server := httptest.NewServer(NewControlServer(opts))
+	defer server.Close()
+
+	request := func(method, path, body string) int {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("request creation failed: %v", err)
+		}
+
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	sysfs := strings.TrimPrefix(sysfsPath, "/")
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodDelete, "/devices/1", "", http.StatusNoContent},
+		{http.MethodDelete, "/devices/1", "", http.StatusNotFound},
+		{http.MethodPost, "/devices/0", "", http.StatusConflict},
+		{http.MethodPost, "/devices/2", "", http.StatusBadRequest},
+		{http.MethodPut, "/devices/0/health", `{"Wedged": true}`, http.StatusNoContent},
+		{http.MethodPut, "/devices/0/health", `{"Foo": true}`, http.StatusBadRequest},
+		{http.MethodPut, "/sysfs/class/drm/card0/device/hwmon/hwmon0/temp1_input", "95000", http.StatusNoContent},
+		{http.MethodPut, "/sysfs/class/drm/card0/missing", "1", http.StatusNotFound},
+		{http.MethodPut, "/sysfs/../../etc/passwd", "1", http.StatusNotFound},
+		{http.MethodPut, "/sysfs/class/drm", "1", http.StatusBadRequest},
+	} {
+		if status := request(tc.method, tc.path, tc.body); status != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.path, tc.status, status)
+		}
+	}
+
+	for file, content := range map[string]string{
+		"class/drm/card0/device/hwmon/hwmon0/temp1_input": "95000",
+		"kernel/debug/dri/0/i915_wedged":                  "1",
+	} {
+		data, err := fs.ReadFile(mem.FS(), filepath.Join(sysfs, file))
+		if err != nil || string(data) != content {
+			t.Errorf("'%s': expected '%s', got '%s': %v", file, content, data, err)
+		}
+	}
+
+	resp, err := server.Client().Get(server.URL + "/devices")
+	if err != nil {
+		t.Fatalf("device listing failed: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	var devices []ControlDevice
+	if err = json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		t.Fatalf("device list decoding failed: %v", err)
+	}
+
+	if len(devices) != 2 || !devices[0].Present || devices[1].Present || devices[1].Card != "card1" {
+		t.Errorf("unexpected device list: %+v", devices)
+	}
+
+	if status := request(http.MethodPost, "/devices/1", ""); status != http.StatusCreated {
+		t.Errorf("expected device to be re-added, got status %d", status)
+	}
+
+	if _, err = fs.Stat(mem.FS(), filepath.Join(sysfs, "class/drm/card1")); err != nil {
+		t.Errorf("expected re-added device: %v", err)
+	}
+}
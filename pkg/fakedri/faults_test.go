@@ -0,0 +1,89 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFaults(t *testing.T) {
+	const spec = `
+DevCount: 5
+Driver: i915
+Faults:
+  MissingLmem: [0]
+  UnreadableNuma: [1]
+  DanglingDriver: [2]
+  EmptyVendor: [3]
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	lmem := func(i int) string {
+		return filepath.Join(sysfsPath, "class/drm", opts.cardName(i), "lmem_total_bytes")
+	}
+	pciFile := func(i int, name string) string {
+		return filepath.Join(opts.pciDevicePath(i, opts.pciAddress(i)), name)
+	}
+
+	// Device 4 is the healthy reference for all the faults.
+	for _, i := range []int{0, 4} {
+		if _, err = mem.Stat(lmem(i)); (err != nil) != (i == 0) {
+			t.Errorf("dev-%d: unexpected lmem_total_bytes state: %v", i, err)
+		}
+	}
+
+	for _, i := range []int{1, 4} {
+		data, err := mem.ReadFile(pciFile(i, "numa_node"))
+		if i == 1 && err == nil {
+			t.Errorf("dev-%d: expected unreadable numa_node, got '%s'", i, data)
+		}
+
+		if i == 4 && (err != nil || string(data) != "0") {
+			t.Errorf("dev-%d: expected numa_node 0, got '%s', %v", i, data, err)
+		}
+	}
+
+	for _, i := range []int{2, 4} {
+		link := pciFile(i, "driver")
+
+		if target, err := mem.Readlink(link); err != nil || !strings.HasSuffix(target, "/"+opts.Driver) {
+			t.Errorf("dev-%d: expected driver symlink, got '%s', %v", i, target, err)
+		}
+
+		if _, err = mem.Stat(link); (err != nil) != (i == 2) {
+			t.Errorf("dev-%d: unexpected driver symlink target state: %v", i, err)
+		}
+	}
+
+	for _, i := range []int{3, 4} {
+		data, err := mem.ReadFile(pciFile(i, "vendor"))
+		if err != nil || (len(data) == 0) != (i == 3) {
+			t.Errorf("dev-%d: unexpected vendor '%s', %v", i, data, err)
+		}
+	}
+}
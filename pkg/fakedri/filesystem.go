@@ -0,0 +1,536 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Filesystem is the interface through which the fake device files are
+// generated. Its methods take absolute OS paths, and behave like the
+// corresponding os / unix package functions.
+type Filesystem interface {
+	Mkdir(path string, perm fs.FileMode) error
+	MkdirAll(path string, perm fs.FileMode) error
+	WriteFile(path string, data []byte, perm fs.FileMode) error
+	Symlink(target, link string) error
+	Mknod(path string, mode uint32, dev int) error
+	RemoveAll(path string) error
+	ReadDir(path string) ([]fs.DirEntry, error)
+	ReadFile(path string) ([]byte, error)
+	Readlink(path string) (string, error)
+	Stat(path string) (fs.FileInfo, error)
+	Lstat(path string) (fs.FileInfo, error)
+}
+
+// SetFilesystem sets the filesystem to which the fake device files are
+// generated (and hot-plugged / updated). Default is the real OS filesystem.
+func (opts *GenOptions) SetFilesystem(fsys Filesystem) {
+	opts.filesystem = fsys
+}
+
+func (opts *GenOptions) fsys() Filesystem {
+	if opts.filesystem == nil {
+		return osFilesystem{}
+	}
+
+	return opts.filesystem
+}
+
+// osFilesystem is the default, real OS filesystem.
+type osFilesystem struct{}
+
+func (osFilesystem) Mkdir(path string, perm fs.FileMode) error {
+	return os.Mkdir(path, perm)
+}
+
+func (osFilesystem) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osFilesystem) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+func (osFilesystem) Symlink(target, link string) error {
+	return os.Symlink(target, link)
+}
+
+func (osFilesystem) Mknod(path string, mode uint32, dev int) error {
+	return unix.Mknod(path, mode, dev)
+}
+
+func (osFilesystem) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (osFilesystem) ReadDir(path string) ([]fs.DirEntry, error) {
+	return os.ReadDir(path)
+}
+
+func (osFilesystem) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (osFilesystem) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+func (osFilesystem) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (osFilesystem) Lstat(path string) (fs.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+// Same limit as Linux has for following symlinks in a path.
+const maxSymlinkHops = 40
+
+type memNode struct {
+	children map[string]*memNode // directories
+	target   string              // symlinks
+	data     []byte              // regular files
+	mode     fs.FileMode
+}
+
+// MemFS is an in-memory Filesystem, e.g. for unit tests consuming fake
+// device files without needing mknod privileges or polluting /tmp.
+// Its content can be read through the io/fs interface returned by FS().
+type MemFS struct {
+	root *memNode
+	mu   sync.RWMutex
+}
+
+// NewMemFS returns a new, empty in-memory filesystem.
+func NewMemFS() *MemFS {
+	return &MemFS{root: newMemDir(dirMode)}
+}
+
+func newMemDir(perm fs.FileMode) *memNode {
+	return &memNode{mode: fs.ModeDir | perm.Perm(), children: map[string]*memNode{}}
+}
+
+// resolve returns the node for given path and its symlink-free path. Symlinks
+// are followed in all path components, except in the last one when follow is unset.
+func (m *MemFS) resolve(path string, follow bool, hops *int) (*memNode, string, error) {
+	node, cur := m.root, "/"
+	names := strings.Split(strings.Trim(filepath.Clean("/"+path), "/"), "/")
+
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+
+		if !node.mode.IsDir() {
+			return nil, "", syscall.ENOTDIR
+		}
+
+		child, ok := node.children[name]
+		if !ok {
+			return nil, "", fs.ErrNotExist
+		}
+
+		next := filepath.Join(cur, name)
+
+		if child.mode&fs.ModeSymlink != 0 && (follow || i < len(names)-1) {
+			if *hops++; *hops > maxSymlinkHops {
+				return nil, "", syscall.ELOOP
+			}
+
+			target := child.target
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(cur, target)
+			}
+
+			var err error
+			if child, next, err = m.resolve(target, true, hops); err != nil {
+				return nil, "", err
+			}
+		}
+
+		node, cur = child, next
+	}
+
+	return node, cur, nil
+}
+
+func (m *MemFS) lookup(op, path string, follow bool) (*memNode, error) {
+	hops := 0
+
+	node, _, err := m.resolve(path, follow, &hops)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: path, Err: err}
+	}
+
+	return node, nil
+}
+
+// create adds given node to given path, which must not exist yet.
+func (m *MemFS) create(op, path string, node *memNode) error {
+	dir, name := filepath.Split(filepath.Clean(path))
+
+	parent, err := m.lookup(op, dir, true)
+	if err != nil {
+		return err
+	}
+
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: path, Err: syscall.ENOTDIR}
+	}
+
+	if _, ok := parent.children[name]; ok {
+		return &fs.PathError{Op: op, Path: path, Err: fs.ErrExist}
+	}
+
+	parent.children[name] = node
+
+	return nil
+}
+
+func (m *MemFS) mkdirAll(path string, perm fs.FileMode) error {
+	node, err := m.lookup("mkdir", path, true)
+	if err == nil {
+		if node.mode.IsDir() {
+			return nil
+		}
+
+		return &fs.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if parent := filepath.Dir(filepath.Clean(path)); parent != path {
+		if err = m.mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+
+	return m.create("mkdir", path, newMemDir(perm))
+}
+
+// Mkdir creates a new directory.
+func (m *MemFS) Mkdir(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.create("mkdir", path, newMemDir(perm))
+}
+
+// MkdirAll creates a directory, along with any missing parents.
+func (m *MemFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.mkdirAll(path, perm)
+}
+
+// WriteFile writes data to a file, creating it if necessary.
+func (m *MemFS) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, err := m.lookup("open", path, true)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m.create("open", path, &memNode{mode: perm.Perm(), data: bytes.Clone(data)})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if node.mode.IsDir() {
+		return &fs.PathError{Op: "open", Path: path, Err: syscall.EISDIR}
+	}
+
+	if node.mode.IsRegular() {
+		node.data = bytes.Clone(data)
+	}
+
+	return nil
+}
+
+// Symlink creates link as a symbolic link to target.
+func (m *MemFS) Symlink(target, link string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.create("symlink", link, &memNode{mode: fs.ModeSymlink | 0o777, target: target})
+}
+
+// Mknod creates a character device node. Device number is ignored.
+func (m *MemFS) Mknod(path string, mode uint32, dev int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	perm := fs.FileMode(mode).Perm()
+
+	return m.create("mknod", path, &memNode{mode: fs.ModeDevice | fs.ModeCharDevice | perm})
+}
+
+// RemoveAll removes given path and everything it contains.
+func (m *MemFS) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, name := filepath.Split(filepath.Clean(path))
+
+	parent, err := m.lookup("unlinkat", dir, true)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	delete(parent.children, name)
+
+	return nil
+}
+
+// ReadDir returns the directory entries sorted by name.
+func (m *MemFS) ReadDir(path string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("open", path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.entries("readdirent", path)
+}
+
+// ReadFile returns the content of given file, following symlinks.
+func (m *MemFS) ReadFile(path string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("open", path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: syscall.EISDIR}
+	}
+
+	return bytes.Clone(node.data), nil
+}
+
+// Readlink returns the target of given symlink.
+func (m *MemFS) Readlink(path string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("readlink", path, false)
+	if err != nil {
+		return "", err
+	}
+
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: fs.ErrInvalid}
+	}
+
+	return node.target, nil
+}
+
+// Stat returns file info for given path, following symlinks.
+func (m *MemFS) Stat(path string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("stat", path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.info(filepath.Base(path)), nil
+}
+
+// Lstat returns file info for given path, without following a symlink in its last component.
+func (m *MemFS) Lstat(path string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, err := m.lookup("lstat", path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.info(filepath.Base(path)), nil
+}
+
+// FS returns a read-only io/fs view of the filesystem, with paths relative to its root,
+// e.g. "tmp/sys/class/drm".
+func (m *MemFS) FS() fs.FS {
+	return memView{m: m}
+}
+
+func (node *memNode) info(name string) memInfo {
+	return memInfo{name: name, size: int64(len(node.data)), mode: node.mode}
+}
+
+func (node *memNode) entries(op, path string) ([]fs.DirEntry, error) {
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: op, Path: path, Err: syscall.ENOTDIR}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(node.children))
+	for name, child := range node.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child.info(name)))
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+type memInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (info memInfo) Name() string       { return info.name }
+func (info memInfo) Size() int64        { return info.size }
+func (info memInfo) Mode() fs.FileMode  { return info.mode }
+func (info memInfo) ModTime() time.Time { return time.Time{} }
+func (info memInfo) IsDir() bool        { return info.mode.IsDir() }
+func (info memInfo) Sys() any           { return nil }
+
+type memView struct {
+	m *MemFS
+}
+
+// Open opens the named file (following symlinks) for reading.
+func (view memView) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	view.m.mu.RLock()
+	defer view.m.mu.RUnlock()
+
+	node, err := view.m.lookup("open", "/"+name, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.Unwrap(err)}
+	}
+
+	file := &memFile{info: node.info(filepath.Base(name))}
+
+	if node.mode.IsDir() {
+		if file.entries, err = node.entries("readdirent", name); err != nil {
+			return nil, err
+		}
+	} else {
+		file.reader = bytes.NewReader(bytes.Clone(node.data))
+	}
+
+	return file, nil
+}
+
+// ReadLink returns the target of the named symlink.
+func (view memView) ReadLink(name string) (string, error) {
+	node, err := view.lstat("readlink", name)
+	if err != nil {
+		return "", err
+	}
+
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return node.target, nil
+}
+
+// Lstat returns file info for the named file, without following a symlink in its last component.
+func (view memView) Lstat(name string) (fs.FileInfo, error) {
+	node, err := view.lstat("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.info(filepath.Base(name)), nil
+}
+
+func (view memView) lstat(op, name string) (*memNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	view.m.mu.RLock()
+	defer view.m.mu.RUnlock()
+
+	node, err := view.m.lookup(op, "/"+name, false)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: errors.Unwrap(err)}
+	}
+
+	return node, nil
+}
+
+// memFile is an open MemFS file, with a snapshot of its content.
+type memFile struct {
+	reader  *bytes.Reader
+	entries []fs.DirEntry
+	info    memInfo
+	offset  int
+}
+
+func (file *memFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+func (file *memFile) Close() error               { return nil }
+
+func (file *memFile) Read(buf []byte) (int, error) {
+	if file.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: file.info.name, Err: syscall.EISDIR}
+	}
+
+	return file.reader.Read(buf)
+}
+
+func (file *memFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !file.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: file.info.name, Err: syscall.ENOTDIR}
+	}
+
+	entries := file.entries[file.offset:]
+	if n > 0 && len(entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > 0 && n < len(entries) {
+		entries = entries[:n]
+	}
+
+	file.offset += len(entries)
+
+	return entries, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs GT frequency SPECIFICATION (Freq option)
+//
+// sys/class/drm/cardX/gt/gtN/ (gt0 also for devices without tiles)
+// sys/class/drm/cardX/gt/gtN/rps_{min,max}_freq_mhz (frequency limits)
+// sys/class/drm/cardX/gt/gtN/rps_{RPn,RP0}_freq_mhz (HW min / max frequency)
+// sys/class/drm/cardX/gt/gtN/rps_{cur,act}_freq_mhz (current frequency)
+// sys/class/drm/cardX/gt/gtN/throttle_reason_status (1 if any throttle reason)
+// sys/class/drm/cardX/gt/gtN/throttle_reason_REASON (1 if REASON throttles)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// throttleReasons are the GT frequency throttle reasons reported by i915.
+var throttleReasons = []string{"pl1", "pl2", "pl4", "prochot", "ratl", "thermal", "vr_tdc", "vr_thermalert"}
+
+// FreqOptions are the values for the GT frequency and throttle files of a fake device.
+type FreqOptions struct {
+	// Throttle lists the active throttle reasons, e.g. "pl1" or "thermal".
+	Throttle []string `yaml:"Throttle,omitempty"`
+	MinMhz   int      `yaml:"MinMhz"`
+	MaxMhz   int      `yaml:"MaxMhz"`
+	// ActMhz is the current frequency, defaults to MinMhz.
+	ActMhz int `yaml:"ActMhz,omitempty"`
+}
+
+func (freq *FreqOptions) validate() error {
+	if freq == nil {
+		return nil
+	}
+
+	if freq.MinMhz <= 0 || freq.MaxMhz < freq.MinMhz {
+		return fmt.Errorf("%w: Freq MinMhz (%d) - MaxMhz (%d) is not a valid frequency range", ErrInvalidOptions, freq.MinMhz, freq.MaxMhz)
+	}
+
+	if freq.ActMhz != 0 && (freq.ActMhz < freq.MinMhz || freq.ActMhz > freq.MaxMhz) {
+		return fmt.Errorf("%w: Freq ActMhz (%d) not within %d-%d", ErrInvalidOptions, freq.ActMhz, freq.MinMhz, freq.MaxMhz)
+	}
+
+	for _, reason := range freq.Throttle {
+		if !slices.Contains(throttleReasons, reason) {
+			return fmt.Errorf("%w: unknown Freq throttle reason '%s', known ones are: %v", ErrInvalidOptions, reason, throttleReasons)
+		}
+	}
+
+	return nil
+}
+
+func addSysfsFreqFiles(root string, opts *GenOptions, i int) error {
+	dev := opts.device(i)
+
+	freq := dev.Freq
+	if freq == nil {
+		return nil
+	}
+
+	act := freq.ActMhz
+	if act == 0 {
+		act = freq.MinMhz
+	}
+
+	values := map[string]int{
+		"rps_min_freq_mhz":       freq.MinMhz,
+		"rps_max_freq_mhz":       freq.MaxMhz,
+		"rps_RPn_freq_mhz":       freq.MinMhz,
+		"rps_RP0_freq_mhz":       freq.MaxMhz,
+		"rps_cur_freq_mhz":       act,
+		"rps_act_freq_mhz":       act,
+		"throttle_reason_status": 0,
+	}
+
+	for _, reason := range throttleReasons {
+		values["throttle_reason_"+reason] = 0
+	}
+
+	for _, reason := range freq.Throttle {
+		values["throttle_reason_"+reason] = 1
+		values["throttle_reason_status"] = 1
+	}
+
+	for gt := 0; gt < max(dev.TilesPerDev, 1); gt++ {
+		base := filepath.Join(root, "class", "drm", opts.cardName(i), "gt", fmt.Sprintf("gt%d", gt))
+		if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
+			return err
+		}
+
+		if dev.TilesPerDev == 0 {
+			opts.dirs++
+		}
+
+		for name, value := range values {
+			if err := writeFile(opts, filepath.Join(base, name), strconv.Itoa(value)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs health SPECIFICATION (devices with Health option)
+//
+// sys/class/drm/cardX/error (GPU error state, "No error state collected" when healthy)
+// sys/kernel/debug/dri/X/i915_wedged (1 when GPU is wedged, otherwise 0)
+// sys/kernel/debug/dri/X/i915_reset_info ("full gpu reset = N")
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+const noErrorState = "No error state collected\n"
+
+// HealthOptions describe the health state of a fake GPU device.
+type HealthOptions struct {
+	// ErrorState is the content of the GPU error state file, empty
+	// for no error state.
+	ErrorState string `yaml:"ErrorState,omitempty"`
+	// Resets is the number of full GPU resets done.
+	Resets int `yaml:"Resets,omitempty"`
+	// Wedged GPU can not be used until it is reset.
+	Wedged bool `yaml:"Wedged,omitempty"`
+}
+
+func validateHealth(opts *GenOptions) error {
+	for i, dev := range opts.Devices {
+		if dev.Health == nil {
+			continue
+		}
+
+		if !opts.isGpuMode() {
+			return fmt.Errorf("%w: Devices[%d]: Health is supported only in GPU mode", ErrInvalidOptions, i)
+		}
+
+		if dev.Health.Resets < 0 {
+			return fmt.Errorf("%w: Devices[%d]: Health Resets (%d) must not be negative", ErrInvalidOptions, i, dev.Health.Resets)
+		}
+	}
+
+	return nil
+}
+
+// addHealthFiles writes the health state files for device i, if it has
+// the Health option.
+func addHealthFiles(opts *GenOptions, i int) error {
+	health := opts.device(i).Health
+	if health == nil {
+		return nil
+	}
+
+	return writeHealthFiles(opts, i, *health)
+}
+
+func writeHealthFiles(opts *GenOptions, i int, health HealthOptions) error {
+	card, _ := opts.minors(i)
+	debugfs := filepath.Join(sysfsPath, "kernel", "debug", "dri", strconv.Itoa(card))
+
+	errorState := health.ErrorState
+	if errorState == "" {
+		errorState = noErrorState
+	}
+
+	wedged := "0"
+	if health.Wedged {
+		wedged = "1"
+	}
+
+	for path, content := range map[string]string{
+		filepath.Join(sysfsPath, "class", "drm", opts.cardName(i), "error"): errorState,
+		filepath.Join(debugfs, "i915_wedged"):                               wedged,
+		filepath.Join(debugfs, "i915_reset_info"):                           fmt.Sprintf("full gpu reset = %d\n", health.Resets),
+	} {
+		if err := writeFile(opts, path, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetDeviceHealth updates the health state files of already generated fake
+// GPU device i at runtime, e.g. to wedge it, without re-plugging it.
+func SetDeviceHealth(opts *GenOptions, i int, health HealthOptions) error {
+	if !opts.isGpuMode() {
+		return fmt.Errorf("%w: device health is supported only in GPU mode", ErrInvalidOptions)
+	}
+
+	if i < 0 || i >= opts.DevCount || !opts.hasDevice(i) {
+		return fmt.Errorf("%w: no fake device %d", ErrInvalidOptions, i)
+	}
+
+	if err := writeHealthFiles(opts, i, health); err != nil {
+		return fmt.Errorf("dev-%d health update failed: %w", i, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// devicePath returns the path that exists when fake device i has been generated.
+func (opts *GenOptions) devicePath(i int) string {
+	switch opts.Mode {
+	case modeQat:
+		return filepath.Join(sysfsPath, "bus", "pci", "devices", opts.pciAddress(i))
+	case modeSgx:
+		return filepath.Join(devfsPath, "sgx_enclave")
+	case modeDsa, modeIaa:
+		prefix, _ := opts.idxdDevice()
+		return filepath.Join(sysfsPath, "bus", "dsa", "devices", fmt.Sprintf("%s%d", prefix, i))
+	case modeDlb:
+		return filepath.Join(sysfsPath, "class", "dlb2", fmt.Sprintf("dlb%d", i))
+	case modeNpu:
+		return filepath.Join(sysfsPath, "class", "accel", fmt.Sprintf("accel%d", i))
+	}
+
+	return filepath.Join(sysfsPath, "class", "drm", opts.cardName(i))
+}
+
+// hasDevice tells whether fake device i has already been generated.
+func (opts *GenOptions) hasDevice(i int) bool {
+	_, err := opts.fsys().Lstat(opts.devicePath(i))
+
+	return err == nil
+}
+
+// AddDevice hot-plugs fake device i into an already generated fake tree.
+func AddDevice(opts *GenOptions, i int) error {
+	if opts.hasDevice(i) {
+		return fmt.Errorf("dev-%d: %w", i, os.ErrExist)
+	}
+
+	if err := addDevice(opts, i); err != nil {
+		return err
+	}
+
+	opts.log().V(1).Info("Added fake device", "card", opts.cardName(i))
+
+	return nil
+}
+
+// RemoveDevice hot-unplugs fake device i from the fake tree, removing
+// all its sysfs, devfs and debugfs content.
+func RemoveDevice(opts *GenOptions, i int) error {
+	card := opts.cardName(i)
+	paths := []string{
+		filepath.Join(devfsPath, "dri", opts.byPathName(i, "card")),
+		filepath.Join(devfsPath, "dri", opts.byPathName(i, "render")),
+		filepath.Join(devfsPath, "dri", card),
+		filepath.Join(devfsPath, "dri", opts.renderName(i)),
+		filepath.Join(sysfsPath, "class", "drm", card),
+		filepath.Join(sysfsPath, "bus", "pci", "drivers", opts.Driver, opts.pciAddress(i)),
+		filepath.Join(sysfsPath, "kernel", "debug", "dri", strings.TrimPrefix(card, "card")),
+		filepath.Join(sysfsPath, "devices", opts.pciRoot(i), opts.pciAddress(i)),
+	}
+
+	if index := opts.meiIndex(i); index >= 0 {
+		paths = append(paths,
+			filepath.Join(devfsPath, fmt.Sprintf("mei%d", index)),
+			filepath.Join(sysfsPath, "class", "mei", fmt.Sprintf("mei%d", index)))
+	}
+
+	if _, err := opts.fsys().Stat(paths[4]); err != nil {
+		return fmt.Errorf("dev-%d: %w", i, err)
+	}
+
+	for _, path := range paths {
+		if err := opts.fsys().RemoveAll(path); err != nil {
+			return fmt.Errorf("dev-%d: removing '%s' failed: %w", i, path, err)
+		}
+	}
+
+	opts.log().V(1).Info("Removed fake device", "card", card)
+
+	return nil
+}
+
+// sameExceptRuntime tells whether the devices differ at most by their
+// health and driver binding, which can be changed at runtime.
+func sameExceptRuntime(a, b DeviceOptions) bool {
+	a.Health, b.Health = nil, nil
+	a.Unbound, b.Unbound = false, false
+
+	return reflect.DeepEqual(a, b)
+}
+
+// unchanged tells whether device i has the same DRM minor numbers and
+// properties (except for the runtime ones) in both options.
+func unchanged(old, opts *GenOptions, i int) bool {
+	oldCard, oldRender := old.minors(i)
+	card, render := opts.minors(i)
+
+	return oldCard == card && oldRender == render && sameExceptRuntime(old.device(i), opts.device(i))
+}
+
+func validateUnbound(opts *GenOptions) error {
+	for i, dev := range opts.Devices {
+		if dev.Unbound && !opts.isGpuMode() {
+			return fmt.Errorf("%w: Devices[%d]: Unbound is supported only in GPU mode", ErrInvalidOptions, i)
+		}
+	}
+
+	return nil
+}
+
+// UnbindDevice simulates unbinding already generated fake GPU device i from
+// its driver at runtime, by removing its driver symlink.
+func UnbindDevice(opts *GenOptions, i int) error {
+	return setDeviceBound(opts, i, false)
+}
+
+// BindDevice simulates (re-)binding already generated fake GPU device i to
+// its driver at runtime, by (re-)creating its driver symlink.
+func BindDevice(opts *GenOptions, i int) error {
+	return setDeviceBound(opts, i, true)
+}
+
+func setDeviceBound(opts *GenOptions, i int, bound bool) error {
+	if !opts.isGpuMode() {
+		return fmt.Errorf("%w: driver binding is supported only in GPU mode", ErrInvalidOptions)
+	}
+
+	if i < 0 || i >= opts.DevCount || !opts.hasDevice(i) {
+		return fmt.Errorf("%w: no fake device %d", ErrInvalidOptions, i)
+	}
+
+	link := filepath.Join(opts.pciDevicePath(i, opts.pciAddress(i)), "driver")
+	if err := opts.fsys().RemoveAll(link); err != nil {
+		return fmt.Errorf("dev-%d: removing driver symlink failed: %w", i, err)
+	}
+
+	if bound {
+		if err := opts.fsys().Symlink(opts.driverTarget(i), link); err != nil {
+			return fmt.Errorf("dev-%d: driver symlink creation failed: %w", i, err)
+		}
+	}
+
+	opts.log().V(1).Info("Changed fake device driver binding", "card", opts.cardName(i), "bound", bound)
+
+	return nil
+}
+
+// Respec updates a fake tree generated with the old options to match the new
+// ones: devices missing from the new spec are unplugged, new devices plugged in
+// and devices whose properties changed are replugged. Returns the new options.
+func Respec(old, opts GenOptions) (GenOptions, error) {
+	if !old.isGpuMode() || !opts.isGpuMode() {
+		return old, fmt.Errorf("%w: device hot-plug is supported only in GPU mode", ErrInvalidOptions)
+	}
+
+	if opts.filesystem == nil {
+		opts.filesystem = old.filesystem
+	}
+
+	replugAll := old.Driver != opts.Driver || !reflect.DeepEqual(old.Capabilities, opts.Capabilities) ||
+		!reflect.DeepEqual(old.Faults, opts.Faults) || !reflect.DeepEqual(old.Mei, opts.Mei)
+
+	for i := 0; i < old.DevCount; i++ {
+		if i < opts.DevCount && !replugAll && unchanged(&old, &opts, i) {
+			continue
+		}
+
+		if err := RemoveDevice(&old, i); err != nil {
+			return old, err
+		}
+	}
+
+	for i := 0; i < opts.DevCount; i++ {
+		if i < old.DevCount && !replugAll && unchanged(&old, &opts, i) {
+			// Health and driver binding changes are applied without
+			// re-plugging the device.
+			if health := opts.device(i).Health; !reflect.DeepEqual(old.device(i).Health, health) {
+				if health == nil {
+					health = &HealthOptions{}
+				}
+
+				if err := SetDeviceHealth(&opts, i, *health); err != nil {
+					return opts, err
+				}
+			}
+
+			if unbound := opts.device(i).Unbound; unbound != old.device(i).Unbound {
+				if err := setDeviceBound(&opts, i, !unbound); err != nil {
+					return opts, err
+				}
+			}
+
+			continue
+		}
+
+		if err := AddDevice(&opts, i); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, makeXelinkSideCar(opts)
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestHotplug(t *testing.T) {
+	opts, err := GetOptionsBySpecE("DevCount: 2\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	devfs := filepath.Join(devfsPath, "dri")
+	sysfs := filepath.Join(sysfsPath, "class", "drm")
+
+	exists := func(paths map[string]bool) {
+		t.Helper()
+
+		for path, expected := range paths {
+			if _, err := mem.Lstat(path); (err == nil) != expected {
+				t.Errorf("expected '%s' to exist: %t, got: %v", path, expected, err)
+			}
+		}
+	}
+
+	if err = AddDevice(&opts, 1); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected ErrExist for existing device, got: %v", err)
+	}
+
+	opts.DevCount = 3
+
+	if err = AddDevice(&opts, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exists(map[string]bool{
+		filepath.Join(devfs, "card2"):      true,
+		filepath.Join(devfs, "renderD130"): true,
+		filepath.Join(sysfs, "card2"):      true,
+	})
+
+	if err = RemoveDevice(&opts, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exists(map[string]bool{
+		filepath.Join(devfs, "card1"):      false,
+		filepath.Join(devfs, "renderD129"): false,
+		filepath.Join(sysfs, "card1"):      false,
+		filepath.Join(sysfsPath, "bus/pci/drivers", opts.Driver, opts.pciAddress(1)): false,
+		filepath.Join(sysfsPath, "devices", opts.pciRoot(1), opts.pciAddress(1)):     false,
+		filepath.Join(devfs, "card0"): true,
+		filepath.Join(devfs, "card2"): true,
+	})
+
+	if err = RemoveDevice(&opts, 1); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected ErrNotExist for removed device, got: %v", err)
+	}
+
+	if err = AddDevice(&opts, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Markers tell which devices a respec re-plugs.
+	markers := []string{}
+
+	for i := 0; i < opts.DevCount; i++ {
+		markers = append(markers, filepath.Join(opts.devicePath(i), "marker"))
+
+		if err = mem.WriteFile(markers[i], nil, fileMode); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	for _, step := range []struct {
+		name      string
+		spec      string
+		devices   map[string]bool
+		replugged []bool
+	}{
+		{
+			name:      "no-op respec",
+			spec:      "DevCount: 3\n",
+			replugged: []bool{false, false, false},
+		},
+		{
+			name:      "changed device properties",
+			spec:      "DevCount: 3\nDevices:\n  - Count: 1\n  - DevMemSize: 8589934592\n",
+			replugged: []bool{false, true, false},
+		},
+		{
+			name:      "removed and added devices",
+			spec:      "DevCount: 4\nDevices:\n  - Count: 1\n  - DevMemSize: 8589934592\n  - Count: 1\n  - Count: 1\n    NumaNode: 1\n",
+			devices:   map[string]bool{filepath.Join(devfs, "card3"): true},
+			replugged: []bool{false, false, false},
+		},
+		{
+			name:      "unplugged devices",
+			spec:      "DevCount: 1\n",
+			devices:   map[string]bool{filepath.Join(sysfs, "card1"): false, filepath.Join(sysfs, "card3"): false},
+			replugged: []bool{false},
+		},
+	} {
+		respec, err := GetOptionsBySpecE(step.spec)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+
+		if opts, err = Respec(opts, respec); err != nil {
+			t.Fatalf("%s: respec failed: %v", step.name, err)
+		}
+
+		exists(step.devices)
+
+		for i, replugged := range step.replugged {
+			if _, err := mem.Lstat(markers[i]); (err != nil) != replugged {
+				t.Errorf("%s: expected device %d re-plugged: %t, got: %v", step.name, i, replugged, err)
+			}
+
+			if err := mem.WriteFile(markers[i], nil, fileMode); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+}
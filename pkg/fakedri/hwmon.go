@@ -0,0 +1,69 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs hwmon SPECIFICATION
+//
+// sys/class/drm/cardX/device/hwmon/hwmonX/
+// sys/class/drm/cardX/device/hwmon/hwmonX/name (driver name)
+// sys/class/drm/cardX/device/hwmon/hwmonX/power1_max (power limit, microwatts)
+// sys/class/drm/cardX/device/hwmon/hwmonX/energy1_input (energy counter, microjoules)
+// sys/class/drm/cardX/device/hwmon/hwmonX/temp1_input (temperature, millidegrees Celsius)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// HwmonOptions are the values for the hwmon files of a fake device.
+type HwmonOptions struct {
+	Power1Max    int64 `yaml:"Power1Max"`
+	Energy1Input int64 `yaml:"Energy1Input"`
+	Temp1Input   int64 `yaml:"Temp1Input"`
+}
+
+func addSysfsHwmonTree(root string, opts *GenOptions, i int) error {
+	hwmon := opts.device(i).Hwmon
+	if hwmon == nil {
+		return nil
+	}
+
+	base := filepath.Join(root, "class", "drm", opts.cardName(i),
+		"device", "hwmon", fmt.Sprintf("hwmon%d", i))
+	if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs++
+
+	if err := writeFile(opts, filepath.Join(base, "name"), opts.Driver); err != nil {
+		return err
+	}
+
+	for name, value := range map[string]int64{
+		"power1_max":    hwmon.Power1Max,
+		"energy1_input": hwmon.Energy1Input,
+		"temp1_input":   hwmon.Temp1Input,
+	} {
+		if err := writeFile(opts, filepath.Join(base, name), strconv.FormatInt(value, 10)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestHwmon(t *testing.T) {
+	const spec = `
+DevCount: 3
+Driver: xe
+Hwmon: {Power1Max: 150000000, Energy1Input: 1000, Temp1Input: 45000}
+Devices:
+  - Count: 1
+  - Hwmon: {Power1Max: 300000000, Temp1Input: 60000}
+`
+
+	opts, err := GetOptionsBySpecE(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	for i, expected := range []map[string]string{
+		{"name": "xe", "power1_max": "150000000", "energy1_input": "1000", "temp1_input": "45000"},
+		{"name": "xe", "power1_max": "300000000", "energy1_input": "0", "temp1_input": "60000"},
+		{"name": "xe", "power1_max": "150000000", "energy1_input": "1000", "temp1_input": "45000"},
+	} {
+		base := filepath.Join(sysfsPath, "class/drm", opts.cardName(i), "device/hwmon", fmt.Sprintf("hwmon%d", i))
+
+		for name, value := range expected {
+			if data, err := mem.ReadFile(filepath.Join(base, name)); err != nil || string(data) != value {
+				t.Errorf("dev-%d: expected %s '%s', got '%s', %v", i, name, value, data, err)
+			}
+		}
+	}
+
+	// No hwmon without the options.
+	opts, err = GetOptionsBySpecE("DevCount: 1\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem = NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	if _, err = mem.Stat(filepath.Join(sysfsPath, "class/drm/card0/device/hwmon")); err == nil {
+		t.Error("expected no hwmon directory")
+	}
+}
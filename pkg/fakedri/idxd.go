@@ -0,0 +1,344 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs IDXD SPECIFICATION (Mode: dsa / iaa)
+//
+// PCI device dirs bound to "idxd" driver (see pci.go), with:
+// sys/devices/ROOT/BDF/DEVX/ (DEV being "dsa" or "iax")
+// sys/devices/ROOT/BDF/DEVX/{state,max_groups,max_engines,max_work_queues}
+// sys/devices/ROOT/BDF/DEVX/groupX.G/{engines,work_queues}
+// sys/devices/ROOT/BDF/DEVX/engineX.E/group_id
+// sys/devices/ROOT/BDF/DEVX/wqX.Y/{state,mode,type,name,size,priority,group_id}
+// sys/bus/dsa/devices/{DEVX,groupX.G,engineX.E,wqX.Y} -> ../../../devices/ROOT/BDF/DEVX[/...]
+// sys/dev/char/MAJOR:MINOR -> ../../devices/ROOT/BDF/DEVX/wqX.Y
+//---------------------------------------------------------------
+// devfs IDXD SPECIFICATION
+//
+// dev/DEV/wqX.Y (user type work queues, unique major:minor)
+// dev/char/MAJOR:MINOR -> ../DEV/wqX.Y
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Experimental char device major number for the work queue nodes,
+	// they need to be unique for the /dev/char/ symlinks.
+	idxdMajor = 240
+	// Hardware limits of current DSA and IAA devices.
+	idxdMaxGroups     = 4
+	idxdMaxEngines    = 8
+	idxdMaxWorkQueues = 8
+	idxdMaxWqSize     = 128
+)
+
+// IdxdOptions describe the DSA / IAA specific options for the "dsa" and "iaa"
+// modes. Given groups, engines and work queues are generated for each device.
+type IdxdOptions struct {
+	WorkQueues []IdxdWqOptions `yaml:"WorkQueues,omitempty"`
+	Groups     int             `yaml:"Groups,omitempty"`
+	Engines    int             `yaml:"Engines,omitempty"`
+}
+
+// IdxdWqOptions describe an idxd work queue. Work queues are assigned to
+// the groups in round-robin order.
+type IdxdWqOptions struct {
+	Name     string `yaml:"Name,omitempty"`
+	Mode     string `yaml:"Mode,omitempty"`
+	Type     string `yaml:"Type,omitempty"`
+	State    string `yaml:"State,omitempty"`
+	Size     int    `yaml:"Size,omitempty"`
+	Priority int    `yaml:"Priority,omitempty"`
+}
+
+// idxdDevice returns the device name prefix and the PCI device ID for the mode.
+func (opts *GenOptions) idxdDevice() (prefix, deviceID string) {
+	if opts.Mode == modeIaa {
+		return "iax", "0x0cfe"
+	}
+
+	return "dsa", "0x0b25"
+}
+
+func (opts *GenOptions) setIdxdDefaults() {
+	if opts.Idxd == nil {
+		opts.Idxd = &IdxdOptions{}
+	}
+
+	idxd := opts.Idxd
+
+	if opts.DeviceID == "" {
+		_, opts.DeviceID = opts.idxdDevice()
+	}
+
+	if idxd.Groups == 0 {
+		idxd.Groups = 1
+	}
+
+	if idxd.Engines == 0 {
+		idxd.Engines = idxd.Groups
+	}
+
+	if len(idxd.WorkQueues) == 0 {
+		idxd.WorkQueues = []IdxdWqOptions{{}}
+	}
+
+	for i := range idxd.WorkQueues {
+		wq := &idxd.WorkQueues[i]
+
+		if wq.Mode == "" {
+			wq.Mode = "dedicated"
+		}
+
+		if wq.Type == "" {
+			wq.Type = "user"
+		}
+
+		if wq.State == "" {
+			wq.State = "enabled"
+		}
+
+		if wq.Size == 0 {
+			wq.Size = idxdMaxWqSize / len(idxd.WorkQueues)
+		}
+
+		if wq.Priority == 0 {
+			wq.Priority = 10
+		}
+
+		if wq.Name == "" {
+			wq.Name = fmt.Sprintf("%s%d", wq.Type, i)
+		}
+	}
+}
+
+func validateIdxd(opts *GenOptions) error {
+	if opts.Mode != modeDsa && opts.Mode != modeIaa {
+		if opts.Idxd != nil {
+			return fmt.Errorf("%w: Idxd options given for '%s' mode", ErrInvalidOptions, opts.Mode)
+		}
+
+		return nil
+	}
+
+	if opts.VfsPerPf > 0 || opts.TilesPerDev > 0 || opts.DevMemSize > 0 || opts.Hwmon != nil || opts.Freq != nil ||
+		opts.MemRegions != nil || opts.XeLinks != nil || len(opts.Clients) > 0 {
+		return fmt.Errorf("%w: SR-IOV or GPU specific options given for '%s' mode", ErrInvalidOptions, opts.Mode)
+	}
+
+	idxd := opts.Idxd
+	if idxd == nil {
+		return nil
+	}
+
+	if idxd.Groups < 0 || idxd.Groups > idxdMaxGroups || idxd.Engines < idxd.Groups || idxd.Engines > idxdMaxEngines {
+		return fmt.Errorf("%w: Idxd Groups (%d) not within 1-%d, or Engines (%d) not within Groups-%d",
+			ErrInvalidOptions, idxd.Groups, idxdMaxGroups, idxd.Engines, idxdMaxEngines)
+	}
+
+	if len(idxd.WorkQueues) > idxdMaxWorkQueues {
+		return fmt.Errorf("%w: %d Idxd WorkQueues given, max is %d", ErrInvalidOptions, len(idxd.WorkQueues), idxdMaxWorkQueues)
+	}
+
+	size := 0
+
+	for i, wq := range idxd.WorkQueues {
+		if (wq.Mode != "dedicated" && wq.Mode != "shared") || (wq.Type != "user" && wq.Type != "kernel") ||
+			(wq.State != "enabled" && wq.State != "disabled") {
+			return fmt.Errorf("%w: Idxd WorkQueues[%d]: invalid Mode '%s', Type '%s' or State '%s'",
+				ErrInvalidOptions, i, wq.Mode, wq.Type, wq.State)
+		}
+
+		size += wq.Size
+	}
+
+	if size > idxdMaxWqSize {
+		return fmt.Errorf("%w: Idxd WorkQueues total Size (%d) > %d", ErrInvalidOptions, size, idxdMaxWqSize)
+	}
+
+	return nil
+}
+
+func (opts *GenOptions) idxdPciName(i int) string {
+	slot := 1
+	if opts.Mode == modeIaa {
+		slot = 2
+	}
+
+	return fmt.Sprintf("0000:%02x:%02x.0", i+1, slot)
+}
+
+// addIdxdDevice generates the sysfs and devfs content for DSA / IAA device i.
+func addIdxdDevice(opts *GenOptions, i int) error {
+	prefix, _ := opts.idxdDevice()
+	name := fmt.Sprintf("%s%d", prefix, i)
+	idxd := opts.Idxd
+
+	pciDir := filepath.Join("devices", opts.pciRoot(i), opts.idxdPciName(i))
+	base := filepath.Join(sysfsPath, pciDir, name)
+
+	if _, err := addPciDeviceDir(opts, i, opts.idxdPciName(i), "idxd"); err != nil {
+		return err
+	}
+
+	if err := opts.fsys().Mkdir(base, dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs++
+
+	for file, value := range map[string]string{
+		"state":           "enabled",
+		"max_groups":      strconv.Itoa(idxdMaxGroups),
+		"max_engines":     strconv.Itoa(idxdMaxEngines),
+		"max_work_queues": strconv.Itoa(idxdMaxWorkQueues),
+	} {
+		if err := writeFile(opts, filepath.Join(base, file), value); err != nil {
+			return err
+		}
+	}
+
+	groups := make([][]string, idxd.Groups)
+	wqs := make([][]string, idxd.Groups)
+
+	for e := 0; e < idxd.Engines; e++ {
+		engine := fmt.Sprintf("engine%d.%d", i, e)
+		groups[e%idxd.Groups] = append(groups[e%idxd.Groups], engine)
+
+		if err := addIdxdSubdir(opts, base, engine, map[string]string{"group_id": strconv.Itoa(e % idxd.Groups)}); err != nil {
+			return err
+		}
+	}
+
+	for y, wq := range idxd.WorkQueues {
+		wqName := fmt.Sprintf("wq%d.%d", i, y)
+		wqs[y%idxd.Groups] = append(wqs[y%idxd.Groups], wqName)
+
+		if err := addIdxdSubdir(opts, base, wqName, map[string]string{
+			"state":    wq.State,
+			"mode":     wq.Mode,
+			"type":     wq.Type,
+			"name":     wq.Name,
+			"size":     strconv.Itoa(wq.Size),
+			"priority": strconv.Itoa(wq.Priority),
+			"group_id": strconv.Itoa(y % idxd.Groups),
+		}); err != nil {
+			return err
+		}
+
+		if wq.Type == "user" {
+			if err := addIdxdWqNode(opts, prefix, filepath.Join(pciDir, name, wqName), i*idxdMaxWorkQueues+y); err != nil {
+				return err
+			}
+		}
+	}
+
+	for g := range groups {
+		if err := addIdxdSubdir(opts, base, fmt.Sprintf("group%d.%d", i, g), map[string]string{
+			"engines":     strings.Join(groups[g], " "),
+			"work_queues": strings.Join(wqs[g], " "),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return addIdxdBusLinks(opts, filepath.Join(pciDir, name))
+}
+
+// addIdxdSubdir adds given group, engine or work queue dir with its files.
+func addIdxdSubdir(opts *GenOptions, base, name string, files map[string]string) error {
+	dir := filepath.Join(base, name)
+	if err := opts.fsys().Mkdir(dir, dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs++
+
+	for file, value := range files {
+		if err := writeFile(opts, filepath.Join(dir, file), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addIdxdBusLinks adds dsa bus symlinks for the device and its subdirs.
+func addIdxdBusLinks(opts *GenOptions, device string) error {
+	bus := filepath.Join(sysfsPath, "bus", "dsa", "devices")
+	if err := opts.fsys().MkdirAll(bus, dirMode); err != nil {
+		return err
+	}
+
+	entries, err := opts.fsys().ReadDir(filepath.Join(sysfsPath, device))
+	if err != nil {
+		return err
+	}
+
+	if err := addSymlink(opts, "../../../"+device, filepath.Join(bus, filepath.Base(device))); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		target := "../../../" + filepath.Join(device, entry.Name())
+		if err := addSymlink(opts, target, filepath.Join(bus, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addIdxdWqNode adds the work queue device node, its /dev/char/ symlink, and
+// /sys/dev/char/ symlink to given work queue sysfs device.
+func addIdxdWqNode(opts *GenOptions, prefix, device string, minor int) error {
+	wqName := filepath.Base(device)
+	devName := fmt.Sprintf("%d:%d", idxdMajor, minor)
+
+	dir := filepath.Join(devfsPath, prefix)
+	if err := opts.fsys().MkdirAll(dir, dirMode); err != nil {
+		return err
+	}
+
+	if err := addCharDeviceNode(opts, filepath.Join(dir, wqName), idxdMajor, minor); err != nil {
+		return err
+	}
+
+	charDir := filepath.Join(devfsPath, "char")
+	if err := opts.fsys().MkdirAll(charDir, dirMode); err != nil {
+		return err
+	}
+
+	if err := addSymlink(opts, filepath.Join("..", prefix, wqName), filepath.Join(charDir, devName)); err != nil {
+		return err
+	}
+
+	sysCharDir := filepath.Join(sysfsPath, "dev", "char")
+	if err := opts.fsys().MkdirAll(sysCharDir, dirMode); err != nil {
+		return err
+	}
+
+	return addSymlink(opts, "../../"+device, filepath.Join(sysCharDir, devName))
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"github.com/go-logr/logr"
+
+	"k8s.io/klog/v2"
+)
+
+// SetLogger sets the structured logger for the generation messages, instead
+// of the global klog one. Informational messages are logged at V(1) level,
+// and warnings at V(0); failures are only returned as errors.
+func (opts *GenOptions) SetLogger(logger logr.Logger) {
+	opts.logger = logger
+}
+
+// log returns the logger for the generation messages, which discards
+// all of them in Quiet mode.
+func (opts *GenOptions) log() logr.Logger {
+	if opts.Quiet {
+		return logr.Discard()
+	}
+
+	if opts.logger.GetSink() == nil {
+		return klog.Background()
+	}
+
+	return opts.logger
+}
@@ -0,0 +1,274 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// maxDiffs limits the number of differences listed in verification errors.
+const maxDiffs = 10
+
+// Manifest lists everything generated for the fake device tree, and hash
+// of the spec from which it was generated.
+type Manifest struct {
+	SpecHash string
+	Entries  []ManifestEntry
+}
+
+// ManifestEntry is a dir, file, (char) device node or symlink in the fake tree.
+type ManifestEntry struct {
+	Path string
+	Type string // "dir", "file", "device" or "symlink"
+	// Target of a symlink.
+	Target string `json:",omitempty"`
+	// Hash (SHA-256) of a file content, omitted for dynamic files.
+	Hash string `json:",omitempty"`
+}
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// specHash returns hash of the spec for given options.
+func (opts *GenOptions) specHash() (string, error) {
+	spec, err := MarshalSpec(*opts)
+	if err != nil {
+		return "", err
+	}
+
+	return hashData(spec), nil
+}
+
+// BuildManifest returns manifest of the fake device tree currently generated
+// for given options.
+func BuildManifest(opts GenOptions) (Manifest, error) {
+	var manifest Manifest
+
+	hash, err := opts.specHash()
+	if err != nil {
+		return manifest, fmt.Errorf("spec hashing failed: %w", err)
+	}
+
+	manifest.SpecHash = hash
+
+	dynamic := map[string]bool{}
+	if opts.Dynamic != nil {
+		for _, file := range opts.Dynamic.Files {
+			dynamic[filepath.Join(sysfsPath, file.Path)] = true
+		}
+	}
+
+	for _, root := range []string{sysfsPath, devfsPath, procfsPath} {
+		if manifest.Entries, err = addManifestEntries(&opts, manifest.Entries, root, dynamic); err != nil {
+			return manifest, err
+		}
+	}
+
+	dir := opts.NfdFeatureDir
+	if dir == "" {
+		dir = defaultNfdFeatureDir
+	}
+
+	// Feature files are in a shared dir, so only the generated ones are listed.
+	for _, name := range []string{sgxFeatureFile, sideCarFile} {
+		if manifest.Entries, err = addManifestEntries(&opts, manifest.Entries, filepath.Join(dir, name), dynamic); err != nil {
+			return manifest, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// addManifestEntries appends entries for given path and, if it is a dir,
+// everything under it. Non-existing path is skipped.
+func addManifestEntries(opts *GenOptions, entries []ManifestEntry, path string, dynamic map[string]bool) ([]ManifestEntry, error) {
+	info, err := opts.fsys().Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+
+	if err != nil {
+		return entries, err
+	}
+
+	entry := ManifestEntry{Path: path}
+
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		entry.Type = "dir"
+	case mode&fs.ModeSymlink != 0:
+		entry.Type = "symlink"
+
+		if entry.Target, err = opts.fsys().Readlink(path); err != nil {
+			return entries, err
+		}
+	case mode&fs.ModeDevice != 0:
+		entry.Type = "device"
+	default:
+		entry.Type = "file"
+
+		if !dynamic[path] {
+			data, err := opts.fsys().ReadFile(path)
+			if err != nil {
+				return entries, err
+			}
+
+			entry.Hash = hashData(data)
+		}
+	}
+
+	entries = append(entries, entry)
+
+	if entry.Type != "dir" {
+		return entries, nil
+	}
+
+	dirEntries, err := opts.fsys().ReadDir(path)
+	if err != nil {
+		return entries, err
+	}
+
+	for _, dirEntry := range dirEntries {
+		if entries, err = addManifestEntries(opts, entries, filepath.Join(path, dirEntry.Name()), dynamic); err != nil {
+			return entries, err
+		}
+	}
+
+	return entries, nil
+}
+
+func validateManifest(opts *GenOptions) error {
+	if opts.Manifest == "" {
+		return nil
+	}
+
+	if !filepath.IsAbs(opts.Manifest) {
+		return fmt.Errorf("%w: Manifest '%s' is not an absolute path", ErrInvalidOptions, opts.Manifest)
+	}
+
+	for _, root := range []string{sysfsPath, devfsPath, procfsPath} {
+		if rel, err := filepath.Rel(root, opts.Manifest); err == nil && !strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("%w: Manifest '%s' is inside fake '%s' tree", ErrInvalidOptions, opts.Manifest, root)
+		}
+	}
+
+	return nil
+}
+
+// writeManifest writes the manifest of the generated fake device tree to the
+// file given with Manifest option, if any.
+func writeManifest(opts *GenOptions) error {
+	if opts.Manifest == "" {
+		return nil
+	}
+
+	manifest, err := BuildManifest(*opts)
+	if err != nil {
+		return fmt.Errorf("manifest creation failed: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = opts.fsys().WriteFile(opts.Manifest, data, fileMode); err != nil {
+		return fmt.Errorf("manifest writing failed: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyManifest checks that the fake device tree still matches the manifest
+// written to the file given with Manifest option when it was generated, and
+// that the manifest is for the same spec. Returns ErrManifestMismatch wrapping
+// error listing the differences, if they do not match.
+func VerifyManifest(opts GenOptions) error {
+	if opts.Manifest == "" {
+		return fmt.Errorf("%w: no Manifest file given", ErrInvalidOptions)
+	}
+
+	data, err := opts.fsys().ReadFile(opts.Manifest)
+	if err != nil {
+		return fmt.Errorf("reading manifest failed: %w", err)
+	}
+
+	var expected Manifest
+	if err = json.Unmarshal(data, &expected); err != nil {
+		return fmt.Errorf("manifest '%s' parsing failed: %w", opts.Manifest, err)
+	}
+
+	current, err := BuildManifest(opts)
+	if err != nil {
+		return err
+	}
+
+	if current.SpecHash != expected.SpecHash {
+		return fmt.Errorf("%w: manifest '%s' is for another spec", ErrManifestMismatch, opts.Manifest)
+	}
+
+	if diffs := diffManifestEntries(expected.Entries, current.Entries); len(diffs) > 0 {
+		if len(diffs) > maxDiffs {
+			diffs = append(diffs[:maxDiffs], fmt.Sprintf("... (%d more)", len(diffs)-maxDiffs))
+		}
+
+		return fmt.Errorf("%w: %s", ErrManifestMismatch, strings.Join(diffs, ", "))
+	}
+
+	return nil
+}
+
+// diffManifestEntries returns descriptions of missing, changed and extra entries.
+func diffManifestEntries(expected, current []ManifestEntry) []string {
+	entries := make(map[string]ManifestEntry, len(current))
+	for _, entry := range current {
+		entries[entry.Path] = entry
+	}
+
+	diffs := []string{}
+
+	for _, entry := range expected {
+		found, ok := entries[entry.Path]
+
+		switch {
+		case !ok:
+			diffs = append(diffs, "missing "+entry.Type+" '"+entry.Path+"'")
+		case found != entry:
+			diffs = append(diffs, "changed "+entry.Type+" '"+entry.Path+"'")
+		}
+
+		delete(entries, entry.Path)
+	}
+
+	extra := make([]string, 0, len(entries))
+	for path, entry := range entries {
+		extra = append(extra, "extra "+entry.Type+" '"+path+"'")
+	}
+
+	slices.Sort(extra)
+
+	return append(diffs, extra...)
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs MEI GSC SPECIFICATION (Mei option, GPU PFs only)
+//
+// sys/devices/ROOT/BDF/DRIVER.mei-KIND.ID/ (GSC auxiliary device, ID = PCI bus << 8 | devfn)
+// sys/devices/ROOT/BDF/DRIVER.mei-KIND.ID/mei/meiN/dev (MAJOR:MINOR)
+// sys/devices/ROOT/BDF/DRIVER.mei-KIND.ID/mei/meiN/kind ("gsc" or "gscfi")
+// sys/devices/ROOT/BDF/DRIVER.mei-KIND.ID/mei/meiN/fw_ver (firmware versions, "0:VERSION" lines)
+// sys/devices/ROOT/BDF/DRIVER.mei-KIND.ID/mei/meiN/{fw_status,hbm_ver,trc,tx_queue_limit}
+// sys/devices/ROOT/BDF/DRIVER.mei-KIND.ID/mei/meiN/device -> ../../../DRIVER.mei-KIND.ID
+// sys/class/mei/meiN -> ../../devices/ROOT/BDF/DRIVER.mei-KIND.ID/mei/meiN
+//---------------------------------------------------------------
+// devfs MEI GSC SPECIFICATION
+//
+// dev/meiN
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultMeiKind      = "gsc"
+	defaultMeiFwVersion = "100.3.0.1170"
+	// MEI char device major number is dynamic, this is a typical one.
+	meiMajor = 234
+)
+
+var meiKinds = []string{"gsc", "gscfi"}
+
+// MeiOptions enable the MEI GSC (graphics security controller) devices of
+// the fake GPU PFs.
+type MeiOptions struct {
+	// Kind is "gsc" (DG2 and later), or "gscfi" (GSC firmware interface).
+	Kind      string `yaml:"Kind,omitempty"`
+	FwVersion string `yaml:"FwVersion,omitempty"`
+}
+
+func validateMei(opts *GenOptions) error {
+	mei := opts.Mei
+	if mei == nil {
+		return nil
+	}
+
+	if !opts.isGpuMode() {
+		return fmt.Errorf("%w: Mei is supported only in GPU mode", ErrInvalidOptions)
+	}
+
+	if mei.Kind != "" && !slices.Contains(meiKinds, mei.Kind) {
+		return fmt.Errorf("%w: unknown Mei Kind '%s', known ones are: %v", ErrInvalidOptions, mei.Kind, meiKinds)
+	}
+
+	return nil
+}
+
+// meiIndex returns the MEI device index for device i, or -1 if it has none.
+func (opts *GenOptions) meiIndex(i int) int {
+	if opts.Mei == nil || i%(opts.VfsPerPf+1) != 0 {
+		return -1
+	}
+
+	return i / (opts.VfsPerPf + 1)
+}
+
+// meiAuxDevice returns the name of the GSC auxiliary device of device i.
+func (opts *GenOptions) meiAuxDevice(i int) string {
+	driver := "i915"
+	if opts.Driver == xeDriver {
+		driver = opts.Driver
+	}
+
+	kind := opts.Mei.Kind
+	if kind == "" {
+		kind = defaultMeiKind
+	}
+
+	_, bus, fn := opts.pciLocation(i)
+
+	return fmt.Sprintf("%s.mei-%s.%d", driver, kind, bus<<8|fn)
+}
+
+// addMeiDevice adds the MEI GSC sysfs and devfs content for device i, if
+// it is a PF and Mei option is given.
+func addMeiDevice(opts *GenOptions, i int) error {
+	index := opts.meiIndex(i)
+	if index < 0 {
+		return nil
+	}
+
+	kind := opts.Mei.Kind
+	if kind == "" {
+		kind = defaultMeiKind
+	}
+
+	version := opts.Mei.FwVersion
+	if version == "" {
+		version = defaultMeiFwVersion
+	}
+
+	aux := opts.meiAuxDevice(i)
+	name := fmt.Sprintf("mei%d", index)
+	bdf := opts.pciAddress(i)
+
+	classDir := filepath.Join(opts.pciDevicePath(i, bdf), aux, "mei", name)
+	if err := opts.fsys().MkdirAll(classDir, dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs += 3
+
+	for file, content := range map[string]string{
+		"dev":            fmt.Sprintf("%d:%d", meiMajor, index),
+		"kind":           kind,
+		"fw_ver":         strings.Repeat("0:"+version+"\n", 3),
+		"fw_status":      "00000245\n00000000\n00000000\n00000000\n00000000\n00000000\n",
+		"hbm_ver":        "2.2",
+		"trc":            "00000000",
+		"tx_queue_limit": "50",
+	} {
+		if err := writeFile(opts, filepath.Join(classDir, file), content); err != nil {
+			return err
+		}
+	}
+
+	if err := addSymlink(opts, "../../../"+aux, filepath.Join(classDir, "device")); err != nil {
+		return err
+	}
+
+	classLinks := filepath.Join(sysfsPath, "class", "mei")
+	if err := opts.fsys().MkdirAll(classLinks, dirMode); err != nil {
+		return err
+	}
+
+	target := filepath.Join("../../devices", opts.pciRoot(i), bdf, aux, "mei", name)
+	if err := addSymlink(opts, target, filepath.Join(classLinks, name)); err != nil {
+		return err
+	}
+
+	if err := opts.fsys().MkdirAll(devfsPath, dirMode); err != nil {
+		return err
+	}
+
+	return addCharDeviceNode(opts, filepath.Join(devfsPath, name), meiMajor, index)
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs i915 memory region SPECIFICATION
+//
+// sys/class/drm/cardX/device/drm/cardX/prelim_lmem_total_bytes (device memory size, number)
+// sys/class/drm/cardX/device/drm/cardX/prelim_lmem_avail_bytes (free device memory, number)
+// sys/class/drm/cardX/device/drm/cardX/memory_regions/lmem/total_bytes
+// sys/class/drm/cardX/device/drm/cardX/memory_regions/lmem/avail_bytes
+// sys/class/drm/cardX/device/drm/cardX/memory_regions/smem/total_bytes
+// sys/class/drm/cardX/device/drm/cardX/memory_regions/smem/avail_bytes
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// MemRegionOptions are the sizes for the i915 memory region files of a fake
+// device. Device (lmem) region total size is the device memory size.
+type MemRegionOptions struct {
+	LmemAvail int `yaml:"LmemAvail"` // defaults to device memory size
+	SmemTotal int `yaml:"SmemTotal"`
+	SmemAvail int `yaml:"SmemAvail"` // defaults to SmemTotal
+}
+
+func (regions *MemRegionOptions) validate(lmemTotal int) error {
+	if regions == nil {
+		return nil
+	}
+
+	if regions.LmemAvail < 0 || regions.LmemAvail > lmemTotal {
+		return fmt.Errorf("%w: LmemAvail (%d) not within 0-%d", ErrInvalidOptions, regions.LmemAvail, lmemTotal)
+	}
+
+	if regions.SmemAvail < 0 || regions.SmemAvail > regions.SmemTotal {
+		return fmt.Errorf("%w: SmemAvail (%d) not within 0-%d", ErrInvalidOptions, regions.SmemAvail, regions.SmemTotal)
+	}
+
+	return nil
+}
+
+func addSysfsMemRegions(root string, opts *GenOptions, i int) error {
+	dev := opts.device(i)
+	if dev.MemRegions == nil {
+		return nil
+	}
+
+	card := opts.cardName(i)
+	base := filepath.Join(root, "class", "drm", card, "device", "drm", card)
+
+	lmemAvail := dev.MemRegions.LmemAvail
+	if lmemAvail == 0 {
+		lmemAvail = dev.DevMemSize
+	}
+
+	smemAvail := dev.MemRegions.SmemAvail
+	if smemAvail == 0 {
+		smemAvail = dev.MemRegions.SmemTotal
+	}
+
+	if err := writeFile(opts, filepath.Join(base, "prelim_lmem_total_bytes"), strconv.Itoa(dev.DevMemSize)); err != nil {
+		return err
+	}
+
+	if err := writeFile(opts, filepath.Join(base, "prelim_lmem_avail_bytes"), strconv.Itoa(lmemAvail)); err != nil {
+		return err
+	}
+
+	for _, region := range []struct {
+		name         string
+		total, avail int
+	}{
+		{"lmem", dev.DevMemSize, lmemAvail},
+		{"smem", dev.MemRegions.SmemTotal, smemAvail},
+	} {
+		path := filepath.Join(base, "memory_regions", region.name)
+		if err := opts.fsys().MkdirAll(path, dirMode); err != nil {
+			return err
+		}
+
+		opts.dirs++
+
+		if err := writeFile(opts, filepath.Join(path, "total_bytes"), strconv.Itoa(region.total)); err != nil {
+			return err
+		}
+
+		if err := writeFile(opts, filepath.Join(path, "avail_bytes"), strconv.Itoa(region.avail)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
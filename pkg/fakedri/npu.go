@@ -0,0 +1,111 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs NPU SPECIFICATION (Mode: npu)
+//
+// PCI device dirs bound to "intel_vpu" driver (see pci.go), with:
+// sys/devices/ROOT/BDF/npu_busy_time_us (0)
+// sys/devices/ROOT/BDF/accel/accelX/dev (MAJOR:MINOR)
+// sys/devices/ROOT/BDF/accel/accelX/device -> ../../../BDF
+// sys/class/accel/accelX -> ../../devices/ROOT/BDF/accel/accelX
+//---------------------------------------------------------------
+// devfs NPU SPECIFICATION
+//
+// dev/accel/accelX
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+const (
+	npuDriver          = "intel_vpu"
+	defaultNpuDeviceID = "0x7d1d" // Meteor Lake
+	// DRM accel subsystem char device major number.
+	accelMajor = 261
+)
+
+func (opts *GenOptions) setNpuDefaults() {
+	if opts.Driver == "" {
+		opts.Driver = npuDriver
+	}
+
+	if opts.DeviceID == "" {
+		opts.DeviceID = defaultNpuDeviceID
+	}
+}
+
+func validateNpu(opts *GenOptions) error {
+	if opts.Mode != modeNpu {
+		return nil
+	}
+
+	if opts.VfsPerPf > 0 || opts.TilesPerDev > 0 || opts.DevMemSize > 0 || opts.Hwmon != nil || opts.Freq != nil ||
+		opts.MemRegions != nil || opts.XeLinks != nil || len(opts.Clients) > 0 {
+		return fmt.Errorf("%w: SR-IOV or GPU specific options given for NPU mode", ErrInvalidOptions)
+	}
+
+	return nil
+}
+
+// addNpuDevice generates the sysfs and devfs content for NPU device i.
+func addNpuDevice(opts *GenOptions, i int) error {
+	bdf := fmt.Sprintf("0000:%02x:0b.0", i)
+	name := fmt.Sprintf("accel%d", i)
+
+	base, err := addPciDeviceDir(opts, i, bdf, opts.Driver)
+	if err != nil {
+		return err
+	}
+
+	if err = writeFile(opts, filepath.Join(base, "npu_busy_time_us"), "0"); err != nil {
+		return err
+	}
+
+	classDir := filepath.Join(base, "accel", name)
+	if err = opts.fsys().MkdirAll(classDir, dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs++
+
+	if err = writeFile(opts, filepath.Join(classDir, "dev"), fmt.Sprintf("%d:%d", accelMajor, i)); err != nil {
+		return err
+	}
+
+	if err = addSymlink(opts, "../../../"+bdf, filepath.Join(classDir, "device")); err != nil {
+		return err
+	}
+
+	classLinks := filepath.Join(sysfsPath, "class", "accel")
+	if err = opts.fsys().MkdirAll(classLinks, dirMode); err != nil {
+		return err
+	}
+
+	target := filepath.Join("../../devices", opts.pciRoot(i), bdf, "accel", name)
+	if err = addSymlink(opts, target, filepath.Join(classLinks, name)); err != nil {
+		return err
+	}
+
+	devDir := filepath.Join(devfsPath, "accel")
+	if err = opts.fsys().MkdirAll(devDir, dirMode); err != nil {
+		return err
+	}
+
+	return addCharDeviceNode(opts, filepath.Join(devDir, name), accelMajor, i)
+}
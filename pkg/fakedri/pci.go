@@ -0,0 +1,235 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs PCI device SPECIFICATION (non-GPU modes)
+//
+// sys/devices/ROOT/BDF/{vendor,device,revision,numa_node}
+// sys/devices/ROOT/BDF/{config,resource,*_link_*} (see pcie.go)
+// sys/devices/ROOT/BDF/driver -> ../../../bus/pci/drivers/DRIVER
+// sys/bus/pci/devices/BDF -> ../../../devices/ROOT/BDF
+// sys/bus/pci/drivers/DRIVER/BDF -> ../../../../devices/ROOT/BDF
+// sys/bus/pci/drivers/DRIVER/{bind,unbind,new_id}
+//
+// ROOT is the PCI root bus dir, e.g. pci0000:00 (see topology.go).
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// VFs are placed after their PF on the same bus, 8 functions per PCI device.
+	pciFunctions      = 8
+	pciDevices        = 32
+	pciBuses          = 256
+	pciDomains        = 0x10000
+	defaultPciAddress = "0000:01:00.0"
+)
+
+var pciAddressRE = regexp.MustCompile(`^([0-9a-f]{4}):([0-9a-f]{2}):([01][0-9a-f])\.([0-7])$`)
+
+// pciBase returns the domain, bus and function index (device * 8 + function)
+// of the PciAddress option, or of the default address if it's invalid / unset.
+func (opts *GenOptions) pciBase() (domain, bus, fn int) {
+	match := pciAddressRE.FindStringSubmatch(opts.PciAddress)
+	if match == nil {
+		match = pciAddressRE.FindStringSubmatch(defaultPciAddress)
+	}
+
+	values := make([]int, 4)
+	for i, value := range match[1:] {
+		parsed, _ := strconv.ParseInt(value, 16, 32)
+		values[i] = int(parsed)
+	}
+
+	return values[0], values[1], values[2]*pciFunctions + values[3]
+}
+
+// pciLocation returns the domain, bus and function index of device i. Starting
+// from the PciAddress option, or from the PCI root bus of the device NUMA node
+// (see topology.go), each PF has a bus of its own, with its SR-IOV VFs
+// following it on the same bus.
+func (opts *GenOptions) pciLocation(i int) (domain, bus, fn int) {
+	domain, bus, fn = opts.pciBase()
+
+	pf := i / (opts.VfsPerPf + 1)
+	fn += i % (opts.VfsPerPf + 1)
+
+	if rootDomain, rootBus, nth, ok := opts.pciRootBus(pf); ok {
+		return rootDomain, rootBus + 1 + nth, fn
+	}
+
+	bus += pf
+
+	return domain + bus/pciBuses, bus % pciBuses, fn
+}
+
+// pciAddress returns the PCI BDF address of device i.
+func (opts *GenOptions) pciAddress(i int) string {
+	domain, bus, fn := opts.pciLocation(i)
+
+	return fmt.Sprintf("%04x:%02x:%02x.%d", domain, bus, fn/pciFunctions, fn%pciFunctions)
+}
+
+// pciRoot returns the PCI root bus dir name for device i.
+func (opts *GenOptions) pciRoot(i int) string {
+	pf := i / (opts.VfsPerPf + 1)
+	if domain, bus, _, ok := opts.pciRootBus(pf); ok {
+		return fmt.Sprintf("pci%04x:%02x", domain, bus)
+	}
+
+	if !opts.hasPciLayout() {
+		return "pci0000:00"
+	}
+
+	domain, _, _ := opts.pciLocation(i)
+
+	return fmt.Sprintf("pci%04x:00", domain)
+}
+
+// pciDevicePath returns the sysfs path of the PCI device dir for device i,
+// with given BDF address.
+func (opts *GenOptions) pciDevicePath(i int, bdf string) string {
+	return filepath.Join(sysfsPath, "devices", opts.pciRoot(i), bdf)
+}
+
+func validatePciAddress(opts *GenOptions) error {
+	if opts.PciAddress == "" {
+		return nil
+	}
+
+	if !opts.hasPciLayout() {
+		return fmt.Errorf("%w: PciAddress is not supported in '%s' mode", ErrInvalidOptions, opts.Mode)
+	}
+
+	if !pciAddressRE.MatchString(opts.PciAddress) {
+		return fmt.Errorf("%w: PciAddress '%s' is not a (lower case) PCI address, e.g. '%s'",
+			ErrInvalidOptions, opts.PciAddress, defaultPciAddress)
+	}
+
+	domain, bus, fn := opts.pciBase()
+	if fn+opts.VfsPerPf >= pciDevices*pciFunctions {
+		return fmt.Errorf("%w: VFs of PciAddress '%s' device do not fit to its bus", ErrInvalidOptions, opts.PciAddress)
+	}
+
+	if last := bus + (opts.DevCount-1)/(opts.VfsPerPf+1); domain+last/pciBuses >= pciDomains {
+		return fmt.Errorf("%w: %d devices starting from PciAddress '%s' do not fit to PCI address space",
+			ErrInvalidOptions, opts.DevCount, opts.PciAddress)
+	}
+
+	return nil
+}
+
+// addSymlink creates and counts a new symlink.
+func addSymlink(opts *GenOptions, target, link string) error {
+	if err := opts.fsys().Symlink(target, link); err != nil {
+		return fmt.Errorf("symlink creation failed '%s': %w", link, err)
+	}
+
+	opts.symls++
+
+	return nil
+}
+
+// addPciDriverDir adds the PCI driver dir with its (no-op) control files,
+// unless it exists already (e.g. added by another generation worker).
+func addPciDriverDir(opts *GenOptions, driver string) error {
+	drivers := filepath.Join(sysfsPath, "bus", "pci", "drivers")
+	if err := opts.fsys().MkdirAll(drivers, dirMode); err != nil {
+		return err
+	}
+
+	base := filepath.Join(drivers, driver)
+	if err := opts.fsys().Mkdir(base, dirMode); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	opts.dirs++
+
+	for _, name := range []string{"bind", "unbind", "new_id"} {
+		if err := writeFile(opts, filepath.Join(base, name), ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasPciLayout tells whether the mode devices are laid out according to the
+// PciAddress and Topology options.
+func (opts *GenOptions) hasPciLayout() bool {
+	return opts.isGpuMode() || opts.Mode == modeQat || opts.Mode == modeDlb
+}
+
+// addPciDeviceDir adds the PCI device dir for device i with given BDF address,
+// bound to given driver, and returns its path.
+func addPciDeviceDir(opts *GenOptions, i int, bdf, driver string) (string, error) {
+	dev := opts.device(i)
+	root := opts.pciRoot(i)
+	base := opts.pciDevicePath(i, bdf)
+
+	if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
+		return "", err
+	}
+
+	opts.dirs++
+
+	if err := addPciDriverDir(opts, driver); err != nil {
+		return "", err
+	}
+
+	if err := opts.fsys().MkdirAll(filepath.Join(sysfsPath, "bus", "pci", "devices"), dirMode); err != nil {
+		return "", err
+	}
+
+	for link, target := range map[string]string{
+		filepath.Join(base, "driver"):                                  "../../../bus/pci/drivers/" + driver,
+		filepath.Join(sysfsPath, "bus", "pci", "devices", bdf):         "../../../devices/" + root + "/" + bdf,
+		filepath.Join(sysfsPath, "bus", "pci", "drivers", driver, bdf): "../../../../devices/" + root + "/" + bdf,
+	} {
+		if err := addSymlink(opts, target, link); err != nil {
+			return "", err
+		}
+	}
+
+	if err := writeFile(opts, filepath.Join(base, "vendor"), dev.Vendor); err != nil {
+		return "", err
+	}
+
+	if err := writeFile(opts, filepath.Join(base, "numa_node"), strconv.Itoa(*dev.NumaNode)); err != nil {
+		return "", err
+	}
+
+	if err := addLocalCpulist(base, opts, *dev.NumaNode); err != nil {
+		return "", err
+	}
+
+	if err := addPciIDFiles(base, opts, dev); err != nil {
+		return "", err
+	}
+
+	return base, addPciConfigFiles(base, opts, dev, i)
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs PCI config space and PCIe link SPECIFICATION (all PCI devices)
+//
+// sys/devices/ROOT/BDF/config (256 byte config space header with PCIe capability, binary)
+// sys/devices/ROOT/BDF/resource (BAR start, end and flags lines, hex)
+// sys/devices/ROOT/BDF/{max,current}_link_speed (e.g. "16.0 GT/s PCIe")
+// sys/devices/ROOT/BDF/{max,current}_link_width (lane count, number)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	pciConfigSize   = 256
+	pciResources    = 13 // BARs, ROM and SR-IOV BARs listed in the resource file
+	pcieCapOffset   = 0x40
+	pcieCapID       = 0x10
+	defaultPcieRate = "16.0"
+	defaultPcieLane = 16
+
+	// Each device gets a 1 GiB MMIO window, with 16 MiB register BAR0
+	// and 256 MiB prefetchable (e.g. GPU local memory) BAR2.
+	pciMmioBase     = 0x4000000000
+	pciMmioWindow   = 1 << 30
+	pciBar0Size     = 16 * mib
+	pciBar2Offset   = 512 * mib
+	pciBar2Size     = 256 * mib
+	pciMem64Flags   = 0x140204
+	pciPrefetchFlag = 0x2008
+)
+
+// pcieSpeeds lists the PCIe link speeds (GT/s), in Link Capabilities
+// register encoding order starting from 1.
+var pcieSpeeds = []string{"2.5", "5.0", "8.0", "16.0", "32.0", "64.0"}
+
+var pcieWidths = []int{1, 2, 4, 8, 12, 16, 32}
+
+// pciClasses are the PCI class codes of the device modes.
+var pciClasses = map[string]uint32{
+	modeGpu: 0x030000, // VGA compatible display controller
+	modeQat: 0x0b4000, // co-processor
+	modeDsa: 0x088000, // other system peripheral
+	modeIaa: 0x088000,
+	modeDlb: 0x0b4000,
+	modeNpu: 0x120000, // processing accelerator
+}
+
+// PcieOptions are the PCIe link speed (in GT/s, e.g. "16.0") and width
+// (lanes) of a fake device, maximum ones defaulting to the current ones.
+type PcieOptions struct {
+	Speed    string `yaml:"Speed,omitempty"`
+	MaxSpeed string `yaml:"MaxSpeed,omitempty"`
+	Width    int    `yaml:"Width,omitempty"`
+	MaxWidth int    `yaml:"MaxWidth,omitempty"`
+}
+
+// link returns the current and max link speed codes and widths.
+func (pcie *PcieOptions) link() (speed, maxSpeed, width, maxWidth int) {
+	link := PcieOptions{Speed: defaultPcieRate, Width: defaultPcieLane}
+	if pcie != nil {
+		link = *pcie
+	}
+
+	if link.Speed == "" {
+		link.Speed = defaultPcieRate
+	}
+
+	if link.MaxSpeed == "" {
+		link.MaxSpeed = link.Speed
+	}
+
+	if link.Width == 0 {
+		link.Width = defaultPcieLane
+	}
+
+	if link.MaxWidth == 0 {
+		link.MaxWidth = link.Width
+	}
+
+	return slices.Index(pcieSpeeds, link.Speed) + 1, slices.Index(pcieSpeeds, link.MaxSpeed) + 1, link.Width, link.MaxWidth
+}
+
+func (pcie *PcieOptions) validate() error {
+	if pcie == nil {
+		return nil
+	}
+
+	for _, speed := range []string{pcie.Speed, pcie.MaxSpeed} {
+		if speed != "" && !slices.Contains(pcieSpeeds, speed) {
+			return fmt.Errorf("%w: unknown Pcie link speed '%s' GT/s, known ones are: %v", ErrInvalidOptions, speed, pcieSpeeds)
+		}
+	}
+
+	for _, width := range []int{pcie.Width, pcie.MaxWidth} {
+		if width != 0 && !slices.Contains(pcieWidths, width) {
+			return fmt.Errorf("%w: invalid Pcie link width %d, valid ones are: %v", ErrInvalidOptions, width, pcieWidths)
+		}
+	}
+
+	speed, maxSpeed, width, maxWidth := pcie.link()
+	if speed > maxSpeed || width > maxWidth {
+		return fmt.Errorf("%w: Pcie link speed / width over their max", ErrInvalidOptions)
+	}
+
+	return nil
+}
+
+func validatePcie(opts *GenOptions) error {
+	given := opts.Pcie != nil
+
+	for i, dev := range opts.Devices {
+		if err := dev.Pcie.validate(); err != nil {
+			return fmt.Errorf("Devices[%d]: %w", i, err)
+		}
+
+		given = given || dev.Pcie != nil
+	}
+
+	if given && opts.Mode == modeSgx {
+		return fmt.Errorf("%w: Pcie options given for SGX mode", ErrInvalidOptions)
+	}
+
+	return opts.Pcie.validate()
+}
+
+// pciConfig returns the PCI config space content for given device.
+func pciConfig(opts *GenOptions, dev DeviceOptions, bar0, bar2 uint64) []byte {
+	config := make([]byte, pciConfigSize)
+	le := binary.LittleEndian
+
+	vendorID, _ := strconv.ParseUint(strings.TrimPrefix(dev.Vendor, "0x"), 16, 16)
+	deviceID, _ := strconv.ParseUint(strings.TrimPrefix(dev.DeviceID, "0x"), 16, 16)
+	revision, _ := strconv.ParseUint(strings.TrimPrefix(dev.Revision, "0x"), 16, 8)
+
+	class := pciClasses[opts.Mode]
+	if opts.isGpuMode() {
+		class = pciClasses[modeGpu]
+	}
+
+	le.PutUint16(config[0x00:], uint16(vendorID))
+	le.PutUint16(config[0x02:], uint16(deviceID))
+	le.PutUint16(config[0x04:], 0x0006) // memory space and bus master enabled
+	le.PutUint16(config[0x06:], 0x0010) // capability list
+	le.PutUint32(config[0x08:], class<<8|uint32(revision))
+	le.PutUint64(config[0x10:], bar0|0x4)             // 64-bit BAR0
+	le.PutUint64(config[0x18:], bar2|0xc)             // 64-bit prefetchable BAR2
+	le.PutUint16(config[0x2c:], uint16(vendorID))     // subsystem vendor
+	le.PutUint16(config[0x2e:], uint16(deviceID))     // subsystem
+	config[0x34] = pcieCapOffset                      // capabilities pointer
+	le.PutUint16(config[pcieCapOffset:], pcieCapID)   // PCIe capability, no next one
+	le.PutUint16(config[pcieCapOffset+0x02:], 0x0002) // version 2 endpoint
+
+	speed, maxSpeed, width, maxWidth := dev.Pcie.link()
+	le.PutUint32(config[pcieCapOffset+0x0c:], uint32(maxSpeed|maxWidth<<4)) // link capabilities
+	le.PutUint16(config[pcieCapOffset+0x12:], uint16(speed|width<<4))       // link status
+
+	return config
+}
+
+// addPciConfigFiles adds the PCI config space, resource and PCIe link files
+// for device i to given PCI device dir.
+func addPciConfigFiles(base string, opts *GenOptions, dev DeviceOptions, i int) error {
+	bar0 := uint64(pciMmioBase) + uint64(i)*pciMmioWindow
+	bar2 := bar0 + pciBar2Offset
+
+	resources := make([]string, pciResources)
+	for r := range resources {
+		resources[r] = fmt.Sprintf("0x%016x 0x%016x 0x%016x", 0, 0, 0)
+	}
+
+	resources[0] = fmt.Sprintf("0x%016x 0x%016x 0x%016x", bar0, bar0+pciBar0Size-1, pciMem64Flags)
+	resources[2] = fmt.Sprintf("0x%016x 0x%016x 0x%016x", bar2, bar2+pciBar2Size-1, pciMem64Flags|pciPrefetchFlag)
+
+	speed, maxSpeed, width, maxWidth := dev.Pcie.link()
+
+	for name, value := range map[string]string{
+		"resource":           strings.Join(resources, "\n") + "\n",
+		"max_link_speed":     pcieSpeeds[maxSpeed-1] + " GT/s PCIe",
+		"current_link_speed": pcieSpeeds[speed-1] + " GT/s PCIe",
+		"max_link_width":     strconv.Itoa(maxWidth),
+		"current_link_width": strconv.Itoa(width),
+	} {
+		if err := writeFile(opts, filepath.Join(base, name), value); err != nil {
+			return err
+		}
+	}
+
+	if err := opts.fsys().WriteFile(filepath.Join(base, "config"), pciConfig(opts, dev, bar0, bar2), fileMode); err != nil {
+		return err
+	}
+
+	opts.files++
+
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs i915 prelim SR-IOV provisioning SPECIFICATION (PrelimIov option, PFs only)
+//
+// sys/class/drm/cardX/prelim_iov/pf/auto_provisioning (1 unless Manual, number)
+// sys/class/drm/cardX/prelim_iov/pf/gtN/{exec_quantum_ms,preempt_timeout_us} (PF scheduling, number)
+// sys/class/drm/cardX/prelim_iov/pf/gtN/available/{ggtt,lmem,contexts,doorbells}_max_quota (VF resources, number)
+// sys/class/drm/cardX/prelim_iov/pf/gtN/available/{ggtt,lmem}_free (not provisioned to VFs, number)
+// sys/class/drm/cardX/prelim_iov/vfM/gtN/{ggtt,lmem,contexts,doorbells}_quota (VF M resources, 0 if Manual, number)
+// sys/class/drm/cardX/prelim_iov/vfM/gtN/{exec_quantum_ms,preempt_timeout_us} (VF M scheduling, number)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// GGTT address space, GuC contexts and doorbells available for the VFs.
+	iovGgttSize  = 4*1024*mib - 64*mib
+	iovContexts  = 65535 - 1024
+	iovDoorbells = 256 - 16
+)
+
+// PrelimIovOptions are the values for the i915 prelim SR-IOV provisioning
+// files of the fake PF devices.
+type PrelimIovOptions struct {
+	ExecQuantumMs    int `yaml:"ExecQuantumMs,omitempty"`
+	PreemptTimeoutUs int `yaml:"PreemptTimeoutUs,omitempty"`
+	// Manual provisioning leaves the VF quotas to 0 (with auto-provisioning
+	// disabled), instead of PF resources being split evenly between VFs.
+	Manual bool `yaml:"Manual,omitempty"`
+}
+
+func validatePrelimIov(opts *GenOptions) error {
+	iov := opts.PrelimIov
+	if iov == nil {
+		return nil
+	}
+
+	if !opts.isGpuMode() || opts.VfsPerPf <= 0 {
+		return fmt.Errorf("%w: PrelimIov requires GPU mode with VfsPerPf", ErrInvalidOptions)
+	}
+
+	if iov.ExecQuantumMs < 0 || iov.PreemptTimeoutUs < 0 {
+		return fmt.Errorf("%w: PrelimIov ExecQuantumMs (%d) and PreemptTimeoutUs (%d) must not be negative",
+			ErrInvalidOptions, iov.ExecQuantumMs, iov.PreemptTimeoutUs)
+	}
+
+	return nil
+}
+
+// addPrelimIovFiles adds the prelim SR-IOV provisioning files for device i,
+// if it is a PF and PrelimIov option is given.
+func addPrelimIovFiles(root string, opts *GenOptions, i int) error {
+	iov := opts.PrelimIov
+	if iov == nil || opts.VfsPerPf <= 0 || i%(opts.VfsPerPf+1) != 0 {
+		return nil
+	}
+
+	dev := opts.device(i)
+	vfs := opts.VfsPerPf
+	base := filepath.Join(root, "class", "drm", opts.cardName(i), "prelim_iov")
+
+	maxQuotas := map[string]int{
+		"ggtt":      iovGgttSize,
+		"lmem":      dev.DevMemSize,
+		"contexts":  iovContexts,
+		"doorbells": iovDoorbells,
+	}
+
+	auto := "1"
+	if iov.Manual {
+		auto = "0"
+	}
+
+	files := map[string]string{
+		"pf/auto_provisioning": auto,
+	}
+
+	for gt := 0; gt < max(dev.TilesPerDev, 1); gt++ {
+		gtName := fmt.Sprintf("gt%d", gt)
+
+		files[filepath.Join("pf", gtName, "exec_quantum_ms")] = "0"
+		files[filepath.Join("pf", gtName, "preempt_timeout_us")] = "0"
+
+		for resource, total := range maxQuotas {
+			isMemory := resource == "ggtt" || resource == "lmem"
+
+			quota := 0
+			if !iov.Manual {
+				quota = total / vfs
+			}
+
+			if isMemory {
+				quota = quota / mib * mib
+			}
+
+			files[filepath.Join("pf", gtName, "available", resource+"_max_quota")] = strconv.Itoa(total)
+
+			if isMemory {
+				files[filepath.Join("pf", gtName, "available", resource+"_free")] = strconv.Itoa(total - quota*vfs)
+			}
+
+			for vf := 1; vf <= vfs; vf++ {
+				files[filepath.Join(fmt.Sprintf("vf%d", vf), gtName, resource+"_quota")] = strconv.Itoa(quota)
+			}
+		}
+
+		for vf := 1; vf <= vfs; vf++ {
+			files[filepath.Join(fmt.Sprintf("vf%d", vf), gtName, "exec_quantum_ms")] = strconv.Itoa(iov.ExecQuantumMs)
+			files[filepath.Join(fmt.Sprintf("vf%d", vf), gtName, "preempt_timeout_us")] = strconv.Itoa(iov.PreemptTimeoutUs)
+		}
+	}
+
+	dirs := map[string]bool{}
+
+	for name, content := range files {
+		path := filepath.Join(base, name)
+
+		if dir := filepath.Dir(path); !dirs[dir] {
+			if err := opts.fsys().MkdirAll(dir, dirMode); err != nil {
+				return err
+			}
+
+			dirs[dir] = true
+		}
+
+		if err := writeFile(opts, path, content); err != nil {
+			return err
+		}
+	}
+
+	// prelim_iov and vfM dirs, in addition to the ones containing files.
+	opts.dirs += 1 + vfs + len(dirs)
+
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs QAT SPECIFICATION (Mode: qat)
+//
+// PCI device dirs for the PFs and VFs (see pci.go), with:
+// sys/devices/ROOT/BDF/qat/state (PF only, "up" or "down")
+// sys/devices/ROOT/BDF/qat/cfg_services (PF only, e.g. "sym;asym")
+// sys/devices/ROOT/BDF/sriov_numvfs (PF only, number of VFs)
+// sys/devices/ROOT/BDF/sriov_totalvfs (PF only, max number of VFs)
+// sys/devices/ROOT/BDF/virtfnN -> ../VF-BDF (PF only)
+// sys/devices/ROOT/BDF/physfn -> ../PF-BDF (VF only)
+// sys/devices/ROOT/BDF/iommu_group -> ../../../kernel/iommu_groups/N (VF only)
+// sys/kernel/iommu_groups/N/
+// sys/kernel/debug/qat_DRIVER_BDF/heartbeat/status (PF only, 0 or -1)
+//---------------------------------------------------------------
+// devfs QAT SPECIFICATION
+//
+// dev/vfio/vfio
+// dev/vfio/N (VFs bound to vfio-pci)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultQatDriver   = "4xxx"
+	defaultQatDeviceID = "0x4940"
+	defaultQatVfID     = "0x4941"
+	defaultQatVfDriver = "vfio-pci"
+	defaultQatState    = "up"
+	defaultQatServices = "sym;asym"
+)
+
+// QatOptions describe the QAT specific options for the "qat" mode.
+type QatOptions struct {
+	State     string `yaml:"State,omitempty"`
+	Services  string `yaml:"Services,omitempty"`
+	VfDriver  string `yaml:"VfDriver,omitempty"`
+	Unhealthy []int  `yaml:"Unhealthy,omitempty"`
+}
+
+func (opts *GenOptions) setQatDefaults() {
+	if opts.Qat == nil {
+		opts.Qat = &QatOptions{}
+	}
+
+	if opts.Driver == "" {
+		opts.Driver = defaultQatDriver
+	}
+
+	if opts.DeviceID == "" {
+		opts.DeviceID = defaultQatDeviceID
+	}
+
+	if opts.VfDeviceID == "" {
+		opts.VfDeviceID = defaultQatVfID
+	}
+
+	if opts.Qat.VfDriver == "" {
+		opts.Qat.VfDriver = defaultQatVfDriver
+	}
+
+	if opts.Qat.State == "" {
+		opts.Qat.State = defaultQatState
+	}
+
+	if opts.Qat.Services == "" {
+		opts.Qat.Services = defaultQatServices
+	}
+}
+
+func validateQat(opts *GenOptions) error {
+	if opts.Mode != modeQat {
+		if opts.Qat != nil {
+			return fmt.Errorf("%w: Qat options given for '%s' mode", ErrInvalidOptions, opts.Mode)
+		}
+
+		return nil
+	}
+
+	if opts.VfsPerPf < 1 {
+		return fmt.Errorf("%w: QAT mode requires VfsPerPf >= 1", ErrInvalidOptions)
+	}
+
+	if opts.TilesPerDev > 0 || opts.DevMemSize > 0 || opts.Hwmon != nil || opts.Freq != nil || opts.MemRegions != nil ||
+		opts.XeLinks != nil || len(opts.Clients) > 0 {
+		return fmt.Errorf("%w: GPU specific options given for QAT mode", ErrInvalidOptions)
+	}
+
+	if opts.Qat == nil {
+		return nil
+	}
+
+	if state := opts.Qat.State; state != "" && state != "up" && state != "down" {
+		return fmt.Errorf("%w: QAT State '%s' is not 'up' or 'down'", ErrInvalidOptions, state)
+	}
+
+	for _, service := range strings.Split(opts.Qat.Services, ";") {
+		switch service {
+		case "", "sym", "asym", "dc":
+		default:
+			return fmt.Errorf("%w: unknown QAT service '%s' in '%s'", ErrInvalidOptions, service, opts.Qat.Services)
+		}
+	}
+
+	for _, i := range opts.Qat.Unhealthy {
+		if i < 0 || i >= opts.DevCount || i%(opts.VfsPerPf+1) != 0 {
+			return fmt.Errorf("%w: Unhealthy QAT device %d is not a PF index", ErrInvalidOptions, i)
+		}
+	}
+
+	return nil
+}
+
+// addQatDevice generates the sysfs, debugfs and devfs content for QAT device i.
+func addQatDevice(opts *GenOptions, i int) error {
+	bdf := opts.pciAddress(i)
+	pf := i - i%(opts.VfsPerPf+1)
+
+	driver := opts.Driver
+	if i != pf {
+		driver = opts.Qat.VfDriver
+	}
+
+	base, err := addPciDeviceDir(opts, i, bdf, driver)
+	if err != nil {
+		return err
+	}
+
+	if i == pf {
+		return addQatPfFiles(base, opts, i)
+	}
+
+	return addQatVfFiles(base, opts, i, pf)
+}
+
+func addQatPfFiles(base string, opts *GenOptions, i int) error {
+	if err := opts.fsys().Mkdir(filepath.Join(base, "qat"), dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs++
+
+	totalVfs := opts.TotalVfs
+	if totalVfs == 0 {
+		totalVfs = opts.VfsPerPf
+	}
+
+	for name, value := range map[string]string{
+		"qat/state":        opts.Qat.State,
+		"qat/cfg_services": opts.Qat.Services,
+		"sriov_numvfs":     strconv.Itoa(opts.VfsPerPf),
+		"sriov_totalvfs":   strconv.Itoa(totalVfs),
+	} {
+		if err := writeFile(opts, filepath.Join(base, name), value); err != nil {
+			return err
+		}
+	}
+
+	for vf := 0; vf < opts.VfsPerPf; vf++ {
+		link := filepath.Join(base, fmt.Sprintf("virtfn%d", vf))
+		if err := addSymlink(opts, "../"+opts.pciAddress(i+1+vf), link); err != nil {
+			return err
+		}
+	}
+
+	debugfs := filepath.Join(sysfsPath, "kernel", "debug",
+		fmt.Sprintf("qat_%s_%s", opts.Driver, opts.pciAddress(i)), "heartbeat")
+	if err := opts.fsys().MkdirAll(debugfs, dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs++
+
+	status := "0"
+	if hasFault(opts.Qat.Unhealthy, i) {
+		status = "-1"
+	}
+
+	return writeFile(opts, filepath.Join(debugfs, "status"), status)
+}
+
+func addQatVfFiles(base string, opts *GenOptions, i, pf int) error {
+	if err := addSymlink(opts, "../"+opts.pciAddress(pf), filepath.Join(base, "physfn")); err != nil {
+		return err
+	}
+
+	group := strconv.Itoa(i)
+	if err := opts.fsys().MkdirAll(filepath.Join(sysfsPath, "kernel", "iommu_groups", group), dirMode); err != nil {
+		return err
+	}
+
+	opts.dirs++
+
+	if err := addSymlink(opts, "../../../kernel/iommu_groups/"+group, filepath.Join(base, "iommu_group")); err != nil {
+		return err
+	}
+
+	if opts.Qat.VfDriver != defaultQatVfDriver {
+		return nil
+	}
+
+	return addVfioNodes(devfsPath, opts, group)
+}
+
+// addVfioNodes adds the VFIO control node and the node for given IOMMU group.
+func addVfioNodes(root string, opts *GenOptions, group string) error {
+	base := filepath.Join(root, "vfio")
+	if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"vfio", group} {
+		// VFIO control node is shared by all the VFs.
+		err := addNullDeviceNode(opts, filepath.Join(base, name))
+		if err != nil && !(name == "vfio" && errors.Is(err, fs.ErrExist)) {
+			return err
+		}
+	}
+
+	return nil
+}
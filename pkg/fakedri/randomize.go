@@ -0,0 +1,163 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+const (
+	// maxRandomDevs limits the number of randomized devices, as Xe Links
+	// between all their tiles are considered.
+	maxRandomDevs  = 256
+	maxRandomTiles = 8
+)
+
+// RandomizeOptions describe ranges for a reproducible pseudo-random GPU
+// topology, which is used instead of the DevCount and Devices options.
+type RandomizeOptions struct {
+	DevCount    IntRange `yaml:"DevCount,omitempty"`
+	DevMemSize  IntRange `yaml:"DevMemSize,omitempty"` // rounded down to MiB
+	TilesPerDev IntRange `yaml:"TilesPerDev,omitempty"`
+	// Seed for the pseudo-random numbers, same seed gives same topology.
+	Seed uint64 `yaml:"Seed,omitempty"`
+	// LinkDensity is the probability (0-1) of an Xe Link between tiles of
+	// two different devices.
+	LinkDensity float64 `yaml:"LinkDensity,omitempty"`
+}
+
+// IntRange is an inclusive range of integers. Max defaults to Min.
+type IntRange struct {
+	Min int `yaml:"Min,omitempty"`
+	Max int `yaml:"Max,omitempty"`
+}
+
+func (r IntRange) max() int {
+	return max(r.Min, r.Max)
+}
+
+func (r IntRange) random(rnd *rand.Rand) int {
+	return r.Min + rnd.IntN(r.max()-r.Min+1)
+}
+
+// randomize generates the devices, and unless given, their Xe Links from the
+// Randomize options. Nothing is generated if DevCount or Devices are given
+// (which validation rejects).
+func (opts *GenOptions) randomize() {
+	random := opts.Randomize
+	if random == nil || opts.DevCount > 0 || len(opts.Devices) > 0 || random.validate() != nil {
+		return
+	}
+
+	rnd := rand.New(rand.NewPCG(random.Seed, random.Seed))
+
+	devCount := IntRange{Min: max(random.DevCount.Min, 1), Max: random.DevCount.Max}
+	tiles := IntRange{Min: max(random.TilesPerDev.Min, 1), Max: random.TilesPerDev.Max}
+
+	opts.DevCount = devCount.random(rnd)
+	opts.Devices = make([]DeviceOptions, opts.DevCount)
+
+	for i := range opts.Devices {
+		dev := &opts.Devices[i]
+		dev.Count = 1
+		dev.TilesPerDev = tiles.random(rnd)
+
+		if random.DevMemSize.max() > 0 {
+			dev.DevMemSize = random.DevMemSize.random(rnd) / mib * mib
+		}
+	}
+
+	if random.LinkDensity <= 0 || opts.XeLinks != nil {
+		return
+	}
+
+	links := []XeLink{}
+
+	// Tiles of the same device are connected internally, so links are
+	// only between tiles of different devices.
+	for gpu1, dev1 := range opts.Devices {
+		for tile1 := 0; tile1 < dev1.TilesPerDev; tile1++ {
+			for gpu2 := gpu1 + 1; gpu2 < len(opts.Devices); gpu2++ {
+				for tile2 := 0; tile2 < opts.Devices[gpu2].TilesPerDev; tile2++ {
+					if rnd.Float64() < random.LinkDensity {
+						links = append(links, XeLink{
+							From: fmt.Sprintf("%d.%d", gpu1, tile1),
+							To:   fmt.Sprintf("%d.%d", gpu2, tile2),
+						})
+					}
+				}
+			}
+		}
+	}
+
+	opts.XeLinks = &XeLinkOptions{Links: links}
+}
+
+func (random *RandomizeOptions) validate() error {
+	if random == nil {
+		return nil
+	}
+
+	for name, r := range map[string]IntRange{
+		"DevCount":    random.DevCount,
+		"DevMemSize":  random.DevMemSize,
+		"TilesPerDev": random.TilesPerDev,
+	} {
+		if r.Min < 0 || r.Max < 0 || (r.Max > 0 && r.Max < r.Min) {
+			return fmt.Errorf("%w: Randomize %s range %d-%d is invalid", ErrInvalidOptions, name, r.Min, r.Max)
+		}
+	}
+
+	if random.DevCount.max() > maxRandomDevs {
+		return fmt.Errorf("%w: Randomize DevCount max (%d) is over %d", ErrInvalidOptions, random.DevCount.max(), maxRandomDevs)
+	}
+
+	if random.TilesPerDev.max() > maxRandomTiles {
+		return fmt.Errorf("%w: Randomize TilesPerDev max (%d) is over %d", ErrInvalidOptions, random.TilesPerDev.max(), maxRandomTiles)
+	}
+
+	if random.LinkDensity < 0 || random.LinkDensity > 1 {
+		return fmt.Errorf("%w: Randomize LinkDensity (%g) not within 0-1", ErrInvalidOptions, random.LinkDensity)
+	}
+
+	return nil
+}
+
+func validateRandomize(opts *GenOptions) error {
+	random := opts.Randomize
+	if random == nil {
+		return nil
+	}
+
+	if !opts.isGpuMode() {
+		return fmt.Errorf("%w: Randomize is supported only in GPU mode", ErrInvalidOptions)
+	}
+
+	if err := random.validate(); err != nil {
+		return err
+	}
+
+	if opts.VfsPerPf > 0 {
+		return fmt.Errorf("%w: Randomize and VfsPerPf are mutually exclusive", ErrInvalidOptions)
+	}
+
+	// Devices are generated by randomize(), unless DevCount was given.
+	if len(opts.Devices) == 0 {
+		return fmt.Errorf("%w: Randomize and DevCount / Devices are mutually exclusive", ErrInvalidOptions)
+	}
+
+	return nil
+}
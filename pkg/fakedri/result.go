@@ -0,0 +1,64 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import "time"
+
+// Device generation statuses.
+const (
+	DeviceGenerated = "generated"
+	// DeviceExisting device was already generated (in Append mode).
+	DeviceExisting = "existing"
+	DeviceFailed   = "failed"
+	// DeviceSkipped device was not generated because of another device failing.
+	DeviceSkipped = "skipped"
+)
+
+// GenerationResult tells what was generated for the fake device tree.
+type GenerationResult struct {
+	Devices  []DeviceResult
+	Duration time.Duration
+	Dirs     int
+	Files    int
+	DevNodes int
+	Symlinks int
+	// Placeholders is the number of regular files created instead of device
+	// nodes, when creating them was not permitted.
+	Placeholders int
+}
+
+// DeviceResult tells the generation status of device Index.
+type DeviceResult struct {
+	// Err is the device generation error for DeviceFailed status.
+	Err error
+	// Path is the sysfs or devfs path identifying the device, e.g. its
+	// DRM class dir for GPUs.
+	Path   string
+	Status string
+	Index  int
+}
+
+// result returns the generation counts and given device results.
+func (opts *GenOptions) result(devices []DeviceResult, start time.Time) GenerationResult {
+	return GenerationResult{
+		Devices:      devices,
+		Duration:     time.Since(start),
+		Dirs:         opts.dirs,
+		Files:        opts.files,
+		DevNodes:     opts.devs,
+		Symlinks:     opts.symls,
+		Placeholders: opts.placeholders,
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	yamlUnknownFieldRE = regexp.MustCompile(`field (\S+) not found in type`)
+	jsonUnknownFieldRE = regexp.MustCompile(`unknown field "([^"]+)"`)
+)
+
+// unmarshalYAMLStrict decodes YAML spec, failing on unknown and duplicate fields.
+func unmarshalYAMLStrict(data []byte, withTags *genOptionsWithTags) error {
+	if err := yaml.UnmarshalStrict(data, withTags); err != nil {
+		return explainDecodeError(err, yamlUnknownFieldRE)
+	}
+
+	return nil
+}
+
+// unmarshalJSONStrict decodes JSON spec, failing on unknown fields.
+func unmarshalJSONStrict(data []byte, opts *GenOptions) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(opts); err != nil {
+		return explainDecodeError(err, jsonUnknownFieldRE)
+	}
+
+	return nil
+}
+
+// explainDecodeError adds "did you mean" suggestions for unknown fields
+// matched by given regexp to the decoding error.
+func explainDecodeError(err error, unknownFieldRE *regexp.Regexp) error {
+	var hints []string
+
+	for _, match := range unknownFieldRE.FindAllStringSubmatch(err.Error(), -1) {
+		if known := closestField(match[1]); known != "" {
+			hints = append(hints, fmt.Sprintf("'%s' -> did you mean '%s'?", match[1], known))
+		} else {
+			hints = append(hints, fmt.Sprintf("'%s' is not a known spec field", match[1]))
+		}
+	}
+
+	if len(hints) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w (%s)", err, strings.Join(hints, ", "))
+}
+
+// specFields returns names of all (nested) spec fields.
+func specFields() []string {
+	fields := []string{}
+	seen := map[reflect.Type]bool{}
+
+	var walk func(t reflect.Type)
+
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+
+		if t.Kind() != reflect.Struct || seen[t] {
+			return
+		}
+
+		seen[t] = true
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if name, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); name != "" {
+				fields = append(fields, name)
+			}
+
+			walk(field.Type)
+		}
+	}
+
+	walk(reflect.TypeOf(genOptionsWithTags{}))
+
+	return fields
+}
+
+// closestField returns the spec field closest to the given unknown one,
+// or empty string if there's no reasonably close field.
+func closestField(unknown string) string {
+	best, bestDistance := "", len(unknown)/3+2
+
+	for _, field := range specFields() {
+		if strings.EqualFold(field, unknown) {
+			return field
+		}
+
+		if distance := editDistance(strings.ToLower(field), strings.ToLower(unknown)); distance < bestDistance {
+			best, bestDistance = field, distance
+		}
+	}
+
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+// validateRanges checks that numeric options are within their valid ranges,
+// and that mutually exclusive options are not used together.
+func validateRanges(opts *GenOptions) error {
+	for name, value := range map[string]int{
+		"TilesPerDev": opts.TilesPerDev,
+		"DevMemSize":  opts.DevMemSize,
+		"DevsPerNode": opts.DevsPerNode,
+		"VfsPerPf":    opts.VfsPerPf,
+		"TotalVfs":    opts.TotalVfs,
+		"Workers":     opts.Workers,
+	} {
+		if value < 0 {
+			return fmt.Errorf("%w: %s (%d) must not be negative", ErrInvalidOptions, name, value)
+		}
+	}
+
+	for i, dev := range opts.Devices {
+		if dev.Count < 0 || dev.TilesPerDev < 0 || dev.DevMemSize < 0 || (dev.NumaNode != nil && *dev.NumaNode < 0) {
+			return fmt.Errorf("%w: Devices[%d]: Count, TilesPerDev, DevMemSize and NumaNode must not be negative", ErrInvalidOptions, i)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs SGX SPECIFICATION (Mode: sgx)
+//
+// sys/devices/system/node/nodeX/x86/sgx_total_bytes (EPC size in the node, number)
+//---------------------------------------------------------------
+// devfs SGX SPECIFICATION
+//
+// dev/sgx_enclave
+// dev/sgx_provision
+//---------------------------------------------------------------
+// NFD feature file (in NfdFeatureDir)
+//
+// sgx-epc.txt: intel.feature.node.kubernetes.io/sgx=true
+//              sgx.intel.com/epc=<EPC size>
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	sgxFeatureFile = "sgx-epc.txt"
+	// Default EPC size, i.e. Processor Reserved Memory, per NUMA node.
+	defaultEpcSize = 64 * mib
+)
+
+// SgxOptions describe the SGX specific options for the "sgx" mode.
+type SgxOptions struct {
+	// EpcSize is the total EPC size in bytes, split evenly between the Numa nodes.
+	EpcSize   int `yaml:"EpcSize,omitempty"`
+	NumaNodes int `yaml:"NumaNodes,omitempty"`
+}
+
+func (opts *GenOptions) setSgxDefaults() {
+	if opts.Sgx == nil {
+		opts.Sgx = &SgxOptions{}
+	}
+
+	if opts.DevCount == 0 {
+		opts.DevCount = 1
+	}
+
+	if opts.Sgx.NumaNodes == 0 {
+		opts.Sgx.NumaNodes = 1
+	}
+
+	if opts.Sgx.EpcSize == 0 {
+		opts.Sgx.EpcSize = opts.Sgx.NumaNodes * defaultEpcSize
+	}
+}
+
+func validateSgx(opts *GenOptions) error {
+	if opts.Mode != modeSgx {
+		if opts.Sgx != nil {
+			return fmt.Errorf("%w: Sgx options given for '%s' mode", ErrInvalidOptions, opts.Mode)
+		}
+
+		return nil
+	}
+
+	if opts.DevCount != 1 || len(opts.Devices) > 0 || opts.VfsPerPf > 0 || opts.TilesPerDev > 0 || opts.DevMemSize > 0 ||
+		opts.Hwmon != nil || opts.Freq != nil || opts.MemRegions != nil || opts.XeLinks != nil || len(opts.Clients) > 0 {
+		return fmt.Errorf("%w: SGX mode supports only DevCount 1 and no device (GPU) specific options", ErrInvalidOptions)
+	}
+
+	if opts.Sgx == nil {
+		return nil
+	}
+
+	if opts.Sgx.NumaNodes < 0 || opts.Sgx.EpcSize < 0 {
+		return fmt.Errorf("%w: SGX EpcSize (%d) and NumaNodes (%d) must not be negative",
+			ErrInvalidOptions, opts.Sgx.EpcSize, opts.Sgx.NumaNodes)
+	}
+
+	if opts.Sgx.NumaNodes > 0 && opts.Sgx.EpcSize%(opts.Sgx.NumaNodes*mib) != 0 {
+		return fmt.Errorf("%w: SGX EpcSize (%d) is not evenly divisible to %d NUMA nodes in MiB units",
+			ErrInvalidOptions, opts.Sgx.EpcSize, opts.Sgx.NumaNodes)
+	}
+
+	return nil
+}
+
+// addSgxDevice generates the SGX device nodes, and the EPC size information
+// to sysfs and to an NFD feature file (like sgx_epchook NFD hook provides).
+func addSgxDevice(opts *GenOptions) error {
+	for _, name := range []string{"sgx_enclave", "sgx_provision"} {
+		if err := opts.fsys().MkdirAll(devfsPath, dirMode); err != nil {
+			return err
+		}
+
+		if err := addNullDeviceNode(opts, filepath.Join(devfsPath, name)); err != nil {
+			return err
+		}
+	}
+
+	nodeEpc := opts.Sgx.EpcSize / opts.Sgx.NumaNodes
+
+	for node := 0; node < opts.Sgx.NumaNodes; node++ {
+		base := filepath.Join(sysfsPath, "devices", "system", "node", fmt.Sprintf("node%d", node), "x86")
+		if err := opts.fsys().MkdirAll(base, dirMode); err != nil {
+			return err
+		}
+
+		opts.dirs++
+
+		if err := writeFile(opts, filepath.Join(base, "sgx_total_bytes"), strconv.Itoa(nodeEpc)); err != nil {
+			return err
+		}
+	}
+
+	return writeNfdFeatureFile(opts, sgxFeatureFile, []string{
+		"intel.feature.node.kubernetes.io/sgx=true",
+		"sgx.intel.com/epc=" + strconv.Itoa(opts.Sgx.EpcSize),
+	})
+}
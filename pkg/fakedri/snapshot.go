@@ -0,0 +1,219 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s.io/klog/v2"
+)
+
+var cardRE = regexp.MustCompile(`^card([0-9]+)$`)
+
+// Snapshot walks the DRM devices of a real node under given sysfs and devfs
+// roots (normally "/sys" and "/dev"), and returns options reproducing the
+// node's GPU topology with fake devices.
+func Snapshot(sysfsRoot, devfsRoot string) (GenOptions, error) {
+	opts := GenOptions{Version: SpecVersion}
+
+	drmDir := filepath.Join(sysfsRoot, "class", "drm")
+
+	entries, err := os.ReadDir(drmDir)
+	if err != nil {
+		return opts, fmt.Errorf("reading '%s' failed: %w", drmDir, err)
+	}
+
+	cards := []int{}
+
+	for _, entry := range entries {
+		if match := cardRE.FindStringSubmatch(entry.Name()); match != nil {
+			index, _ := strconv.Atoi(match[1])
+			cards = append(cards, index)
+		}
+	}
+
+	sort.Ints(cards)
+
+	for _, index := range cards {
+		card := fmt.Sprintf("card%d", index)
+		cardPath := filepath.Join(drmDir, card)
+
+		if readTrimmed(filepath.Join(cardPath, "device", "vendor")) != intelVendorID {
+			klog.V(1).InfoS("Skipping non-Intel card", "card", card)
+			continue
+		}
+
+		if _, err = os.Stat(filepath.Join(devfsRoot, "dri", card)); err != nil {
+			klog.InfoS("Warning: skipping card without device node", "card", card, "err", err)
+			continue
+		}
+
+		caps := readCapabilities(filepath.Join(sysfsRoot, "kernel", "debug", "dri", strconv.Itoa(index), "i915_capabilities"))
+
+		if opts.Driver == "" {
+			if link, err := os.Readlink(filepath.Join(cardPath, "device", "driver")); err == nil {
+				opts.Driver = filepath.Base(link)
+			}
+
+			opts.Capabilities = caps
+		}
+
+		if vfs, _ := strconv.Atoi(readTrimmed(filepath.Join(cardPath, "device", "sriov_numvfs"))); vfs > 0 {
+			opts.VfsPerPf = vfs
+			opts.TotalVfs, _ = strconv.Atoi(readTrimmed(filepath.Join(cardPath, "device", "sriov_totalvfs")))
+			opts.VfDeviceID = readTrimmed(filepath.Join(cardPath, "device", "sriov_vf_device"))
+		}
+
+		dev := snapshotDevice(cardPath)
+		dev.Capabilities = capabilitiesDiff(opts.Capabilities, caps)
+
+		opts.Devices = appendDevice(opts.Devices, dev)
+		opts.DevCount++
+	}
+
+	if opts.DevCount == 0 {
+		return opts, fmt.Errorf("%w: no Intel GPUs found under '%s'", ErrInvalidOptions, drmDir)
+	}
+
+	if opts.VfsPerPf > 0 {
+		// SR-IOV can be faked only with the default tiles and NUMA layout.
+		for i := range opts.Devices {
+			opts.Devices[i].NumaNode = nil
+			opts.Devices[i].TilesPerDev = 0
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	opts.Info = fmt.Sprintf("Snapshot of %d GPU(s) on '%s'", opts.DevCount, hostname)
+
+	return opts, nil
+}
+
+func snapshotDevice(cardPath string) DeviceOptions {
+	node, err := strconv.Atoi(readTrimmed(filepath.Join(cardPath, "device", "numa_node")))
+	if err != nil || node < 0 {
+		node = 0
+	}
+
+	tiles, _ := filepath.Glob(filepath.Join(cardPath, "gt", "gt*")) // i915
+	if len(tiles) == 0 {
+		tiles, _ = filepath.Glob(filepath.Join(cardPath, "device", "tile?")) // xe
+	}
+
+	memSize, _ := strconv.Atoi(readTrimmed(filepath.Join(cardPath, "lmem_total_bytes")))
+
+	return DeviceOptions{
+		NumaNode:    &node,
+		DeviceID:    readTrimmed(filepath.Join(cardPath, "device", "device")),
+		Revision:    readTrimmed(filepath.Join(cardPath, "device", "revision")),
+		Count:       1,
+		TilesPerDev: len(tiles),
+		DevMemSize:  memSize - memSize%int(mib),
+	}
+}
+
+// appendDevice appends device to the list, or increments the count of the
+// last list entry if it is identical to device.
+func appendDevice(devs []DeviceOptions, dev DeviceOptions) []DeviceOptions {
+	if n := len(devs); n > 0 {
+		last := devs[n-1]
+		last.Count = 1
+
+		if reflect.DeepEqual(last, dev) {
+			devs[n-1].Count++
+			return devs
+		}
+	}
+
+	return append(devs, dev)
+}
+
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+func readCapabilities(path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		klog.V(1).InfoS("Skipping capabilities", "err", err)
+		return nil
+	}
+	defer f.Close()
+
+	caps := map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key, value, found := strings.Cut(scanner.Text(), ":"); found {
+			caps[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return caps
+}
+
+// capabilitiesDiff returns the capabilities differing from the base ones, or
+// nil if there are none.
+func capabilitiesDiff(base, caps map[string]string) map[string]string {
+	var diff map[string]string
+
+	for key, value := range caps {
+		if base[key] == value {
+			continue
+		}
+
+		if diff == nil {
+			diff = map[string]string{}
+		}
+
+		diff[key] = value
+	}
+
+	return diff
+}
+
+// MarshalSpec returns the options as a YAML spec accepted by GetOptionsBySpec.
+func MarshalSpec(opts GenOptions) ([]byte, error) {
+	return yaml.Marshal(convertFromGenOptions(opts))
+}
+
+// UnmarshalSpec parses options from a YAML (or JSON) spec, and converts
+// them to the current spec version layout, without applying defaults to
+// them or validating them.
+func UnmarshalSpec(data []byte) (GenOptions, error) {
+	var withTags genOptionsWithTags
+	if err := unmarshalYAMLStrict(data, &withTags); err != nil {
+		return GenOptions{}, err
+	}
+
+	opts := convertToGenOptions(withTags)
+
+	return opts, opts.convertVersion()
+}
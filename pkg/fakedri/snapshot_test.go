@@ -0,0 +1,117 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createTestFiles(t *testing.T, root string, dirs []string, files map[string]string) {
+	t.Helper()
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, content := range files {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	root := t.TempDir()
+	sysfs := filepath.Join(root, "sys")
+	devfs := filepath.Join(root, "dev")
+
+	createTestFiles(t, sysfs,
+		[]string{
+			"class/drm/card0/gt/gt0", "class/drm/card0/gt/gt1",
+			"class/drm/card1/gt/gt0", "class/drm/card1/gt/gt1",
+			"class/drm/card2/gt/gt0",
+			"class/drm/card3",
+			"bus/pci/drivers/i915",
+		},
+		map[string]string{
+			"class/drm/card0/device/vendor":    "0x8086\n",
+			"class/drm/card0/device/device":    "0x0bd5\n",
+			"class/drm/card0/device/revision":  "0x2f\n",
+			"class/drm/card0/device/numa_node": "1\n",
+			"class/drm/card0/lmem_total_bytes": "68719476736\n",
+			"class/drm/card1/device/vendor":    "0x8086\n",
+			"class/drm/card1/device/device":    "0x0bd5\n",
+			"class/drm/card1/device/revision":  "0x2f\n",
+			"class/drm/card1/device/numa_node": "1\n",
+			"class/drm/card1/lmem_total_bytes": "68719476736\n",
+			"class/drm/card2/device/vendor":    "0x8086\n",
+			"class/drm/card2/device/device":    "0x56c1\n",
+			"class/drm/card2/device/revision":  "0x05\n",
+			"class/drm/card2/device/numa_node": "-1\n",
+			"class/drm/card3/device/vendor":    "0x10de\n",
+			"kernel/debug/dri/0/i915_capabilities": "platform: PONTEVECCHIO\n" +
+				"gen: 12\n",
+			"kernel/debug/dri/2/i915_capabilities": "platform: DG2\n" +
+				"gen: 12\n",
+		})
+	createTestFiles(t, devfs, nil, map[string]string{
+		"dri/card0": "", "dri/card1": "", "dri/card2": "", "dri/card3": "",
+	})
+
+	if err := os.Symlink("../../../../bus/pci/drivers/i915", filepath.Join(sysfs, "class/drm/card0/device/driver")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := Snapshot(sysfs, devfs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if opts.DevCount != 3 || len(opts.Devices) != 2 || opts.Devices[0].Count != 2 {
+		t.Fatalf("unexpected devices (%d): %+v", opts.DevCount, opts.Devices)
+	}
+
+	if opts.Driver != "i915" || opts.Capabilities["platform"] != "PONTEVECCHIO" {
+		t.Errorf("unexpected driver '%s' or capabilities %v", opts.Driver, opts.Capabilities)
+	}
+
+	if dev := opts.device(2); dev.DeviceID != "0x56c1" || dev.TilesPerDev != 1 || *dev.NumaNode != 0 ||
+		dev.Capabilities["platform"] != "DG2" || dev.Capabilities["gen"] != "12" {
+		t.Errorf("unexpected dev-2 properties: %+v", dev)
+	}
+
+	spec, err := MarshalSpec(opts)
+	if err != nil {
+		t.Fatalf("unexpected marshaling error: %v", err)
+	}
+
+	reread, err := GetOptionsBySpecE(string(spec))
+	if err != nil {
+		t.Fatalf("snapshot spec is invalid: %v\n%s", err, spec)
+	}
+
+	if reread.DevCount != opts.DevCount || reread.device(0).DevMemSize != 68719476736 {
+		t.Errorf("snapshot spec does not match snapshot:\n%s", spec)
+	}
+}
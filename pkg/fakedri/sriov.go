@@ -0,0 +1,78 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs SR-IOV SPECIFICATION
+//
+// sys/class/drm/cardX/device/sriov_numvfs (PF only, number of VF GPUs, number)
+// sys/class/drm/cardX/device/sriov_totalvfs (PF only, max number of VF GPUs, number)
+// sys/class/drm/cardX/device/sriov_vf_device (PF only, VF PCI device ID)
+// sys/class/drm/cardX/device/virtfnN -> ../../cardY/device (PF only, link to Nth VF)
+// sys/class/drm/cardY/device/physfn -> ../../cardX/device (VF only, link to its PF)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// addSriovFiles adds the SR-IOV PF or VF files for device i to given PCI device dir.
+func addSriovFiles(base string, opts *GenOptions, i int) error {
+	pf := i - i%(opts.VfsPerPf+1)
+
+	if i != pf {
+		target := "../" + opts.pciAddress(pf)
+		if err := opts.fsys().Symlink(target, filepath.Join(base, "physfn")); err != nil {
+			return fmt.Errorf("physfn symlink creation failed: %w", err)
+		}
+
+		opts.symls++
+
+		return nil
+	}
+
+	totalVfs := opts.TotalVfs
+	if totalVfs == 0 {
+		totalVfs = opts.VfsPerPf
+	}
+
+	vfDeviceID := opts.VfDeviceID
+	if vfDeviceID == "" {
+		vfDeviceID = opts.device(i).DeviceID
+	}
+
+	for name, value := range map[string]string{
+		"sriov_numvfs":    strconv.Itoa(opts.VfsPerPf),
+		"sriov_totalvfs":  strconv.Itoa(totalVfs),
+		"sriov_vf_device": vfDeviceID,
+	} {
+		if err := writeFile(opts, filepath.Join(base, name), value); err != nil {
+			return err
+		}
+	}
+
+	for vf := 0; vf < opts.VfsPerPf; vf++ {
+		target := "../" + opts.pciAddress(pf+1+vf)
+		if err := opts.fsys().Symlink(target, filepath.Join(base, fmt.Sprintf("virtfn%d", vf))); err != nil {
+			return fmt.Errorf("virtfn symlink creation failed: %w", err)
+		}
+
+		opts.symls++
+	}
+
+	return nil
+}
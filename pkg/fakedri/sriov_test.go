@@ -0,0 +1,82 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestSriov(t *testing.T) {
+	opts, err := GetOptionsBySpecE("DevCount: 6\nVfsPerPf: 2\nTotalVfs: 7\nVfDeviceID: \"0x56c2\"\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mem := NewMemFS()
+	opts.SetFilesystem(mem)
+
+	if err = GenerateDriFilesE(opts); err != nil {
+		t.Fatalf("generation to memory failed: %v", err)
+	}
+
+	pciFile := func(i int, name string) string {
+		return filepath.Join(sysfsPath, "class/drm", opts.cardName(i), "device", name)
+	}
+
+	for _, pf := range []int{0, 3} {
+		for name, value := range map[string]string{"sriov_numvfs": "2", "sriov_totalvfs": "7", "sriov_vf_device": "0x56c2"} {
+			if data, err := mem.ReadFile(pciFile(pf, name)); err != nil || string(data) != value {
+				t.Errorf("PF dev-%d: expected %s '%s', got '%s', %v", pf, name, value, data, err)
+			}
+		}
+
+		if _, err = mem.Lstat(pciFile(pf, "physfn")); err == nil {
+			t.Errorf("PF dev-%d: unexpected physfn", pf)
+		}
+
+		for vf := 0; vf < 2; vf++ {
+			i := pf + 1 + vf
+
+			if target, err := mem.Readlink(pciFile(pf, fmt.Sprintf("virtfn%d", vf))); err != nil || target != "../"+opts.pciAddress(i) {
+				t.Errorf("PF dev-%d: expected virtfn%d to VF dev-%d, got '%s', %v", pf, vf, i, target, err)
+			}
+
+			if target, err := mem.Readlink(pciFile(i, "physfn")); err != nil || target != "../"+opts.pciAddress(pf) {
+				t.Errorf("VF dev-%d: expected physfn to PF dev-%d, got '%s', %v", i, pf, target, err)
+			}
+
+			if _, err = mem.Lstat(pciFile(i, "sriov_numvfs")); err == nil {
+				t.Errorf("VF dev-%d: unexpected sriov_numvfs", i)
+			}
+
+			if data, err := mem.ReadFile(pciFile(i, "device")); err != nil || string(data) != "0x56c2" {
+				t.Errorf("VF dev-%d: expected VF device ID, got '%s', %v", i, data, err)
+			}
+
+			for _, node := range []string{opts.cardName(i), opts.renderName(i)} {
+				if _, err = mem.Stat(filepath.Join(devfsPath, "dri", node)); err != nil {
+					t.Errorf("VF dev-%d: expected DRM node %s: %v", i, node, err)
+				}
+			}
+		}
+	}
+
+	if _, err = GetOptionsBySpecE("DevCount: 5\nVfsPerPf: 2\n"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("expected ErrInvalidOptions for uneven VF split, got: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs tile memory SPECIFICATION (devices with TilesPerDev > 1)
+//
+// i915:
+// sys/class/drm/cardX/gt/gtN/lmem_total_bytes (tile N share of device memory, number)
+// xe:
+// sys/devices/ROOT/BDF/tileN/physical_vram_size_bytes (tile N share of device memory, number)
+// sys/devices/ROOT/BDF/tileN/gtN/
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+const xeDriver = "xe"
+
+// addSysfsTileFiles adds the per-tile memory files for device i, if it has
+// several tiles. Device memory is split evenly between the tiles.
+func addSysfsTileFiles(root string, opts *GenOptions, i int) error {
+	dev := opts.device(i)
+	if dev.TilesPerDev <= 1 {
+		return nil
+	}
+
+	size := strconv.Itoa(dev.DevMemSize / dev.TilesPerDev)
+
+	for tile := 0; tile < dev.TilesPerDev; tile++ {
+		if opts.Driver != xeDriver {
+			file := filepath.Join(root, "class", "drm", opts.cardName(i), "gt", fmt.Sprintf("gt%d", tile), "lmem_total_bytes")
+			if err := writeFile(opts, file, size); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		base := filepath.Join(opts.pciDevicePath(i, opts.pciAddress(i)), fmt.Sprintf("tile%d", tile))
+		if err := opts.fsys().MkdirAll(filepath.Join(base, fmt.Sprintf("gt%d", tile)), dirMode); err != nil {
+			return err
+		}
+
+		opts.dirs += 2
+
+		if err := writeFile(opts, filepath.Join(base, "physical_vram_size_bytes"), size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// tmpfs SPECIFICATION (Tmpfs option, OS filesystem only)
+//
+// tmp/sys (dedicated tmpfs mount, size=SIZE)
+// tmp/dev (dedicated tmpfs mount, size=SIZE)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// tmpfsPaths are the fake trees put to dedicated tmpfs mounts.
+var tmpfsPaths = []string{sysfsPath, devfsPath}
+
+// TmpfsOptions put the fake sysfs and devfs trees to dedicated tmpfs mounts,
+// so that large fake topologies can not fill /tmp.
+type TmpfsOptions struct {
+	// Size limit (in bytes) for each of the fake trees. Generation fails
+	// before writing a file that would take tree over it.
+	Size int `yaml:"Size,omitempty"`
+	// Mount tmpfs to the fake tree paths (requires CAP_SYS_ADMIN), instead
+	// of requiring them to be already tmpfs mounts.
+	Mount bool `yaml:"Mount,omitempty"`
+}
+
+func validateTmpfs(opts *GenOptions) error {
+	if opts.Tmpfs == nil {
+		return nil
+	}
+
+	if opts.Tmpfs.Size <= 0 {
+		return fmt.Errorf("%w: Tmpfs Size %d, not a positive number of bytes", ErrInvalidOptions, opts.Tmpfs.Size)
+	}
+
+	return nil
+}
+
+// isTmpfsMount tells whether path is a tmpfs mount point, i.e. a dedicated
+// tmpfs instead of e.g. a dir in tmpfs mounted /tmp.
+func isTmpfsMount(path string) (bool, error) {
+	var stfs unix.Statfs_t
+
+	if err := unix.Statfs(path, &stfs); err != nil {
+		return false, err
+	}
+
+	if stfs.Type != unix.TMPFS_MAGIC {
+		return false, nil
+	}
+
+	var dir, parent unix.Stat_t
+
+	if err := unix.Stat(path, &dir); err != nil {
+		return false, err
+	}
+
+	if err := unix.Stat(filepath.Dir(path), &parent); err != nil {
+		return false, err
+	}
+
+	return dir.Dev != parent.Dev, nil
+}
+
+// prepareTmpfs mounts (or checks for) the fake tree tmpfs mounts, and sets
+// the filesystem to account the tree sizes against Tmpfs Size limit.
+func prepareTmpfs(opts *GenOptions) error {
+	if opts.Tmpfs == nil {
+		return nil
+	}
+
+	// Other filesystems (like MemFS) get only the size accounting.
+	if opts.filesystem == nil {
+		for _, path := range tmpfsPaths {
+			mounted, err := isTmpfsMount(path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("checking '%s' for tmpfs mount failed: %w", path, err)
+			}
+
+			if mounted {
+				continue
+			}
+
+			if !opts.Tmpfs.Mount {
+				return fmt.Errorf("%w: '%s' is not a dedicated tmpfs mount, and Tmpfs Mount is not set", ErrInvalidOptions, path)
+			}
+
+			if err = os.MkdirAll(path, dirMode); err != nil {
+				return err
+			}
+
+			data := fmt.Sprintf("size=%d,mode=%o", opts.Tmpfs.Size, dirMode)
+			if err = unix.Mount("fakedri", path, "tmpfs", unix.MS_NOSUID, data); err != nil {
+				return fmt.Errorf("mounting tmpfs to '%s' failed: %w", path, err)
+			}
+
+			opts.log().V(1).Info("Mounted tmpfs", "path", path, "size", opts.Tmpfs.Size)
+		}
+	}
+
+	opts.filesystem = &tmpfsFilesystem{
+		Filesystem: opts.fsys(),
+		used:       map[string]int{},
+		limit:      opts.Tmpfs.Size,
+	}
+
+	return nil
+}
+
+// unmountTmpfs unmounts tmpfs mounted to given fake tree path by Tmpfs Mount
+// option, if there is one.
+func unmountTmpfs(opts *GenOptions, path string) error {
+	if opts.Tmpfs == nil || !opts.Tmpfs.Mount || opts.filesystem != nil {
+		return nil
+	}
+
+	if mounted, err := isTmpfsMount(path); err != nil || !mounted {
+		return nil
+	}
+
+	if err := unix.Unmount(path, 0); err != nil {
+		return fmt.Errorf("unmounting tmpfs from '%s' failed: %w", path, err)
+	}
+
+	opts.log().V(1).Info("Unmounted tmpfs", "path", path)
+
+	return nil
+}
+
+// tmpfsFilesystem accounts file content written to the fake trees through
+// it, in pages like tmpfs does, and fails writes that would take a tree
+// over the size limit, instead of filling the tmpfs.
+type tmpfsFilesystem struct {
+	Filesystem
+	used  map[string]int
+	limit int
+	mu    sync.Mutex
+}
+
+// tmpfsPages returns the tmpfs memory usage of a file of given size.
+func tmpfsPages(size int) int {
+	page := os.Getpagesize()
+
+	return (size + page - 1) / page * page
+}
+
+func (t *tmpfsFilesystem) WriteFile(path string, data []byte, perm fs.FileMode) error {
+	var root string
+
+	for _, tree := range tmpfsPaths {
+		if strings.HasPrefix(path, tree+"/") {
+			root = tree
+		}
+	}
+
+	if root == "" {
+		return t.Filesystem.WriteFile(path, data, perm)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	used := t.used[root] + tmpfsPages(len(data))
+	if info, err := t.Filesystem.Lstat(path); err == nil && info.Mode().IsRegular() {
+		used -= tmpfsPages(int(info.Size()))
+	}
+
+	if used > t.limit {
+		return fmt.Errorf("%w: writing '%s' would take fake tree '%s' to %d bytes, over Tmpfs Size %d",
+			ErrTmpfsFull, path, root, used, t.limit)
+	}
+
+	if err := t.Filesystem.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+
+	t.used[root] = used
+
+	return nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//---------------------------------------------------------------
+// sysfs NUMA topology SPECIFICATION (Topology option)
+//
+// sys/devices/system/node/{online,possible} (e.g. 0-1)
+// sys/devices/system/node/nodeX/cpulist (e.g. 0-7)
+// sys/devices/pciDDDD:BB/ (PCI root bus, DDDD:BB given in PciRoots)
+// sys/devices/pciDDDD:BB/BDF/local_cpulist (CPUs of the device NUMA node)
+//---------------------------------------------------------------
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const defaultCpusPerNode = 8
+
+var pciRootRE = regexp.MustCompile(`^([0-9a-f]{4}):([0-9a-f]{2})$`)
+
+// TopologyOptions describe the NUMA nodes and the PCI root buses to which
+// the devices are connected, e.g. for faking multi-socket systems.
+type TopologyOptions struct {
+	PciRoots    []PciRootOptions `yaml:"PciRoots,omitempty"`
+	CpusPerNode int              `yaml:"CpusPerNode,omitempty"`
+}
+
+// PciRootOptions describe a PCI root bus ("DDDD:BB") and its NUMA node. Devices
+// are placed round-robin to the root buses of their NUMA node, each PF on a
+// bus of its own after the root bus.
+type PciRootOptions struct {
+	Bus      string `yaml:"Bus,omitempty"`
+	NumaNode int    `yaml:"NumaNode,omitempty"`
+}
+
+func (topology *TopologyOptions) cpusPerNode() int {
+	if topology.CpusPerNode == 0 {
+		return defaultCpusPerNode
+	}
+
+	return topology.CpusPerNode
+}
+
+// nodeRoots returns the PCI root buses of given NUMA node.
+func (topology *TopologyOptions) nodeRoots(node int) []string {
+	roots := []string{}
+
+	for _, root := range topology.PciRoots {
+		if root.NumaNode == node {
+			roots = append(roots, root.Bus)
+		}
+	}
+
+	return roots
+}
+
+// pfNode returns the NUMA node of given PF.
+func (opts *GenOptions) pfNode(pf int) int {
+	return *opts.device(pf * (opts.VfsPerPf + 1)).NumaNode
+}
+
+// pciRootBus returns the domain and bus of the PCI root bus for given PF,
+// and how many PFs precede it on that root bus. Returns false when there
+// are no PCI root buses in the options.
+func (opts *GenOptions) pciRootBus(pf int) (domain, bus, nth int, ok bool) {
+	if opts.Topology == nil || len(opts.Topology.PciRoots) == 0 {
+		return 0, 0, 0, false
+	}
+
+	node := opts.pfNode(pf)
+
+	roots := opts.Topology.nodeRoots(node)
+	if len(roots) == 0 {
+		return 0, 0, 0, false
+	}
+
+	// PFs on the same NUMA node before this one.
+	count := 0
+
+	for j := 0; j < pf; j++ {
+		if opts.pfNode(j) == node {
+			count++
+		}
+	}
+
+	match := pciRootRE.FindStringSubmatch(roots[count%len(roots)])
+	d, _ := strconv.ParseInt(match[1], 16, 32)
+	b, _ := strconv.ParseInt(match[2], 16, 32)
+
+	return int(d), int(b), count / len(roots), true
+}
+
+// numaNodes returns the number of NUMA nodes used by the devices and PCI root buses.
+func (opts *GenOptions) numaNodes() int {
+	nodes := 1
+
+	for i := 0; i < opts.DevCount; i++ {
+		nodes = max(nodes, *opts.device(i).NumaNode+1)
+	}
+
+	for _, root := range opts.Topology.PciRoots {
+		nodes = max(nodes, root.NumaNode+1)
+	}
+
+	return nodes
+}
+
+func cpuRange(first, count int) string {
+	if count == 1 {
+		return strconv.Itoa(first)
+	}
+
+	return fmt.Sprintf("%d-%d", first, first+count-1)
+}
+
+func validateTopology(opts *GenOptions) error {
+	topology := opts.Topology
+	if topology == nil {
+		return nil
+	}
+
+	if !opts.hasPciLayout() {
+		return fmt.Errorf("%w: Topology is not supported in '%s' mode", ErrInvalidOptions, opts.Mode)
+	}
+
+	if topology.CpusPerNode < 0 {
+		return fmt.Errorf("%w: Topology CpusPerNode (%d) must not be negative", ErrInvalidOptions, topology.CpusPerNode)
+	}
+
+	if len(topology.PciRoots) == 0 {
+		return nil
+	}
+
+	if opts.PciAddress != "" {
+		return fmt.Errorf("%w: PciAddress and Topology PciRoots are mutually exclusive", ErrInvalidOptions)
+	}
+
+	seen := map[string]bool{}
+
+	for i, root := range topology.PciRoots {
+		if !pciRootRE.MatchString(root.Bus) || root.NumaNode < 0 || seen[root.Bus] {
+			return fmt.Errorf("%w: Topology PciRoots[%d]: Bus '%s' is not a unique (lower case) 'DDDD:BB' PCI bus, or NumaNode (%d) is negative",
+				ErrInvalidOptions, i, root.Bus, root.NumaNode)
+		}
+
+		seen[root.Bus] = true
+	}
+
+	pfs := map[int]int{}
+	for pf := 0; pf*(opts.VfsPerPf+1) < opts.DevCount; pf++ {
+		pfs[opts.pfNode(pf)]++
+	}
+
+	for node, count := range pfs {
+		roots := topology.nodeRoots(node)
+		if len(roots) == 0 {
+			return fmt.Errorf("%w: no Topology PciRoots for NUMA node %d devices", ErrInvalidOptions, node)
+		}
+
+		for _, root := range roots {
+			if bus, _ := strconv.ParseInt(root[5:], 16, 32); int(bus)+1+(count-1)/len(roots) >= pciBuses {
+				return fmt.Errorf("%w: NUMA node %d devices do not fit to the buses after PCI root bus '%s'",
+					ErrInvalidOptions, node, root)
+			}
+		}
+	}
+
+	return nil
+}
+
+// addNumaNodes adds the NUMA node dirs with their CPU lists.
+func addNumaNodes(opts *GenOptions) error {
+	if opts.Topology == nil {
+		return nil
+	}
+
+	nodes := opts.numaNodes()
+	cpus := opts.Topology.cpusPerNode()
+	base := filepath.Join(sysfsPath, "devices", "system", "node")
+
+	for node := 0; node < nodes; node++ {
+		dir := filepath.Join(base, fmt.Sprintf("node%d", node))
+		if err := opts.fsys().MkdirAll(dir, dirMode); err != nil {
+			return err
+		}
+
+		opts.dirs++
+
+		if err := writeFile(opts, filepath.Join(dir, "cpulist"), cpuRange(node*cpus, cpus)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range []string{"online", "possible"} {
+		if err := writeFile(opts, filepath.Join(base, name), cpuRange(0, nodes)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addLocalCpulist writes the CPUs of given NUMA node (all CPUs for
+// a negative node) as local CPUs of given PCI device dir.
+func addLocalCpulist(base string, opts *GenOptions, node int) error {
+	if opts.Topology == nil {
+		return nil
+	}
+
+	cpus := opts.Topology.cpusPerNode()
+	cpulist := cpuRange(node*cpus, cpus)
+
+	if node < 0 {
+		cpulist = cpuRange(0, opts.numaNodes()*cpus)
+	}
+
+	return writeFile(opts, filepath.Join(base, "local_cpulist"), cpulist)
+}
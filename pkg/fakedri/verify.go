@@ -0,0 +1,172 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// Same as GPU plugin card and DRM control node name matching.
+	pluginCardRE    = regexp.MustCompile(`^card[0-9]+$`)
+	pluginControlRE = regexp.MustCompile(`^controlD[0-9]+$`)
+)
+
+// discoveredGpu is a GPU as the GPU plugin discovers it.
+type discoveredGpu struct {
+	driver string
+	nodes  []string
+}
+
+// discoverGpus returns the GPUs the GPU plugin would find from the fake tree,
+// by card name. Like the plugin, it skips non-Intel cards, cards without
+// device/drm dir, and SR-IOV PFs with VFs, and includes only DRM nodes
+// having a device file.
+func discoverGpus(opts *GenOptions) (map[string]discoveredGpu, error) {
+	drmDir := filepath.Join(sysfsPath, "class", "drm")
+
+	entries, err := opts.fsys().ReadDir(drmDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading '%s' failed: %w", drmDir, err)
+	}
+
+	gpus := map[string]discoveredGpu{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !pluginCardRE.MatchString(name) {
+			continue
+		}
+
+		device := filepath.Join(drmDir, name, "device")
+
+		vendor, err := opts.fsys().ReadFile(filepath.Join(device, "vendor"))
+		if err != nil || strings.TrimSpace(string(vendor)) != intelVendorID {
+			continue
+		}
+
+		nodes, err := opts.fsys().ReadDir(filepath.Join(device, "drm"))
+		if err != nil {
+			continue
+		}
+
+		if vfs, _ := opts.fsys().ReadFile(filepath.Join(device, "sriov_numvfs")); len(vfs) > 0 && string(vfs) != "0" {
+			continue
+		}
+
+		var gpu discoveredGpu
+
+		if link, err := opts.fsys().Readlink(filepath.Join(device, "driver")); err == nil {
+			gpu.driver = filepath.Base(link)
+		}
+
+		for _, node := range nodes {
+			if pluginControlRE.MatchString(node.Name()) {
+				continue
+			}
+
+			if _, err := opts.fsys().Stat(filepath.Join(devfsPath, "dri", node.Name())); err == nil {
+				gpu.nodes = append(gpu.nodes, node.Name())
+			}
+		}
+
+		if len(gpu.nodes) > 0 {
+			gpus[name] = gpu
+		}
+	}
+
+	return gpus, nil
+}
+
+// Verify checks that the GPU plugin discovery logic (vendor check, DRM dirs,
+// device nodes, driver) finds from the generated fake tree the GPUs expected
+// from given options, to catch spec and generator bugs before they surface
+// as confusing plugin behavior. Returns ErrTreeMismatch wrapping error
+// listing the differences, if they do not match.
+func Verify(opts GenOptions) error {
+	if !opts.isGpuMode() {
+		return fmt.Errorf("%w: verification is supported only in GPU mode", ErrInvalidOptions)
+	}
+
+	gpus, err := discoverGpus(&opts)
+	if err != nil {
+		return err
+	}
+
+	diffs := []string{}
+
+	for i := 0; i < opts.DevCount; i++ {
+		card := opts.cardName(i)
+		dev := opts.device(i)
+		gpu, found := gpus[card]
+
+		delete(gpus, card)
+
+		isPfWithVfs := opts.VfsPerPf > 0 && i%(opts.VfsPerPf+1) == 0
+		if dev.Vendor != intelVendorID || hasFault(opts.Faults.EmptyVendor, i) || isPfWithVfs {
+			if found {
+				diffs = append(diffs, fmt.Sprintf("dev-%d: %s discovered, but should be skipped", i, card))
+			}
+
+			continue
+		}
+
+		if !found {
+			diffs = append(diffs, fmt.Sprintf("dev-%d: %s not discovered", i, card))
+			continue
+		}
+
+		nodes := []string{card, opts.renderName(i)}
+		slices.Sort(nodes)
+		slices.Sort(gpu.nodes)
+
+		if !slices.Equal(nodes, gpu.nodes) {
+			diffs = append(diffs, fmt.Sprintf("dev-%d: %s device nodes %v, expected %v", i, card, gpu.nodes, nodes))
+		}
+
+		// Without Driver option, bound driver name is unspecified.
+		driver := opts.Driver
+		if dev.Unbound {
+			driver = ""
+		} else if driver == "" {
+			continue
+		}
+
+		if gpu.driver != driver {
+			diffs = append(diffs, fmt.Sprintf("dev-%d: %s driver '%s', expected '%s'", i, card, gpu.driver, driver))
+		}
+	}
+
+	extra := make([]string, 0, len(gpus))
+	for card := range gpus {
+		extra = append(extra, "unexpected "+card+" discovered")
+	}
+
+	slices.Sort(extra)
+
+	if diffs = append(diffs, extra...); len(diffs) > 0 {
+		if len(diffs) > maxDiffs {
+			diffs = append(diffs[:maxDiffs], fmt.Sprintf("... (%d more)", len(diffs)-maxDiffs))
+		}
+
+		return fmt.Errorf("%w: %s", ErrTreeMismatch, strings.Join(diffs, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// SpecVersion is the current spec layout version. Specs without Version
+// are in the original "v1" layout.
+const SpecVersion = "v2"
+
+// specVersions lists the spec layout versions from oldest to newest.
+var specVersions = []string{"v1", SpecVersion}
+
+// specConverters[i] converts options from specVersions[i] layout to the
+// specVersions[i+1] one.
+var specConverters = []func(opts *GenOptions){
+	convertSpecV1,
+}
+
+// convertVersion converts options from their spec Version layout to the
+// current one.
+func (opts *GenOptions) convertVersion() error {
+	version := opts.Version
+	if version == "" {
+		version = specVersions[0]
+	}
+
+	index := slices.Index(specVersions, version)
+	if index < 0 {
+		return fmt.Errorf("%w: unknown spec Version '%s', known ones are: %v", ErrInvalidOptions, version, specVersions)
+	}
+
+	for _, convert := range specConverters[index:] {
+		convert(opts)
+	}
+
+	opts.Version = SpecVersion
+
+	return nil
+}
+
+// convertSpecV1 moves the Xe Link "connection-topology" and "connections"
+// pseudo-capabilities of v1 specs to the XeLinks section.
+func convertSpecV1(opts *GenOptions) {
+	topology, hasTopology := opts.Capabilities["connection-topology"]
+	connections, hasConnections := opts.Capabilities["connections"]
+
+	if !hasTopology && !hasConnections {
+		return
+	}
+
+	opts.Capabilities = maps.Clone(opts.Capabilities)
+	delete(opts.Capabilities, "connection-topology")
+	delete(opts.Capabilities, "connections")
+
+	if topology != fullyConnected && connections == "" {
+		return
+	}
+
+	if opts.XeLinks == nil {
+		opts.XeLinks = &XeLinkOptions{}
+	}
+
+	opts.XeLinks.FullyConnected = topology == fullyConnected
+	opts.XeLinks.Connections = connections
+}
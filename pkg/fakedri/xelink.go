@@ -0,0 +1,311 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakedri
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	xeLinkLabelName  = "xpumanager.intel.com/xe-links"
+	labelControlChar = "Z"
+	// maxXeLinkLabels limits the number of xe-links labels, as each
+	// of them adds to the node object size.
+	maxXeLinkLabels = 64
+	sideCarFile     = "xpum-sidecar-labels.txt"
+)
+
+// XeLinkOptions describe the Xe Link fabric between device tiles, either as
+// a list of links between "gpu.tile" pairs, as an adjacency matrix whose
+// rows and columns are all the device tiles in "gpu.tile" order, as a raw
+// xe-links label connection list, or as fully connected.
+type XeLinkOptions struct {
+	Links  []XeLink `yaml:"Links,omitempty"`
+	Matrix [][]int  `yaml:"Matrix,omitempty"`
+	// Connections is given as-is as the xe-links label value.
+	Connections string `yaml:"Connections,omitempty"`
+	// FullyConnected links all the device tiles to each other.
+	FullyConnected bool `yaml:"FullyConnected,omitempty"`
+}
+
+// XeLink is a link between two device tiles, given in "gpu.tile" format.
+type XeLink struct {
+	From string `yaml:"From"`
+	To   string `yaml:"To"`
+}
+
+// xeLinkNodes returns the "gpu.tile" names of the tiles of all devices.
+func xeLinkNodes(tiles []int) []string {
+	nodes := []string{}
+
+	for gpu := range tiles {
+		for tile := 0; tile < tiles[gpu]; tile++ {
+			nodes = append(nodes, fmt.Sprintf("%d.%d", gpu, tile))
+		}
+	}
+
+	return nodes
+}
+
+// deviceTiles returns the tile count for each device.
+func deviceTiles(opts *GenOptions) []int {
+	tiles := make([]int, opts.DevCount)
+	for i := range tiles {
+		tiles[i] = opts.device(i).TilesPerDev
+	}
+
+	return tiles
+}
+
+func validateXeLinks(opts *GenOptions) error {
+	for _, name := range []string{"connection-topology", "connections"} {
+		if _, ok := opts.Capabilities[name]; ok {
+			return fmt.Errorf("%w: Capabilities '%s' is replaced by XeLinks section in spec %s", ErrInvalidOptions, name, SpecVersion)
+		}
+	}
+
+	if err := opts.XeLinks.validate(opts); err != nil {
+		return err
+	}
+
+	_, connections := xeLinkConnections(opts)
+	if connections == "" {
+		return nil
+	}
+
+	_, err := splitXeLinkLabels(connections)
+
+	return err
+}
+
+func (xelinks *XeLinkOptions) validate(opts *GenOptions) error {
+	if xelinks == nil {
+		return nil
+	}
+
+	given := 0
+
+	for _, set := range []bool{len(xelinks.Links) > 0, len(xelinks.Matrix) > 0, xelinks.Connections != "", xelinks.FullyConnected} {
+		if set {
+			given++
+		}
+	}
+
+	if given > 1 {
+		return fmt.Errorf("%w: XeLinks Links, Matrix, Connections and FullyConnected are mutually exclusive", ErrInvalidOptions)
+	}
+
+	nodes := xeLinkNodes(deviceTiles(opts))
+
+	for i, link := range xelinks.Links {
+		if !slices.Contains(nodes, link.From) || !slices.Contains(nodes, link.To) || link.From == link.To {
+			return fmt.Errorf("%w: XeLinks Links[%d]: invalid link '%s' - '%s', tiles are: %v",
+				ErrInvalidOptions, i, link.From, link.To, nodes)
+		}
+	}
+
+	if len(xelinks.Matrix) == 0 {
+		return nil
+	}
+
+	if len(xelinks.Matrix) != len(nodes) {
+		return fmt.Errorf("%w: XeLinks Matrix has %d rows, expected one per tile (%d)", ErrInvalidOptions, len(xelinks.Matrix), len(nodes))
+	}
+
+	for i, row := range xelinks.Matrix {
+		if len(row) != len(nodes) {
+			return fmt.Errorf("%w: XeLinks Matrix row %d has %d columns, expected %d", ErrInvalidOptions, i, len(row), len(nodes))
+		}
+	}
+
+	for i, row := range xelinks.Matrix {
+		for j, value := range row {
+			if value != xelinks.Matrix[j][i] || (i == j && value != 0) {
+				return fmt.Errorf("%w: XeLinks Matrix is not symmetric with zero diagonal at [%d][%d]", ErrInvalidOptions, i, j)
+			}
+		}
+	}
+
+	return nil
+}
+
+// xeLinkConnections returns the topology name and the connection list
+// for the xe-links labels, or empty connection list if there are no links.
+func xeLinkConnections(opts *GenOptions) (topology, connections string) {
+	xelinks := opts.XeLinks
+
+	switch {
+	case xelinks == nil:
+		return "", ""
+	case xelinks.FullyConnected:
+		return fullyConnected, buildConnectionList(deviceTiles(opts))
+	case xelinks.Connections != "":
+		return "RAW", xelinks.Connections
+	}
+
+	return "XeLinks", xelinks.connectionList(deviceTiles(opts))
+}
+
+// splitXeLinkLabels splits the connection list to label values the same way
+// as pluginutils.SplitAtLastAlphaNum(), i.e. continuation values are prefixed
+// with labelControlChar, but the values are cut only at link boundaries.
+func splitXeLinkLabels(connections string) ([]string, error) {
+	values := []string{}
+	value := ""
+
+	for _, link := range strings.Split(connections, "_") {
+		switch {
+		case value == "":
+			value = link
+		case len(value)+1+len(link) <= maxK8sLabelSize:
+			value += "_" + link
+		default:
+			values = append(values, value)
+			value = labelControlChar + "_" + link
+		}
+
+		if len(value) > maxK8sLabelSize {
+			return nil, fmt.Errorf("%w: Xe Link '%s' does not fit to a label value", ErrInvalidOptions, link)
+		}
+	}
+
+	values = append(values, value)
+
+	if len(values) > maxXeLinkLabels {
+		return nil, fmt.Errorf("%w: Xe Link connections need %d labels, max is %d", ErrInvalidOptions, len(values), maxXeLinkLabels)
+	}
+
+	for _, value := range values {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return nil, fmt.Errorf("%w: invalid xe-links label value '%s': %s", ErrInvalidOptions, value, strings.Join(errs, ", "))
+		}
+	}
+
+	return values, nil
+}
+
+// connectionList returns the links in the same "to-from" link format and
+// order as used for the fully connected topology.
+func (xelinks *XeLinkOptions) connectionList(tiles []int) string {
+	nodes := xeLinkNodes(tiles)
+	index := make(map[string]int, len(nodes))
+
+	for i, node := range nodes {
+		index[node] = i
+	}
+
+	pairs := map[[2]int]bool{}
+
+	for _, link := range xelinks.Links {
+		from, to := index[link.From], index[link.To]
+		pairs[[2]int{min(from, to), max(from, to)}] = true
+	}
+
+	for i, row := range xelinks.Matrix {
+		for j := i + 1; j < len(row); j++ {
+			if row[j] != 0 {
+				pairs[[2]int{i, j}] = true
+			}
+		}
+	}
+
+	sorted := make([][2]int, 0, len(pairs))
+	for pair := range pairs {
+		sorted = append(sorted, pair)
+	}
+
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a][0] != sorted[b][0] {
+			return sorted[a][0] < sorted[b][0]
+		}
+
+		return sorted[a][1] < sorted[b][1]
+	})
+
+	links := make([]string, len(sorted))
+	for i, pair := range sorted {
+		links[i] = nodes[pair[1]] + "-" + nodes[pair[0]]
+	}
+
+	return strings.Join(links, "_")
+}
+
+func makeXelinkSideCar(opts GenOptions) error {
+	topology, connections := xeLinkConnections(&opts)
+	if connections == "" {
+		return nil
+	}
+
+	values, err := splitXeLinkLabels(connections)
+	if err != nil {
+		return err
+	}
+
+	if err := saveSideCarFile(&opts, values); err != nil {
+		return err
+	}
+
+	opts.log().V(1).Info("Generated Xe Link sidecar label file", "gpus", opts.DevCount, "tiles", deviceTiles(&opts), "topology", topology)
+
+	return nil
+}
+
+func buildConnectionList(tiles []int) string {
+	nodes := xeLinkNodes(tiles)
+
+	var links = make(map[string]bool, 0)
+
+	var smap = make([]string, 0)
+
+	for _, from := range nodes {
+		for _, to := range nodes {
+			if to == from {
+				continue
+			}
+
+			link := fmt.Sprintf("%s-%s", to, from)
+
+			reverselink := fmt.Sprintf("%s-%s", from, to)
+			if _, exists := links[reverselink]; !exists {
+				links[link] = true
+
+				smap = append(smap, link)
+			}
+		}
+	}
+
+	return strings.Join(smap, "_")
+}
+
+func saveSideCarFile(opts *GenOptions, values []string) error {
+	labels := make([]string, 0, len(values))
+
+	for i, value := range values {
+		name := xeLinkLabelName
+		if i > 0 {
+			name += strconv.Itoa(i + 1)
+		}
+
+		labels = append(labels, fmt.Sprintf("%s=%s", name, value))
+	}
+
+	return writeNfdFeatureFile(opts, sideCarFile, labels)
+}
@@ -27,6 +27,10 @@ import (
 // to compress devtype a bit, because it's used as a part of the socket's address.
 // Also names of extended resources (without namespace) cannot be longer than 63 characters.
 func GetAfuDevType(interfaceID, afuID string) (string, error) {
+	if len(interfaceID) < 3 || len(afuID) < 3 {
+		return "", errors.Errorf("too short interface ID %q or AFU ID %q", interfaceID, afuID)
+	}
+
 	bin, err := hex.DecodeString(interfaceID + afuID)
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to decode %q and %q", interfaceID, afuID)
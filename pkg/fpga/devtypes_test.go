@@ -48,6 +48,11 @@ func TestGetAfuDevType(t *testing.T) {
 			interfaceID: "unparsable",
 			expectedErr: true,
 		},
+		{
+			name:        "empty interfaceID",
+			afuID:       "d8424dc4a4a3c413f89e433683f9040b",
+			expectedErr: true,
+		},
 	}
 	for _, tt := range tcases {
 		t.Run(tt.name, func(t *testing.T) {
@@ -34,6 +34,32 @@ const (
 
 var (
 	pciAddressRE = regexp.MustCompile(pciAddressRegex)
+
+	// Device families of the FPGA cards supported by the dfl-pci driver,
+	// by "vendor:device" PCI ID.
+	dflDeviceFamilies = map[string]string{
+		"0x8086:0xbcbd": "Integrated FPGA 5.x",
+		"0x8086:0xbcbf": "Integrated FPGA 5.x VF",
+		"0x8086:0xbcc0": "Integrated FPGA 6.x",
+		"0x8086:0xbcc1": "Integrated FPGA 6.x VF",
+		"0x8086:0x09c4": "PAC Arria 10 GX",
+		"0x8086:0x09c5": "PAC Arria 10 GX VF",
+		"0x8086:0x0b30": "PAC N3000",
+		"0x8086:0x0b2b": "PAC D5005",
+		"0x8086:0x0b2c": "PAC D5005 VF",
+		"0x1c2c:0x1000": "Silicom PAC N5010",
+		"0x1c2c:0x1001": "Silicom PAC N5011",
+		"0x8086:0xbcce": "OFS",
+		"0x8086:0xbccf": "OFS VF",
+	}
+
+	// Device families of the Open FPGA Stack (OFS) cards sharing the OFS
+	// PCI device ID, by "subsystem_vendor:subsystem_device" PCI ID.
+	ofsDeviceFamilies = map[string]string{
+		"0x8086:0x1770": "OFS N6000",
+		"0x8086:0x1771": "OFS N6001",
+		"0x8086:0x17d4": "OFS C6100",
+	}
 )
 
 // PCIDevice represents most valuable sysfs information about PCI device.
@@ -110,6 +136,20 @@ func NewPCIDevice(devPath string) (*PCIDevice, error) {
 	return pci, nil
 }
 
+// DFLFamily returns the device family of the FPGA card supported by the
+// dfl-pci driver, e.g. "OFS N6001", or empty string for unknown devices.
+func (pci *PCIDevice) DFLFamily() string {
+	family := dflDeviceFamilies[pci.Vendor+":"+pci.Device]
+
+	if pci.Vendor+":"+pci.Device == "0x8086:0xbcce" {
+		if ofsFamily, ok := ofsDeviceFamilies[pci.SubVendor+":"+pci.SubDevice]; ok {
+			return ofsFamily
+		}
+	}
+
+	return family
+}
+
 // NumVFs returns number of configured VFs.
 func (pci *PCIDevice) NumVFs() int64 {
 	if numvfs, err := strconv.ParseInt(pci.VFs, 10, 32); err == nil {
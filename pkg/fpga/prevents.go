@@ -0,0 +1,149 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fpga
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// PREventDirectory is the directory, where the FPGA CRI hook records the
+// partial reconfiguration events for the FPGA plugin to report.
+const PREventDirectory = "/var/run/intel-fpga/pr-events"
+
+// MaxPREvents is the maximum number of the events kept in the directory, so
+// that it does not grow without limit while the plugin is not reading them.
+const MaxPREvents = 1000
+
+// PREvent is a partial reconfiguration of an FPGA port by the CRI hook.
+type PREvent struct {
+	Start       time.Time     `json:"start"`
+	Port        string        `json:"port"`
+	InterfaceID string        `json:"interfaceId"`
+	AfuID       string        `json:"afuId"`
+	BitstreamID string        `json:"bitstreamId"`
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// eventFiles returns the event files in the directory, the oldest first.
+func eventFiles(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	names := []string{}
+
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		names = append(names, file.Name())
+	}
+
+	// The names start with the start time in nanoseconds.
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) < len(names[j]) || len(names[i]) == len(names[j]) && names[i] < names[j]
+	})
+
+	return names, nil
+}
+
+// WritePREvent atomically writes the event to a new file in the directory.
+// The oldest events are dropped to keep at most MaxPREvents in it.
+func WritePREvent(dir string, event PREvent) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "unable to create PR event directory")
+	}
+
+	names, err := eventFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names[:max(0, len(names)-MaxPREvents+1)] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "unable to drop PR event")
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode PR event")
+	}
+
+	name := fmt.Sprintf("%d-%s.json", event.Start.UnixNano(), event.Port)
+
+	// The readers skip the hidden files.
+	tmpFile := filepath.Join(dir, "."+name)
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return errors.Wrap(err, "unable to write PR event")
+	}
+
+	return errors.WithStack(os.Rename(tmpFile, filepath.Join(dir, name)))
+}
+
+// ReadPREvents reads and removes the events in the directory, in the order
+// they were started. The files that can't be read or decoded are removed.
+func ReadPREvents(dir string) ([]PREvent, error) {
+	names, err := eventFiles(dir)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	events := []PREvent{}
+
+	for _, name := range names {
+		fname := filepath.Join(dir, name)
+
+		data, err := os.ReadFile(fname)
+		if err == nil {
+			err = os.Remove(fname)
+		}
+
+		var event PREvent
+		if err == nil {
+			err = json.Unmarshal(data, &event)
+		}
+
+		if err != nil {
+			klog.Warningf("Dropping PR event %s: %v", fname, err)
+
+			_ = os.Remove(fname)
+
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+
+	return events, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fpga
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadPREventsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now()
+
+	if err := WritePREvent(dir, PREvent{Start: start, Port: "dfl-port.0"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "1-dfl-port.1.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WritePREvent(dir, PREvent{Start: start.Add(time.Second), Port: "dfl-port.2"}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	events, err := ReadPREvents(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if len(events) != 2 || events[0].Port != "dfl-port.0" || events[1].Port != "dfl-port.2" {
+		t.Errorf("expected the decoded events, got %+v", events)
+	}
+
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected all the event files to be removed, got %v", files)
+	}
+}
+
+func TestWritePREventLimit(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now()
+
+	for i := 0; i < MaxPREvents+5; i++ {
+		if err := WritePREvent(dir, PREvent{Start: start.Add(time.Duration(i) * time.Second), Port: "dfl-port.0"}); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+
+	events, err := ReadPREvents(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if len(events) != MaxPREvents || !events[0].Start.Equal(start.Add(5*time.Second)) {
+		t.Errorf("expected the latest %d events, got %d from %v", MaxPREvents, len(events), events[0].Start)
+	}
+}
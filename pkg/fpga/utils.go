@@ -73,7 +73,8 @@ func checkPCIDeviceType(dev commonFpgaAPI) error {
 		return err
 	}
 
-	if pci.Class != fpgaClass {
+	// OFS based designs may use other class codes.
+	if pci.Class != fpgaClass && pci.DFLFamily() == "" {
 		return errors.Errorf("unsupported PCI class device %s  VID=%s PID=%s Class=%s", pci.BDF, pci.Vendor, pci.Device, pci.Class)
 	}
 
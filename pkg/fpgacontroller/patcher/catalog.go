@@ -0,0 +1,168 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fpgav2 "github.com/intel/intel-device-plugins-for-kubernetes/pkg/apis/fpga/v2"
+)
+
+const (
+	catalogTimeout = 5 * time.Second
+	// Period of retrying the failed catalog fetches.
+	catalogRetryPeriod = 30 * time.Second
+)
+
+// catalogEntry is an accelerator function in the bitstream catalog.
+type catalogEntry struct {
+	Name string `json:"name"`
+	fpgav2.AcceleratorFunctionSpec
+}
+
+// HTTPCatalog is a MappingSource resolving the accelerator functions from a
+// bitstream catalog served over HTTP(S) as a JSON list of accelerator function
+// specs with names, e.g.
+//
+//	[{"name": "arria10.dcp1.2-nlb0", "afuId": "d8424dc4a4a3c413f89e433683f9040b",
+//	  "interfaceId": "69528db6eb31577a8c3668f9faa081f6", "mode": "region"}]
+//
+// The catalog is fetched again when it is older than the refresh period. The
+// failed fetches are retried after catalogRetryPeriod at the earliest, and the
+// previous catalog is used until a fetch succeeds.
+type HTTPCatalog struct {
+	fetched time.Time
+	err     error
+	client  *http.Client
+	afs     map[string]*fpgav2.AcceleratorFunction
+	// Closed when the fetch in progress is done.
+	fetching chan struct{}
+	url      string
+	refresh  time.Duration
+	sync.Mutex
+}
+
+// NewHTTPCatalog creates a new HTTPCatalog for the catalog at the given URL.
+func NewHTTPCatalog(url string, refresh time.Duration) *HTTPCatalog {
+	return &HTTPCatalog{
+		client:  &http.Client{Timeout: catalogTimeout},
+		url:     url,
+		refresh: refresh,
+	}
+}
+
+func (c *HTTPCatalog) fetch(ctx context.Context) (map[string]*fpgav2.AcceleratorFunction, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid catalog request")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to fetch catalog %s", c.url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unable to fetch catalog %s: %s", c.url, resp.Status)
+	}
+
+	entries := []catalogEntry{}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode catalog %s", c.url)
+	}
+
+	afs := make(map[string]*fpgav2.AcceleratorFunction, len(entries))
+
+	for _, entry := range entries {
+		if entry.Name == "" || (entry.Mode != af && entry.Mode != region) {
+			return nil, errors.Errorf("invalid catalog %s entry: %+v", c.url, entry)
+		}
+
+		afs[entry.Name] = &fpgav2.AcceleratorFunction{
+			ObjectMeta: metav1.ObjectMeta{Name: entry.Name},
+			Spec:       entry.AcceleratorFunctionSpec,
+		}
+	}
+
+	return afs, nil
+}
+
+// isStale tells whether the catalog should be fetched. The catalog must be
+// locked.
+func (c *HTTPCatalog) isStale() bool {
+	period := c.refresh
+	if c.err != nil {
+		period = min(period, catalogRetryPeriod)
+	}
+
+	return c.fetched.IsZero() || time.Since(c.fetched) > period
+}
+
+// GetAcceleratorFunction returns the accelerator function of the given name
+// from the catalog, or nil if the catalog does not have it. The catalog is
+// fetched without holding the lock, so that the lookups of the other callers
+// are served from the previous catalog meanwhile.
+func (c *HTTPCatalog) GetAcceleratorFunction(ctx context.Context, name string) (*fpgav2.AcceleratorFunction, error) {
+	c.Lock()
+
+	switch {
+	case c.fetching == nil && c.isStale():
+		done := make(chan struct{})
+		c.fetching = done
+		c.Unlock()
+
+		afs, err := c.fetch(ctx)
+
+		c.Lock()
+
+		if err == nil {
+			c.afs = afs
+		}
+
+		c.err = err
+		c.fetched = time.Now()
+		c.fetching = nil
+
+		close(done)
+	case c.fetching != nil && c.afs == nil:
+		// Nothing to serve before the first fetch is done.
+		done := c.fetching
+		c.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		}
+
+		c.Lock()
+	}
+
+	defer c.Unlock()
+
+	if c.afs == nil {
+		return nil, c.err
+	}
+
+	return c.afs[name], nil
+}
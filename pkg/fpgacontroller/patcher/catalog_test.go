@@ -0,0 +1,278 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package patcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2/ktesting"
+
+	fpgav2 "github.com/intel/intel-device-plugins-for-kubernetes/pkg/apis/fpga/v2"
+)
+
+const testCatalog = `[
+  {"name": "arria10.dcp1.2-nlb0", "afuId": "d8424dc4a4a3c413f89e433683f9040b", "interfaceId": "69528db6eb31577a8c3668f9faa081f6", "mode": "region"},
+  {"name": "arria10.dcp1.2-nlb0-preprogrammed", "afuId": "d8424dc4a4a3c413f89e433683f9040b", "interfaceId": "69528db6eb31577a8c3668f9faa081f6", "mode": "af"}
+]`
+
+func TestHTTPCatalog(t *testing.T) {
+	tcases := []struct {
+		name        string
+		catalog     string
+		afName      string
+		status      int
+		expectedErr bool
+		expectedAf  bool
+	}{
+		{
+			name:       "accelerator function in catalog",
+			catalog:    testCatalog,
+			status:     http.StatusOK,
+			afName:     "arria10.dcp1.2-nlb0-preprogrammed",
+			expectedAf: true,
+		},
+		{
+			name:    "accelerator function not in catalog",
+			catalog: testCatalog,
+			status:  http.StatusOK,
+			afName:  "arria10.dcp1.2-nlb3",
+		},
+		{
+			name:        "catalog entry with invalid mode",
+			catalog:     `[{"name": "arria10", "afuId": "d8424dc4", "interfaceId": "69528db6", "mode": "regiondevel"}]`,
+			status:      http.StatusOK,
+			afName:      "arria10",
+			expectedErr: true,
+		},
+		{
+			name:        "catalog not available",
+			status:      http.StatusNotFound,
+			afName:      "arria10.dcp1.2-nlb0",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				requests++
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.catalog)
+			}))
+			defer server.Close()
+
+			_, ctx := ktesting.NewTestContext(t)
+			catalog := NewHTTPCatalog(server.URL, time.Hour)
+
+			for i := 0; i < 2; i++ {
+				accfunc, err := catalog.GetAcceleratorFunction(ctx, tc.afName)
+				if tc.expectedErr != (err != nil) {
+					t.Fatalf("unexpected error: %+v", err)
+				}
+
+				if tc.expectedAf != (accfunc != nil) {
+					t.Fatalf("unexpected accelerator function: %+v", accfunc)
+				}
+			}
+
+			// The failed fetches are not retried right away either.
+			if requests != 1 {
+				t.Errorf("expected the catalog to be fetched once, got %d times", requests)
+			}
+		})
+	}
+}
+
+func TestResolveExternal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, testCatalog)
+	}))
+	defer server.Close()
+
+	log, ctx := ktesting.NewTestContext(t)
+	p := newPatcher(log, NewHTTPCatalog(server.URL, time.Hour))
+
+	container := corev1.Container{
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				"fpga.intel.com/arria10.dcp1.2-nlb0": resource.MustParse("1"),
+			},
+			Requests: corev1.ResourceList{
+				"fpga.intel.com/arria10.dcp1.2-nlb0": resource.MustParse("1"),
+			},
+		},
+	}
+
+	if err := p.resolveExternal(ctx, container); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	ops, err := p.getPatchOps(0, container)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	// Remove and add ops for limits and requests, and the env variables.
+	if len(ops) != 5 {
+		t.Errorf("expected 5 patch operations, got %d: %v", len(ops), ops)
+	}
+
+	server.Close()
+
+	// The resolved mapping does not need the catalog anymore.
+	if err := p.resolveExternal(ctx, container); err != nil {
+		t.Errorf("unexpected error: %+v", err)
+	}
+
+	if _, err := p.getPatchOps(0, container); err != nil {
+		t.Errorf("unexpected error: %+v", err)
+	}
+}
+
+// fakeSource is a MappingSource counting the lookups.
+type fakeSource struct {
+	afs     map[string]*fpgav2.AcceleratorFunction
+	lookups int
+}
+
+func (s *fakeSource) GetAcceleratorFunction(_ context.Context, name string) (*fpgav2.AcceleratorFunction, error) {
+	s.lookups++
+
+	return s.afs[name], nil
+}
+
+func TestExternalMappingCache(t *testing.T) {
+	name := "arria10.dcp1.2-nlb0-preprogrammed"
+	source := &fakeSource{
+		afs: map[string]*fpgav2.AcceleratorFunction{
+			name: {
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: fpgav2.AcceleratorFunctionSpec{
+					AfuID:       "d8424dc4a4a3c413f89e433683f9040b",
+					InterfaceID: "69528db6eb31577a8c3668f9faa081f6",
+					Mode:        af,
+				},
+			},
+		},
+	}
+
+	log, ctx := ktesting.NewTestContext(t)
+	p := newPatcher(log, source)
+
+	newContainer := func(rname string) corev1.Container {
+		return corev1.Container{
+			Resources: corev1.ResourceRequirements{
+				Limits:   corev1.ResourceList{corev1.ResourceName(namespace + "/" + rname): resource.MustParse("1")},
+				Requests: corev1.ResourceList{corev1.ResourceName(namespace + "/" + rname): resource.MustParse("1")},
+			},
+		}
+	}
+
+	expire := func() {
+		for rname, ext := range p.external {
+			ext.resolved = ext.resolved.Add(-externalMappingTTL)
+			p.external[rname] = ext
+		}
+	}
+
+	for _, rname := range []string{name, name, "unknown", "unknown"} {
+		if err := p.resolveExternal(ctx, newContainer(rname)); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+
+	// The known and the unknown names are looked up once.
+	if source.lookups != 2 {
+		t.Errorf("expected 2 lookups, got %d", source.lookups)
+	}
+
+	if _, err := p.getPatchOps(0, newContainer(name)); err != nil {
+		t.Errorf("unexpected error: %+v", err)
+	}
+
+	// The mapping is not in the CR-backed maps.
+	if len(p.afMap) != 0 || len(p.resourceMap) != 0 {
+		t.Errorf("expected no CR mappings, got %v", p.resourceMap)
+	}
+
+	// The mapping removed from the source is dropped after it expires.
+	delete(source.afs, name)
+	expire()
+
+	if err := p.resolveExternal(ctx, newContainer(name)); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if _, err := p.getPatchOps(0, newContainer(name)); err == nil {
+		t.Error("expected an error for the mapping removed from the source")
+	}
+}
+
+func TestHTTPCatalogRefresh(t *testing.T) {
+	block := make(chan struct{})
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		if requests > 1 {
+			<-block
+		}
+		fmt.Fprint(w, testCatalog)
+	}))
+	defer server.Close()
+
+	_, ctx := ktesting.NewTestContext(t)
+	catalog := NewHTTPCatalog(server.URL, 0)
+	name := "arria10.dcp1.2-nlb0"
+
+	if accfunc, err := catalog.GetAcceleratorFunction(ctx, name); err != nil || accfunc == nil {
+		t.Fatalf("unexpected lookup result: %+v, %+v", accfunc, err)
+	}
+
+	refreshed := make(chan struct{})
+	go func() {
+		_, _ = catalog.GetAcceleratorFunction(ctx, name)
+		close(refreshed)
+	}()
+
+	// Wait for the refresh to start.
+	for {
+		catalog.Lock()
+		fetching := catalog.fetching != nil
+		catalog.Unlock()
+
+		if fetching {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	// The lookups during the refresh are served from the previous catalog.
+	if accfunc, err := catalog.GetAcceleratorFunction(ctx, name); err != nil || accfunc == nil {
+		t.Errorf("unexpected lookup result during refresh: %+v, %+v", accfunc, err)
+	}
+
+	close(block)
+	<-refreshed
+}
@@ -17,10 +17,12 @@ package patcher
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -66,10 +68,32 @@ const (
         }`
 )
 
+// Period the mappings resolved from the mapping sources, and the resource
+// names the sources do not know, are cached for.
+const externalMappingTTL = time.Minute
+
 var (
 	rfc6901Escaper = strings.NewReplacer("~", "~0", "/", "~1")
 )
 
+// MappingSource resolves the FPGA resource names, which have no
+// AcceleratorFunction CR in the namespace, from outside the cluster, e.g.
+// from a bitstream catalog or a registry.
+type MappingSource interface {
+	// GetAcceleratorFunction returns the accelerator function of the given
+	// resource name without the namespace, or nil if the source does not
+	// know it.
+	GetAcceleratorFunction(ctx context.Context, name string) (*fpgav2.AcceleratorFunction, error)
+}
+
+// externalMapping is a mapping resolved from the mapping sources. The mapping
+// of a resource name the sources do not know has no accelerator function.
+type externalMapping struct {
+	resolved time.Time
+	accfunc  *fpgav2.AcceleratorFunction
+	mapping  string
+}
+
 // Patcher stores FPGA controller's state.
 //
 //nolint:govet
@@ -78,23 +102,35 @@ type Patcher struct {
 
 	log logr.Logger
 
+	sources []MappingSource
+
+	// Patcher of the shared namespace, whose mappings are used for the
+	// resource names without mappings in this namespace.
+	shared *Patcher
+
 	afMap           map[string]*fpgav2.AcceleratorFunction
 	resourceMap     map[string]string
 	resourceModeMap map[string]string
 
+	// Mappings resolved from the mapping sources, kept apart from the ones
+	// of the AcceleratorFunction and FpgaRegion CRs.
+	external map[string]externalMapping
+
 	// This set is needed to maintain the webhook's idempotence: it must be possible to
 	// resolve actual resources (AFs and regions) to themselves. For this we build
 	// a set of identities which must be accepted by the webhook without any transformation.
 	identitySet map[string]int
 }
 
-func newPatcher(log logr.Logger) *Patcher {
+func newPatcher(log logr.Logger, sources ...MappingSource) *Patcher {
 	return &Patcher{
 		log:             log,
+		sources:         sources,
 		afMap:           make(map[string]*fpgav2.AcceleratorFunction),
 		resourceMap:     make(map[string]string),
 		resourceModeMap: make(map[string]string),
 		identitySet:     make(map[string]int),
+		external:        make(map[string]externalMapping),
 	}
 }
 
@@ -112,28 +148,61 @@ func (p *Patcher) decIdentity(id string) {
 	}
 }
 
+// afMapping returns the resource the accelerator function is mapped to.
+func afMapping(accfunc *fpgav2.AcceleratorFunction) (string, error) {
+	if accfunc.Spec.Mode == af {
+		devtype, err := fpga.GetAfuDevType(accfunc.Spec.InterfaceID, accfunc.Spec.AfuID)
+		if err != nil {
+			return "", err
+		}
+
+		return rfc6901Escaper.Replace(namespace + "/" + devtype), nil
+	}
+
+	return rfc6901Escaper.Replace(namespace + "/region-" + accfunc.Spec.InterfaceID), nil
+}
+
 func (p *Patcher) AddAf(accfunc *fpgav2.AcceleratorFunction) error {
 	defer p.Unlock()
 	p.Lock()
 
+	mapping, err := afMapping(accfunc)
+	if err != nil {
+		return err
+	}
+
 	p.afMap[namespace+"/"+accfunc.Name] = accfunc
+	p.resourceMap[namespace+"/"+accfunc.Name] = mapping
+	p.incIdentity(mapping)
+	p.resourceModeMap[namespace+"/"+accfunc.Name] = accfunc.Spec.Mode
 
-	if accfunc.Spec.Mode == af {
-		devtype, err := fpga.GetAfuDevType(accfunc.Spec.InterfaceID, accfunc.Spec.AfuID)
+	return nil
+}
+
+// setExternal caches the accelerator function resolved from the mapping
+// sources for the resource name, or with nil, that the sources do not know it.
+func (p *Patcher) setExternal(rname string, accfunc *fpgav2.AcceleratorFunction) error {
+	defer p.Unlock()
+	p.Lock()
+
+	ext := externalMapping{resolved: time.Now(), accfunc: accfunc}
+
+	if accfunc != nil {
+		mapping, err := afMapping(accfunc)
 		if err != nil {
 			return err
 		}
 
-		mapping := rfc6901Escaper.Replace(namespace + "/" + devtype)
-		p.resourceMap[namespace+"/"+accfunc.Name] = mapping
-		p.incIdentity(mapping)
-	} else {
-		mapping := rfc6901Escaper.Replace(namespace + "/region-" + accfunc.Spec.InterfaceID)
-		p.resourceMap[namespace+"/"+accfunc.Name] = mapping
-		p.incIdentity(mapping)
+		ext.mapping = mapping
 	}
 
-	p.resourceModeMap[namespace+"/"+accfunc.Name] = accfunc.Spec.Mode
+	for name, cached := range p.external {
+		if time.Since(cached.resolved) >= externalMappingTTL {
+			delete(p.external, name)
+		}
+	}
+
+	p.external[rname] = ext
 
 	return nil
 }
@@ -171,6 +240,144 @@ func (p *Patcher) RemoveRegion(name string) {
 	delete(p.resourceModeMap, nname)
 }
 
+// isResolved tells whether the resource name was looked up from the mapping
+// sources within externalMappingTTL, whether or not they knew it.
+func (p *Patcher) isResolved(rname string) bool {
+	defer p.Unlock()
+	p.Lock()
+
+	ext, found := p.external[rname]
+
+	return found && time.Since(ext.resolved) < externalMappingTTL
+}
+
+// lookupCR returns the mode, the mapped resource and the accelerator function
+// of the resource name from the CRs of the namespace. The patcher must be
+// locked.
+func (p *Patcher) lookupCR(rname string) (string, string, *fpgav2.AcceleratorFunction, bool) {
+	mode, found := p.resourceModeMap[rname]
+
+	return mode, p.resourceMap[rname], p.afMap[rname], found
+}
+
+// lookup returns the mode, the mapped resource and the accelerator function
+// of the resource name from the CRs of this namespace, or else of the shared
+// namespace, or else from the mapping sources. The patcher must be locked.
+func (p *Patcher) lookup(rname string) (string, string, *fpgav2.AcceleratorFunction, bool) {
+	if mode, mapping, accfunc, found := p.lookupCR(rname); found {
+		return mode, mapping, accfunc, true
+	}
+
+	if p.shared != nil {
+		p.shared.Lock()
+		mode, mapping, accfunc, found := p.shared.lookupCR(rname)
+		p.shared.Unlock()
+
+		if found {
+			return mode, mapping, accfunc, true
+		}
+	}
+
+	if ext, found := p.external[rname]; found && ext.accfunc != nil && time.Since(ext.resolved) < externalMappingTTL {
+		return ext.accfunc.Spec.Mode, ext.mapping, ext.accfunc, true
+	}
+
+	return "", "", nil, false
+}
+
+// isIdentity tells whether the resource name is an actual resource mapped in
+// this namespace, in the shared namespace or from the mapping sources. The
+// patcher must be locked.
+func (p *Patcher) isIdentity(name string) bool {
+	if _, isVirtual := p.identitySet[rfc6901Escaper.Replace(name)]; isVirtual {
+		return true
+	}
+
+	for _, ext := range p.external {
+		if ext.accfunc != nil && ext.mapping == rfc6901Escaper.Replace(name) && time.Since(ext.resolved) < externalMappingTTL {
+			return true
+		}
+	}
+
+	if p.shared == nil {
+		return false
+	}
+
+	defer p.shared.Unlock()
+	p.shared.Lock()
+
+	_, isVirtual := p.shared.identitySet[rfc6901Escaper.Replace(name)]
+
+	return isVirtual
+}
+
+func (p *Patcher) isKnown(rname string) bool {
+	defer p.Unlock()
+	p.Lock()
+
+	if _, _, _, found := p.lookup(rname); found {
+		return true
+	}
+
+	return p.isIdentity(rname)
+}
+
+// resolveExternal resolves the FPGA resources requested by the container,
+// which have no mappings in the CRs, from the mapping sources. The results
+// are cached for externalMappingTTL, so that the changes of the sources are
+// picked up after it, e.g. the mappings removed from a catalog.
+func (p *Patcher) resolveExternal(ctx context.Context, container corev1.Container) error {
+	if len(p.sources) == 0 {
+		return nil
+	}
+
+	requestedResources, err := containers.GetRequestedResources(container, namespace)
+	if err != nil {
+		return err
+	}
+
+	for rname := range requestedResources {
+		if p.isResolved(rname) || p.isKnown(rname) {
+			continue
+		}
+
+		var resolved *fpgav2.AcceleratorFunction
+
+		failed := false
+
+		for _, source := range p.sources {
+			accfunc, err := source.GetAcceleratorFunction(ctx, strings.TrimPrefix(rname, namespace+"/"))
+			if err != nil {
+				p.log.Error(err, "unable to resolve resource from mapping source", "resource", rname)
+
+				failed = true
+
+				continue
+			}
+
+			if accfunc != nil {
+				resolved = accfunc
+				break
+			}
+		}
+
+		// The failed lookups are retried on the next request.
+		if resolved == nil && failed {
+			continue
+		}
+
+		if err := p.setExternal(rname, resolved); err != nil {
+			return err
+		}
+
+		if resolved != nil {
+			p.log.V(1).Info("resolved resource from mapping source", "resource", rname, "mode", resolved.Spec.Mode)
+		}
+	}
+
+	return nil
+}
+
 // sanitizeContainer filters out env variables reserved for CRI hook.
 func sanitizeContainer(container corev1.Container) corev1.Container {
 	i := 0
@@ -194,7 +401,7 @@ func sanitizeContainer(container corev1.Container) corev1.Container {
 }
 
 func (p *Patcher) getNoopsOrError(name string) ([]string, error) {
-	if _, isVirtual := p.identitySet[rfc6901Escaper.Replace(name)]; isVirtual {
+	if p.isIdentity(name) {
 		// `name` is not a real mapping, but a virtual one for an actual resource which
 		// needs to be resolved to itself with no transformations.
 		return []string{}, nil
@@ -221,7 +428,7 @@ func (p *Patcher) getPatchOps(containerIdx int, container corev1.Container) ([]s
 	ops := make([]string, 0, 2*len(requestedResources))
 
 	for rname, quantity := range requestedResources {
-		mode, found := p.resourceModeMap[rname]
+		mode, mappedName, accfunc, found := p.lookup(rname)
 		if !found {
 			return p.getNoopsOrError(rname)
 		}
@@ -238,13 +445,13 @@ func (p *Patcher) getPatchOps(containerIdx int, container corev1.Container) ([]s
 			for i := int64(0); i < quantity; i++ {
 				counter++
 
-				envVars[fmt.Sprintf("FPGA_REGION_%d", counter)] = p.afMap[rname].Spec.InterfaceID
-				envVars[fmt.Sprintf("FPGA_AFU_%d", counter)] = p.afMap[rname].Spec.AfuID
+				envVars[fmt.Sprintf("FPGA_REGION_%d", counter)] = accfunc.Spec.InterfaceID
+				envVars[fmt.Sprintf("FPGA_AFU_%d", counter)] = accfunc.Spec.AfuID
 			}
 		default:
 			// Let admin know about broken af CRD.
 			err := errors.Errorf("%q is registered with unknown mode %q instead of %q or %q",
-				rname, p.resourceModeMap[rname], af, region)
+				rname, mode, af, region)
 			p.log.Error(err, "unable to construct patching operations")
 
 			return nil, err
@@ -256,7 +463,6 @@ func (p *Patcher) getPatchOps(containerIdx int, container corev1.Container) ([]s
 			return nil, errors.New("container cannot be scheduled as it requires resources operated in different modes")
 		}
 
-		mappedName := p.resourceMap[rname]
 		resources[mappedName] = resources[mappedName] + quantity
 
 		// Add operations to remove unresolved resources from the pod.
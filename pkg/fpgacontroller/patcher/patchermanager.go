@@ -42,6 +42,9 @@ func init() {
 type Manager struct {
 	patchers map[string]*Patcher
 	log      logr.Logger
+	sources  []MappingSource
+	// Namespace whose mappings are shared with all namespaces.
+	sharedNamespace string
 }
 
 // NewPatcherManager creates a new Manager.
@@ -52,14 +55,33 @@ func NewPatcherManager(log logr.Logger) *Manager {
 	}
 }
 
+// AddMappingSource adds a source for resolving the FPGA resources without
+// AcceleratorFunction CRs in all namespaces. The sources must be added before
+// the webhook is started.
+func (pm *Manager) AddMappingSource(source MappingSource) {
+	pm.sources = append(pm.sources, source)
+}
+
+// SetSharedNamespace sets the namespace, whose AcceleratorFunction and
+// FpgaRegion CRs map the resource names in all namespaces. The mappings in
+// the pod's namespace take precedence over them. The shared namespace must be
+// set before the webhook is started.
+func (pm *Manager) SetSharedNamespace(ns string) {
+	pm.sharedNamespace = ns
+}
+
 // GetPatcher returns a patcher specific to given namespace.
 func (pm *Manager) GetPatcher(namespace string) *Patcher {
 	if p, ok := pm.patchers[namespace]; ok {
 		return p
 	}
 
-	p := newPatcher(pm.log.WithValues("namespace", namespace))
+	p := newPatcher(pm.log.WithValues("namespace", namespace), pm.sources...)
 	pm.patchers[namespace] = p
+
+	if pm.sharedNamespace != "" && namespace != pm.sharedNamespace {
+		p.shared = pm.GetPatcher(pm.sharedNamespace)
+	}
 	pm.log.V(1).Info("created new patcher", "namespace", namespace)
 
 	return p
@@ -111,6 +133,10 @@ func (pm *Manager) mutate(ctx context.Context, req webhook.AdmissionRequest) web
 	ops := []string{}
 
 	for containerIdx, container := range pod.Spec.Containers {
+		if err := patcher.resolveExternal(ctx, container); err != nil {
+			return toAdmissionResponse(err)
+		}
+
 		patchOps, err := patcher.getPatchOps(containerIdx, container)
 		if err != nil {
 			return toAdmissionResponse(err)
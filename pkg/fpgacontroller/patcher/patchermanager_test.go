@@ -16,6 +16,7 @@ package patcher
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	admissionv1 "k8s.io/api/admission/v1"
@@ -194,3 +195,89 @@ func TestMutate(t *testing.T) {
 		})
 	}
 }
+
+func TestSharedNamespace(t *testing.T) {
+	log, _ := ktesting.NewTestContext(t)
+	pm := NewPatcherManager(log)
+	pm.SetSharedNamespace("fpga-mappings")
+
+	for ns, afuID := range map[string]string{
+		"fpga-mappings": "d8424dc4a4a3c413f89e433683f9040b",
+		"team-a":        "f7df405cbd7acf7222f144b0b93acd18",
+	} {
+		err := pm.GetPatcher(ns).AddAf(&fpgav2.AcceleratorFunction{
+			ObjectMeta: metav1.ObjectMeta{Name: "arria10-nlb0", Namespace: ns},
+			Spec: fpgav2.AcceleratorFunctionSpec{
+				AfuID:       afuID,
+				InterfaceID: "ce48969398f05f33946d560708be108a",
+				Mode:        region,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcases := []struct {
+		name        string
+		namespace   string
+		resource    string
+		expectedAfu string
+		expectedOps int
+		expectedErr bool
+	}{
+		{
+			name:        "mapping of the pod's namespace takes precedence",
+			namespace:   "team-a",
+			resource:    "fpga.intel.com/arria10-nlb0",
+			expectedAfu: "f7df405cbd7acf7222f144b0b93acd18",
+			expectedOps: 5,
+		},
+		{
+			name:        "mapping of the shared namespace",
+			namespace:   "team-b",
+			resource:    "fpga.intel.com/arria10-nlb0",
+			expectedAfu: "d8424dc4a4a3c413f89e433683f9040b",
+			expectedOps: 5,
+		},
+		{
+			name:      "actual resource mapped in the shared namespace",
+			namespace: "team-b",
+			resource:  "fpga.intel.com/region-ce48969398f05f33946d560708be108a",
+		},
+		{
+			name:        "unknown resource",
+			namespace:   "team-b",
+			resource:    "fpga.intel.com/arria10-nlb3",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tcases {
+		t.Run(tt.name, func(t *testing.T) {
+			container := corev1.Container{
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						corev1.ResourceName(tt.resource): resource.MustParse("1"),
+					},
+					Requests: corev1.ResourceList{
+						corev1.ResourceName(tt.resource): resource.MustParse("1"),
+					},
+				},
+			}
+
+			ops, err := pm.GetPatcher(tt.namespace).getPatchOps(0, container)
+			if tt.expectedErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(ops) != tt.expectedOps {
+				t.Errorf("expected %d operations, got %d: %v", tt.expectedOps, len(ops), ops)
+			}
+
+			if tt.expectedAfu != "" && !strings.Contains(strings.Join(ops, ","), tt.expectedAfu) {
+				t.Errorf("expected AFU %s in the operations: %v", tt.expectedAfu, ops)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idxd
+
+import (
+	"maps"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+)
+
+// Capabilities configures the detection of the capabilities of the workqueues.
+type Capabilities struct {
+	// Opcodes of the operations of each capability, e.g. "compress".
+	Opcodes map[string][]int
+	// NFD feature file the capability node labels are written to, if set.
+	NFDFeatureFile string
+	// Prefix of the capability node labels, e.g. "iaa.intel.com/capability.".
+	LabelPrefix string
+	// Advertise the workqueues with a single capability as resources of
+	// their own, e.g. "wq-user-dedicated-compress".
+	SplitResources bool
+}
+
+// SetCapabilities enables the detection of the capabilities of the
+// workqueues. With NFDFeatureFile, the node labels are removed when the
+// plugin is terminated.
+func (dp *DevicePlugin) SetCapabilities(caps *Capabilities) {
+	dp.caps = caps
+
+	if caps.NFDFeatureFile != "" {
+		go removeLabelsOnExit(caps.NFDFeatureFile)
+	}
+}
+
+// readOpcodes returns the opcodes set in the operation bitmap file of the
+// device (op_cap) or of the workqueue (op_config). The kernel prints the
+// bitmap either as 64-bit "0x" prefixed words, the least significant first,
+// or as 32-bit words, the most significant first.
+func readOpcodes(fpath string) (map[int]bool, error) {
+	data, err := readFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.Split(strings.TrimSuffix(data, ","), ",")
+	lsbFirst := strings.HasPrefix(words[0], "0x")
+
+	wordBits := 32
+	if lsbFirst {
+		wordBits = 64
+	}
+
+	opcodes := map[int]bool{}
+
+	for i, word := range words {
+		value, err := strconv.ParseUint(strings.TrimPrefix(word, "0x"), 16, wordBits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid operation bitmap in %s", fpath)
+		}
+
+		offset := i * wordBits
+		if !lsbFirst {
+			offset = (len(words) - 1 - i) * wordBits
+		}
+
+		for bit := 0; bit < wordBits; bit++ {
+			if value&(1<<bit) != 0 {
+				opcodes[offset+bit] = true
+			}
+		}
+	}
+
+	return opcodes, nil
+}
+
+// getCapabilities returns the sorted capabilities of the workqueue, given
+// the operations the workqueue is configured for, or when the device does
+// not support configuring them, the operations of the device.
+func (dp *DevicePlugin) getCapabilities(queueDir string) ([]string, error) {
+	opcodes, err := readOpcodes(path.Join(queueDir, "op_config"))
+	if err != nil {
+		opcodes, err = readOpcodes(path.Join(filepath.Dir(queueDir), "op_cap"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	caps := []string{}
+
+	for _, name := range slices.Sorted(maps.Keys(dp.caps.Opcodes)) {
+		if slices.ContainsFunc(dp.caps.Opcodes[name], func(opcode int) bool { return opcodes[opcode] }) {
+			caps = append(caps, name)
+		}
+	}
+
+	return caps, nil
+}
+
+// writeLabels atomically writes the labels to the NFD feature file.
+func writeLabels(labelFile string, labels map[string]string) error {
+	var sb strings.Builder
+
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		sb.WriteString(name + "=" + labels[name] + "\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(labelFile), 0755); err != nil {
+		return errors.Wrap(err, "failed to create NFD feature directory")
+	}
+
+	// NFD ignores the hidden files.
+	tmpFile := filepath.Join(filepath.Dir(labelFile), "."+filepath.Base(labelFile))
+
+	if err := os.WriteFile(tmpFile, []byte(sb.String()), 0644); err != nil {
+		return errors.Wrap(err, "failed to write labels")
+	}
+
+	return os.Rename(tmpFile, labelFile)
+}
+
+// updateLabels writes a node label for each of the capabilities of the
+// enabled workqueues to the NFD feature file, when they have changed.
+func (dp *DevicePlugin) updateLabels(caps map[string]bool) {
+	if dp.caps == nil || dp.caps.NFDFeatureFile == "" {
+		return
+	}
+
+	labels := map[string]string{}
+	for name := range caps {
+		labels[dp.caps.LabelPrefix+name] = "true"
+	}
+
+	if dp.labels != nil && maps.Equal(labels, dp.labels) {
+		return
+	}
+
+	klog.V(1).Infof("Writing node labels %v", labels)
+
+	if err := writeLabels(dp.caps.NFDFeatureFile, labels); err != nil {
+		klog.Warningf("failed to write node labels: %+v", err)
+		return
+	}
+
+	dp.labels = labels
+}
+
+// removeLabelsOnExit removes the NFD feature file, and so the node labels,
+// when the plugin is terminated.
+func removeLabelsOnExit(labelFile string) {
+	interruptChan := make(chan os.Signal, 1)
+	signal.Notify(interruptChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
+
+	interrupt := <-interruptChan
+	klog.V(2).Infof("Interrupt %d received, removing label file", interrupt)
+
+	if err := os.Remove(labelFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		klog.Errorf("Failed to cleanup label file: %+v", err)
+	}
+
+	os.Exit(0)
+}
@@ -19,6 +19,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -42,9 +43,12 @@ type getDevNodesFunc func(devDir, charDevDir, wqName string) ([]pluginapi.Device
 
 // DevicePlugin defines properties of the idxd device plugin.
 type DevicePlugin struct {
-	scanTicker   *time.Ticker
-	scanDone     chan bool
-	getDevNodes  getDevNodesFunc
+	scanTicker  *time.Ticker
+	scanDone    chan bool
+	getDevNodes getDevNodesFunc
+	caps        *Capabilities
+	// Node labels written to the NFD feature file by the previous scan.
+	labels       map[string]string
 	statePattern string
 	devDir       string
 	charDevDir   string
@@ -93,6 +97,30 @@ func readFile(fpath string) (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
+// sizeEnvName returns the name of the environment variable with the size of
+// the work queue, e.g. IDXD_WQ0_1_SIZE for wq0.1. The work queue names are
+// unique across the DSA and IAA devices.
+func sizeEnvName(wqName string) string {
+	return "IDXD_" + strings.ToUpper(strings.ReplaceAll(wqName, ".", "_")) + "_SIZE"
+}
+
+// getTopology returns the NUMA node of the idxd device as the topology hint of
+// its workqueues, so that they can be aligned with the CPUs and memory of the
+// containers. Returns nil when the device has no NUMA node.
+func getTopology(deviceDir string) *pluginapi.TopologyInfo {
+	numaNode, err := readFile(path.Join(deviceDir, "numa_node"))
+	if err != nil {
+		return nil
+	}
+
+	node, err := strconv.ParseInt(numaNode, 10, 64)
+	if err != nil || node < 0 {
+		return nil
+	}
+
+	return &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: node}}}
+}
+
 // getDevNodes collects device nodes that belong to working queue.
 func getDevNodes(devDir, charDevDir, wqName string) ([]pluginapi.DeviceSpec, error) {
 	// check if /dev/dsa/<work queue> device node exists
@@ -154,6 +182,7 @@ func (dp *DevicePlugin) scan() (dpapi.DeviceTree, error) {
 	}
 
 	devTree := dpapi.NewDeviceTree()
+	nodeCaps := map[string]bool{}
 
 	for _, fpath := range matches {
 		// Read queue state entry
@@ -195,14 +224,51 @@ func (dp *DevicePlugin) scan() (dpapi.DeviceTree, error) {
 			amount = 1
 		}
 
-		klog.V(4).Infof("%s: amount: %d, type: %s, mode: %s, nodes: %+v", wqName, amount, wqType, wqMode, devNodes)
+		// Tell the workloads the queue size, e.g. to size their batches of
+		// descriptors, as dedicated and shared queues are allocated as is.
+		var envs map[string]string
+		if wqSize, err := readFile(path.Join(queueDir, "size")); err == nil {
+			envs = map[string]string{sizeEnvName(wqName): wqSize}
+		}
+
+		klog.V(4).Infof("%s: amount: %d, type: %s, mode: %s, nodes: %+v, envs: %v", wqName, amount, wqType, wqMode, devNodes, envs)
+
+		deviceType := fmt.Sprintf("wq-%s-%s", wqType, wqMode)
+
+		if dp.caps != nil {
+			caps, err := dp.getCapabilities(queueDir)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, name := range caps {
+				nodeCaps[name] = true
+			}
+
+			// The workqueues with several capabilities serve any of them.
+			if dp.caps.SplitResources && len(caps) == 1 {
+				deviceType = deviceType + "-" + caps[0]
+			}
+		}
+
+		topology := getTopology(filepath.Dir(queueDir))
 
 		for i := 0; i < amount; i++ {
-			deviceType := fmt.Sprintf("wq-%s-%s", wqType, wqMode)
 			deviceID := fmt.Sprintf("%s-%s-%d", deviceType, wqName, i)
-			devTree.AddDevice(deviceType, deviceID, dpapi.NewDeviceInfo(pluginapi.Healthy, devNodes, nil, nil, nil, nil))
+
+			var devInfo dpapi.DeviceInfo
+			if topology != nil {
+				devInfo = dpapi.NewDeviceInfoWithTopologyHints(pluginapi.Healthy, devNodes, nil, envs, nil, topology, nil)
+			} else {
+				// Fall back to the topology of the device nodes.
+				devInfo = dpapi.NewDeviceInfo(pluginapi.Healthy, devNodes, nil, envs, nil, nil)
+			}
+
+			devTree.AddDevice(deviceType, deviceID, devInfo)
 		}
 	}
 
+	dp.updateLabels(nodeCaps)
+
 	return devTree, nil
 }
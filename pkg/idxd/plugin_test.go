@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 
 	dpapi "github.com/intel/intel-device-plugins-for-kubernetes/pkg/deviceplugin"
@@ -269,3 +270,184 @@ func checkDeviceTree(deviceTree dpapi.DeviceTree, expectedResult map[string]int,
 
 	return nil
 }
+
+func TestWorkQueueSize(t *testing.T) {
+	sysfs := path.Join(t.TempDir(), "sys/bus/dsa/devices")
+
+	for _, wq := range []string{"dsa0/wq0.0", "dsa0/wq0.1"} {
+		if err := os.MkdirAll(path.Join(sysfs, wq), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for filename, body := range map[string]string{
+		"dsa0/wq0.0/state": "enabled",
+		"dsa0/wq0.0/mode":  "dedicated",
+		"dsa0/wq0.0/type":  "user",
+		"dsa0/wq0.0/size":  "16\n",
+		"dsa0/wq0.1/state": "enabled",
+		"dsa0/wq0.1/mode":  "shared",
+		"dsa0/wq0.1/type":  "user",
+		"dsa0/wq0.1/size":  "112\n",
+	} {
+		if err := os.WriteFile(path.Join(sysfs, filename), []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin := NewDevicePlugin(path.Join(sysfs, "dsa*/wq*/state"), "", 2)
+	plugin.getDevNodes = getFakeDevNodes
+
+	tree, err := plugin.scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	for resource, devices := range map[string]map[string]string{
+		"wq-user-dedicated": {"wq-user-dedicated-wq0.0-0": "IDXD_WQ0_0_SIZE=16"},
+		"wq-user-shared": {
+			"wq-user-shared-wq0.1-0": "IDXD_WQ0_1_SIZE=112",
+			"wq-user-shared-wq0.1-1": "IDXD_WQ0_1_SIZE=112",
+		},
+	} {
+		for id, expected := range devices {
+			envs := reflect.ValueOf(tree[resource][id]).FieldByName("envs")
+			if envs.Len() != 1 {
+				t.Errorf("%s: expected 1 environment variable, got %d", id, envs.Len())
+				continue
+			}
+
+			key := envs.MapKeys()[0]
+			if env := key.String() + "=" + envs.MapIndex(key).String(); env != expected {
+				t.Errorf("%s: expected %s, got %s", id, expected, env)
+			}
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	root := t.TempDir()
+	sysfs := path.Join(root, "sys/bus/dsa/devices")
+	labelFile := path.Join(root, "features.d/intel-iaa-labels.txt")
+
+	for _, wq := range []string{"iax1/wq1.0", "iax1/wq1.1", "iax1/wq1.2", "iax3/wq3.0"} {
+		if err := os.MkdirAll(path.Join(sysfs, wq), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		// Decompress, Compress, Decrypt and Encrypt.
+		"iax1/op_cap":          "00000000,00000000,00000000,00000000,00000000,0000000f,00000000,00000000\n",
+		"iax1/wq1.0/op_config": "00000000,00000000,00000000,00000000,00000000,0000000c,00000000,00000000\n",
+		"iax1/wq1.1/op_config": "00000000,00000000,00000000,00000000,00000000,00000003,00000000,00000000\n",
+		"iax3/op_cap":          "0x0,0xc,0x0,0x0\n",
+		"iax1/wq1.0/mode":      "dedicated",
+		"iax1/wq1.1/mode":      "dedicated",
+		"iax1/wq1.2/mode":      "shared",
+		"iax3/wq3.0/mode":      "dedicated",
+		"iax1/wq1.0/state":     "enabled",
+		"iax1/wq1.1/state":     "enabled",
+		"iax1/wq1.2/state":     "enabled",
+		"iax3/wq3.0/state":     "enabled",
+		"iax1/wq1.0/type":      "user",
+		"iax1/wq1.1/type":      "user",
+		"iax1/wq1.2/type":      "user",
+		"iax3/wq3.0/type":      "user",
+	}
+	for filename, body := range files {
+		if err := os.WriteFile(path.Join(sysfs, filename), []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin := NewDevicePlugin(path.Join(sysfs, "iax*/wq*/state"), "", 1)
+	plugin.getDevNodes = getFakeDevNodes
+	plugin.caps = &Capabilities{
+		Opcodes: map[string][]int{
+			"compress": {0x42, 0x43},
+			"crypto":   {0x40, 0x41},
+		},
+		NFDFeatureFile: labelFile,
+		LabelPrefix:    "iaa.intel.com/capability.",
+		SplitResources: true,
+	}
+
+	tree, err := plugin.scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if err = checkDeviceTree(tree, map[string]int{
+		"wq-user-dedicated-compress": 2,
+		"wq-user-dedicated-crypto":   1,
+		"wq-user-shared":             1,
+	}, false); err != nil {
+		t.Error(err)
+	}
+
+	labels, err := os.ReadFile(labelFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	expected := "iaa.intel.com/capability.compress=true\niaa.intel.com/capability.crypto=true\n"
+	if string(labels) != expected {
+		t.Errorf("expected labels %q, got %q", expected, labels)
+	}
+
+	// Without the resource split, the workqueues are advertised as before.
+	plugin.caps.SplitResources = false
+
+	if tree, err = plugin.scan(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if err = checkDeviceTree(tree, map[string]int{"wq-user-dedicated": 3, "wq-user-shared": 1}, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTopology(t *testing.T) {
+	sysfs := path.Join(t.TempDir(), "sys/bus/dsa/devices")
+
+	for _, wq := range []string{"dsa0/wq0.0", "dsa2/wq2.0"} {
+		if err := os.MkdirAll(path.Join(sysfs, wq), 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for filename, body := range map[string]string{
+		"dsa0/numa_node":   "0\n",
+		"dsa2/numa_node":   "1\n",
+		"dsa0/wq0.0/mode":  "dedicated",
+		"dsa2/wq2.0/mode":  "dedicated",
+		"dsa0/wq0.0/state": "enabled",
+		"dsa2/wq2.0/state": "enabled",
+		"dsa0/wq0.0/type":  "user",
+		"dsa2/wq2.0/type":  "user",
+	} {
+		if err := os.WriteFile(path.Join(sysfs, filename), []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plugin := NewDevicePlugin(path.Join(sysfs, "dsa*/wq*/state"), "", 1)
+	plugin.getDevNodes = getFakeDevNodes
+
+	tree, err := plugin.scan()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	for id, expected := range map[string]int64{
+		"wq-user-dedicated-wq0.0-0": 0,
+		"wq-user-dedicated-wq2.0-0": 1,
+	} {
+		topology := reflect.ValueOf(tree["wq-user-dedicated"][id]).FieldByName("topology")
+		if topology.IsNil() || topology.Elem().FieldByName("Nodes").Len() != 1 ||
+			topology.Elem().FieldByName("Nodes").Index(0).Elem().FieldByName("ID").Int() != expected {
+			t.Errorf("%s: expected NUMA node %d, got %+v", id, expected, topology)
+		}
+	}
+}
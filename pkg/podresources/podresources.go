@@ -0,0 +1,93 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package podresources provides the device plugins with the resources
+// kubelet has allocated to the pods, and serves the metrics based on them.
+package podresources
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+	"k8s.io/kubernetes/pkg/kubelet/apis/podresources"
+)
+
+const (
+	// Socket of the kubelet PodResources API, needs to be mounted to the plugin.
+	Socket = "unix:///var/lib/kubelet/pod-resources/kubelet.sock"
+	// Timeout of the PodResources API calls.
+	Timeout = 5 * time.Second
+
+	maxSize = 4 * 1024 * 1024
+)
+
+// List returns the resources allocated to the pods on the node.
+func List(client podresourcesv1.PodResourcesListerClient) (*podresourcesv1.ListPodResourcesResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	resp, err := client.List(ctx, &podresourcesv1.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not list pod resources")
+	}
+
+	return resp, nil
+}
+
+// Poll calls update with a PodResources API client at startup and every
+// period, logging the failures as failures of what. It never returns.
+func Poll(period time.Duration, what string, update func(client podresourcesv1.PodResourcesListerClient) error) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		client, conn, err := podresources.GetV1Client(Socket, Timeout, maxSize)
+		if err == nil {
+			err = update(client)
+
+			conn.Close()
+		}
+
+		if err != nil {
+			klog.Warningf("%s failed: %v", what, err)
+		}
+
+		<-ticker.C
+	}
+}
+
+// ServeMetrics serves the metrics of the registry at /metrics of the given
+// address in the background. The plugin is terminated if the server fails.
+func ServeMetrics(address string, registry *prometheus.Registry) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: Timeout,
+	}
+
+	klog.V(1).Infof("Serving metrics at %s/metrics", address)
+
+	go func() {
+		klog.Fatal(errors.Wrap(server.ListenAndServe(), "metrics server failed"))
+	}()
+}
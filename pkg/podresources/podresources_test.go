@@ -0,0 +1,58 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podresources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	podresourcesv1 "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// mockPodResources lists the given pod resources, or fails with err.
+type mockPodResources struct {
+	podresourcesv1.PodResourcesListerClient
+	err       error
+	resources []*podresourcesv1.PodResources
+}
+
+func (m *mockPodResources) List(ctx context.Context, _ *podresourcesv1.ListPodResourcesRequest, _ ...grpc.CallOption) (*podresourcesv1.ListPodResourcesResponse, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("no deadline")
+	}
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &podresourcesv1.ListPodResourcesResponse{PodResources: m.resources}, nil
+}
+
+func TestList(t *testing.T) {
+	client := &mockPodResources{resources: []*podresourcesv1.PodResources{{Name: "pod"}}}
+
+	resp, err := List(client)
+	if err != nil || len(resp.PodResources) != 1 || resp.PodResources[0].Name != "pod" {
+		t.Errorf("expected the pod resources, got %v (%v)", resp, err)
+	}
+
+	client.err = errors.New("kubelet failed")
+
+	if _, err = List(client); err == nil {
+		t.Error("expected an error")
+	}
+}
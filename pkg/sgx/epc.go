@@ -0,0 +1,75 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sgx reports the SGX Enclave Page Cache (EPC) of the host.
+package sgx
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/cpuid/v2"
+	"k8s.io/klog/v2"
+)
+
+// SysfsNodeDirectory is the sysfs directory of the NUMA nodes.
+const SysfsNodeDirectory = "/sys/devices/system/node"
+
+// NumaEPC returns the EPC size in bytes of each NUMA node, as reported by
+// the kernel in the given sysfs NUMA node directory. Returns an empty map
+// when the sizes are not reported.
+func NumaEPC(sysfsNodeDir string) map[int]uint64 {
+	sizes := map[int]uint64{}
+
+	files, _ := filepath.Glob(filepath.Join(sysfsNodeDir, "node*", "x86", "sgx_total_bytes"))
+	for _, file := range files {
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(filepath.Dir(file))), "node"))
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			klog.Warningf("Failed to read NUMA node %d EPC size: %v", node, err)
+			continue
+		}
+
+		size, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			klog.Warningf("Invalid NUMA node %d EPC size: %v", node, err)
+			continue
+		}
+
+		if size > 0 {
+			sizes[node] = size
+		}
+	}
+
+	return sizes
+}
+
+// CPUIDEPC returns the total size of the EPC sections reported by CPUID.
+func CPUIDEPC() uint64 {
+	var size uint64
+
+	if cpuid.CPU.SGX.Available {
+		for _, s := range cpuid.CPU.SGX.EPCSections {
+			size += s.EPCSize
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sgx
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNumaEPC(t *testing.T) {
+	tcases := []struct {
+		files    map[string]string
+		expected map[int]uint64
+		name     string
+	}{
+		{
+			name:     "no NUMA information",
+			files:    map[string]string{"node0/cpulist": "0-7"},
+			expected: map[int]uint64{},
+		},
+		{
+			name: "two nodes",
+			files: map[string]string{
+				"node0/x86/sgx_total_bytes": "8388608\n",
+				"node1/x86/sgx_total_bytes": "4194304\n",
+			},
+			expected: map[int]uint64{0: 8388608, 1: 4194304},
+		},
+		{
+			name: "node without EPC",
+			files: map[string]string{
+				"node0/x86/sgx_total_bytes": "8388608\n",
+				"node1/x86/sgx_total_bytes": "0\n",
+			},
+			expected: map[int]uint64{0: 8388608},
+		},
+		{
+			name: "invalid sizes and nodes",
+			files: map[string]string{
+				"node0/x86/sgx_total_bytes":    "8M\n",
+				"node1/x86/sgx_total_bytes":    "4194304\n",
+				"nodefoo/x86/sgx_total_bytes":  "4194304\n",
+				"node2/x86/sgx_total_bytes/fw": "",
+			},
+			expected: map[int]uint64{1: 4194304},
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+
+			for name, content := range tc.files {
+				file := filepath.Join(root, name)
+
+				if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if sizes := NumaEPC(root); !maps.Equal(sizes, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, sizes)
+			}
+		})
+	}
+}
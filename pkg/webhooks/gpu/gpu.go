@@ -0,0 +1,231 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gpu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/internal/containers"
+)
+
+var (
+	ErrObjectType        = errors.New("invalid runtime object type")
+	ErrMonitoringDenied  = errors.New("GPU monitoring resource is not allowed in the namespace")
+	ErrDeviceCapExceeded = errors.New("namespace GPU device cap exceeded")
+)
+
+// +kubebuilder:webhook:path=/validate--v1-pod,mutating=false,failurePolicy=ignore,groups="",resources=pods,verbs=create,versions=v1,name=gpu.validator.webhooks.intel.com,sideEffects=None,admissionReviewVersions=v1
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+const (
+	namespace = "gpu.intel.com"
+
+	// Namespace annotations for the GPU devices the pods in the namespace
+	// may request in total, and whether they may request the monitoring
+	// resource giving access to all GPUs of the node.
+	maxDevicesAnnotation      = namespace + "/max-devices"
+	allowMonitoringAnnotation = namespace + "/allow-monitoring"
+)
+
+// Validator checks the GPU resource requests of the Pods against the caps
+// of their namespaces. Without Quotas, it accepts all Pods, so that the
+// webhook can be installed regardless of whether the quotas are enforced.
+type Validator struct {
+	Client client.Reader
+	Quotas bool
+}
+
+func (v *Validator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&corev1.Pod{}).
+		WithValidator(v).
+		Complete()
+}
+
+// isDeviceResource tells whether the resource is a GPU device, i.e. a
+// shared GPU slot or tile, and not a monitoring, memory or millicore one,
+// or a GPU Aware Scheduling resource like "gpu.intel.com/memory.max".
+func isDeviceResource(resourceName string) bool {
+	name := strings.TrimPrefix(resourceName, namespace+"/")
+
+	if strings.Contains(name, ".") || name == "millicores" || name == "tiles" {
+		return false
+	}
+
+	for _, suffix := range []string{"_monitoring", "_memory", "_millicores"} {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// podDevices returns the number of GPU devices the Pod requests, and
+// whether it requests the monitoring resource. Init containers run one
+// at a time before the other containers, so the largest of their
+// requests counts, if it is larger than the other containers' total.
+func podDevices(pod *corev1.Pod) (int64, bool, error) {
+	var (
+		devices, initDevices int64
+		monitoring           bool
+	)
+
+	countDevices := func(container corev1.Container) (int64, error) {
+		resources, err := containers.GetRequestedResources(container, namespace)
+		if err != nil {
+			return 0, err
+		}
+
+		count := int64(0)
+
+		for name, quantity := range resources {
+			switch {
+			case strings.HasSuffix(name, "_monitoring"):
+				monitoring = true
+			case isDeviceResource(name):
+				count += quantity
+			}
+		}
+
+		return count, nil
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		count, err := countDevices(container)
+		if err != nil {
+			return 0, false, err
+		}
+
+		initDevices = max(initDevices, count)
+	}
+
+	for _, container := range pod.Spec.Containers {
+		count, err := countDevices(container)
+		if err != nil {
+			return 0, false, err
+		}
+
+		devices += count
+	}
+
+	return max(devices, initDevices), monitoring, nil
+}
+
+// usedDevices returns the number of GPU devices requested by the Pods in
+// the namespace, which have not terminated.
+func (v *Validator) usedDevices(ctx context.Context, ns string) (int64, error) {
+	pods := corev1.PodList{}
+
+	if err := v.Client.List(ctx, &pods, client.InNamespace(ns)); err != nil {
+		return 0, fmt.Errorf("unable to list pods in namespace %s: %w", ns, err)
+	}
+
+	used := int64(0)
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		// Pods with invalid requests have been rejected by the API server.
+		if devices, _, err := podDevices(pod); err == nil {
+			used += devices
+		}
+	}
+
+	return used, nil
+}
+
+func (v *Validator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	log := logf.FromContext(ctx)
+
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected a Pod but got a %T", ErrObjectType, obj)
+	}
+
+	if !v.Quotas {
+		return nil, nil
+	}
+
+	devices, monitoring, err := podDevices(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	if devices == 0 && !monitoring {
+		return nil, nil
+	}
+
+	// Pod namespace may be left for the API server to fill in from the request.
+	nsName := pod.Namespace
+	if req, err := admission.RequestFromContext(ctx); err == nil && req.Namespace != "" {
+		nsName = req.Namespace
+	}
+
+	ns := corev1.Namespace{}
+	if err = v.Client.Get(ctx, client.ObjectKey{Name: nsName}, &ns); err != nil {
+		return nil, fmt.Errorf("unable to get namespace %s: %w", nsName, err)
+	}
+
+	if monitoring && ns.Annotations[allowMonitoringAnnotation] != "true" {
+		return nil, fmt.Errorf("%w: %s is not annotated with %s: \"true\"", ErrMonitoringDenied, nsName, allowMonitoringAnnotation)
+	}
+
+	value, found := ns.Annotations[maxDevicesAnnotation]
+	if !found || devices == 0 {
+		return nil, nil
+	}
+
+	maxDevices, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Info("invalid GPU device cap, ignoring it", "namespace", nsName, maxDevicesAnnotation, value)
+
+		return nil, nil
+	}
+
+	used, err := v.usedDevices(ctx, nsName)
+	if err != nil {
+		return nil, err
+	}
+
+	if used+devices > maxDevices {
+		return nil, fmt.Errorf("%w: %s has %d of %d GPU devices in use, pod requests %d", ErrDeviceCapExceeded, nsName, used, maxDevices, devices)
+	}
+
+	return nil, nil
+}
+
+func (v *Validator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *Validator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gpu
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func gpuPod(name, ns string, phase corev1.PodPhase, resources map[string]string) *corev1.Pod {
+	list := corev1.ResourceList{}
+	for name, quantity := range resources {
+		list[corev1.ResourceName(name)] = resource.MustParse(quantity)
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:      "container",
+				Resources: corev1.ResourceRequirements{Limits: list, Requests: list},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestValidateCreate(t *testing.T) {
+	capped := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "capped",
+		Annotations: map[string]string{maxDevicesAnnotation: "3"},
+	}}
+	monitoring := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "monitoring",
+		Annotations: map[string]string{allowMonitoringAnnotation: "true"},
+	}}
+	open := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "open"}}
+
+	validator := &Validator{
+		Client: fake.NewClientBuilder().WithObjects(capped, monitoring, open,
+			gpuPod("running", "capped", corev1.PodRunning, map[string]string{"gpu.intel.com/i915": "1", "gpu.intel.com/i915_memory": "8"}),
+			gpuPod("pending", "capped", corev1.PodPending, map[string]string{"gpu.intel.com/xe_tile": "1"}),
+			gpuPod("done", "capped", corev1.PodSucceeded, map[string]string{"gpu.intel.com/i915": "2"}),
+		).Build(),
+		Quotas: true,
+	}
+
+	tcases := []struct {
+		expectedErr error
+		pod         *corev1.Pod
+		name        string
+	}{
+		{
+			name: "pod within namespace cap",
+			pod:  gpuPod("new", "capped", "", map[string]string{"gpu.intel.com/i915": "1", "gpu.intel.com/millicores": "100"}),
+		},
+		{
+			name:        "pod exceeding namespace cap",
+			pod:         gpuPod("new", "capped", "", map[string]string{"gpu.intel.com/i915": "2"}),
+			expectedErr: ErrDeviceCapExceeded,
+		},
+		{
+			name: "pod without GPU devices in capped namespace",
+			pod:  gpuPod("new", "capped", "", map[string]string{"gpu.intel.com/i915_memory": "16"}),
+		},
+		{
+			name: "pod in namespace without cap",
+			pod:  gpuPod("new", "open", "", map[string]string{"gpu.intel.com/i915": "8"}),
+		},
+		{
+			name:        "monitoring pod in namespace without approval",
+			pod:         gpuPod("new", "open", "", map[string]string{"gpu.intel.com/i915_monitoring": "1"}),
+			expectedErr: ErrMonitoringDenied,
+		},
+		{
+			name: "monitoring pod in approved namespace",
+			pod:  gpuPod("new", "monitoring", "", map[string]string{"gpu.intel.com/i915_monitoring": "1"}),
+		},
+		{
+			name: "pod without GPU resources in unknown namespace",
+			pod:  gpuPod("new", "unknown", "", map[string]string{"example.com/device": "1"}),
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := validator.ValidateCreate(context.Background(), tc.pod)
+
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+
+	// Without the quotas, all pods are accepted.
+	validator.Quotas = false
+
+	for _, tc := range tcases {
+		if _, err := validator.ValidateCreate(context.Background(), tc.pod); err != nil {
+			t.Errorf("%s: expected no error without quotas, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestPodDevices(t *testing.T) {
+	pod := gpuPod("pod", "default", "", map[string]string{"gpu.intel.com/i915": "1", "gpu.intel.com/i915_monitoring": "1"})
+	pod.Spec.InitContainers = []corev1.Container{*pod.Spec.Containers[0].DeepCopy()}
+	pod.Spec.InitContainers[0].Resources.Limits["gpu.intel.com/i915"] = resource.MustParse("2")
+	pod.Spec.InitContainers[0].Resources.Requests["gpu.intel.com/i915"] = resource.MustParse("2")
+
+	devices, monitoring, err := podDevices(pod)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if devices != 2 || !monitoring {
+		t.Errorf("expected 2 devices with monitoring, got %d devices, monitoring %v", devices, monitoring)
+	}
+}
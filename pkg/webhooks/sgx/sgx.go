@@ -28,7 +28,10 @@ import (
 	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/internal/containers"
 )
 
-var ErrObjectType = errors.New("invalid runtime object type")
+var (
+	ErrObjectType        = errors.New("invalid runtime object type")
+	ErrInvalidAnnotation = errors.New("invalid pod annotation")
+)
 
 // +kubebuilder:webhook:path=/mutate--v1-pod,mutating=true,failurePolicy=ignore,groups="",resources=pods,verbs=create,versions=v1,name=sgx.mutator.webhooks.intel.com,sideEffects=None,admissionReviewVersions=v1,reinvocationPolicy=IfNeeded
 
@@ -48,6 +51,7 @@ const (
 	epc                      = namespace + "/epc"
 	provision                = namespace + "/provision"
 	quoteProvAnnotation      = namespace + "/quote-provider"
+	epcSizeAnnotationPrefix  = namespace + "/epc-size."
 	aesmdQuoteProvKey        = "aesmd"
 	aesmdSocketDirectoryPath = "/var/run/aesmd"
 	aesmdSocketName          = "aesmd-socket"
@@ -123,6 +127,46 @@ func createNewVolumeMounts(container *corev1.Container, volumeMount *corev1.Volu
 	return append(container.VolumeMounts, *volumeMount)
 }
 
+// injectEpcRequests sets the sgx.intel.com/epc resource requests and limits of
+// the containers from the sgx.intel.com/epc-size.<container name> pod annotations.
+// The resources set explicitly in the container spec take precedence.
+func injectEpcRequests(pod *corev1.Pod) error {
+	for idx := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[idx]
+
+		value, ok := pod.Annotations[epcSizeAnnotationPrefix+container.Name]
+		if !ok {
+			continue
+		}
+
+		size, err := resource.ParseQuantity(value)
+		if _, integral := size.AsInt64(); err != nil || !integral || size.Sign() <= 0 {
+			return fmt.Errorf("%w: invalid EPC size %q for container %q", ErrInvalidAnnotation, value, container.Name)
+		}
+
+		if _, ok := container.Resources.Limits[corev1.ResourceName(epc)]; ok {
+			continue
+		}
+
+		if _, ok := container.Resources.Requests[corev1.ResourceName(epc)]; ok {
+			continue
+		}
+
+		if container.Resources.Limits == nil {
+			container.Resources.Limits = corev1.ResourceList{}
+		}
+
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = corev1.ResourceList{}
+		}
+
+		container.Resources.Limits[corev1.ResourceName(epc)] = size
+		container.Resources.Requests[corev1.ResourceName(epc)] = size
+	}
+
+	return nil
+}
+
 func (s *Mutator) Default(ctx context.Context, obj runtime.Object) error {
 	var pod *corev1.Pod
 
@@ -144,6 +188,10 @@ func (s *Mutator) Default(ctx context.Context, obj runtime.Object) error {
 
 	quoteProvider := pod.Annotations[quoteProvAnnotation]
 
+	if err := injectEpcRequests(pod); err != nil {
+		return err
+	}
+
 	for idx, container := range pod.Spec.Containers {
 		requestedResources, err := containers.GetRequestedResources(container, namespace)
 		if err != nil {
@@ -0,0 +1,123 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEpcSizeAnnotations(t *testing.T) {
+	tcases := []struct {
+		expectedErr   error
+		annotations   map[string]string
+		limits        corev1.ResourceList
+		name          string
+		expectedEpc   string
+		expectedTotal string
+		expectedVols  int
+	}{
+		{
+			name:          "EPC size from annotation",
+			annotations:   map[string]string{"sgx.intel.com/epc-size.app": "512Ki"},
+			expectedEpc:   "512Ki",
+			expectedTotal: "512Ki",
+		},
+		{
+			name: "EPC size from annotation with aesmd quote provider",
+			annotations: map[string]string{
+				"sgx.intel.com/epc-size.app":   "1Mi",
+				"sgx.intel.com/quote-provider": "aesmd",
+			},
+			expectedEpc:   "1Mi",
+			expectedTotal: "1Mi",
+			expectedVols:  1,
+		},
+		{
+			name:          "explicit EPC resources take precedence",
+			annotations:   map[string]string{"sgx.intel.com/epc-size.app": "1Mi"},
+			limits:        corev1.ResourceList{epc: resource.MustParse("2Mi")},
+			expectedEpc:   "2Mi",
+			expectedTotal: "2Mi",
+		},
+		{
+			name:        "annotation of another container",
+			annotations: map[string]string{"sgx.intel.com/epc-size.other": "1Mi"},
+		},
+		{
+			name:        "invalid EPC size",
+			annotations: map[string]string{"sgx.intel.com/epc-size.app": "0.5"},
+			expectedErr: ErrInvalidAnnotation,
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: tc.annotations},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:      "app",
+						Resources: corev1.ResourceRequirements{Limits: tc.limits, Requests: tc.limits},
+					}},
+				},
+			}
+
+			err := (&Mutator{}).Default(context.Background(), pod)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			resources := pod.Spec.Containers[0].Resources
+
+			if tc.expectedEpc == "" {
+				if _, ok := resources.Limits[epc]; ok {
+					t.Errorf("unexpected EPC limit %v", resources.Limits)
+				}
+
+				return
+			}
+
+			if limit := resources.Limits[epc]; limit.String() != tc.expectedEpc {
+				t.Errorf("expected EPC limit %s, got %s", tc.expectedEpc, limit.String())
+			}
+
+			if request := resources.Requests[epc]; request.String() != tc.expectedEpc {
+				t.Errorf("expected EPC request %s, got %s", tc.expectedEpc, request.String())
+			}
+
+			if _, ok := resources.Limits[encl]; !ok {
+				t.Error("expected enclave resource limit")
+			}
+
+			if total := pod.Annotations["sgx.intel.com/epc"]; total != tc.expectedTotal {
+				t.Errorf("expected EPC annotation %s, got %s", tc.expectedTotal, total)
+			}
+
+			if len(pod.Spec.Volumes) != tc.expectedVols || len(pod.Spec.Containers[0].VolumeMounts) != tc.expectedVols {
+				t.Errorf("expected %d aesmd volumes, got %v", tc.expectedVols, pod.Spec.Volumes)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2edaemonset "k8s.io/kubernetes/test/e2e/framework/daemonset"
+
+	"github.com/intel/intel-device-plugins-for-kubernetes/pkg/fakedri"
+)
+
+const (
+	fakeDriName     = "intel-gpu-fakedev"
+	fakeDriImage    = "intel/intel-gpu-fakedev:devel"
+	fakeDriSpecDir  = "/etc/fakedri"
+	fakeDriSpecFile = "spec.yaml"
+	fakeDriPort     = 8080
+	fakeDriTimeout  = 2 * time.Minute
+
+	// FakeDriPrefix is the sysfs / devfs path prefix (e.g. GPU plugin
+	// "-prefix" option value) with which plugins see the fake devices.
+	FakeDriPrefix = "/tmp"
+)
+
+// DeployFakeDri deploys fake device generator (intel-gpu-fakedev) DaemonSet
+// for given spec to the framework namespace, and waits until it has generated
+// the fake device files on all nodes. The fake files are shared with plugins
+// through the host FakeDriPrefix dir. Returned function undeploys the generator,
+// which removes the fake files, and waits until that is done:
+//
+//	cleanup := utils.DeployFakeDri(ctx, f, fakedri.GenOptions{DevCount: 4})
+//	ginkgo.DeferCleanup(cleanup)
+func DeployFakeDri(ctx context.Context, f *framework.Framework, opts fakedri.GenOptions) func(context.Context) {
+	opts, err := fakedri.MakeOptionsE(opts)
+	framework.ExpectNoError(err, "invalid fake device spec")
+
+	spec, err := fakedri.MarshalSpec(opts)
+	framework.ExpectNoError(err, "fake device spec marshaling failed")
+
+	ns := f.Namespace.Name
+	configMaps := f.ClientSet.CoreV1().ConfigMaps(ns)
+	daemonSets := f.ClientSet.AppsV1().DaemonSets(ns)
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: fakeDriName},
+		Data:       map[string]string{fakeDriSpecFile: string(spec)},
+	}
+
+	_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	framework.ExpectNoError(err, "fake device spec ConfigMap creation failed")
+
+	hostPathType := v1.HostPathDirectoryOrCreate
+	volumes := []v1.Volume{
+		{
+			Name: "spec",
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: fakeDriName}},
+			},
+		},
+		{
+			Name: "tmp",
+			VolumeSource: v1.VolumeSource{
+				HostPath: &v1.HostPathVolumeSource{Path: FakeDriPrefix, Type: &hostPathType},
+			},
+		},
+	}
+	mounts := []v1.VolumeMount{
+		{Name: "spec", MountPath: fakeDriSpecDir, ReadOnly: true},
+		{Name: "tmp", MountPath: FakeDriPrefix},
+	}
+	ports := []v1.ContainerPort{{Name: "control", ContainerPort: fakeDriPort}}
+
+	daemonSet := e2edaemonset.NewDaemonSet(fakeDriName, fakeDriImage, map[string]string{"app": fakeDriName}, volumes, mounts, ports,
+		"-json="+filepath.Join(fakeDriSpecDir, fakeDriSpecFile), fmt.Sprintf("-control=:%d", fakeDriPort), "-cleanup")
+
+	// Control API serves only after the fake files have been generated.
+	daemonSet.Spec.Template.Spec.Containers[0].ReadinessProbe = &v1.Probe{
+		ProbeHandler: v1.ProbeHandler{
+			HTTPGet: &v1.HTTPGetAction{Path: "/devices", Port: intstr.FromInt32(fakeDriPort)},
+		},
+	}
+
+	daemonSet, err = daemonSets.Create(ctx, daemonSet, metav1.CreateOptions{})
+	framework.ExpectNoError(err, "fake device generator DaemonSet creation failed")
+
+	err = wait.PollUntilContextTimeout(ctx, poll, fakeDriTimeout, true, func(ctx context.Context) (bool, error) {
+		return e2edaemonset.CheckRunningOnAllNodes(ctx, f, daemonSet)
+	})
+	framework.ExpectNoError(err, "fake device generator did not get ready on all nodes")
+
+	return func(ctx context.Context) {
+		err := daemonSets.Delete(ctx, fakeDriName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			framework.Failf("fake device generator DaemonSet deletion failed: %v", err)
+		}
+
+		err = configMaps.Delete(ctx, fakeDriName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			framework.Failf("fake device spec ConfigMap deletion failed: %v", err)
+		}
+
+		// Generator removes the fake files when terminated.
+		selector := labels.Set{"app": fakeDriName}.AsSelector().String()
+
+		err = wait.PollUntilContextTimeout(ctx, poll, fakeDriTimeout, true, func(ctx context.Context) (bool, error) {
+			pods, err := f.ClientSet.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return false, err
+			}
+
+			return len(pods.Items) == 0, nil
+		})
+		framework.ExpectNoError(err, "fake device generator pods were not removed")
+	}
+}